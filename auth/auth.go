@@ -67,19 +67,22 @@ func cleanUpByServer(server *config.Server) error {
 	serverNodes := config.GetNodes()
 	for i := range serverNodes {
 		node := serverNodes[i]
+		if node.Server != server.Name {
+			continue
+		}
 		config.DeleteNode(node.Network)
 	}
 	if err := config.WriteNodeConfig(); err != nil {
 		return err
 	}
-	config.RemoveServerHostPeerCfg()
+	config.RemoveServerHostPeerCfg(server.Name)
 	if err := wireguard.SetPeers(true); err != nil {
 		logger.Log(0, "interface not up, failed to remove peers for %s \n", server.Name)
 	}
 	if err := routes.CleanUp(config.Netclient().DefaultInterface, nil); err != nil {
 		return err
 	}
-	config.DeleteServerHostPeerCfg()
+	config.DeleteServerHostPeerCfg(server.Name)
 	if err := config.WriteNetclientConfig(); err != nil {
 		return err
 	}
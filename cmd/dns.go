@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/spf13/cobra"
+)
+
+// dnsCmd represents the dns command
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Args:  cobra.NoArgs,
+	Short: "show the dns records of the mesh",
+	Long: `show the mesh names the daemon resolves, with the network and server they belong to
+names of networks listed in the dns search setting also resolve without the network
+For example:
+netclient dns                     //all records
+netclient dns --network mynet     //records of a network
+netclient dns --name web.mynet    //records of a name
+netclient dns -o json             //print the records as json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var filter functions.DNSFilter
+		var err error
+		if filter.Network, err = cmd.Flags().GetString("network"); err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if filter.Server, err = cmd.Flags().GetString("server"); err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if filter.Name, err = cmd.Flags().GetString("name"); err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if err := functions.DNSCmd(filter, output); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+	dnsCmd.Flags().String("network", "", "only records of the network")
+	dnsCmd.Flags().String("server", "", "only records of the server")
+	dnsCmd.Flags().String("name", "", "only records of the name")
+	dnsCmd.Flags().StringP("output", "o", "", "output format, json")
+}
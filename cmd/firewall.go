@@ -0,0 +1,58 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/spf13/cobra"
+)
+
+// firewallCmd represents the firewall command
+var firewallCmd = &cobra.Command{
+	Use:   "firewall",
+	Args:  cobra.NoArgs,
+	Short: "inspect the firewall rules of the daemon",
+	Long: `inspect the firewall rules netmaker installs on ingress and egress gateways
+For example:
+netclient firewall show      //display the netmaker chains and rule ownership map
+`,
+}
+
+var firewallShowCmd = &cobra.Command{
+	Use:   "show",
+	Args:  cobra.NoArgs,
+	Short: "display the netmaker chains, rule ownership map and drift",
+	Long: `display the netmaker chains, the ingress and egress rules the daemon installed with the
+ext client or egress gateway and peer each rule belongs to, and the drift against the live
+nftables/iptables state: rules missing in the kernel and unknown rules in the netmaker chains
+For example:
+netclient firewall show                   //display all rules
+netclient firewall show --server myserver //only rules of myserver
+netclient firewall show -o json           //print the rules as json
+netclient firewall show -o nft            //print the netmaker chains in nft syntax
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, err := cmd.Flags().GetString("server")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if err := functions.FirewallShowCmd(server, output); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(firewallCmd)
+	firewallCmd.AddCommand(firewallShowCmd)
+	firewallShowCmd.Flags().String("server", "", "only rules of the server")
+	firewallShowCmd.Flags().StringP("output", "o", "", "output format, json or nft")
+}
@@ -4,6 +4,8 @@ Copyright © 2022 Netmaker Team <info@netmaker.io>
 package cmd
 
 import (
+	"time"
+
 	"github.com/gravitl/netclient/functions"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/spf13/cobra"
@@ -20,6 +22,8 @@ netclient list mynet    //display details of mynet network
 netclient list mynet -l //display extended details of mynet network
 netclient list          //display details of all networks
 netclient list  -l      //display extented details of all networks
+netclient list -o wide  //display peers with hostname, handshake, transfer and gateway roles
+netclient list -o table --watch //refresh the table every 5 seconds
 `,
 
 	Run: func(cmd *cobra.Command, args []string) {
@@ -27,10 +31,29 @@ netclient list  -l      //display extented details of all networks
 		if err != nil {
 			logger.Log(0, "error getting flags", err.Error())
 		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		network := ""
 		if len(args) > 0 {
-			functions.List(args[0], long)
+			network = args[0]
+		}
+		if watch {
+			err = functions.WatchList(network, long, output, interval)
 		} else {
-			functions.List("", long)
+			err = functions.List(network, long, output)
+		}
+		if err != nil {
+			logger.Log(0, "failed to list networks", err.Error())
 		}
 	},
 }
@@ -38,6 +61,9 @@ netclient list  -l      //display extented details of all networks
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolP("long", "l", false, "display detailed network information")
+	listCmd.Flags().StringP("output", "o", "json", "output format, one of json, yaml, table or wide")
+	listCmd.Flags().BoolP("watch", "w", false, "refresh the output until interrupted")
+	listCmd.Flags().Duration("interval", time.Second*5, "refresh interval of --watch")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [server]",
+	Args:  cobra.RangeArgs(0, 1),
+	Short: "display updates waiting for approval",
+	Long: `display the pending plans of the daemon
+while plan mode is on, host, peer and dns updates from a server are recorded in a plan instead of being applied,
+showing the network joins, host changes, acl policies and deletes of the host as well as the peers, routes,
+gateway, firewall rules and hosts entries they change
+updates that only touch auto-apply networks are applied right away while nothing is pending
+For example:
+netclient plan                       //display all pending plans
+netclient plan myserver -o json      //display the plan of myserver as json
+netclient plan approve myserver      //apply the plan of myserver
+netclient plan discard myserver      //drop the plan of myserver
+netclient plan mode on               //turn plan mode on
+netclient plan auto-apply mynet on   //apply updates for mynet without approval
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		server := ""
+		if len(args) > 0 {
+			server = args[0]
+		}
+		if err := functions.ShowPlans(server, output); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+var planApproveCmd = &cobra.Command{
+	Use:   "approve server",
+	Args:  cobra.ExactArgs(1),
+	Short: "apply the pending plan of a server",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := functions.ApprovePlanCmd(args[0]); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fmt.Println("plan applied")
+	},
+}
+
+var planDiscardCmd = &cobra.Command{
+	Use:   "discard server",
+	Args:  cobra.ExactArgs(1),
+	Short: "drop the pending plan of a server without applying it",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := functions.DiscardPlanCmd(args[0]); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fmt.Println("plan discarded")
+	},
+}
+
+var planModeCmd = &cobra.Command{
+	Use:       "mode [on|off]",
+	Args:      cobra.RangeArgs(0, 1),
+	ValidArgs: []string{"on", "off"},
+	Short:     "display or set plan mode, turning it off applies the pending plans",
+	Run: func(cmd *cobra.Command, args []string) {
+		mode := ""
+		if len(args) > 0 {
+			mode = args[0]
+		}
+		if err := functions.PlanMode(mode); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+var planAutoApplyCmd = &cobra.Command{
+	Use:   "auto-apply network on|off",
+	Args:  cobra.ExactArgs(2),
+	Short: "set whether updates for a network are applied without approval",
+	Run: func(cmd *cobra.Command, args []string) {
+		if args[1] != "on" && args[1] != "off" {
+			fmt.Println("auto-apply must be on or off")
+			return
+		}
+		if err := functions.PlanAutoApply(args[0], args[1] == "on"); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringP("output", "o", "", "output format, json")
+	planCmd.AddCommand(planApproveCmd)
+	planCmd.AddCommand(planDiscardCmd)
+	planCmd.AddCommand(planModeCmd)
+	planCmd.AddCommand(planAutoApplyCmd)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/spf13/cobra"
+)
+
+// reloadCmd represents the reload command
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Args:  cobra.NoArgs,
+	Short: "apply config changes to the running daemon",
+	Long: `make the running daemon apply its config files in place
+only what changed is touched: the listen ports are rebound, the interface is re-keyed,
+peers and addresses are converged and message queues are (un)subscribed,
+the interface and unchanged peers stay up
+on linux and mac the daemon also reloads on SIGUSR1
+For example:
+netclient reload            //apply the changes in place
+netclient reload --full     //restart the daemon routines and the interface like SIGHUP
+netclient reload -o json    //print the applied changes as json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		full, err := cmd.Flags().GetBool("full")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if err := functions.ReloadCmd(full, output); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reloadCmd)
+	reloadCmd.Flags().Bool("full", false, "reset all daemon routines and the interface")
+	reloadCmd.Flags().StringP("output", "o", "", "output format, json")
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/spf13/cobra"
+)
+
+// rotateKeysCmd represents the rotate-keys command
+var rotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys",
+	Args:  cobra.NoArgs,
+	Short: "rotate the wireguard keys of the host",
+	Long: `rotate the wireguard keys of the host
+the new public key is published to all servers while the interface keeps the current key,
+the interface switches to the new key once every server sent a peer update carrying it,
+the old key is published again if they do not within the timeout of the key rotation policy
+scheduled rotations are set with keyrotation.interval (hours) in netclient.yml
+For example:
+netclient rotate-keys           //start a rotation
+netclient rotate-keys --wait    //start a rotation and wait for its result
+netclient rotate-keys --traffic //rotate the traffic keys encrypting the messages to and from the servers,
+                                //messages for the old key are accepted during keyrotation.traffickeygrace (minutes),
+                                //needs keyrotation.traffickeys and servers storing the traffic key of the host
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		traffic, err := cmd.Flags().GetBool("traffic")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if traffic {
+			err = functions.RotateTrafficKeysCmd(wait)
+		} else {
+			err = functions.RotateKeysCmd(wait)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateKeysCmd)
+	rotateKeysCmd.Flags().Bool("traffic", false, "rotate the traffic keys instead of the wireguard keys")
+	rotateKeysCmd.Flags().Bool("wait", false, "wait until the servers acknowledged the new key or the rotation was rolled back")
+}
@@ -11,7 +11,7 @@ import (
 var switchServer = &cobra.Command{
 	Use:   "switch [ servername ]",
 	Short: "switch [ servername ]",
-	Long:  `switches netclient to a registered server`,
+	Long:  `switches the netclient context to a registered server, the daemon stays connected to all registered servers`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		err := functions.SwitchServer(args[0])
@@ -0,0 +1,38 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.ExactArgs(0),
+	Short: "display the status of the netclient daemon",
+	Long: `display whether the daemon is running, the broker connection, last checkin
+and turn state per server, the nat type, proxy status and firewall backend
+the status is read from the running daemon, if it is not reachable the on-disk config is shown
+For example:
+netclient status         //display status
+netclient status -o json //display status as json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logger.Log(0, "error getting flags", err.Error())
+		}
+		if err := functions.Status(output); err != nil {
+			logger.Log(0, "failed to display status", err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringP("output", "o", "", "output format, json")
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/gravitl/netmaker/logger"
+)
+
+// AclLockfile lockfile to control access to the file of the pushed acl policies
+const AclLockfile = "acl.lck"
+
+const (
+	// AclAllow - the rule passes the traffic it matches on to the input rules of the host
+	AclAllow = "allow"
+	// AclDeny - the rule drops the traffic it matches
+	AclDeny = "deny"
+)
+
+// AclPolicy - which peers of a network may reach which ports and protocols of the host,
+// the first matching rule wins
+type AclPolicy struct {
+	Network string `json:"network"`
+	// Server is set for policies pushed by a server, empty for local files
+	Server string `json:"server,omitempty"`
+	// DefaultAction applies to traffic of the network no rule matches, allow (default) or deny
+	DefaultAction string `json:"default_action,omitempty"`
+	// Tags - names used as tag:<name> in the sources of the rules and the peers carrying them
+	Tags  map[string][]string `json:"tags,omitempty"`
+	Rules []AclPolicyRule     `json:"rules"`
+}
+
+// AclPolicyRule - allows or denies the traffic of the sources to the ports and protocols of the host
+type AclPolicyRule struct {
+	Action string `json:"action"` // allow or deny
+	// Sources - * for all peers of the network, tag:<name>, names of peers, addresses or networks
+	Sources []string `json:"sources"`
+	// Protocols - tcp, udp or icmp, all protocols if empty or tcp and udp if ports are set
+	Protocols []string `json:"protocols,omitempty"`
+	// Ports - destination ports such as 22 or 8000-8100, all ports if empty
+	Ports []string `json:"ports,omitempty"`
+}
+
+// AclPolicyFile - returns the path of the local acl policy of a network, it takes precedence over
+// the policy pushed by the server
+func AclPolicyFile(network string) string {
+	return filepath.Join(GetNetclientPath(), "acl", network+".json")
+}
+
+// ReadLocalAclPolicy - returns the local acl policy of a network, nil if it has none
+func ReadLocalAclPolicy(network string) (*AclPolicy, error) {
+	data, err := os.ReadFile(AclPolicyFile(network))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var policy AclPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	policy.Network = network
+	policy.Server = ""
+	return &policy, nil
+}
+
+// ReadAclPolicies - returns the acl policies pushed by the servers per network
+func ReadAclPolicies() (map[string]AclPolicy, error) {
+	lockfile := filepath.Join(os.TempDir(), AclLockfile)
+	if err := Lock(lockfile); err != nil {
+		return nil, err
+	}
+	defer Unlock(lockfile)
+	policies := make(map[string]AclPolicy)
+	data, err := os.ReadFile(GetNetclientPath() + "acl.json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return policies, nil
+		}
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		logger.Log(0, "discarding unreadable acl policies", err.Error())
+		return make(map[string]AclPolicy), nil
+	}
+	return policies, nil
+}
+
+// WriteAclPolicies - writes the acl policies pushed by the servers to a temporary file and renames it
+func WriteAclPolicies(policies map[string]AclPolicy) error {
+	lockfile := filepath.Join(os.TempDir(), AclLockfile)
+	if err := Lock(lockfile); err != nil {
+		return err
+	}
+	defer Unlock(lockfile)
+	file := GetNetclientPath() + "acl.json"
+	if len(policies) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -60,15 +61,29 @@ var (
 	WgPublicListenPort int
 	// HostPublicIP - host's public endpoint
 	HostPublicIP net.IP
+	// netclientPath - directory of the netclient files if not the default of the os
+	netclientPath string
 )
 
 // Config configuration for netclient and host as a whole
 type Config struct {
 	models.Host
-	PrivateKey        wgtypes.Key          `json:"privatekey" yaml:"privatekey"`
-	TrafficKeyPrivate []byte               `json:"traffickeyprivate" yaml:"traffickeyprivate"`
-	HostPeers         []wgtypes.PeerConfig `json:"host_peers" yaml:"host_peers"`
-	DisableGUIServer  bool                 `json:"disableguiserver" yaml:"disableguiserver"`
+	PrivateKey        wgtypes.Key                     `json:"privatekey" yaml:"privatekey"`
+	TrafficKeyPrivate []byte                          `json:"traffickeyprivate" yaml:"traffickeyprivate"`
+	HostPeers         []wgtypes.PeerConfig            `json:"host_peers" yaml:"host_peers"`
+	ServerPeers       map[string][]wgtypes.PeerConfig `json:"server_peers" yaml:"server_peers"`
+	DisableGUIServer  bool                            `json:"disableguiserver" yaml:"disableguiserver"`
+	LocalAPITCP       bool                            `json:"localapitcp" yaml:"localapitcp"`
+	PlanMode          bool                            `json:"planmode" yaml:"planmode"`
+	AutoApplyNetworks []string                        `json:"autoapplynetworks" yaml:"autoapplynetworks"`
+	Hooks             []Hook                          `json:"hooks" yaml:"hooks"`
+	KeyRotation       KeyRotationPolicy               `json:"keyrotation" yaml:"keyrotation"`
+	PendingKey        *PendingKey                     `json:"pendingkey,omitempty" yaml:"pendingkey,omitempty"`
+	LastKeyRotation   time.Time                       `json:"lastkeyrotation" yaml:"lastkeyrotation"`
+	PendingTrafficKey *PendingTrafficKey              `json:"pendingtraffickey,omitempty" yaml:"pendingtraffickey,omitempty"`
+	RetiredTrafficKey *RetiredTrafficKey              `json:"retiredtraffickey,omitempty" yaml:"retiredtraffickey,omitempty"`
+	ServerTrafficKeys map[string]ServerTrafficKey     `json:"servertraffickeys,omitempty" yaml:"servertraffickeys,omitempty"`
+	DNS               DNSConfig                       `json:"dns" yaml:"dns"`
 }
 
 func init() {
@@ -84,7 +99,9 @@ func UpdateNetclient(c Config) {
 	netclient = c
 }
 
-func UpdateHost(host *models.Host) (resetInterface, restart bool) {
+// HostChanges - returns whether the host update needs the interface to be reset or the daemon
+// to be restarted, without applying it
+func HostChanges(host *models.Host) (resetInterface, restart bool) {
 	hostCfg := Netclient()
 	if hostCfg == nil || host == nil {
 		return
@@ -96,6 +113,15 @@ func UpdateHost(host *models.Host) (resetInterface, restart bool) {
 	if host.MTU != 0 && hostCfg.MTU != host.MTU {
 		resetInterface = true
 	}
+	return
+}
+
+func UpdateHost(host *models.Host) (resetInterface, restart bool) {
+	hostCfg := Netclient()
+	if hostCfg == nil || host == nil {
+		return
+	}
+	resetInterface, restart = HostChanges(host)
 	// do not update fields that should not be changed by server
 	host.OS = hostCfg.OS
 	host.FirewallInUse = hostCfg.FirewallInUse
@@ -118,33 +144,93 @@ func Netclient() *Config {
 	return &netclient
 }
 
-// UpdateHostPeers - updates host peer map in the netclient config
-func UpdateHostPeers(peers []wgtypes.PeerConfig) (isHostInetGW bool) {
-	netclient.HostPeers = peers
-	return detectOrFilterGWPeers(peers)
+// UpdateHostPeers - updates the peers received from the given server and
+// rebuilds the combined host peer list in the netclient config
+func UpdateHostPeers(server string, peers []wgtypes.PeerConfig) (isHostInetGW bool) {
+	if netclient.ServerPeers == nil {
+		netclient.ServerPeers = make(map[string][]wgtypes.PeerConfig)
+	}
+	netclient.ServerPeers[server] = peers
+	netclient.HostPeers = mergeServerPeers(netclient.ServerPeers)
+	return detectOrFilterGWPeers(netclient.HostPeers)
 }
 
 // DeleteServerHostPeerCfg - deletes the host peers for the server
-func DeleteServerHostPeerCfg() {
-	netclient.HostPeers = []wgtypes.PeerConfig{}
+func DeleteServerHostPeerCfg(server string) {
+	delete(netclient.ServerPeers, server)
+	netclient.HostPeers = mergeServerPeers(netclient.ServerPeers)
 }
 
 // RemoveServerHostPeerCfg - sets remove flag for all peers on the given server peers
-func RemoveServerHostPeerCfg() {
-	if netclient.HostPeers == nil {
-		netclient.HostPeers = []wgtypes.PeerConfig{}
+func RemoveServerHostPeerCfg(server string) {
+	peers, ok := netclient.ServerPeers[server]
+	if !ok {
 		return
 	}
-	peers := netclient.HostPeers
 	for i := range peers {
 		peer := peers[i]
 		peer.Remove = true
 		peers[i] = peer
 	}
-	netclient.HostPeers = peers
+	netclient.ServerPeers[server] = peers
+	netclient.HostPeers = mergeServerPeers(netclient.ServerPeers)
 	_ = WriteNetclientConfig()
 }
 
+// GetServerPeers - returns the peers received from the given server
+func GetServerPeers(server string) []wgtypes.PeerConfig {
+	return netclient.ServerPeers[server]
+}
+
+// mergeServerPeers - combines the peers of all servers into a single list,
+// a peer known to more than one server gets the union of its allowed ips
+// and is only removed once no server has it as an active peer
+func mergeServerPeers(serverPeers map[string][]wgtypes.PeerConfig) []wgtypes.PeerConfig {
+	servers := make([]string, 0, len(serverPeers))
+	for server := range serverPeers {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	merged := []wgtypes.PeerConfig{}
+	index := make(map[wgtypes.Key]int)
+	for _, server := range servers {
+		for _, peer := range serverPeers[server] {
+			i, ok := index[peer.PublicKey]
+			if !ok {
+				peer.AllowedIPs = append([]net.IPNet{}, peer.AllowedIPs...)
+				index[peer.PublicKey] = len(merged)
+				merged = append(merged, peer)
+				continue
+			}
+			existing := merged[i]
+			if peer.Remove {
+				continue
+			}
+			if existing.Remove {
+				peer.AllowedIPs = append([]net.IPNet{}, peer.AllowedIPs...)
+				merged[i] = peer
+				continue
+			}
+			for _, allowedIP := range peer.AllowedIPs {
+				if !ipNetInList(allowedIP, existing.AllowedIPs) {
+					existing.AllowedIPs = append(existing.AllowedIPs, allowedIP)
+				}
+			}
+			merged[i] = existing
+		}
+	}
+	return merged
+}
+
+func ipNetInList(ipNet net.IPNet, list []net.IPNet) bool {
+	for i := range list {
+		if list[i].String() == ipNet.String() {
+			return true
+		}
+	}
+	return false
+}
+
 // SetVersion - sets version for use by other packages
 func SetVersion(ver string) {
 	Version = ver
@@ -212,8 +298,17 @@ func WriteNetclientConfig() error {
 	return f.Sync()
 }
 
+// SetNetclientPath - sets the directory of the netclient files, with a trailing separator;
+// tests point it to a temporary directory, an empty path restores the default of the os
+func SetNetclientPath(path string) {
+	netclientPath = path
+}
+
 // GetNetclientPath - returns path to netclient config directory
 func GetNetclientPath() string {
+	if netclientPath != "" {
+		return netclientPath
+	}
 	if runtime.GOOS == "windows" {
 		return WindowsAppDataPath
 	} else if runtime.GOOS == "darwin" {
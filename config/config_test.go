@@ -1,10 +1,18 @@
 package config
 
 import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gravitl/netmaker/models"
 	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"gopkg.in/yaml.v3"
 )
 
@@ -39,3 +47,285 @@ func TestReadNetclientConfig(t *testing.T) {
 	assert.NotEmpty(t, existing.HostPeers["foo1"], "foo1 exists after Decode")
 	assert.NotEmpty(t, existing.HostPeers["foo2"])
 }
+
+// useTempMaps - points the netclient files to a temporary directory holding servers a and b and
+// a node of server a, the maps are reset when the test ends
+func useTempMaps(t *testing.T) {
+	SetNetclientPath(t.TempDir() + string(os.PathSeparator))
+	Servers = map[string]Server{"a": {Name: "a"}, "b": {Name: "b"}}
+	Nodes = NodeMap{"dev": Node{CommonNode: models.CommonNode{Network: "dev", Server: "a"}}}
+	assert.NoError(t, WriteServerConfig())
+	assert.NoError(t, WriteNodeConfig())
+	t.Cleanup(func() {
+		SetNetclientPath("")
+		Servers = make(map[string]Server)
+		Nodes = make(NodeMap)
+	})
+}
+
+func TestReadMaps(t *testing.T) {
+	useTempMaps(t)
+	UpdateServer("c", Server{Name: "c"})
+	DeleteNode("dev")
+	servers := GetServerMap()
+	nodes := GetNodes()
+	assert.NoError(t, ReadServerConf())
+	assert.NoError(t, ReadNodeConfig())
+	// the maps read from disk replace the previous maps, which are left as they were
+	assert.Len(t, servers, 3)
+	assert.Empty(t, nodes)
+	assert.Len(t, GetServerMap(), 2)
+	assert.Nil(t, GetServer("c"))
+	assert.Equal(t, "a", GetNode("dev").Server)
+}
+
+func TestUpdateMaps(t *testing.T) {
+	useTempMaps(t)
+	servers := GetServerMap()
+	nodes := GetNodes()
+	UpdateServer("c", Server{Name: "c"})
+	DeleteServer("a")
+	UpdateServerConfig(&models.ServerConfig{Server: "d"})
+	UpdateNodeMap("prod", Node{CommonNode: models.CommonNode{Network: "prod", Server: "b"}})
+	SetNodes("a", nil)
+	// updates replace the maps handed out before
+	assert.Len(t, servers, 2)
+	assert.Contains(t, servers, "a")
+	assert.Len(t, nodes, 1)
+	assert.ElementsMatch(t, []string{"b", "c", "d"}, GetServers())
+	assert.Equal(t, NodeMap{"prod": Node{CommonNode: models.CommonNode{Network: "prod", Server: "b"}}}, GetNodes())
+}
+
+func TestReadMapsConcurrently(t *testing.T) {
+	useTempMaps(t)
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, ReadServerConf())
+			assert.NoError(t, ReadNodeConfig())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			UpdateNodeMap("prod", Node{})
+			DeleteNode("prod")
+		}
+	}()
+	// routines ranging over the maps see complete maps while they are read from disk
+	for i := 0; i < 50; i++ {
+		for name, server := range GetServerMap() {
+			assert.Equal(t, name, server.Name)
+		}
+		assert.Equal(t, "a", GetNodes()["dev"].Server)
+	}
+	wg.Wait()
+}
+
+func TestEnsureAPIToken(t *testing.T) {
+	SetNetclientPath(t.TempDir() + string(os.PathSeparator))
+	defer SetNetclientPath("")
+	file := GetNetclientPath() + GUITokenFile
+	t.Run("created", func(t *testing.T) {
+		_, err := GetAPIToken()
+		assert.Error(t, err)
+		token, err := EnsureAPIToken()
+		assert.NoError(t, err)
+		assert.Regexp(t, "^[0-9a-f]{64}$", token)
+		info, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		stored, err := GetAPIToken()
+		assert.NoError(t, err)
+		assert.Equal(t, token, stored)
+	})
+	t.Run("existing token kept", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(file, []byte("existing\n"), 0600))
+		token, err := EnsureAPIToken()
+		assert.NoError(t, err)
+		assert.Equal(t, "existing", token)
+	})
+	t.Run("empty token replaced", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(file, []byte(" \n"), 0644))
+		assert.NoError(t, os.Chmod(file, 0644))
+		token, err := EnsureAPIToken()
+		assert.NoError(t, err)
+		assert.Len(t, token, 64)
+		// the mode of the existing file is tightened
+		info, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		again, err := EnsureAPIToken()
+		assert.NoError(t, err)
+		assert.Equal(t, token, again)
+	})
+}
+
+func TestOutboxAtRest(t *testing.T) {
+	SetNetclientPath(t.TempDir() + string(os.PathSeparator))
+	defer SetNetclientPath("")
+	queued := time.Now().UTC().Round(0)
+	t.Run("payloads encrypted on disk", func(t *testing.T) {
+		assert.NoError(t, UpdateOutbox(func(outbox Outbox) {
+			outbox["server"] = []OutboxMessage{{Key: "a", Topic: "topic", QoS: 1, Payload: []byte("hostpass-secret"), Queued: queued}}
+		}))
+		data, err := os.ReadFile(GetNetclientPath() + "outbox.yml")
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "hostpass-secret")
+		info, err := os.Stat(GetNetclientPath() + OutboxKeyFile)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		outbox, err := ReadOutbox()
+		assert.NoError(t, err)
+		assert.Equal(t, []OutboxMessage{{Key: "a", Topic: "topic", QoS: 1, Payload: []byte("hostpass-secret"), Queued: queued}}, outbox["server"])
+	})
+	t.Run("unreadable payloads discarded", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(GetNetclientPath()+OutboxKeyFile, make([]byte, 32), 0600))
+		outbox, err := ReadOutbox()
+		assert.NoError(t, err)
+		assert.Empty(t, outbox["server"])
+	})
+}
+
+// mergeTestPeer - returns the peer of the key with the allowed ips
+func mergeTestPeer(t *testing.T, key wgtypes.Key, remove bool, allowedIPs ...string) wgtypes.PeerConfig {
+	peer := wgtypes.PeerConfig{PublicKey: key, Remove: remove}
+	for _, cidr := range allowedIPs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer.AllowedIPs = append(peer.AllowedIPs, *ipnet)
+	}
+	return peer
+}
+
+// describePeers - returns the peers as "name allowed ips", with remove for removed peers, sorted
+func describePeers(names map[wgtypes.Key]string, peers []wgtypes.PeerConfig) []string {
+	described := []string{}
+	for _, peer := range peers {
+		ips := []string{}
+		for _, ip := range peer.AllowedIPs {
+			ips = append(ips, ip.String())
+		}
+		description := fmt.Sprintf("%s %s", names[peer.PublicKey], strings.Join(ips, ","))
+		if peer.Remove {
+			description += " remove"
+		}
+		described = append(described, description)
+	}
+	sort.Strings(described)
+	return described
+}
+
+func TestMergeServerPeers(t *testing.T) {
+	keys := make(map[string]wgtypes.Key)
+	names := make(map[wgtypes.Key]string)
+	for _, name := range []string{"a", "b", "c"} {
+		private, err := wgtypes.GeneratePrivateKey()
+		assert.NoError(t, err)
+		keys[name] = private.PublicKey()
+		names[private.PublicKey()] = name
+	}
+	tests := []struct {
+		name        string
+		serverPeers map[string][]wgtypes.PeerConfig
+		expected    []string
+	}{
+		{
+			name: "peers of different servers",
+			serverPeers: map[string][]wgtypes.PeerConfig{
+				"one": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32")},
+				"two": {mergeTestPeer(t, keys["b"], false, "10.1.0.2/32")},
+			},
+			expected: []string{"a 10.0.0.2/32", "b 10.1.0.2/32"},
+		},
+		{
+			name: "duplicate public key",
+			serverPeers: map[string][]wgtypes.PeerConfig{
+				"one": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32")},
+				"two": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32")},
+			},
+			expected: []string{"a 10.0.0.2/32"},
+		},
+		{
+			name: "allowed ips union",
+			serverPeers: map[string][]wgtypes.PeerConfig{
+				"one": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32", "192.168.1.0/24")},
+				"two": {mergeTestPeer(t, keys["a"], false, "10.1.0.2/32", "192.168.1.0/24")},
+			},
+			expected: []string{"a 10.0.0.2/32,192.168.1.0/24,10.1.0.2/32"},
+		},
+		{
+			name: "removed by one server, active on another",
+			serverPeers: map[string][]wgtypes.PeerConfig{
+				"one": {mergeTestPeer(t, keys["a"], true, "10.0.0.2/32")},
+				"two": {mergeTestPeer(t, keys["a"], false, "10.1.0.2/32")},
+			},
+			expected: []string{"a 10.1.0.2/32"},
+		},
+		{
+			name: "active on one server, removed by a later one",
+			serverPeers: map[string][]wgtypes.PeerConfig{
+				"one": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32")},
+				"two": {mergeTestPeer(t, keys["a"], true, "10.1.0.2/32")},
+			},
+			expected: []string{"a 10.0.0.2/32"},
+		},
+		{
+			name: "removed by all servers",
+			serverPeers: map[string][]wgtypes.PeerConfig{
+				"one": {mergeTestPeer(t, keys["a"], true, "10.0.0.2/32")},
+				"two": {mergeTestPeer(t, keys["a"], true, "10.1.0.2/32")},
+			},
+			expected: []string{"a 10.0.0.2/32 remove"},
+		},
+		{
+			name:        "no servers",
+			serverPeers: map[string][]wgtypes.PeerConfig{},
+			expected:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, describePeers(names, mergeServerPeers(tt.serverPeers)))
+		})
+	}
+	t.Run("server peers are not changed", func(t *testing.T) {
+		serverPeers := map[string][]wgtypes.PeerConfig{
+			"one": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32")},
+			"two": {mergeTestPeer(t, keys["a"], false, "10.1.0.2/32")},
+		}
+		mergeServerPeers(serverPeers)
+		assert.Equal(t, []string{"a 10.0.0.2/32"}, describePeers(names, serverPeers["one"]))
+	})
+	t.Run("removal of one server's peers", func(t *testing.T) {
+		SetNetclientPath(t.TempDir() + string(os.PathSeparator))
+		t.Cleanup(func() {
+			SetNetclientPath("")
+			netclient.ServerPeers = nil
+			netclient.HostPeers = nil
+		})
+		tests := []struct {
+			name     string
+			remove   func(server string)
+			expected []string
+		}{
+			{name: "deleted", remove: DeleteServerHostPeerCfg, expected: []string{"a 10.1.0.2/32", "c 10.1.0.4/32"}},
+			{name: "flagged for removal", remove: RemoveServerHostPeerCfg, expected: []string{"a 10.1.0.2/32", "b 10.0.0.3/32 remove", "c 10.1.0.4/32"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				netclient.ServerPeers = map[string][]wgtypes.PeerConfig{
+					"one": {mergeTestPeer(t, keys["a"], false, "10.0.0.2/32"), mergeTestPeer(t, keys["b"], false, "10.0.0.3/32")},
+					"two": {mergeTestPeer(t, keys["a"], false, "10.1.0.2/32"), mergeTestPeer(t, keys["c"], false, "10.1.0.4/32")},
+				}
+				tt.remove("one")
+				// a peer shared with another server stays with the allowed ips of that server
+				assert.Equal(t, tt.expected, describePeers(names, netclient.HostPeers))
+			})
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package config
+
+const (
+	// DNSModeHosts - mesh names are written to the hosts file
+	DNSModeHosts = "hosts"
+	// DNSModeResolver - mesh names are answered by the resolver of the daemon on the netmaker interface
+	DNSModeResolver = "resolver"
+)
+
+// DNSConfig - how mesh names are resolved on the host
+type DNSConfig struct {
+	Mode string `json:"mode" yaml:"mode"` // hosts (default) or resolver
+	// servers the resolver forwards names outside the mesh to, the nameservers of /etc/resolv.conf if empty
+	Upstreams []string `json:"upstreams" yaml:"upstreams"`
+	// networks whose domain is a search domain, short names of their hosts resolve without the network
+	Search []string `json:"search" yaml:"search"`
+}
+
+// DNSConfig.Resolver - returns true if mesh names are answered by the resolver of the daemon
+func (d DNSConfig) Resolver() bool {
+	return d.Mode == DNSModeResolver
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,6 +14,9 @@ import (
 // GUILockeFile lockfile for controlling access to gui config file on disk
 const GUILockFile = "gui.lock"
 
+// GUITokenFile file holding the bearer token of the local api, next to the gui config
+const GUITokenFile = "gui.token"
+
 // Gui - in memory gui configuration
 var gui Gui
 
@@ -18,6 +24,7 @@ var gui Gui
 type Gui struct {
 	Address string
 	Port    string
+	Socket  string // unix socket or named pipe of the local api
 }
 
 // SetGUI - set GUI configuration
@@ -26,6 +33,11 @@ func SetGUI(a, p string) {
 	gui.Port = p
 }
 
+// SetGUISocket - set the socket the local api listens on
+func SetGUISocket(socket string) {
+	gui.Socket = socket
+}
+
 // GetGUI - get GUI configuration
 func GetGUI() *Gui {
 	return &gui
@@ -76,3 +88,41 @@ func ReadGUIConfig() (*Gui, error) {
 	}
 	return &gui, nil
 }
+
+// GetAPIToken - reads the bearer token of the local api
+func GetAPIToken() (string, error) {
+	data, err := os.ReadFile(GetNetclientPath() + GUITokenFile)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("empty local api token")
+	}
+	return token, nil
+}
+
+// EnsureAPIToken - returns the bearer token of the local api, creating it if it does not exist yet;
+// the token file is only readable by its owner
+func EnsureAPIToken() (string, error) {
+	if token, err := GetAPIToken(); err == nil {
+		return token, nil
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	file := GetNetclientPath() + GUITokenFile
+	if err := os.WriteFile(file, []byte(token), 0600); err != nil {
+		return "", err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(file, 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
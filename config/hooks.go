@@ -0,0 +1,28 @@
+package config
+
+const (
+	// HookWarn - a failing hook is logged and the remaining hooks of the event still run
+	HookWarn = "warn"
+	// HookAbort - a failing hook stops the remaining hooks of the event; for pre_down it also refuses
+	// the interface resets commanded by a server (a join or a host update), which are then left
+	// unapplied and announced with a host_update_refused event; shutdowns, restarts and uninstalls
+	// can not be cancelled and take the interface down regardless
+	HookAbort = "abort"
+	// DefaultHookTimeout - seconds a hook may run before it is killed
+	DefaultHookTimeout = 30
+)
+
+// Hook - command run with the event as json on stdin when a lifecycle event occurs,
+// hooks configured here run in order before the scripts of the hooks directory
+type Hook struct {
+	Event     string   `json:"event" yaml:"event"`
+	Command   string   `json:"command" yaml:"command"`
+	Args      []string `json:"args" yaml:"args"`
+	Timeout   int      `json:"timeout" yaml:"timeout"`
+	OnFailure string   `json:"onfailure" yaml:"onfailure"`
+}
+
+// GetHooksPath - returns the directory holding a sub directory of hook scripts per event
+func GetHooksPath() string {
+	return GetNetclientPath() + "hooks"
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// DefaultKeyRotationTimeout - seconds to wait for the servers to acknowledge a new key
+	DefaultKeyRotationTimeout = 120
+	// DefaultTrafficKeyGrace - minutes messages for a replaced traffic key are still accepted
+	DefaultTrafficKeyGrace = 10
+)
+
+// KeyRotationPolicy - scheduled rotation of the wireguard keys of the host
+type KeyRotationPolicy struct {
+	Interval int `json:"interval" yaml:"interval"` // hours between rotations, 0 disables scheduled rotations
+	Timeout  int `json:"timeout" yaml:"timeout"`   // seconds to wait for the servers before rolling back
+	// minutes messages encrypted for a replaced traffic key are still accepted
+	TrafficKeyGrace int `json:"traffickeygrace" yaml:"traffickeygrace"`
+	// allows traffic key rotations, the servers must store the traffic key the host publishes
+	TrafficKeys bool `json:"traffickeys" yaml:"traffickeys"`
+}
+
+// PendingKey - wireguard key advertised to the servers that the interface switches to once they all acknowledged it
+type PendingKey struct {
+	PrivateKey   wgtypes.Key `json:"privatekey" yaml:"privatekey"`
+	Started      time.Time   `json:"started" yaml:"started"`
+	Acknowledged []string    `json:"acknowledged" yaml:"acknowledged"`
+}
+
+// PendingTrafficKey - traffic keypair advertised to the servers, messages to a server are encrypted
+// with it once the server encrypted a message for it
+type PendingTrafficKey struct {
+	Private      []byte    `json:"private" yaml:"private"`
+	Public       []byte    `json:"public" yaml:"public"`
+	Previous     []byte    `json:"previous" yaml:"previous"` // public key advertised before the rotation
+	Started      time.Time `json:"started" yaml:"started"`
+	Acknowledged []string  `json:"acknowledged" yaml:"acknowledged"`
+}
+
+// RetiredTrafficKey - replaced private traffic key, messages encrypted for it are accepted until it expires
+type RetiredTrafficKey struct {
+	Private []byte    `json:"private" yaml:"private"`
+	Expires time.Time `json:"expires" yaml:"expires"`
+}
+
+// ServerTrafficKey - traffic keypair a server switched to during a rotation that was rolled back,
+// messages to and from that server keep using it instead of the traffic keys of the host
+type ServerTrafficKey struct {
+	Private []byte `json:"private" yaml:"private"`
+	Public  []byte `json:"public" yaml:"public"`
+}
+
+// GetTimeout - returns the time to wait for the servers to acknowledge a new key
+func (p *KeyRotationPolicy) GetTimeout() time.Duration {
+	if p.Timeout <= 0 {
+		return DefaultKeyRotationTimeout * time.Second
+	}
+	return time.Duration(p.Timeout) * time.Second
+}
+
+// GetTrafficKeyGrace - returns how long messages for a replaced traffic key are accepted
+func (p *KeyRotationPolicy) GetTrafficKeyGrace() time.Duration {
+	if p.TrafficKeyGrace <= 0 {
+		return DefaultTrafficKeyGrace * time.Minute
+	}
+	return time.Duration(p.TrafficKeyGrace) * time.Minute
+}
+
+// AdvertisedTrafficKey - returns the public traffic key the host publishes to the server: the key of a
+// pending rotation, else the key the server kept from a rolled back rotation, else the key of the host
+func (c *Config) AdvertisedTrafficKey(server string) []byte {
+	if c.PendingTrafficKey == nil {
+		if key, ok := c.ServerTrafficKeys[server]; ok {
+			return key.Public
+		}
+	}
+	return c.TrafficKeyPublic
+}
@@ -42,46 +42,80 @@ func ReadNodeConfig() error {
 		return err
 	}
 	defer f.Close()
-	for k := range Nodes {
-		delete(Nodes, k)
-	}
-	if err := yaml.NewDecoder(f).Decode(&Nodes); err != nil {
+	nodes := make(NodeMap)
+	if err := yaml.NewDecoder(f).Decode(&nodes); err != nil {
 		return err
 	}
+	if nodes == nil {
+		nodes = make(NodeMap)
+	}
+	mapMutex.Lock()
+	Nodes = nodes
+	mapMutex.Unlock()
 	return nil
 }
 
-// GetNodes returns a copy of the NodeMap
+// GetNodes returns the NodeMap, the map is replaced rather than changed by updates
 func GetNodes() NodeMap {
+	mapMutex.RLock()
+	defer mapMutex.RUnlock()
 	return Nodes
 }
 
 // GetNode returns returns the node configuation of the specified network name
 func GetNode(k string) Node {
+	mapMutex.RLock()
+	defer mapMutex.RUnlock()
 	if node, ok := Nodes[k]; ok {
 		return node
 	}
 	return Node{}
 }
 
-// SetNodes - sets server nodes in client config
-func SetNodes(nodes []models.Node) {
-	Nodes = make(NodeMap)
+// SetNodes - sets the nodes of the given server in client config,
+// nodes belonging to other servers are left untouched
+func SetNodes(server string, nodes []models.Node) {
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+	updated := copyNodes()
+	for k, node := range updated {
+		if node.Server == server {
+			delete(updated, k)
+		}
+	}
 	for _, node := range nodes {
-		Nodes[node.Network] = Node{
+		updated[node.Network] = Node{
 			CommonNode: node.CommonNode,
 		}
 	}
+	Nodes = updated
 }
 
 // UpdateNodeMap updates the in memory nodemap for the specified network
 func UpdateNodeMap(k string, value Node) {
-	Nodes[k] = value
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+	nodes := copyNodes()
+	nodes[k] = value
+	Nodes = nodes
 }
 
 // DeleteNode deletes the node from the nodemap for the specified network
 func DeleteNode(k string) {
-	delete(Nodes, k)
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+	nodes := copyNodes()
+	delete(nodes, k)
+	Nodes = nodes
+}
+
+// copyNodes - returns a copy of the node map to be changed and swapped in, mapMutex must be held
+func copyNodes() NodeMap {
+	nodes := make(NodeMap, len(Nodes)+1)
+	for k, node := range Nodes {
+		nodes[k] = node
+	}
+	return nodes
 }
 
 // PrimaryAddress returns the primary address of a node
@@ -117,7 +151,9 @@ func WriteNodeConfig() error {
 		return err
 	}
 	defer f.Close()
+	mapMutex.RLock()
 	err = yaml.NewEncoder(f).Encode(Nodes)
+	mapMutex.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -174,7 +210,7 @@ func ConvertToNetmakerNode(node *Node, server *Server, host *Config) *models.Leg
 	netmakerNode.Interface = ncutils.GetInterfaceName()
 	netmakerNode.Interfaces = host.Interfaces
 	netmakerNode.Server = node.Server
-	netmakerNode.TrafficKeys.Mine = host.TrafficKeyPublic
+	netmakerNode.TrafficKeys.Mine = host.AdvertisedTrafficKey(server.Name)
 	netmakerNode.TrafficKeys.Server = server.TrafficKey
 	//only send ip
 	netmakerNode.Endpoint = host.EndpointIP.String()
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"golang.org/x/crypto/nacl/secretbox"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// OutboxLockfile lockfile to control access to the outbox file
+	OutboxLockfile = "outbox.lck"
+	// OutboxKeyFile - file holding the key the payloads of the outbox are encrypted with on disk
+	OutboxKeyFile = "outbox.key"
+)
+
+// OutboxMessage - a publish waiting for the broker of its server to be reachable, the payload is
+// encrypted for the server when it is sent so it carries the keys and freshness header of that moment,
+// until then it is stored encrypted with the outbox key
+type OutboxMessage struct {
+	Key     string    `json:"key" yaml:"key"`
+	Topic   string    `json:"topic" yaml:"topic"`
+	QoS     byte      `json:"qos" yaml:"qos"`
+	Payload []byte    `json:"payload" yaml:"payload"`
+	Queued  time.Time `json:"queued" yaml:"queued"`
+}
+
+// Outbox - pending publishes keyed by server name, in the order they were queued
+type Outbox map[string][]OutboxMessage
+
+// UpdateOutbox - reads the outbox from disk, applies fn and writes the result back
+// while holding the outbox lock, so updates from the daemon and the cli do not clobber each other
+func UpdateOutbox(fn func(Outbox)) error {
+	lockfile := filepath.Join(os.TempDir(), OutboxLockfile)
+	if err := Lock(lockfile); err != nil {
+		return err
+	}
+	defer Unlock(lockfile)
+	outbox, err := readOutbox()
+	if err != nil {
+		return err
+	}
+	fn(outbox)
+	return writeOutbox(outbox)
+}
+
+// ReadOutbox - returns the pending publishes stored on disk
+func ReadOutbox() (Outbox, error) {
+	lockfile := filepath.Join(os.TempDir(), OutboxLockfile)
+	if err := Lock(lockfile); err != nil {
+		return nil, err
+	}
+	defer Unlock(lockfile)
+	return readOutbox()
+}
+
+func readOutbox() (Outbox, error) {
+	outbox := Outbox{}
+	f, err := os.Open(GetNetclientPath() + "outbox.yml")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return outbox, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := yaml.NewDecoder(f).Decode(&outbox); err != nil && !errors.Is(err, io.EOF) {
+		logger.Log(0, "discarding unreadable outbox", err.Error())
+		return Outbox{}, nil
+	}
+	if len(outbox) == 0 {
+		return outbox, nil
+	}
+	key, err := outboxKey()
+	if err != nil {
+		return nil, err
+	}
+	for server, messages := range outbox {
+		opened := []OutboxMessage{}
+		for _, msg := range messages {
+			payload, ok := openPayload(msg.Payload, key)
+			if !ok {
+				logger.Log(0, "discarding unreadable outbox message for", server, msg.Topic)
+				continue
+			}
+			msg.Payload = payload
+			opened = append(opened, msg)
+		}
+		outbox[server] = opened
+	}
+	return outbox, nil
+}
+
+func writeOutbox(outbox Outbox) error {
+	file := GetNetclientPath() + "outbox.yml"
+	for server, messages := range outbox {
+		if len(messages) == 0 {
+			delete(outbox, server)
+		}
+	}
+	if len(outbox) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return err
+	}
+	key, err := outboxKey()
+	if err != nil {
+		return err
+	}
+	sealed := make(Outbox, len(outbox))
+	for server, messages := range outbox {
+		for _, msg := range messages {
+			if msg.Payload, err = sealPayload(msg.Payload, key); err != nil {
+				return err
+			}
+			sealed[server] = append(sealed[server], msg)
+		}
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := yaml.NewEncoder(f).Encode(sealed); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// outboxKey - returns the key the outbox payloads are encrypted with, creating it if it does not exist yet;
+// the key file is only readable by its owner
+func outboxKey() (*[32]byte, error) {
+	file := GetNetclientPath() + OutboxKeyFile
+	key := new([32]byte)
+	data, err := os.ReadFile(file)
+	if err == nil && len(data) == len(key) {
+		copy(key[:], data)
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// a missing or damaged key makes queued payloads unreadable, they are discarded
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(file, key[:], 0600); err != nil {
+		return nil, err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(file, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sealPayload - encrypts the payload with the outbox key, prefixed with its nonce
+func sealPayload(payload []byte, key *[32]byte) ([]byte, error) {
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	return secretbox.Seal(nonce[:], payload, &nonce, key), nil
+}
+
+// openPayload - decrypts a payload sealed with the outbox key, returns false if it can not be opened
+func openPayload(sealed []byte, key *[32]byte) ([]byte, bool) {
+	var nonce [24]byte
+	if len(sealed) < len(nonce)+secretbox.Overhead {
+		return nil, false
+	}
+	copy(nonce[:], sealed[:len(nonce)])
+	return secretbox.Open(nil, sealed[len(nonce):], &nonce, key)
+}
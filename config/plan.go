@@ -0,0 +1,192 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+// PlanLockfile lockfile to control access to the plans file
+const PlanLockfile = "plans.lck"
+
+// ErrNoPlan - there is no pending plan for the server
+var ErrNoPlan = errors.New("no pending plan")
+
+// Plan - updates received from a server that are recorded instead of applied while plan mode is on,
+// they are applied once the plan is approved, the host updates first and in the order received
+type Plan struct {
+	ID          string                 `json:"id"`
+	Server      string                 `json:"server"`
+	Created     time.Time              `json:"created"`
+	Updated     time.Time              `json:"updated"`
+	Networks    []string               `json:"networks"`
+	HostUpdates []PlanHostUpdate       `json:"host_updates,omitempty"`
+	PeerUpdate  *models.HostPeerUpdate `json:"peer_update,omitempty"`
+	DNS         []PlanDNS              `json:"dns,omitempty"`
+	Changes     PlanChanges            `json:"changes"`
+}
+
+// PlanHostUpdate - host update recorded in a plan, the message is kept as received
+type PlanHostUpdate struct {
+	Action  models.HostMqAction `json:"action"`
+	Network string              `json:"network,omitempty"`
+	Message json.RawMessage     `json:"message"`
+}
+
+// PlanDNS - dns update recorded in a plan, replace holds the full set of entries of the server
+type PlanDNS struct {
+	Replace bool               `json:"replace,omitempty"`
+	Entries []models.DNSUpdate `json:"entries"`
+}
+
+// PlanChanges - changes the plan makes to the host when applied
+type PlanChanges struct {
+	HostUpdates     []string   `json:"host_updates"`
+	PeersAdded      []PlanPeer `json:"peers_added"`
+	PeersRemoved    []PlanPeer `json:"peers_removed"`
+	PeersUpdated    []PlanPeer `json:"peers_updated"`
+	RoutesAdded     []string   `json:"routes_added"`
+	RoutesRemoved   []string   `json:"routes_removed"`
+	GatewayBefore   string     `json:"gateway_before,omitempty"`
+	GatewayAfter    string     `json:"gateway_after,omitempty"`
+	FirewallAdded   []string   `json:"firewall_added"`
+	FirewallRemoved []string   `json:"firewall_removed"`
+	HostsAdded      []string   `json:"hosts_added"`
+	HostsRemoved    []string   `json:"hosts_removed"`
+}
+
+// PlanPeer - peer changed by a plan
+type PlanPeer struct {
+	PublicKey  string   `json:"public_key"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	AllowedIPs []string `json:"allowed_ips"`
+	Networks   []string `json:"networks,omitempty"`
+}
+
+// Empty - returns true if the plan does not change anything
+func (c *PlanChanges) Empty() bool {
+	return len(c.HostUpdates) == 0 && len(c.PeersAdded) == 0 && len(c.PeersRemoved) == 0 && len(c.PeersUpdated) == 0 &&
+		len(c.RoutesAdded) == 0 && len(c.RoutesRemoved) == 0 && c.GatewayBefore == c.GatewayAfter &&
+		len(c.FirewallAdded) == 0 && len(c.FirewallRemoved) == 0 &&
+		len(c.HostsAdded) == 0 && len(c.HostsRemoved) == 0
+}
+
+// IsAutoApply - returns true if updates for the network are applied without approval in plan mode
+func IsAutoApply(network string) bool {
+	for _, name := range netclient.AutoApplyNetworks {
+		if name == network {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdatePlan - reads the pending plan of the server, creating it if there is none, applies fn
+// and writes the result back while holding the plans lock
+func UpdatePlan(server string, fn func(*Plan)) (Plan, error) {
+	lockfile := filepath.Join(os.TempDir(), PlanLockfile)
+	if err := Lock(lockfile); err != nil {
+		return Plan{}, err
+	}
+	defer Unlock(lockfile)
+	plans, err := readPlans()
+	if err != nil {
+		return Plan{}, err
+	}
+	plan, ok := plans[server]
+	if !ok {
+		plan = Plan{
+			ID:      time.Now().UTC().Format("20060102T150405.000000000"),
+			Server:  server,
+			Created: time.Now(),
+		}
+	}
+	fn(&plan)
+	plan.Updated = time.Now()
+	plans[server] = plan
+	return plan, writePlans(plans)
+}
+
+// GetPlan - returns the pending plan of the server
+func GetPlan(server string) (Plan, error) {
+	plans, err := GetPlans()
+	if err != nil {
+		return Plan{}, err
+	}
+	plan, ok := plans[server]
+	if !ok {
+		return Plan{}, ErrNoPlan
+	}
+	return plan, nil
+}
+
+// GetPlans - returns the pending plans by server
+func GetPlans() (map[string]Plan, error) {
+	lockfile := filepath.Join(os.TempDir(), PlanLockfile)
+	if err := Lock(lockfile); err != nil {
+		return nil, err
+	}
+	defer Unlock(lockfile)
+	return readPlans()
+}
+
+// TakePlan - removes the pending plan of the server and returns it
+func TakePlan(server string) (Plan, error) {
+	lockfile := filepath.Join(os.TempDir(), PlanLockfile)
+	if err := Lock(lockfile); err != nil {
+		return Plan{}, err
+	}
+	defer Unlock(lockfile)
+	plans, err := readPlans()
+	if err != nil {
+		return Plan{}, err
+	}
+	plan, ok := plans[server]
+	if !ok {
+		return Plan{}, ErrNoPlan
+	}
+	delete(plans, server)
+	return plan, writePlans(plans)
+}
+
+func readPlans() (map[string]Plan, error) {
+	plans := make(map[string]Plan)
+	data, err := os.ReadFile(GetNetclientPath() + "plans.json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return plans, nil
+		}
+		return plans, err
+	}
+	if err := json.Unmarshal(data, &plans); err != nil {
+		logger.Log(0, "discarding unreadable plans", err.Error())
+		return make(map[string]Plan), nil
+	}
+	return plans, nil
+}
+
+func writePlans(plans map[string]Plan) error {
+	file := GetNetclientPath() + "plans.json"
+	if len(plans) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(plans)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
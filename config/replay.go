@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/gravitl/netmaker/logger"
+)
+
+// ReplayLockfile lockfile to control access to the replay file
+const ReplayLockfile = "replay.lck"
+
+// ReplayState - sequence numbers accepted from the servers, kept across restarts so captured
+// messages can not be replayed once the daemon restarted
+type ReplayState struct {
+	Servers map[string]ServerReplayState `json:"servers"`
+}
+
+// ServerReplayState - replay windows of the topics of a server
+type ServerReplayState struct {
+	// Fresh is set once the server sent a message with a freshness header, messages without one are rejected
+	Fresh   bool                    `json:"fresh"`
+	Windows map[string]ReplayWindow `json:"windows"`
+	// Digests - hex sha256 digests of the last messages without freshness header per topic, oldest first
+	Digests map[string][]string `json:"digests,omitempty"`
+}
+
+// ReplayWindow - highest sequence number accepted on a topic and a bitmap of the sequence numbers
+// accepted below it, bit n stands for highest-n
+type ReplayWindow struct {
+	Highest uint64 `json:"highest"`
+	Bitmap  uint64 `json:"bitmap"`
+}
+
+// ReadReplayState - returns the replay state stored on disk
+func ReadReplayState() (ReplayState, error) {
+	lockfile := filepath.Join(os.TempDir(), ReplayLockfile)
+	if err := Lock(lockfile); err != nil {
+		return ReplayState{}, err
+	}
+	defer Unlock(lockfile)
+	state := ReplayState{Servers: make(map[string]ServerReplayState)}
+	data, err := os.ReadFile(GetNetclientPath() + "replay.json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return state, err
+	}
+	var stored ReplayState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		logger.Log(0, "discarding unreadable replay state", err.Error())
+		return state, nil
+	}
+	if stored.Servers != nil {
+		state.Servers = stored.Servers
+	}
+	return state, nil
+}
+
+// WriteReplayState - writes the replay state to a temporary file and renames it
+func WriteReplayState(state ReplayState) error {
+	lockfile := filepath.Join(os.TempDir(), ReplayLockfile)
+	if err := Lock(lockfile); err != nil {
+		return err
+	}
+	defer Unlock(lockfile)
+	file := GetNetclientPath() + "replay.json"
+	if len(state.Servers) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/gravitl/netmaker/logger"
@@ -20,6 +21,10 @@ var CurrServer string
 // Servers is map of servers indexed by server name
 var Servers map[string]Server
 
+// mapMutex - guards the server and node maps, maps read from disk replace the maps in one step
+// so routines ranging over the previous maps are not affected
+var mapMutex sync.RWMutex
+
 // ServerLockFile is a lockfile for controlling access to the server map file on disk
 const ServerLockfile = "netclient-servers.lck"
 
@@ -30,6 +35,28 @@ type Server struct {
 	MQID      uuid.UUID       `json:"mqid" yaml:"mqid"`
 	Nodes     map[string]bool `json:"nodes" yaml:"nodes"`
 	AccessKey string          `json:"accesskey" yaml:"accesskey"`
+	// Brokers ordered list of broker urls to fail over between, tried before Broker
+	Brokers []string `json:"brokers" yaml:"brokers"`
+}
+
+// GetBrokers - returns the ordered list of brokers of the server, ending with the broker
+// provided by the server if it is not part of the configured list
+func (s *Server) GetBrokers() []string {
+	brokers := []string{}
+	for _, broker := range s.Brokers {
+		if broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	for _, broker := range brokers {
+		if broker == s.Broker {
+			return brokers
+		}
+	}
+	if s.Broker != "" {
+		brokers = append(brokers, s.Broker)
+	}
+	return brokers
 }
 
 // OldNetmakerServerConfig - pre v0.18.0 server configuration
@@ -65,12 +92,16 @@ func ReadServerConf() error {
 		return err
 	}
 	defer f.Close()
-	for k := range Servers {
-		delete(Servers, k)
-	}
-	if err := yaml.NewDecoder(f).Decode(&Servers); err != nil {
+	servers := make(map[string]Server)
+	if err := yaml.NewDecoder(f).Decode(&servers); err != nil {
 		return err
 	}
+	if servers == nil {
+		servers = make(map[string]Server)
+	}
+	mapMutex.Lock()
+	Servers = servers
+	mapMutex.Unlock()
 	return nil
 }
 
@@ -99,7 +130,9 @@ func WriteServerConfig() error {
 		return err
 	}
 	defer f.Close()
+	mapMutex.RLock()
 	err = yaml.NewEncoder(f).Encode(Servers)
+	mapMutex.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -108,25 +141,49 @@ func WriteServerConfig() error {
 
 // SaveServer updates the server map with current server struct and writes map to disk
 func SaveServer(name string, server Server) error {
-	Servers[name] = server
+	UpdateServer(name, server)
 	return WriteServerConfig()
 }
 
 // UpdateServer updates the in-memory server map
 func UpdateServer(name string, server Server) {
-	Servers[name] = server
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+	servers := copyServers()
+	servers[name] = server
+	Servers = servers
+}
+
+// copyServers - returns a copy of the server map to be changed and swapped in, mapMutex must be held
+func copyServers() map[string]Server {
+	servers := make(map[string]Server, len(Servers)+1)
+	for name, server := range Servers {
+		servers[name] = server
+	}
+	return servers
 }
 
 // GetServer returns the server struct for the given server name
 func GetServer(name string) *Server {
+	mapMutex.RLock()
+	defer mapMutex.RUnlock()
 	if server, ok := Servers[name]; ok {
 		return &server
 	}
 	return nil
 }
 
+// GetServerMap - returns the server map, the map is replaced rather than changed by updates
+func GetServerMap() map[string]Server {
+	mapMutex.RLock()
+	defer mapMutex.RUnlock()
+	return Servers
+}
+
 // GetServers - gets all the server names host has registered to.
 func GetServers() (servers []string) {
+	mapMutex.RLock()
+	defer mapMutex.RUnlock()
 	for _, server := range Servers {
 		servers = append(servers, server.Name)
 	}
@@ -173,7 +230,11 @@ func SetServerCtx() {
 
 // DeleteServer deletes the specified server name from the server map
 func DeleteServer(k string) {
-	delete(Servers, k)
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+	servers := copyServers()
+	delete(servers, k)
+	Servers = servers
 }
 
 // ConvertServerCfg converts a netmaker ServerConfig to netclient server struct
@@ -197,6 +258,8 @@ func UpdateServerConfig(cfg *models.ServerConfig) {
 	if cfg == nil {
 		return
 	}
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
 	server, ok := Servers[cfg.Server]
 	if !ok {
 		server = Server{}
@@ -206,23 +269,28 @@ func UpdateServerConfig(cfg *models.ServerConfig) {
 	server.MQID = netclient.ID
 	server.ServerConfig = *cfg
 
-	Servers[cfg.Server] = server
+	servers := copyServers()
+	servers[cfg.Server] = server
+	Servers = servers
 }
 
 // GetAllTurnConfigs - fetches all turn configs from all servers
 func GetAllTurnConfigs() (turnList []TurnConfig) {
 	turnMap := make(map[string]struct{})
-	server := GetServer(CurrServer)
-	if server == nil || !server.UseTurn {
-		return
-	}
-	if _, ok := turnMap[server.TurnDomain]; !ok {
-		turnList = append(turnList, TurnConfig{
-			Server: CurrServer,
-			Domain: server.TurnDomain,
-			Port:   server.TurnPort,
-		})
-		turnMap[server.TurnDomain] = struct{}{}
+	mapMutex.RLock()
+	defer mapMutex.RUnlock()
+	for name, server := range Servers {
+		if !server.UseTurn {
+			continue
+		}
+		if _, ok := turnMap[server.TurnDomain]; !ok {
+			turnList = append(turnList, TurnConfig{
+				Server: name,
+				Domain: server.TurnDomain,
+				Port:   server.TurnPort,
+			})
+			turnMap[server.TurnDomain] = struct{}{}
+		}
 	}
 
 	return
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+const (
+	// SnapshotLockfile lockfile to control access to the snapshot file
+	SnapshotLockfile = "snapshot.lck"
+	// SnapshotVersion - format version of the snapshot file, snapshots of other versions are discarded
+	SnapshotVersion = 2
+)
+
+// Snapshot - last known good state applied from the servers, used to bring the mesh up
+// on startup before the servers are reachable
+type Snapshot struct {
+	Version int                       `json:"version"`
+	Servers map[string]ServerSnapshot `json:"servers"`
+}
+
+// ServerSnapshot - last peer update and dns entries applied from a server
+type ServerSnapshot struct {
+	// Serial is incremented on every change to the server's snapshot
+	Serial        uint64                `json:"serial"`
+	ServerVersion string                `json:"server_version"`
+	Updated       time.Time             `json:"updated"`
+	HasPeers      bool                  `json:"has_peers"` // a peer update of the server was recorded
+	PeerUpdate    models.HostPeerUpdate `json:"peer_update"`
+	DNS           []models.DNSUpdate    `json:"dns"`
+}
+
+// UpdateSnapshot - reads the snapshot of the server from disk, applies fn and writes the result back
+// while holding the snapshot lock, the serial and update time are set on write
+func UpdateSnapshot(server string, fn func(*ServerSnapshot)) error {
+	lockfile := filepath.Join(os.TempDir(), SnapshotLockfile)
+	if err := Lock(lockfile); err != nil {
+		return err
+	}
+	defer Unlock(lockfile)
+	snapshot, err := readSnapshot()
+	if err != nil {
+		return err
+	}
+	serverSnapshot := snapshot.Servers[server]
+	fn(&serverSnapshot)
+	serverSnapshot.Serial++
+	serverSnapshot.Updated = time.Now()
+	snapshot.Servers[server] = serverSnapshot
+	return writeSnapshot(snapshot)
+}
+
+// DeleteServerSnapshot - removes the snapshot of the server
+func DeleteServerSnapshot(server string) error {
+	lockfile := filepath.Join(os.TempDir(), SnapshotLockfile)
+	if err := Lock(lockfile); err != nil {
+		return err
+	}
+	defer Unlock(lockfile)
+	snapshot, err := readSnapshot()
+	if err != nil {
+		return err
+	}
+	if _, ok := snapshot.Servers[server]; !ok {
+		return nil
+	}
+	delete(snapshot.Servers, server)
+	return writeSnapshot(snapshot)
+}
+
+// ReadSnapshot - returns the snapshot stored on disk
+func ReadSnapshot() (Snapshot, error) {
+	lockfile := filepath.Join(os.TempDir(), SnapshotLockfile)
+	if err := Lock(lockfile); err != nil {
+		return Snapshot{}, err
+	}
+	defer Unlock(lockfile)
+	return readSnapshot()
+}
+
+func readSnapshot() (Snapshot, error) {
+	snapshot := Snapshot{
+		Version: SnapshotVersion,
+		Servers: make(map[string]ServerSnapshot),
+	}
+	data, err := os.ReadFile(GetNetclientPath() + "snapshot.json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return snapshot, nil
+		}
+		return snapshot, err
+	}
+	var stored Snapshot
+	if err := json.Unmarshal(data, &stored); err != nil {
+		logger.Log(0, "discarding unreadable snapshot", err.Error())
+		return snapshot, nil
+	}
+	if stored.Version != SnapshotVersion {
+		logger.Log(0, "discarding snapshot of unsupported version", strconv.Itoa(stored.Version))
+		return snapshot, nil
+	}
+	if stored.Servers != nil {
+		snapshot.Servers = stored.Servers
+	}
+	return snapshot, nil
+}
+
+// writeSnapshot - writes the snapshot to a temporary file and renames it,
+// so a crash while writing never leaves a partial snapshot behind
+func writeSnapshot(snapshot Snapshot) error {
+	file := GetNetclientPath() + "snapshot.json"
+	if len(snapshot.Servers) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(GetNetclientPath(), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
@@ -0,0 +1,99 @@
+// Package events provides an in-process event bus for changes applied by the daemon
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuffer - default number of events buffered per subscription
+const DefaultBuffer = 100
+
+// Event - a change published on the bus
+type Event interface {
+	// EventName returns the name identifying the kind of event
+	EventName() string
+}
+
+// Envelope - an event together with its name and the time it was published
+type Envelope struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	Data Event     `json:"data"`
+}
+
+// Subscription - receives the events published while it is open
+type Subscription struct {
+	// C delivers the published events
+	C       <-chan Envelope
+	ch      chan Envelope
+	names   map[string]struct{}
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+var (
+	mutex         sync.RWMutex
+	subscriptions = make(map[*Subscription]struct{})
+)
+
+// Subscribe - returns a subscription to the events with the given names, or to all events
+// if no names are given; buffer is the number of events held for a slow subscriber
+func Subscribe(buffer int, names ...string) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	ch := make(chan Envelope, buffer)
+	s := &Subscription{
+		C:     ch,
+		ch:    ch,
+		names: make(map[string]struct{}),
+	}
+	for _, name := range names {
+		s.names[name] = struct{}{}
+	}
+	mutex.Lock()
+	subscriptions[s] = struct{}{}
+	mutex.Unlock()
+	return s
+}
+
+// Close - stops delivery to the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		mutex.Lock()
+		delete(subscriptions, s)
+		mutex.Unlock()
+		close(s.ch)
+	})
+}
+
+// Dropped - returns the number of events not delivered because the subscription buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Publish - delivers the event to all matching subscriptions,
+// it never blocks: events for a subscription with a full buffer are dropped
+func Publish(e Event) {
+	envelope := Envelope{
+		Name: e.EventName(),
+		Time: time.Now(),
+		Data: e,
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for s := range subscriptions {
+		if len(s.names) > 0 {
+			if _, ok := s.names[envelope.Name]; !ok {
+				continue
+			}
+		}
+		select {
+		case s.ch <- envelope:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
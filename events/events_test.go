@@ -0,0 +1,84 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+type testEvent struct {
+	name  string
+	value int
+}
+
+func (e testEvent) EventName() string { return e.name }
+
+// received - returns the values of the events waiting in the subscription
+func received(sub *Subscription) []int {
+	values := []int{}
+	for {
+		select {
+		case envelope, ok := <-sub.C:
+			if !ok {
+				return values
+			}
+			values = append(values, envelope.Data.(testEvent).value)
+		default:
+			return values
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Run("all events", func(t *testing.T) {
+		is := is.New(t)
+		sub := Subscribe(0)
+		defer sub.Close()
+		Publish(testEvent{name: "a", value: 1})
+		Publish(testEvent{name: "b", value: 2})
+		is.Equal(received(sub), []int{1, 2})
+	})
+	t.Run("events by name", func(t *testing.T) {
+		is := is.New(t)
+		sub := Subscribe(0, "b")
+		defer sub.Close()
+		Publish(testEvent{name: "a", value: 1})
+		Publish(testEvent{name: "b", value: 2})
+		is.Equal(received(sub), []int{2})
+	})
+	t.Run("envelope", func(t *testing.T) {
+		is := is.New(t)
+		sub := Subscribe(0)
+		defer sub.Close()
+		Publish(testEvent{name: "a", value: 1})
+		envelope := <-sub.C
+		is.Equal(envelope.Name, "a")
+		is.True(!envelope.Time.IsZero())
+	})
+}
+
+func TestPublishFullBuffer(t *testing.T) {
+	is := is.New(t)
+	slow := Subscribe(2)
+	defer slow.Close()
+	fast := Subscribe(0)
+	defer fast.Close()
+	for i := 1; i <= 5; i++ {
+		Publish(testEvent{name: "a", value: i})
+	}
+	// the events beyond the buffer of the slow subscriber are dropped without holding up the others
+	is.Equal(received(slow), []int{1, 2})
+	is.Equal(slow.Dropped(), uint64(3))
+	is.Equal(received(fast), []int{1, 2, 3, 4, 5})
+	is.Equal(fast.Dropped(), uint64(0))
+}
+
+func TestClose(t *testing.T) {
+	is := is.New(t)
+	sub := Subscribe(0)
+	sub.Close()
+	sub.Close()
+	Publish(testEvent{name: "a", value: 1})
+	_, ok := <-sub.C
+	is.True(!ok) // the channel is closed and nothing is delivered after closing
+}
@@ -0,0 +1,331 @@
+package events
+
+import "time"
+
+// PeerAdded - a peer was added to the netmaker interface by a server
+type PeerAdded struct {
+	Server     string   `json:"server"`
+	PublicKey  string   `json:"public_key"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// EventName - name of the event
+func (PeerAdded) EventName() string { return "peer_added" }
+
+// PeerUpdated - the endpoint or allowed ips of a peer were changed by a server
+type PeerUpdated struct {
+	Server     string   `json:"server"`
+	PublicKey  string   `json:"public_key"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// EventName - name of the event
+func (PeerUpdated) EventName() string { return "peer_updated" }
+
+// PeerRemoved - a peer was removed by a server
+type PeerRemoved struct {
+	Server    string `json:"server"`
+	PublicKey string `json:"public_key"`
+}
+
+// EventName - name of the event
+func (PeerRemoved) EventName() string { return "peer_removed" }
+
+// NodeUpdated - a node of the host was updated by its server
+type NodeUpdated struct {
+	Server    string `json:"server"`
+	Network   string `json:"network"`
+	NodeID    string `json:"node_id"`
+	Action    string `json:"action"`
+	Connected bool   `json:"connected"`
+}
+
+// EventName - name of the event
+func (NodeUpdated) EventName() string { return "node_updated" }
+
+// NodeDeleted - a node of the host was deleted by its server
+type NodeDeleted struct {
+	Server  string `json:"server"`
+	Network string `json:"network"`
+	NodeID  string `json:"node_id"`
+}
+
+// EventName - name of the event
+func (NodeDeleted) EventName() string { return "node_deleted" }
+
+// HostUpdated - a host update from a server was applied
+type HostUpdated struct {
+	Server  string `json:"server"`
+	Action  string `json:"action"`
+	Network string `json:"network,omitempty"`
+}
+
+// EventName - name of the event
+func (HostUpdated) EventName() string { return "host_updated" }
+
+// HostUpdateRefused - a host update from a server was not applied, a pre_down hook aborted
+// the interface reset it needs
+type HostUpdateRefused struct {
+	Server  string `json:"server"`
+	Action  string `json:"action"`
+	Network string `json:"network,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// EventName - name of the event
+func (HostUpdateRefused) EventName() string { return "host_update_refused" }
+
+// DNSUpdated - a dns entry from a server was applied
+type DNSUpdated struct {
+	Server     string `json:"server"`
+	Action     string `json:"action"`
+	Name       string `json:"name"`
+	NewName    string `json:"new_name,omitempty"`
+	Address    string `json:"address,omitempty"`
+	NewAddress string `json:"new_address,omitempty"`
+}
+
+// EventName - name of the event
+func (DNSUpdated) EventName() string { return "dns_updated" }
+
+// DNSReplaced - all dns entries of a server were replaced
+type DNSReplaced struct {
+	Server  string `json:"server"`
+	Entries int    `json:"entries"`
+}
+
+// EventName - name of the event
+func (DNSReplaced) EventName() string { return "dns_replaced" }
+
+// ProxyPeerAdded - the proxy started a connection for a peer
+type ProxyPeerAdded struct {
+	Server    string `json:"server"`
+	PublicKey string `json:"public_key"`
+	Relayed   bool   `json:"relayed"`
+	RelayedTo string `json:"relayed_to,omitempty"`
+}
+
+// EventName - name of the event
+func (ProxyPeerAdded) EventName() string { return "proxy_peer_added" }
+
+// ProxyPeersReset - the proxy dropped all of its peer connections
+type ProxyPeersReset struct{}
+
+// EventName - name of the event
+func (ProxyPeersReset) EventName() string { return "proxy_peers_reset" }
+
+// HandshakeChanged - a peer's wireguard handshake went stale or became active again
+type HandshakeChanged struct {
+	PublicKey     string    `json:"public_key"`
+	Endpoint      string    `json:"endpoint,omitempty"`
+	Connected     bool      `json:"connected"`
+	LastHandshake time.Time `json:"last_handshake"`
+}
+
+// EventName - name of the event
+func (HandshakeChanged) EventName() string { return "handshake_changed" }
+
+// BrokerConnected - the daemon connected to the broker of a server
+type BrokerConnected struct {
+	Server string `json:"server"`
+	Broker string `json:"broker"`
+}
+
+// EventName - name of the event
+func (BrokerConnected) EventName() string { return "broker_connected" }
+
+// BrokerDisconnected - the daemon lost or closed the connection to the broker of a server
+type BrokerDisconnected struct {
+	Server string `json:"server"`
+	Broker string `json:"broker"`
+	Error  string `json:"error,omitempty"`
+}
+
+// EventName - name of the event
+func (BrokerDisconnected) EventName() string { return "broker_disconnected" }
+
+// DaemonReset - the daemon restarted its routines after a reset signal
+type DaemonReset struct{}
+
+// EventName - name of the event
+func (DaemonReset) EventName() string { return "daemon_reset" }
+
+// DaemonReloaded - the daemon applied config changes in place without restarting its routines
+type DaemonReloaded struct {
+	Changes []string `json:"changes"`
+}
+
+// EventName - name of the event
+func (DaemonReloaded) EventName() string { return "daemon_reloaded" }
+
+// DeviceDrift - the reconciler found the wireguard device out of sync with the desired config and corrected it
+type DeviceDrift struct {
+	Kind      string `json:"kind"`
+	PublicKey string `json:"public_key,omitempty"`
+	Desired   string `json:"desired,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+}
+
+// EventName - name of the event
+func (DeviceDrift) EventName() string { return "device_drift" }
+
+// PlanRecorded - an update of a server was recorded in its pending plan instead of being applied
+type PlanRecorded struct {
+	Server   string   `json:"server"`
+	ID       string   `json:"id"`
+	Networks []string `json:"networks"`
+}
+
+// EventName - name of the event
+func (PlanRecorded) EventName() string { return "plan_recorded" }
+
+// PlanApplied - the pending plan of a server was approved and applied
+type PlanApplied struct {
+	Server string `json:"server"`
+	ID     string `json:"id"`
+}
+
+// EventName - name of the event
+func (PlanApplied) EventName() string { return "plan_applied" }
+
+// PlanDiscarded - the pending plan of a server was dropped without being applied
+type PlanDiscarded struct {
+	Server string `json:"server"`
+	ID     string `json:"id"`
+}
+
+// EventName - name of the event
+func (PlanDiscarded) EventName() string { return "plan_discarded" }
+
+// PostUp - the netmaker interface was brought up and configured
+type PostUp struct {
+	Interface string   `json:"interface"`
+	Addresses []string `json:"addresses"`
+}
+
+// EventName - name of the event
+func (PostUp) EventName() string { return "post_up" }
+
+// PreDown - the netmaker interface is about to be taken down
+type PreDown struct {
+	Interface string `json:"interface"`
+	Reason    string `json:"reason"`
+}
+
+// EventName - name of the event
+func (PreDown) EventName() string { return "pre_down" }
+
+// GatewayChanged - the default gateway was set to or removed from an internet gateway peer
+type GatewayChanged struct {
+	Action  string `json:"action"`
+	Gateway string `json:"gateway"`
+}
+
+// EventName - name of the event
+func (GatewayChanged) EventName() string { return "gateway_changed" }
+
+// ServerJoined - the host registered with a server
+type ServerJoined struct {
+	Server string `json:"server"`
+}
+
+// EventName - name of the event
+func (ServerJoined) EventName() string { return "server_joined" }
+
+// ServerLeft - the host was removed from a server
+type ServerLeft struct {
+	Server string `json:"server"`
+}
+
+// EventName - name of the event
+func (ServerLeft) EventName() string { return "server_left" }
+
+// KeyRotationStarted - a new wireguard public key was advertised to the servers
+type KeyRotationStarted struct {
+	PublicKey string `json:"public_key"`
+}
+
+// EventName - name of the event
+func (KeyRotationStarted) EventName() string { return "key_rotation_started" }
+
+// KeyRotated - all servers acknowledged the new wireguard key and the interface switched to it
+type KeyRotated struct {
+	PublicKey string `json:"public_key"`
+	Previous  string `json:"previous"`
+}
+
+// EventName - name of the event
+func (KeyRotated) EventName() string { return "key_rotated" }
+
+// KeyRotationRolledBack - the servers did not acknowledge the new wireguard key in time,
+// the old key was advertised again
+type KeyRotationRolledBack struct {
+	PublicKey string `json:"public_key"`
+	Reason    string `json:"reason"`
+}
+
+// EventName - name of the event
+func (KeyRotationRolledBack) EventName() string { return "key_rotation_rolled_back" }
+
+// TrafficKeyRotationStarted - a new traffic public key was advertised to the servers
+type TrafficKeyRotationStarted struct{}
+
+// EventName - name of the event
+func (TrafficKeyRotationStarted) EventName() string { return "traffic_key_rotation_started" }
+
+// TrafficKeyRotated - all servers encrypt for the new traffic key, the host switched to it
+type TrafficKeyRotated struct {
+	GraceUntil time.Time `json:"grace_until"`
+}
+
+// EventName - name of the event
+func (TrafficKeyRotated) EventName() string { return "traffic_key_rotated" }
+
+// TrafficKeyRotationRolledBack - the servers did not switch to the new traffic key in time,
+// the old key was advertised again
+type TrafficKeyRotationRolledBack struct {
+	Reason string `json:"reason"`
+}
+
+// EventName - name of the event
+func (TrafficKeyRotationRolledBack) EventName() string { return "traffic_key_rotation_rolled_back" }
+
+// ReplayRejected - a message of a server was rejected as replayed, stale or without freshness header
+type ReplayRejected struct {
+	Server string `json:"server"`
+	Topic  string `json:"topic"`
+	Reason string `json:"reason"`
+}
+
+// EventName - name of the event
+func (ReplayRejected) EventName() string { return "replay_rejected" }
+
+// FirewallRepaired - the firewall watcher reinstalled netmaker chains or rules removed by another tool
+type FirewallRepaired struct {
+	Chains    int `json:"chains"`
+	JumpRules int `json:"jump_rules"`
+	PeerRules int `json:"peer_rules"`
+}
+
+// EventName - name of the event
+func (FirewallRepaired) EventName() string { return "firewall_repaired" }
+
+// AclPolicyApplied - the acl policy of a network was enforced on the netmaker interface
+type AclPolicyApplied struct {
+	Network string `json:"network"`
+	Source  string `json:"source"` // the server that pushed the policy or local for a local file
+	Rules   int    `json:"rules"`
+}
+
+// EventName - name of the event
+func (AclPolicyApplied) EventName() string { return "acl_policy_applied" }
+
+// AclPolicyRemoved - the acl rules of a network were removed, its peers reach all ports of the host again
+type AclPolicyRemoved struct {
+	Network string `json:"network"`
+}
+
+// EventName - name of the event
+func (AclPolicyRemoved) EventName() string { return "acl_policy_removed" }
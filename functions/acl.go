@@ -0,0 +1,395 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/nmproxy/router"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+// UpdateAclPolicy - host update action of a server pushing the acl policy of the network of the node,
+// the policy is carried in the acl_policy field of the update, a missing policy removes it
+const UpdateAclPolicy models.HostMqAction = "UPDATE_ACL_POLICY"
+
+// aclPolicyUpdate - the acl policy of a host update
+type aclPolicyUpdate struct {
+	AclPolicy *config.AclPolicy `json:"acl_policy"`
+}
+
+// aclPolicyTag - prefix of the sources naming a tag of the policy
+const aclPolicyTag = "tag:"
+
+// aclState - the acl rules installed per network and the policies they were resolved from; the policies are
+// read once and again only after they changed, the rules are resolved again only if the dns table, the
+// nodes or the policies changed since the last successful apply
+var aclState = struct {
+	mutex   sync.Mutex
+	applied map[string][]router.AclRule
+	warned  bool
+	pushed  map[string]config.AclPolicy // policies of acl.json, nil until read
+	local   map[string]config.AclPolicy // local policy files of the networks, nil until read
+	nodes   string                      // networks, servers and ranges of the nodes the policies were read for
+	dns     uint64                      // changes of the dns table the rules were resolved for
+	synced  bool                        // the rules match the policies, the nodes and the dns table
+}{applied: make(map[string][]router.AclRule)}
+
+// updateAclPolicy - stores or removes the acl policy a server pushed for a network and applies the policies
+func updateAclPolicy(server, network string, data []byte) error {
+	var update aclPolicyUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return err
+	}
+	if update.AclPolicy != nil && update.AclPolicy.Network != "" {
+		network = update.AclPolicy.Network
+	}
+	if network == "" {
+		return fmt.Errorf("acl policy without network")
+	}
+	if node, ok := config.GetNodes()[network]; !ok || node.Server != server {
+		return fmt.Errorf("server %s has no node in network %s", server, network)
+	}
+	policies, err := config.ReadAclPolicies()
+	if err != nil {
+		return err
+	}
+	if update.AclPolicy == nil {
+		delete(policies, network)
+	} else {
+		policy := *update.AclPolicy
+		policy.Network = network
+		policy.Server = server
+		if _, err := resolveAclPolicy(policy, config.Node{}); err != nil {
+			return err
+		}
+		policies[network] = policy
+	}
+	if err := config.WriteAclPolicies(policies); err != nil {
+		return err
+	}
+	forgetAclPolicies()
+	applyAclPolicies()
+	return nil
+}
+
+// dropAclPolicies - discards the acl policies pushed by a server that was removed
+func dropAclPolicies(server string) {
+	policies, err := config.ReadAclPolicies()
+	if err != nil {
+		slog.Error("failed to read acl policies", "error", err)
+		return
+	}
+	changed := false
+	for network, policy := range policies {
+		if policy.Server == server {
+			delete(policies, network)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := config.WriteAclPolicies(policies); err != nil {
+		slog.Error("failed to drop acl policies", "server", server, "error", err)
+	}
+	forgetAclPolicies()
+}
+
+// dropAclPolicy - discards the acl policy pushed for a network the host left
+func dropAclPolicy(network string) {
+	policies, err := config.ReadAclPolicies()
+	if err != nil {
+		slog.Error("failed to read acl policies", "error", err)
+		return
+	}
+	if _, ok := policies[network]; !ok {
+		return
+	}
+	delete(policies, network)
+	if err := config.WriteAclPolicies(policies); err != nil {
+		slog.Error("failed to drop acl policy", "network", network, "error", err)
+	}
+	forgetAclPolicies()
+}
+
+// forgetAclPolicies - discards the policies read before, the next apply reads acl.json and the local
+// policy files again
+func forgetAclPolicies() {
+	aclState.mutex.Lock()
+	defer aclState.mutex.Unlock()
+	aclState.pushed = nil
+	aclState.local = nil
+	aclState.synced = false
+}
+
+// aclNodes - returns a key of the networks, servers and ranges of the nodes, the policies and their
+// rules depend on them
+func aclNodes(nodes config.NodeMap) string {
+	key := []string{}
+	for network, node := range nodes {
+		key = append(key, strings.Join([]string{network, node.Server, node.NetworkRange.String(), node.NetworkRange6.String()}, " "))
+	}
+	sort.Strings(key)
+	return strings.Join(key, ",")
+}
+
+// aclPolicies - returns the policies of the networks of the nodes, a local file takes precedence over
+// the policy pushed by the server; the policies are read if they were not read before or the networks
+// changed, the caller holds the lock
+func aclPolicies(nodes config.NodeMap, key string) map[string]config.AclPolicy {
+	if aclState.pushed == nil {
+		pushed, err := config.ReadAclPolicies()
+		if err != nil {
+			slog.Error("failed to read acl policies", "error", err)
+		} else {
+			aclState.pushed = pushed
+		}
+	}
+	if aclState.local == nil || aclState.nodes != key {
+		local := make(map[string]config.AclPolicy)
+		for network := range nodes {
+			policy, err := config.ReadLocalAclPolicy(network)
+			if err != nil {
+				slog.Error("failed to read local acl policy", "network", network, "file", config.AclPolicyFile(network), "error", err)
+			}
+			if policy != nil {
+				local[network] = *policy
+			}
+		}
+		aclState.local = local
+	}
+	policies := make(map[string]config.AclPolicy)
+	for network, node := range nodes {
+		if policy, ok := aclState.local[network]; ok {
+			policies[network] = policy
+			continue
+		}
+		if policy, ok := aclState.pushed[network]; ok && policy.Server == node.Server {
+			policies[network] = policy
+		}
+	}
+	return policies
+}
+
+// applyAclPolicies - enforces the acl policies of the networks on the netmaker interface, the rules of
+// networks without a policy are removed; nothing is done if neither the policies, the nodes nor the dns
+// table changed since the last apply
+func applyAclPolicies() {
+	aclState.mutex.Lock()
+	defer aclState.mutex.Unlock()
+	nodes := config.GetNodes()
+	key := aclNodes(nodes)
+	dns := meshDNS.changes()
+	if aclState.synced && aclState.nodes == key && aclState.dns == dns {
+		return
+	}
+	policies := aclPolicies(nodes, key)
+	aclState.nodes = key
+	aclState.dns = dns
+	aclState.synced = aclState.pushed != nil
+	if runtime.GOOS != "linux" {
+		if len(policies) > 0 && !aclState.warned {
+			slog.Warn("acl policies are only enforced on linux")
+			aclState.warned = true
+		}
+		return
+	}
+	for network := range aclState.applied {
+		if _, ok := policies[network]; ok {
+			continue
+		}
+		if err := router.DeleteAclRules(network); err != nil {
+			slog.Error("failed to remove acl rules", "network", network, "error", err)
+			aclState.synced = false
+			continue
+		}
+		delete(aclState.applied, network)
+		slog.Info("removed acl policy", "network", network)
+		events.Publish(events.AclPolicyRemoved{Network: network})
+	}
+	for network, policy := range policies {
+		rules, err := resolveAclPolicy(policy, nodes[network])
+		if err != nil {
+			slog.Error("invalid acl policy", "network", network, "server", policy.Server, "error", err)
+			continue
+		}
+		if applied, ok := aclState.applied[network]; ok && reflect.DeepEqual(applied, rules) {
+			continue
+		}
+		if err := router.SetAclRules(network, rules); err != nil {
+			slog.Error("failed to set acl rules", "network", network, "error", err)
+			aclState.synced = false
+			continue
+		}
+		aclState.applied[network] = rules
+		source := "local"
+		if policy.Server != "" {
+			source = policy.Server
+		}
+		slog.Info("applied acl policy", "network", network, "source", source, "rules", len(rules))
+		events.Publish(events.AclPolicyApplied{Network: network, Source: source, Rules: len(rules)})
+	}
+}
+
+// closeAclPolicies - removes the acl rules and stops the firewall controller when the daemon stops
+func closeAclPolicies() {
+	aclState.mutex.Lock()
+	defer aclState.mutex.Unlock()
+	router.Stop()
+	aclState.applied = make(map[string][]router.AclRule)
+	aclState.synced = false
+}
+
+// resolveAclPolicy - returns the router rules of the policy for the node of its network, sources are
+// resolved to the addresses they name; names the dns table does not know yet match nothing
+func resolveAclPolicy(policy config.AclPolicy, node config.Node) ([]router.AclRule, error) {
+	ranges := []net.IPNet{}
+	for _, r := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+		if r.IP != nil && r.Mask != nil {
+			ranges = append(ranges, r)
+		}
+	}
+	rules := []router.AclRule{}
+	for i, rule := range policy.Rules {
+		var allow bool
+		switch rule.Action {
+		case config.AclAllow:
+			allow = true
+		case config.AclDeny:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %q", i, rule.Action)
+		}
+		sources := []net.IPNet{}
+		for _, source := range rule.Sources {
+			resolved, err := resolveAclSource(policy, source, ranges)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			sources = append(sources, resolved...)
+		}
+		ports, err := parseAclPorts(rule.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		protocols := rule.Protocols
+		if len(protocols) == 0 {
+			protocols = []string{""}
+			if len(ports) > 0 {
+				protocols = []string{router.AclProtocolTCP, router.AclProtocolUDP}
+			}
+		}
+		for _, protocol := range protocols {
+			protocol = strings.ToLower(protocol)
+			switch protocol {
+			case "", router.AclProtocolTCP, router.AclProtocolUDP:
+			case router.AclProtocolICMP:
+				if len(ports) > 0 {
+					return nil, fmt.Errorf("rule %d: ports need protocol tcp or udp", i)
+				}
+			default:
+				return nil, fmt.Errorf("rule %d: unknown protocol %q", i, protocol)
+			}
+			rules = append(rules, router.AclRule{Sources: sources, Protocol: protocol, Ports: ports, Allow: allow})
+		}
+	}
+	switch policy.DefaultAction {
+	case "", config.AclAllow:
+	case config.AclDeny:
+		rules = append(rules, router.AclRule{Sources: ranges, Allow: false})
+	default:
+		return nil, fmt.Errorf("unknown default action %q", policy.DefaultAction)
+	}
+	return rules, nil
+}
+
+// resolveAclSource - returns the networks a source of the policy names: * for the network ranges,
+// tag:<name> for the peers of a tag, an address, a network or the name of a peer of the network
+func resolveAclSource(policy config.AclPolicy, source string, ranges []net.IPNet) ([]net.IPNet, error) {
+	if source == "*" {
+		return ranges, nil
+	}
+	if strings.HasPrefix(source, aclPolicyTag) {
+		tag := strings.TrimPrefix(source, aclPolicyTag)
+		peers, ok := policy.Tags[tag]
+		if !ok {
+			return nil, fmt.Errorf("unknown tag %q", tag)
+		}
+		resolved := []net.IPNet{}
+		for _, peer := range peers {
+			if peer == "*" || strings.HasPrefix(peer, aclPolicyTag) {
+				return nil, fmt.Errorf("tag %q: tags hold peers, addresses or networks", tag)
+			}
+			nets, err := resolveAclSource(policy, peer, ranges)
+			if err != nil {
+				return nil, fmt.Errorf("tag %q: %w", tag, err)
+			}
+			resolved = append(resolved, nets...)
+		}
+		return resolved, nil
+	}
+	if _, cidr, err := net.ParseCIDR(source); err == nil {
+		return []net.IPNet{*cidr}, nil
+	}
+	if ip := net.ParseIP(source); ip != nil {
+		return []net.IPNet{hostNet(ip)}, nil
+	}
+	if source == "" || strings.ContainsAny(source, " /:") {
+		return nil, fmt.Errorf("invalid source %q", source)
+	}
+	name := dnsName(source)
+	if !strings.Contains(name, ".") && policy.Network != "" {
+		name += "." + dnsName(policy.Network)
+	}
+	resolved := []net.IPNet{}
+	for _, record := range meshDNS.list(DNSFilter{Network: policy.Network, Name: name}) {
+		for _, addr := range record.Addresses {
+			if ip := net.ParseIP(addr); ip != nil {
+				resolved = append(resolved, hostNet(ip))
+			}
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].String() < resolved[j].String() })
+	return resolved, nil
+}
+
+// hostNet - returns the network of the single address
+func hostNet(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// parseAclPorts - parses ports such as 22 and ranges such as 8000-8100
+func parseAclPorts(ports []string) ([]router.PortRange, error) {
+	ranges := []router.PortRange{}
+	for _, port := range ports {
+		from, to, isRange := strings.Cut(port, "-")
+		if !isRange {
+			to = from
+		}
+		first, err := strconv.ParseUint(strings.TrimSpace(from), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		last, err := strconv.ParseUint(strings.TrimSpace(to), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		if first == 0 || first > last {
+			return nil, fmt.Errorf("invalid port range %q", port)
+		}
+		ranges = append(ranges, router.PortRange{From: uint16(first), To: uint16(last)})
+	}
+	return ranges, nil
+}
@@ -0,0 +1,163 @@
+package functions
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/nmproxy/router"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+)
+
+func TestResolveAclPolicy(t *testing.T) {
+	config.Nodes = config.NodeMap{
+		"dev": config.Node{CommonNode: models.CommonNode{Network: "dev", Server: "server"}},
+	}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	meshDNS.replace("server", []models.DNSUpdate{
+		{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.2"},
+		{Action: models.DNSInsert, Name: "ci.dev", Address: "10.0.0.3"},
+	})
+	defer meshDNS.drop("server")
+	_, rangeV4, _ := net.ParseCIDR("10.0.0.0/16")
+	_, rangeV6, _ := net.ParseCIDR("fd00::/64")
+	node := config.Node{CommonNode: models.CommonNode{Network: "dev", NetworkRange: *rangeV4, NetworkRange6: *rangeV6}}
+	host := func(ip string) net.IPNet {
+		return hostNet(net.ParseIP(ip))
+	}
+
+	tests := []struct {
+		name   string
+		policy config.AclPolicy
+		want   []router.AclRule
+		err    bool
+	}{
+		{
+			name: "ports without protocol are tcp and udp",
+			policy: config.AclPolicy{Rules: []config.AclPolicyRule{
+				{Action: config.AclAllow, Sources: []string{"10.0.0.9"}, Ports: []string{"53"}},
+			}},
+			want: []router.AclRule{
+				{Sources: []net.IPNet{host("10.0.0.9")}, Protocol: router.AclProtocolTCP, Ports: []router.PortRange{{From: 53, To: 53}}, Allow: true},
+				{Sources: []net.IPNet{host("10.0.0.9")}, Protocol: router.AclProtocolUDP, Ports: []router.PortRange{{From: 53, To: 53}}, Allow: true},
+			},
+		},
+		{
+			name: "tags and names of peers",
+			policy: config.AclPolicy{
+				Network: "dev",
+				Tags:    map[string][]string{"ci": {"ci", "192.168.1.0/24"}},
+				Rules: []config.AclPolicyRule{
+					{Action: config.AclAllow, Sources: []string{"tag:ci", "web.dev"}, Protocols: []string{"tcp"}, Ports: []string{"22", "8000-8100"}},
+				},
+			},
+			want: []router.AclRule{
+				{
+					Sources:  []net.IPNet{host("10.0.0.3"), {IP: net.ParseIP("192.168.1.0").To4(), Mask: net.CIDRMask(24, 32)}, host("10.0.0.2")},
+					Protocol: router.AclProtocolTCP,
+					Ports:    []router.PortRange{{From: 22, To: 22}, {From: 8000, To: 8100}},
+					Allow:    true,
+				},
+			},
+		},
+		{
+			name: "default deny for the network ranges",
+			policy: config.AclPolicy{
+				DefaultAction: config.AclDeny,
+				Rules: []config.AclPolicyRule{
+					{Action: config.AclAllow, Sources: []string{"*"}, Protocols: []string{"icmp"}},
+				},
+			},
+			want: []router.AclRule{
+				{Sources: []net.IPNet{*rangeV4, *rangeV6}, Protocol: router.AclProtocolICMP, Ports: []router.PortRange{}, Allow: true},
+				{Sources: []net.IPNet{*rangeV4, *rangeV6}, Allow: false},
+			},
+		},
+		{
+			name: "unknown names match nothing",
+			policy: config.AclPolicy{Network: "dev", Rules: []config.AclPolicyRule{
+				{Action: config.AclDeny, Sources: []string{"db"}},
+			}},
+			want: []router.AclRule{{Sources: []net.IPNet{}, Ports: []router.PortRange{}}},
+		},
+		{
+			name:   "unknown action",
+			policy: config.AclPolicy{Rules: []config.AclPolicyRule{{Action: "accept", Sources: []string{"*"}}}},
+			err:    true,
+		},
+		{
+			name:   "unknown tag",
+			policy: config.AclPolicy{Rules: []config.AclPolicyRule{{Action: config.AclAllow, Sources: []string{"tag:db"}}}},
+			err:    true,
+		},
+		{
+			name: "ports of icmp",
+			policy: config.AclPolicy{Rules: []config.AclPolicyRule{
+				{Action: config.AclAllow, Sources: []string{"*"}, Protocols: []string{"icmp"}, Ports: []string{"22"}},
+			}},
+			err: true,
+		},
+		{
+			name: "invalid port range",
+			policy: config.AclPolicy{Rules: []config.AclPolicyRule{
+				{Action: config.AclAllow, Sources: []string{"*"}, Ports: []string{"8100-8000"}},
+			}},
+			err: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			rules, err := resolveAclPolicy(tt.policy, node)
+			if tt.err {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(rules, tt.want)
+		})
+	}
+}
+
+func TestAclPolicies(t *testing.T) {
+	nodes := config.NodeMap{
+		"dev":  config.Node{CommonNode: models.CommonNode{Network: "dev", Server: "server"}},
+		"prod": config.Node{CommonNode: models.CommonNode{Network: "prod", Server: "server"}},
+	}
+	defer forgetAclPolicies()
+	aclState.mutex.Lock()
+	defer aclState.mutex.Unlock()
+	// the policies read before are used, acl.json is not read again
+	aclState.pushed = map[string]config.AclPolicy{
+		"dev":  {Network: "dev", Server: "server", DefaultAction: config.AclDeny},
+		"prod": {Network: "prod", Server: "other"},
+		"test": {Network: "test", Server: "server"},
+	}
+	aclState.local = map[string]config.AclPolicy{}
+	key := aclNodes(nodes)
+	aclState.nodes = key
+
+	t.Run("pushed policies of the servers of the nodes", func(t *testing.T) {
+		is := is.New(t)
+		is.Equal(aclPolicies(nodes, key), map[string]config.AclPolicy{
+			"dev": {Network: "dev", Server: "server", DefaultAction: config.AclDeny},
+		})
+	})
+	t.Run("local policies take precedence", func(t *testing.T) {
+		is := is.New(t)
+		aclState.local = map[string]config.AclPolicy{"dev": {Network: "dev"}}
+		defer func() { aclState.local = map[string]config.AclPolicy{} }()
+		is.Equal(aclPolicies(nodes, key), map[string]config.AclPolicy{"dev": {Network: "dev"}})
+	})
+	t.Run("key of the nodes", func(t *testing.T) {
+		is := is.New(t)
+		_, cidr, _ := net.ParseCIDR("10.0.0.0/16")
+		changed := config.NodeMap{"dev": nodes["dev"], "prod": nodes["prod"]}
+		is.Equal(aclNodes(changed), key)
+		dev := changed["dev"]
+		dev.NetworkRange = *cidr
+		changed["dev"] = dev
+		is.True(aclNodes(changed) != key)
+	})
+}
@@ -0,0 +1,153 @@
+package functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gravitl/netclient/config"
+)
+
+// legacyNetwork - node of the host in a network together with its server, in the form
+// of the unversioned api
+type legacyNetwork struct {
+	Node   config.Node
+	Server config.Server
+}
+
+// legacyRoutes - sets the unversioned routes of existing clients as aliases of the versioned
+// routes, their responses are converted to the bodies of the unversioned api
+func legacyRoutes(router *gin.Engine, routes []apiRoute) {
+	for _, route := range routes {
+		method, path, ok := strings.Cut(route.Legacy, " ")
+		if !ok {
+			continue
+		}
+		if route.Stream {
+			router.Handle(method, path, routeHandlers(route)...)
+			continue
+		}
+		handlers := []gin.HandlerFunc{legacyResponse(route.LegacyBody)}
+		if route.Token {
+			handlers = append(handlers, requireToken)
+		}
+		if route.LegacyRequest != nil {
+			handlers = append(handlers, route.LegacyRequest)
+		}
+		router.Handle(method, path, append(handlers, route.Handler)...)
+	}
+}
+
+// legacyWriter - holds back the response of a versioned handler until it is converted
+type legacyWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *legacyWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *legacyWriter) WriteHeaderNow() {}
+
+func (w *legacyWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *legacyWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *legacyWriter) Status() int {
+	return w.status
+}
+
+func (w *legacyWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *legacyWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// legacyResponse - middleware converting the response of the versioned handler to the unversioned api:
+// errors are answered with {"error": message}, empty responses with 200 and null and
+// successful bodies with the converter of the route
+func legacyResponse(convert func(body []byte) (any, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := c.Writer
+		held := &legacyWriter{ResponseWriter: writer, status: http.StatusOK}
+		c.Writer = held
+		c.Next()
+		c.Writer = writer
+		body := held.body.Bytes()
+		switch {
+		case held.status >= http.StatusBadRequest:
+			c.JSON(held.status, gin.H{"error": legacyError(body)})
+		case len(body) == 0:
+			c.JSON(http.StatusOK, nil)
+		case convert == nil:
+			c.Data(held.status, "application/json; charset=utf-8", body)
+		default:
+			legacy, err := convert(body)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(held.status, legacy)
+		}
+	}
+}
+
+// legacyError - message of an error envelope with its details, in the form of the unversioned api
+func legacyError(body []byte) string {
+	var response ErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return string(body)
+	}
+	return strings.Join(append([]string{response.Error.Message}, response.Error.Details...), ": ")
+}
+
+// legacyBody - returns a converter of a response body of type T to its unversioned form
+func legacyBody[T any](convert func(T) any) func(body []byte) (any, error) {
+	return func(body []byte) (any, error) {
+		var response T
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+		return convert(response), nil
+	}
+}
+
+var (
+	// legacyStatusBody - the unversioned status only tells that the daemon answers
+	legacyStatusBody = legacyBody(func(StatusResponse) any {
+		return gin.H{"status": "ok"}
+	})
+	legacyNetworkBody = legacyBody(func(network Network) any {
+		return legacyNetwork{network.Node, network.Server}
+	})
+	legacyNetworksBody = legacyBody(func(networks []Network) any {
+		legacy := []legacyNetwork{}
+		for _, network := range networks {
+			legacy = append(legacy, legacyNetwork{network.Node, network.Server})
+		}
+		return legacy
+	})
+	legacyServersBody = legacyBody(func(list ServerList) any {
+		return struct{ Name []string }{list.Names}
+	})
+)
+
+// legacyNodePeersRequest - the unversioned api posts the node instead of naming its network
+func legacyNodePeersRequest(c *gin.Context) {
+	var node config.Node
+	if !bindRequest(c, &node) {
+		return
+	}
+	c.Params = append(c.Params, gin.Param{Key: "net", Value: node.Network})
+	c.Next()
+}
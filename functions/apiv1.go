@@ -0,0 +1,513 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/nmproxy/router"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// APIVersionPath - path prefix of the versioned local api
+const APIVersionPath = "/api/v1"
+
+// ErrorCode - machine readable code of an api error
+type ErrorCode string
+
+const (
+	// ErrBadRequest - the request could not be parsed or is invalid
+	ErrBadRequest ErrorCode = "bad_request"
+	// ErrUnauthorized - the bearer token is missing or invalid
+	ErrUnauthorized ErrorCode = "unauthorized"
+	// ErrNotFound - the route does not exist
+	ErrNotFound ErrorCode = "not_found"
+	// ErrNetworkNotFound - the host has no node in the network
+	ErrNetworkNotFound ErrorCode = "network_not_found"
+	// ErrServerNotFound - the server of a node is not configured
+	ErrServerNotFound ErrorCode = "server_not_found"
+	// ErrPlanNotFound - there is no pending plan for the server
+	ErrPlanNotFound ErrorCode = "plan_not_found"
+	// ErrRotationPending - a key rotation of the same kind is already waiting for the servers
+	ErrRotationPending ErrorCode = "key_rotation_pending"
+	// ErrRotationDisabled - the key rotation is not enabled in the key rotation policy
+	ErrRotationDisabled ErrorCode = "key_rotation_disabled"
+	// ErrFirewallUnavailable - the firewall controller is not running
+	ErrFirewallUnavailable ErrorCode = "firewall_unavailable"
+	// ErrUpstream - the netmaker server could not be reached or returned an error
+	ErrUpstream ErrorCode = "upstream_error"
+	// ErrInternal - the request failed in the daemon
+	ErrInternal ErrorCode = "internal_error"
+)
+
+// APIError - error returned by the local api
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details []string  `json:"details,omitempty"`
+}
+
+// ErrorResponse - envelope of all error responses of the local api
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// StatusResponse - status of the daemon
+type StatusResponse struct {
+	Status          string         `json:"status"`
+	Version         string         `json:"version"`
+	Daemon          bool           `json:"daemon"`
+	Error           string         `json:"error,omitempty"`
+	Host            string         `json:"host"`
+	CurrentServer   string         `json:"current_server"`
+	NatType         string         `json:"nat_type,omitempty"`
+	ProxyEnabled    bool           `json:"proxy_enabled"`
+	ProxyRunning    bool           `json:"proxy_running"`
+	Firewall        bool           `json:"firewall"`
+	FirewallBackend string         `json:"firewall_backend,omitempty"`
+	Servers         []ServerStatus `json:"servers"`
+}
+
+// Network - node of the host in a network together with its server
+type Network struct {
+	Node   config.Node   `json:"node"`
+	Server config.Server `json:"server"`
+}
+
+// RegisterRequest - registers the host with an enrollment key
+type RegisterRequest struct {
+	Token string `json:"token"`
+}
+
+// ConnectRequest - connects or disconnects the node of a network
+type ConnectRequest struct {
+	Connect bool `json:"connect"`
+}
+
+// ServerList - names of the servers the host is registered with
+type ServerList struct {
+	Names []string `json:"names"`
+}
+
+// SSOResponse - endpoint the user has to open to finish an sso registration
+type SSOResponse struct {
+	AuthEndpoint string `json:"authendpoint"`
+}
+
+// apiRoute - route of the versioned local api, also describes the route in the openapi document
+type apiRoute struct {
+	Method   string
+	Path     string // relative to APIVersionPath, gin syntax
+	Summary  string
+	Request  any // request body type, nil if the route takes no body
+	Response any // response body type, nil for 204 responses
+	Stream   bool
+	Token    bool // route requires the bearer token, also on the socket
+	Handler  gin.HandlerFunc
+	// Legacy - "METHOD /path" of the unversioned api of existing clients serving the route, empty if none
+	Legacy string
+	// LegacyRequest - adapts a request of the unversioned api to the route, nil if it is the same
+	LegacyRequest gin.HandlerFunc
+	// LegacyBody - converts a successful response to the unversioned body, nil if it is the same
+	LegacyBody func(body []byte) (any, error)
+}
+
+// apiRoutes - routes of the versioned local api
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/status", Summary: "status of the daemon", Response: StatusResponse{}, Handler: status, Legacy: "GET /status", LegacyBody: legacyStatusBody},
+		{Method: http.MethodPost, Path: "/register", Summary: "register the host with an enrollment key", Request: RegisterRequest{}, Token: true, Handler: register, Legacy: "POST /register"},
+		{Method: http.MethodGet, Path: "/networks", Summary: "all networks of the host", Response: []Network{}, Handler: getAllNetworks, Legacy: "GET /allnetworks", LegacyBody: legacyNetworksBody},
+		{Method: http.MethodGet, Path: "/networks/:net", Summary: "a network of the host", Response: Network{}, Handler: getNetwork, Legacy: "GET /network/:net", LegacyBody: legacyNetworkBody},
+		{Method: http.MethodPost, Path: "/networks/:net/connect", Summary: "connect or disconnect the node of a network", Request: ConnectRequest{}, Handler: connect, Legacy: "POST /connect/:net"},
+		{Method: http.MethodPost, Path: "/networks/:net/leave", Summary: "leave a network", Token: true, Handler: leave, Legacy: "POST /leave/:net"},
+		{Method: http.MethodPost, Path: "/networks/:net/pull", Summary: "pull the latest configuration from the servers", Response: Network{}, Handler: pull, Legacy: "GET /pull/:net", LegacyBody: legacyNetworkBody},
+		{Method: http.MethodGet, Path: "/networks/:net/peers", Summary: "peers of the node of a network", Response: []wgtypes.PeerConfig{}, Handler: getNetworkPeers, Legacy: "POST /nodepeers", LegacyRequest: legacyNodePeersRequest},
+		{Method: http.MethodGet, Path: "/peers", Summary: "live state of the peers on the netmaker interface", Response: []PeerStatus{}, Handler: getPeers, Legacy: "GET /peers"},
+		{Method: http.MethodGet, Path: "/netclient", Summary: "host configuration", Response: config.Config{}, Handler: getNetclient, Legacy: "GET /netclient"},
+		{Method: http.MethodGet, Path: "/servers", Summary: "servers the host is registered with", Response: ServerList{}, Handler: servers, Legacy: "GET /servers", LegacyBody: legacyServersBody},
+		{Method: http.MethodGet, Path: "/brokers", Summary: "broker connection status per server", Response: []BrokerStatus{}, Handler: brokers, Legacy: "GET /brokers"},
+		{Method: http.MethodGet, Path: "/events", Summary: "stream of daemon events, filtered by the comma separated names query parameter", Response: events.Envelope{}, Stream: true, Handler: streamEvents, Legacy: "GET /events"},
+		{Method: http.MethodPost, Path: "/uninstall", Summary: "leave all networks and remove netclient", Token: true, Handler: uninstall, Legacy: "POST /uninstall"},
+		{Method: http.MethodPost, Path: "/join", Summary: "join a network with user credentials", Request: RegisterSSO{}, Token: true, Handler: join, Legacy: "POST /join"},
+		{Method: http.MethodPost, Path: "/sso", Summary: "start an sso registration", Request: RegisterSSO{}, Response: SSOResponse{}, Token: true, Handler: sso, Legacy: "POST /sso"},
+		{Method: http.MethodGet, Path: "/plans", Summary: "pending plans of updates waiting for approval", Response: []config.Plan{}, Handler: getPlans},
+		{Method: http.MethodGet, Path: "/plans/:server", Summary: "pending plan of a server", Response: config.Plan{}, Handler: getPlan},
+		{Method: http.MethodPost, Path: "/plans/:server/approve", Summary: "apply the pending plan of a server", Token: true, Handler: approvePlan},
+		{Method: http.MethodDelete, Path: "/plans/:server", Summary: "discard the pending plan of a server", Token: true, Handler: discardPlan},
+		{Method: http.MethodGet, Path: "/planmode", Summary: "plan mode settings", Response: PlanSettings{}, Handler: getPlanMode},
+		{Method: http.MethodPut, Path: "/planmode", Summary: "update the plan mode settings, turning plan mode off applies the pending plans", Request: PlanSettings{}, Response: PlanSettings{}, Token: true, Handler: setPlanMode},
+		{Method: http.MethodGet, Path: "/keys/rotation", Summary: "state of the wireguard key rotation", Response: KeyRotationStatus{}, Handler: getKeyRotation},
+		{Method: http.MethodPost, Path: "/keys/rotate", Summary: "advertise a new wireguard key and switch to it once the servers acknowledged it", Response: KeyRotationStatus{}, Token: true, Handler: rotateKeys},
+		{Method: http.MethodGet, Path: "/keys/traffic", Summary: "state of the traffic key rotation", Response: TrafficKeyStatus{}, Handler: getTrafficKeys},
+		{Method: http.MethodPost, Path: "/keys/traffic/rotate", Summary: "advertise a new traffic key for mq messages, the old key is accepted during a grace window", Response: TrafficKeyStatus{}, Token: true, Handler: rotateTrafficKeys},
+		{Method: http.MethodGet, Path: "/dns", Summary: "records of the dns table, filtered by the network, server and name query parameters", Response: []DNSRecord{}, Handler: getDNS},
+		{Method: http.MethodGet, Path: "/firewall", Summary: "netmaker chains, rule ownership map, drift against the kernel and repair counters, filtered by the server query parameter, format=nft adds the chains in nft syntax", Response: router.Ruleset{}, Handler: getFirewall},
+		{Method: http.MethodGet, Path: "/replay", Summary: "messages accepted and rejected as replays per server and topic", Response: []ReplayCounters{}, Handler: getReplayCounters},
+		{Method: http.MethodPost, Path: "/reload", Summary: "apply the config on disk in place, keeping the interface and unchanged peers up", Request: ReloadRequest{}, Response: ReloadResponse{}, Token: true, Handler: reloadConfig},
+	}
+}
+
+// apiError - aborts the request with the error envelope
+func apiError(c *gin.Context, status int, code ErrorCode, message string, details ...string) {
+	c.AbortWithStatusJSON(status, ErrorResponse{
+		Error: APIError{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// bindRequest - decodes the json body of the request, aborts with a bad request error on failure
+func bindRequest(c *gin.Context, request any) bool {
+	if err := c.ShouldBindJSON(request); err != nil {
+		apiError(c, http.StatusBadRequest, ErrBadRequest, "invalid request body", err.Error())
+		return false
+	}
+	return true
+}
+
+// errorDetails - converts errors to the details of an api error
+func errorDetails(errs []error) []string {
+	details := []string{}
+	for _, err := range errs {
+		details = append(details, err.Error())
+	}
+	return details
+}
+
+// getNetworkConfig - returns the node and server of a network, aborts the request if there is none
+func getNetworkConfig(c *gin.Context, network string) (Network, bool) {
+	node, ok := config.GetNodes()[network]
+	if !ok {
+		apiError(c, http.StatusNotFound, ErrNetworkNotFound, "unknown network "+network)
+		return Network{}, false
+	}
+	server := config.GetServer(node.Server)
+	if server == nil {
+		apiError(c, http.StatusInternalServerError, ErrServerNotFound, "server config not found for "+node.Server)
+		return Network{}, false
+	}
+	return Network{Node: node, Server: *server}, true
+}
+
+func status(c *gin.Context) {
+	c.JSON(http.StatusOK, GetStatus())
+}
+
+func register(c *gin.Context) {
+	var request RegisterRequest
+	if !bindRequest(c, &request) {
+		return
+	}
+	if err := Register(request.Token); err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "registration failed", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func getNetwork(c *gin.Context) {
+	network, ok := getNetworkConfig(c, c.Param("net"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, network)
+}
+
+func getAllNetworks(c *gin.Context) {
+	names := []string{}
+	for name := range config.GetNodes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	networks := []Network{}
+	for _, name := range names {
+		network, ok := getNetworkConfig(c, name)
+		if !ok {
+			return
+		}
+		networks = append(networks, network)
+	}
+	c.JSON(http.StatusOK, networks)
+}
+
+func getNetclient(c *gin.Context) {
+	conf, err := config.ReadNetclientConfig()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "unable to read netclient config", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, conf)
+}
+
+func connect(c *gin.Context) {
+	var request ConnectRequest
+	if !bindRequest(c, &request) {
+		return
+	}
+	network, ok := getNetworkConfig(c, c.Param("net"))
+	if !ok {
+		return
+	}
+	if request.Connect {
+		if err := Connect(network.Node.Network); err != nil {
+			apiError(c, http.StatusInternalServerError, ErrInternal, "failed to connect", err.Error())
+			return
+		}
+	} else {
+		if err := Disconnect(network.Node.Network); err != nil {
+			apiError(c, http.StatusInternalServerError, ErrInternal, "failed to disconnect", err.Error())
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func leave(c *gin.Context) {
+	network, ok := getNetworkConfig(c, c.Param("net"))
+	if !ok {
+		return
+	}
+	if errs, err := LeaveNetwork(network.Node.Network, true); err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, err.Error(), errorDetails(errs)...)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func pull(c *gin.Context) {
+	if _, ok := getNetworkConfig(c, c.Param("net")); !ok {
+		return
+	}
+	if err := Pull(true); err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "failed to pull", err.Error())
+		return
+	}
+	network, ok := getNetworkConfig(c, c.Param("net"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, network)
+}
+
+func getNetworkPeers(c *gin.Context) {
+	network, ok := getNetworkConfig(c, c.Param("net"))
+	if !ok {
+		return
+	}
+	peers, err := GetNodePeers(network.Node)
+	if err != nil {
+		apiError(c, http.StatusBadGateway, ErrUpstream, "failed to get peers", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, peers)
+}
+
+func getPeers(c *gin.Context) {
+	peers, err := GetPeerStatuses()
+	if err != nil {
+		apiError(c, http.StatusServiceUnavailable, ErrInternal, "failed to read interface peers", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, peers)
+}
+
+func servers(c *gin.Context) {
+	list := ServerList{Names: []string{}}
+	for name := range config.GetServerMap() {
+		list.Names = append(list.Names, name)
+	}
+	sort.Strings(list.Names)
+	c.JSON(http.StatusOK, list)
+}
+
+func brokers(c *gin.Context) {
+	c.JSON(http.StatusOK, GetBrokerStatuses())
+}
+
+func uninstall(c *gin.Context) {
+	if errs, err := Uninstall(); err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, err.Error(), errorDetails(errs)...)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func join(c *gin.Context) {
+	request := RegisterSSO{}
+	if !bindRequest(c, &request) {
+		return
+	}
+	if err := RegisterWithSSO(&request); err != nil {
+		apiError(c, http.StatusBadGateway, ErrUpstream, "failed to join", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func getPlans(c *gin.Context) {
+	plans, err := GetPlans()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "failed to read plans", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// planError - aborts the request with the error of a plan operation
+func planError(c *gin.Context, server string, err error) {
+	if errors.Is(err, config.ErrNoPlan) {
+		apiError(c, http.StatusNotFound, ErrPlanNotFound, "no pending plan for server "+server)
+		return
+	}
+	apiError(c, http.StatusInternalServerError, ErrInternal, "plan operation failed", err.Error())
+}
+
+func getPlan(c *gin.Context) {
+	plan, err := config.GetPlan(c.Param("server"))
+	if err != nil {
+		planError(c, c.Param("server"), err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+func approvePlan(c *gin.Context) {
+	if err := ApprovePlan(c.Param("server")); err != nil {
+		planError(c, c.Param("server"), err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func discardPlan(c *gin.Context) {
+	if err := DiscardPlan(c.Param("server")); err != nil {
+		planError(c, c.Param("server"), err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func getPlanMode(c *gin.Context) {
+	c.JSON(http.StatusOK, GetPlanSettings())
+}
+
+func setPlanMode(c *gin.Context) {
+	var request PlanSettings
+	if !bindRequest(c, &request) {
+		return
+	}
+	for _, network := range request.AutoApply {
+		if _, ok := config.GetNodes()[network]; !ok {
+			apiError(c, http.StatusNotFound, ErrNetworkNotFound, "unknown network "+network)
+			return
+		}
+	}
+	if errs, err := SetPlanSettings(request); err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "failed to update plan mode", append([]string{err.Error()}, errorDetails(errs)...)...)
+		return
+	}
+	c.JSON(http.StatusOK, GetPlanSettings())
+}
+
+func getKeyRotation(c *gin.Context) {
+	c.JSON(http.StatusOK, GetKeyRotationStatus())
+}
+
+func rotateKeys(c *gin.Context) {
+	status, err := RotateKeys()
+	if err != nil {
+		if errors.Is(err, ErrKeyRotationPending) {
+			apiError(c, http.StatusConflict, ErrRotationPending, err.Error())
+			return
+		}
+		apiError(c, http.StatusInternalServerError, ErrInternal, "failed to rotate keys", err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, status)
+}
+
+func getTrafficKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, GetTrafficKeyStatus())
+}
+
+func getDNS(c *gin.Context) {
+	var filter DNSFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		apiError(c, http.StatusBadRequest, ErrBadRequest, "invalid query", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, GetDNSRecords(filter))
+}
+
+func getReplayCounters(c *gin.Context) {
+	c.JSON(http.StatusOK, GetReplayCounters())
+}
+
+func getFirewall(c *gin.Context) {
+	var filter FirewallFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		apiError(c, http.StatusBadRequest, ErrBadRequest, "invalid query", err.Error())
+		return
+	}
+	if filter.Format != "" && filter.Format != "nft" {
+		apiError(c, http.StatusBadRequest, ErrBadRequest, "invalid format", filter.Format)
+		return
+	}
+	ruleset, err := GetFirewallRules(filter)
+	if errors.Is(err, router.ErrFirewallNotInitialised) {
+		apiError(c, http.StatusConflict, ErrFirewallUnavailable, err.Error(), "the host is not a gateway and no network has an acl policy")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "failed to inspect firewall", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ruleset)
+}
+
+func rotateTrafficKeys(c *gin.Context) {
+	status, err := RotateTrafficKeys()
+	if err != nil {
+		if errors.Is(err, ErrTrafficKeyRotationPending) {
+			apiError(c, http.StatusConflict, ErrRotationPending, err.Error())
+			return
+		}
+		if errors.Is(err, ErrTrafficKeyRotationDisabled) {
+			apiError(c, http.StatusForbidden, ErrRotationDisabled, err.Error())
+			return
+		}
+		apiError(c, http.StatusInternalServerError, ErrInternal, "failed to rotate traffic keys", err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, status)
+}
+
+func reloadConfig(c *gin.Context) {
+	var request ReloadRequest
+	if c.Request.ContentLength != 0 && !bindRequest(c, &request) {
+		return
+	}
+	changes, err := Reload(request.Full)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, ErrInternal, "reload failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ReloadResponse{Changes: changes})
+}
+
+// getOpenAPI - serves the openapi document of the versioned api
+func getOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPIDocument(apiRoutes()))
+}
+
+// noRoute - error envelope for unknown routes
+func noRoute(c *gin.Context) {
+	apiError(c, http.StatusNotFound, ErrNotFound, fmt.Sprintf("no route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
@@ -0,0 +1,133 @@
+package functions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+)
+
+// testRouter - returns the router of the local api with a node in network dev of server
+// and a node in network orphan whose server is not configured
+func testRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	config.Nodes = config.NodeMap{
+		"dev":    config.Node{CommonNode: models.CommonNode{Network: "dev", Server: "server"}},
+		"orphan": config.Node{CommonNode: models.CommonNode{Network: "orphan", Server: "gone"}},
+	}
+	config.Servers = map[string]config.Server{"server": {Name: "server"}}
+	t.Cleanup(func() {
+		config.Nodes = make(config.NodeMap)
+		config.Servers = make(map[string]config.Server)
+	})
+	return SetupRouter()
+}
+
+// serve - sends the request to the router and returns the response
+func serve(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestAPIErrors(t *testing.T) {
+	router := testRouter(t)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{name: "unknown route", method: http.MethodGet, path: "/api/v1/nope", status: http.StatusNotFound, code: ErrNotFound},
+		{name: "unknown network", method: http.MethodGet, path: "/api/v1/networks/prod", status: http.StatusNotFound, code: ErrNetworkNotFound},
+		{name: "server not configured", method: http.MethodGet, path: "/api/v1/networks/orphan", status: http.StatusInternalServerError, code: ErrServerNotFound},
+		{name: "invalid body", method: http.MethodPost, path: "/api/v1/networks/dev/connect", body: "{", status: http.StatusBadRequest, code: ErrBadRequest},
+		{name: "missing token", method: http.MethodPost, path: "/api/v1/networks/dev/leave", status: http.StatusUnauthorized, code: ErrUnauthorized},
+		{name: "invalid query", method: http.MethodGet, path: "/api/v1/firewall?format=iptables", status: http.StatusBadRequest, code: ErrBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			w := serve(router, tt.method, tt.path, tt.body)
+			is.Equal(w.Code, tt.status)
+			is.True(strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"))
+			var response ErrorResponse
+			is.NoErr(json.Unmarshal(w.Body.Bytes(), &response))
+			is.Equal(response.Error.Code, tt.code)
+			is.True(response.Error.Message != "")
+		})
+	}
+}
+
+func TestOpenAPIRoute(t *testing.T) {
+	is := is.New(t)
+	router := testRouter(t)
+	w := serve(router, http.MethodGet, "/api/v1/openapi.json", "")
+	is.Equal(w.Code, http.StatusOK)
+	var doc OpenAPI
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &doc))
+	is.Equal(doc.OpenAPI, "3.0.3")
+	is.Equal(doc.Info.Version, config.Version)
+	// every route of the versioned api is documented with the error envelope
+	for _, route := range apiRoutes() {
+		path := APIVersionPath + route.Path
+		for _, segment := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				path = strings.Replace(path, segment, "{"+strings.TrimPrefix(segment, ":")+"}", 1)
+			}
+		}
+		op, ok := doc.Paths[path][strings.ToLower(route.Method)]
+		is.True(ok)
+		_, ok = op.Responses["default"]
+		is.True(ok)
+		is.Equal(len(op.Security) > 0, route.Token)
+	}
+	_, ok := doc.Components.Schemas["functions.ErrorResponse"]
+	is.True(ok)
+}
+
+func TestLegacyRoutes(t *testing.T) {
+	router := testRouter(t)
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		request string
+		status  int
+		body    string
+	}{
+		{name: "status", method: http.MethodGet, path: "/status", status: http.StatusOK, body: `{"status":"ok"}`},
+		{name: "servers", method: http.MethodGet, path: "/servers", status: http.StatusOK, body: `{"Name":["server"]}`},
+		{name: "unknown network", method: http.MethodGet, path: "/network/prod", status: http.StatusNotFound, body: `{"error":"unknown network prod"}`},
+		{name: "server not configured", method: http.MethodGet, path: "/network/orphan", status: http.StatusInternalServerError, body: `{"error":"server config not found for gone"}`},
+		{name: "invalid body", method: http.MethodPost, path: "/connect/dev", status: http.StatusBadRequest, body: `{"error":"invalid request body: EOF"}`},
+		{name: "missing token", method: http.MethodPost, path: "/leave/dev", status: http.StatusUnauthorized, body: `{"error":"missing or invalid bearer token"}`},
+		{name: "node peers of an unknown network", method: http.MethodPost, path: "/nodepeers", request: `{"network":"prod"}`, status: http.StatusNotFound, body: `{"error":"unknown network prod"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			w := serve(router, tt.method, tt.path, tt.request)
+			is.Equal(w.Code, tt.status)
+			is.Equal(w.Body.String(), tt.body)
+		})
+	}
+	t.Run("network in the unversioned form", func(t *testing.T) {
+		is := is.New(t)
+		w := serve(router, http.MethodGet, "/network/dev", "")
+		is.Equal(w.Code, http.StatusOK)
+		var network map[string]json.RawMessage
+		is.NoErr(json.Unmarshal(w.Body.Bytes(), &network))
+		_, hasNode := network["Node"]
+		_, hasServer := network["Server"]
+		is.True(hasNode && hasServer)
+	})
+}
@@ -30,11 +30,12 @@ func Disconnect(network string) error {
 	if err := setupMQTTSingleton(server, true); err != nil {
 		return err
 	}
+	defer closeMQTTSingleton(server.Name)
 	if err := PublishNodeUpdate(&node); err != nil {
 		return err
 	}
-	if err := daemon.Restart(); err != nil {
-		fmt.Println("daemon restart failed", err)
+	if err := reloadDaemon(); err != nil {
+		fmt.Println("daemon reload failed", err)
 		if err := daemon.Start(); err != nil {
 			fmt.Println("daemon failed to start", err)
 		}
@@ -64,10 +65,11 @@ func Connect(network string) error {
 	if err := setupMQTTSingleton(server, true); err != nil {
 		return err
 	}
+	defer closeMQTTSingleton(server.Name)
 	if err := PublishNodeUpdate(&node); err != nil {
 		return err
 	}
-	if err := daemon.Restart(); err != nil {
+	if err := reloadDaemon(); err != nil {
 		if err := daemon.Start(); err != nil {
 			return fmt.Errorf("daemon restart failed %w", err)
 		}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 
 	"github.com/gravitl/netclient/config"
-	"github.com/gravitl/netclient/daemon"
-	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // SwitchServer - switches netclient server context
+// the daemon is connected to all servers, the context only sets the server
+// used by default for display and cli operations
 func SwitchServer(server string) error {
 	fmt.Println("setting netclient server context to " + server)
 	if config.GetServer(server) == nil {
@@ -28,7 +28,6 @@ func SwitchServer(server string) error {
 		fmt.Println("failed to set server context ", err)
 		return err
 	}
-	config.Netclient().HostPeers = []wgtypes.PeerConfig{}
-	_ = config.WriteNetclientConfig()
-	return daemon.Restart()
+	config.CurrServer = server
+	return nil
 }
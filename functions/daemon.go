@@ -13,7 +13,8 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gravitl/netclient/config"
-	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/hooks"
 	"github.com/gravitl/netclient/local"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netclient/networking"
@@ -25,9 +26,7 @@ import (
 	"github.com/gravitl/netclient/wireguard"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
-	"github.com/gravitl/netmaker/mq"
 	"golang.org/x/exp/slog"
-	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 const (
@@ -37,7 +36,6 @@ const (
 )
 
 var (
-	Mqclient         mqtt.Client
 	messageCache     = new(sync.Map)
 	ProxyManagerChan = make(chan *models.HostPeerUpdate, 50)
 	hostNatInfo      *ncmodels.HostInfo
@@ -52,6 +50,7 @@ func startProxy(wg *sync.WaitGroup) context.CancelFunc {
 	ctx, cancel := context.WithCancel(context.Background())
 	wg.Add(1)
 	go nmproxy.Start(ctx, wg, ProxyManagerChan, hostNatInfo)
+	go waitProxySnapshot(ctx)
 	return cancel
 }
 
@@ -70,6 +69,11 @@ func Daemon() {
 	reset := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
 	signal.Notify(reset, syscall.SIGHUP)
+	reload := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		// an empty list would relay every signal
+		signal.Notify(reload, reloadSignals...)
+	}
 
 	cancel := startGoRoutines(&wg)
 	stopProxy := startProxy(&wg)
@@ -78,6 +82,7 @@ func Daemon() {
 	httpWg := sync.WaitGroup{}
 	httpWg.Add(1)
 	go HttpServer(httpctx, &httpWg)
+	daemonRunning.Store(true)
 	for {
 		select {
 		case <-quit:
@@ -85,35 +90,52 @@ func Daemon() {
 			closeRoutines([]context.CancelFunc{
 				cancel,
 				stopProxy,
-			}, &wg)
+			}, &wg, "daemon stopped")
 			httpCancel()
 			httpWg.Wait()
 			slog.Info("shutdown complete")
 			return
 		case <-reset:
 			slog.Info("received reset")
-			closeRoutines([]context.CancelFunc{
-				cancel,
-				stopProxy,
-			}, &wg)
-			slog.Info("resetting daemon")
-			cleanUpRoutes()
-			cancel = startGoRoutines(&wg)
-			if !proxy_cfg.GetCfg().ProxyStatus {
-				stopProxy = startProxy(&wg)
-			}
+			cancel, stopProxy = resetDaemon(&wg, cancel, stopProxy)
+		case <-reload:
+			slog.Info("received reload signal")
+			cancel, stopProxy = runReload(&wg, reloadRequest{readConfig: true}, cancel, stopProxy)
+		case request := <-reloadChan:
+			cancel, stopProxy = runReload(&wg, request, cancel, stopProxy)
 		}
 	}
 }
 
-func closeRoutines(closers []context.CancelFunc, wg *sync.WaitGroup) {
+// resetDaemon - stops all routines and the interface and starts them again from the config on disk
+func resetDaemon(wg *sync.WaitGroup, cancel, stopProxy context.CancelFunc) (context.CancelFunc, context.CancelFunc) {
+	closeRoutines([]context.CancelFunc{
+		cancel,
+		stopProxy,
+	}, wg, "daemon reset")
+	slog.Info("resetting daemon")
+	cleanUpRoutes()
+	cancel = startGoRoutines(wg)
+	if !proxy_cfg.GetCfg().ProxyStatus {
+		stopProxy = startProxy(wg)
+	}
+	events.Publish(events.DaemonReset{})
+	return cancel, stopProxy
+}
+
+func closeRoutines(closers []context.CancelFunc, wg *sync.WaitGroup, reason string) {
 	for i := range closers {
 		closers[i]()
 	}
-	if Mqclient != nil {
-		Mqclient.Disconnect(250)
+	for _, mq := range mqclients.all() {
+		mq.disconnect()
 	}
 	wg.Wait()
+	flushReplay()
+	closeAclPolicies()
+	if err := interfaceDown(reason); err != nil {
+		slog.Warn("pre_down hooks aborted, the daemon still takes the interface down", "error", err)
+	}
 	slog.Info("closing netmaker interface")
 	iface := wireguard.GetInterface()
 	iface.Close()
@@ -134,7 +156,7 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 	slog.Info("wireguard public listen port: ", "port", config.WgPublicListenPort)
 	setNatInfo()
 	slog.Info("configuring netmaker wireguard interface")
-	if len(config.Servers) == 0 {
+	if len(config.GetServerMap()) == 0 {
 		ProxyManagerChan <- &models.HostPeerUpdate{
 			ProxyUpdate: models.ProxyManagerPayload{
 				Action: models.ProxyDeleteAllPeers,
@@ -142,23 +164,41 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 		}
 	}
 
-	Pull(false)
+	restored := restoreSnapshot()
 	nc := wireguard.NewNCIface(config.Netclient(), config.GetNodes())
-	nc.Create()
+	if restored {
+		// bring the mesh up from the last known good state right away, the pull reconciles it
+		nc.Create()
+		nc.Configure()
+		wireguard.SetPeers(true)
+	}
+	if err := Pull(false); err != nil {
+		slog.Warn("failed to pull from servers", "error", err)
+		if restored {
+			slog.Warn("running from last known good state until the servers are reachable")
+		}
+	}
+	nc = wireguard.NewNCIface(config.Netclient(), config.GetNodes())
+	if !restored {
+		nc.Create()
+	}
 	nc.Configure()
 	wireguard.SetPeers(true)
-	server := config.GetServer(config.CurrServer)
-	if server == nil {
+	interfaceUp()
+	applyAclPolicies()
+	wg.Add(1)
+	go hooks.Start(ctx, wg)
+	running = newDaemonState(ctx)
+	resumeKeyRotation()
+	resumeTrafficKeyRotation()
+	wg.Add(1)
+	go scheduleKeyRotation(ctx, wg)
+	wg.Add(1)
+	go runDNSResolver(ctx, wg)
+	if len(config.GetServerMap()) == 0 {
 		return cancel
 	}
-	logger.Log(1, "started daemon for server ", server.Name)
-	networking.StoreServerAddresses(server)
-	err := routes.SetNetmakerServerRoutes(config.Netclient().DefaultInterface, server)
-	if err != nil {
-		logger.Log(2, "failed to set route(s) for", server.Name, err.Error())
-	}
-	wg.Add(1)
-	go messageQueue(ctx, wg, server)
+	running.startServers(wg)
 	if err := routes.SetNetmakerPeerEndpointRoutes(config.Netclient().DefaultInterface); err != nil {
 		slog.Warn("failed to set initial peer routes", "error", err.Error())
 	}
@@ -166,6 +206,10 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 	go Checkin(ctx, wg)
 	wg.Add(1)
 	go networking.StartIfaceDetection(ctx, wg, config.Netclient().ProxyListenPort)
+	wg.Add(1)
+	go watchHandshakes(ctx, wg)
+	wg.Add(1)
+	go wireguard.StartReconciler(ctx, wg)
 	return cancel
 }
 
@@ -174,77 +218,69 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 func messageQueue(ctx context.Context, wg *sync.WaitGroup, server *config.Server) {
 	defer wg.Done()
 	slog.Info("netclient message queue started for server:", "server", server.Name)
-	err := setupMQTT(server)
+	mq, err := setupMQTT(ctx, server)
 	if err != nil {
 		slog.Error("unable to connect to broker", "server", server.Broker, "error", err)
 		return
 	}
-	defer func() {
-		if Mqclient != nil {
-			Mqclient.Disconnect(250)
-		}
-	}()
+	// the client of a server removed and added again by a reload is a different instance
+	defer mq.disconnect()
 	<-ctx.Done()
 	slog.Info("shutting down message queue", "server", server.Name)
 }
 
 // setupMQTT creates a connection to broker
-func setupMQTT(server *config.Server) error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(server.Broker)
-	opts.SetUsername(server.MQUserName)
-	opts.SetPassword(server.MQPassword)
-	//opts.SetClientID(ncutils.MakeRandomString(23))
-	opts.SetClientID(server.MQID.String())
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetry(true)
-	opts.SetConnectRetryInterval(time.Second << 2)
-	opts.SetKeepAlive(time.Second * 10)
-	opts.SetWriteTimeout(time.Minute)
-	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		slog.Info("mqtt connect handler")
-		nodes := config.GetNodes()
-		for _, node := range nodes {
-			node := node
-			setSubscriptions(client, &node)
-		}
-		setHostSubscription(client, server.Name)
-		checkin()
-	})
-	opts.SetOrderMatters(true)
-	opts.SetResumeSubs(true)
-	opts.SetConnectionLostHandler(func(c mqtt.Client, e error) {
-		slog.Warn("detected broker connection lost for", "server", server.Broker)
-		if ok := resetServerRoutes(); ok {
-			slog.Info("detected default gateway change, reset server routes")
-			if err := UpdateHostSettings(); err != nil {
-				slog.Error("failed to update host settings", "error", err)
-				return
+// it keeps retrying the brokers of the server with backoff until connected or the context is done
+func setupMQTT(ctx context.Context, server *config.Server) (*mqClient, error) {
+	var mq *mqClient
+	mq = newMQClient(ctx, server.Name, server.GetBrokers(), false, func(broker string) *mqtt.ClientOptions {
+		opts := mqtt.NewClientOptions()
+		opts.AddBroker(broker)
+		opts.SetUsername(server.MQUserName)
+		opts.SetPassword(server.MQPassword)
+		//opts.SetClientID(ncutils.MakeRandomString(23))
+		opts.SetClientID(server.MQID.String())
+		opts.SetKeepAlive(time.Second * 10)
+		opts.SetWriteTimeout(time.Minute)
+		opts.SetOnConnectHandler(func(client mqtt.Client) {
+			slog.Info("mqtt connect handler", "server", server.Name, "broker", broker)
+			nodes := config.GetNodes()
+			for _, node := range nodes {
+				node := node
+				if node.Server != server.Name {
+					continue
+				}
+				setSubscriptions(mq, &node)
 			}
+			setHostSubscription(mq)
+			flushOutbox(mq)
+			checkin(server.Name)
+		})
+		opts.SetOrderMatters(true)
+		opts.SetResumeSubs(true)
+		opts.SetConnectionLostHandler(func(c mqtt.Client, e error) {
+			slog.Warn("detected broker connection lost for", "server", server.Name, "broker", broker)
+			if ok := resetServerRoutes(); ok {
+				slog.Info("detected default gateway change, reset server routes")
+				if err := UpdateHostSettings(); err != nil {
+					slog.Error("failed to update host settings", "error", err)
+					return
+				}
 
-			handlePeerInetGateways(
-				!config.GW4PeerDetected && !config.GW6PeerDetected,
-				config.IsHostInetGateway(), false,
-				nil,
-			)
-		}
-	})
-	Mqclient = mqtt.NewClient(opts)
-	var connecterr error
-	for count := 0; count < 3; count++ {
-		connecterr = nil
-		if token := Mqclient.Connect(); !token.WaitTimeout(30*time.Second) || token.Error() != nil {
-			logger.Log(0, "unable to connect to broker, retrying ...")
-			if token.Error() == nil {
-				connecterr = errors.New("connect timeout")
-			} else {
-				connecterr = token.Error()
+				handlePeerInetGateways(
+					!config.GW4PeerDetected && !config.GW6PeerDetected,
+					config.IsHostInetGateway(), false,
+					nil,
+				)
 			}
-		}
-	}
-	if connecterr != nil {
-		slog.Error("unable to connect to broker", "server", server.Broker, "error", connecterr)
-		return connecterr
+		})
+		return opts
+	})
+	mqclients.add(mq)
+	if connecterr := mq.connect(0); connecterr != nil {
+		slog.Error("unable to connect to broker", "server", server.Name, "error", connecterr)
+		mq.disconnect()
+		return nil, connecterr
 	}
 	if err := PublishHostUpdate(server.Name, models.Acknowledgement); err != nil {
 		slog.Error("failed to send initial ACK to server", "server", server.Name, "error", err)
@@ -253,108 +289,119 @@ func setupMQTT(server *config.Server) error {
 	}
 	// send register signal with turn to server
 	if server.UseTurn {
-		if err := PublishHostUpdate(server.Server, models.RegisterWithTurn); err != nil {
+		if err := PublishHostUpdate(server.Name, models.RegisterWithTurn); err != nil {
 			slog.Error("failed to publish host turn register signal to server", "server", server.Server, "error", err)
 		} else {
 			slog.Info("published host turn register signal to server", "server", server.Server)
 		}
 	}
 
-	return nil
+	return mq, nil
 }
 
 // func setMQTTSingenton creates a connection to broker for single use (ie to publish a message)
 // only to be called from cli (eg. connect/disconnect, join, leave) and not from daemon ---
+// if the daemon already holds a client for the server, that client is used instead
 func setupMQTTSingleton(server *config.Server, publishOnly bool) error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(server.Broker)
-	opts.SetUsername(server.MQUserName)
-	opts.SetPassword(server.MQPassword)
-	opts.SetClientID(server.MQID.String())
-	opts.SetAutoReconnect(true)
-	opts.SetConnectRetry(true)
-	opts.SetConnectRetryInterval(time.Second << 2)
-	opts.SetKeepAlive(time.Minute >> 1)
-	opts.SetWriteTimeout(time.Minute)
-	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		if !publishOnly {
-			slog.Info("mqtt connect handler")
-			nodes := config.GetNodes()
-			for _, node := range nodes {
-				node := node
-				setSubscriptions(client, &node)
+	if mq := mqclients.get(server.Name); mq != nil {
+		if !mq.singleton {
+			if !mq.isConnected() {
+				return errors.New("broker for " + server.Name + " is not connected")
 			}
-			setHostSubscription(client, server.Name)
+			return nil
 		}
-		slog.Info("successfully connected to", "server", server.Broker)
-	})
-	opts.SetOrderMatters(true)
-	opts.SetResumeSubs(true)
-	opts.SetConnectionLostHandler(func(c mqtt.Client, e error) {
-		slog.Warn("detected broker connection lost for", "server", server.Broker)
+		// the client of an earlier call would keep reconnecting with the same client id
+		mq.disconnect()
+	}
+	brokers := server.GetBrokers()
+	var mq *mqClient
+	mq = newMQClient(context.Background(), server.Name, brokers, true, func(broker string) *mqtt.ClientOptions {
+		opts := mqtt.NewClientOptions()
+		opts.AddBroker(broker)
+		opts.SetUsername(server.MQUserName)
+		opts.SetPassword(server.MQPassword)
+		opts.SetClientID(server.MQID.String())
+		opts.SetKeepAlive(time.Minute >> 1)
+		opts.SetWriteTimeout(time.Minute)
+		opts.SetOnConnectHandler(func(client mqtt.Client) {
+			if !publishOnly {
+				slog.Info("mqtt connect handler")
+				nodes := config.GetNodes()
+				for _, node := range nodes {
+					node := node
+					if node.Server != server.Name {
+						continue
+					}
+					setSubscriptions(mq, &node)
+				}
+				setHostSubscription(mq)
+			}
+			slog.Info("successfully connected to", "server", broker)
+		})
+		opts.SetOrderMatters(true)
+		opts.SetResumeSubs(true)
+		opts.SetConnectionLostHandler(func(c mqtt.Client, e error) {
+			slog.Warn("detected broker connection lost for", "server", broker)
+		})
+		return opts
 	})
-	Mqclient = mqtt.NewClient(opts)
+	mqclients.add(mq)
+	return mq.connect(len(brokers))
+}
 
-	var connecterr error
-	if token := Mqclient.Connect(); !token.WaitTimeout(30*time.Second) || token.Error() != nil {
-		logger.Log(0, "unable to connect to broker,", server.Broker+",", "retrying...")
-		if token.Error() == nil {
-			connecterr = errors.New("connect timeout")
-		} else {
-			connecterr = token.Error()
-		}
+// closeMQTTSingleton disconnects the client created by setupMQTTSingleton for the server,
+// a client owned by the daemon is left connected
+func closeMQTTSingleton(server string) {
+	if mq := mqclients.get(server); mq != nil && mq.singleton {
+		mq.disconnect()
 	}
-	return connecterr
 }
 
 // setHostSubscription sets MQ client subscriptions for host
 // should be called for each server host is registered on.
-func setHostSubscription(client mqtt.Client, server string) {
+func setHostSubscription(mq *mqClient) {
 	hostID := config.Netclient().ID
+	server := mq.server
 	slog.Info("subscribing to host updates for", "host", hostID, "server", server)
-	if token := client.Subscribe(fmt.Sprintf("peers/host/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(HostPeerUpdate)); token.Wait() && token.Error() != nil {
-		slog.Error("unable to subscribe to host peer updates", "host", hostID, "server", server, "error", token.Error)
+	if err := mq.subscribe(fmt.Sprintf("peers/host/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(HostPeerUpdate)); err != nil {
+		slog.Error("unable to subscribe to host peer updates", "host", hostID, "server", server, "error", err)
 		return
 	}
 	slog.Info("subscribing to host updates for", "host", hostID, "server", server)
-	if token := client.Subscribe(fmt.Sprintf("host/update/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(HostUpdate)); token.Wait() && token.Error() != nil {
-		slog.Error("unable to subscribe to host updates", "host", hostID, "server", server, "error", token.Error)
+	if err := mq.subscribe(fmt.Sprintf("host/update/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(HostUpdate)); err != nil {
+		slog.Error("unable to subscribe to host updates", "host", hostID, "server", server, "error", err)
 		return
 	}
 	slog.Info("subscribing to dns updates for", "host", hostID, "server", server)
-	if token := client.Subscribe(fmt.Sprintf("dns/update/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(dnsUpdate)); token.Wait() && token.Error() != nil {
-		slog.Error("unable to subscribe to dns updates", "host", hostID, "server", server, "error", token.Error)
+	if err := mq.subscribe(fmt.Sprintf("dns/update/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(dnsUpdate)); err != nil {
+		slog.Error("unable to subscribe to dns updates", "host", hostID, "server", server, "error", err)
 		return
 	}
 	slog.Info("subscribing to all dns updates for", "host", hostID, "server", server)
-	if token := client.Subscribe(fmt.Sprintf("dns/all/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(dnsAll)); token.Wait() && token.Error() != nil {
-		slog.Error("unable to subscribe to all dns updates", "host", hostID, "server", server, "error", token.Error)
+	if err := mq.subscribe(fmt.Sprintf("dns/all/%s/%s", hostID.String(), server), 0, mqtt.MessageHandler(dnsAll)); err != nil {
+		slog.Error("unable to subscribe to all dns updates", "host", hostID, "server", server, "error", err)
 		return
 	}
 }
 
 // setSubcriptions sets MQ client subscriptions for a specific node config
 // should be called for each node belonging to a given server
-func setSubscriptions(client mqtt.Client, node *config.Node) {
-	if token := client.Subscribe(fmt.Sprintf("node/update/%s/%s", node.Network, node.ID), 0, mqtt.MessageHandler(NodeUpdate)); token.WaitTimeout(mq.MQ_TIMEOUT*time.Second) && token.Error() != nil {
-		if token.Error() == nil {
-			slog.Error("unable to subscribe to updates for node ", "node", node.ID, "error", "connection timeout")
-		} else {
-			slog.Error("unable to subscribe to updates for node ", "node", node.ID, "error", token.Error)
-		}
+func setSubscriptions(mq *mqClient, node *config.Node) {
+	if err := mq.subscribe(fmt.Sprintf("node/update/%s/%s", node.Network, node.ID), 0, mqtt.MessageHandler(NodeUpdate)); err != nil {
+		slog.Error("unable to subscribe to updates for node ", "node", node.ID, "error", err)
 		return
 	}
 	slog.Info("subscribed to updates for node", "node", node.ID, "network", node.Network)
 }
 
+// decryptMsg - decrypts a message of the server received on the topic and rejects it if it was replayed,
 // should only ever use node client configs
-func decryptMsg(serverName string, msg []byte) ([]byte, error) {
+func decryptMsg(serverName, topic string, msg []byte) ([]byte, error) {
 	if len(msg) <= 24 { // make sure message is of appropriate length
 		return nil, fmt.Errorf("received invalid message from broker %v", msg)
 	}
-	host := config.Netclient()
 	// setup the keys
-	diskKey, err := ncutils.ConvertBytesToKey(host.TrafficKeyPrivate)
+	keyring, err := hostTrafficKeyring(serverName)
 	if err != nil {
 		return nil, err
 	}
@@ -367,7 +414,18 @@ func decryptMsg(serverName string, msg []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return DeChunk(msg, serverPubKey, diskKey)
+	decrypted, kind, err := keyring.deChunk(msg, serverPubKey)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case trafficKeyPending:
+		// the server knows the new traffic key
+		ackTrafficKey(serverName)
+	case trafficKeyRetired:
+		slog.Debug("accepted message for retired traffic key", "server", serverName)
+	}
+	return checkReplay(serverName, topic, msg, decrypted)
 }
 
 func read(network, which string) string {
@@ -396,58 +454,49 @@ func insert(network, which, cache string) {
 
 // on a delete usually, pass in the nodecfg to unsubscribe client broker communications
 // for the node in nodeCfg
-func unsubscribeNode(client mqtt.Client, node *config.Node) {
-	var ok = true
-	if token := client.Unsubscribe(fmt.Sprintf("node/update/%s/%s", node.Network, node.ID)); token.WaitTimeout(mq.MQ_TIMEOUT*time.Second) && token.Error() != nil {
-		if token.Error() == nil {
-			slog.Error("unable to unsubscribe from updates for node ", "node", node.ID, "error", "connection timeout")
-		} else {
-			slog.Error("unable to unsubscribe from updates for node ", "node", node.ID, "error", token.Error)
-		}
-		ok = false
-	} // peer updates belong to host now
-
-	if ok {
-		slog.Info("unsubscribed from updates for node", "node", node.ID, "network", node.Network)
+func unsubscribeNode(node *config.Node) {
+	mq := mqclients.get(node.Server)
+	if mq == nil {
+		return
 	}
+	if err := mq.unsubscribe(fmt.Sprintf("node/update/%s/%s", node.Network, node.ID)); err != nil {
+		slog.Error("unable to unsubscribe from updates for node ", "node", node.ID, "error", err)
+		return
+	} // peer updates belong to host now
+	slog.Info("unsubscribed from updates for node", "node", node.ID, "network", node.Network)
 }
 
 // unsubscribe client broker communications for host topics
-func unsubscribeHost(client mqtt.Client, server string) {
+func unsubscribeHost(server string) {
+	mq := mqclients.get(server)
+	if mq == nil {
+		return
+	}
 	hostID := config.Netclient().ID
 	slog.Info("removing subscription for host peer updates", "host", hostID, "server", server)
-	if token := client.Unsubscribe(fmt.Sprintf("peers/host/%s/%s", hostID.String(), server)); token.WaitTimeout(mq.MQ_TIMEOUT*time.Second) && token.Error() != nil {
-		slog.Error("unable to unsubscribe from host peer updates", "host", hostID, "server", server, "error", token.Error)
+	if err := mq.unsubscribe(fmt.Sprintf("peers/host/%s/%s", hostID.String(), server)); err != nil {
+		slog.Error("unable to unsubscribe from host peer updates", "host", hostID, "server", server, "error", err)
 		return
 	}
 	slog.Info("removing subscription for host updates", "host", hostID, "server", server)
-	if token := client.Unsubscribe(fmt.Sprintf("host/update/%s/%s", hostID.String(), server)); token.WaitTimeout(mq.MQ_TIMEOUT*time.Second) && token.Error() != nil {
-		slog.Error("unable to unsubscribe from host updates", "host", hostID, "server", server, "error", token.Error)
+	if err := mq.unsubscribe(fmt.Sprintf("host/update/%s/%s", hostID.String(), server)); err != nil {
+		slog.Error("unable to unsubscribe from host updates", "host", hostID, "server", server, "error", err)
 		return
 	}
 }
 
-// UpdateKeys -- updates private key and returns new publickey
+// UpdateKeys -- updates private key and publishes the new public key to the servers
 func UpdateKeys() error {
-	var err error
 	slog.Info("received message to update wireguard keys")
-	host := config.Netclient()
-	host.PrivateKey, err = wgtypes.GeneratePrivateKey()
-	if err != nil {
-		slog.Error("error generating privatekey ", "error", err)
+	if err := rotateKeysNow(); err != nil {
+		slog.Error("failed to rotate wireguard keys", "error", err)
 		return err
 	}
-	host.PublicKey = host.PrivateKey.PublicKey()
-	if err := config.WriteNetclientConfig(); err != nil {
-		slog.Error("error saving netclient config:", "error", err)
-	}
-	PublishHostUpdate(config.CurrServer, models.UpdateHost)
-	daemon.Restart()
 	return nil
 }
 
 func holePunchWgPort() (pubIP net.IP, pubPort int) {
-	for _, server := range config.Servers {
+	for _, server := range config.GetServerMap() {
 		portToStun := config.Netclient().ListenPort
 		pubIP, pubPort = stun.HolePunch(server.StunList, portToStun)
 		if pubPort == 0 || pubIP == nil || pubIP.IsUnspecified() {
@@ -464,7 +513,7 @@ func setNatInfo() {
 		slog.Error("failed to get freeport for proxy: ", "error", err)
 		return
 	}
-	for _, server := range config.Servers {
+	for _, server := range config.GetServerMap() {
 		server := server
 		if hostNatInfo == nil {
 			hostNatInfo = stun.GetHostNatInfo(
@@ -489,12 +538,14 @@ func cleanUpRoutes() {
 func resetServerRoutes() bool {
 	if routes.HasGatewayChanged() {
 		cleanUpRoutes()
-		server := config.GetServer(config.CurrServer)
-		if err := routes.SetNetmakerServerRoutes(config.Netclient().DefaultInterface, server); err != nil {
-			logger.Log(2, "failed to set route(s) for", server.Name, err.Error())
+		for _, server := range config.GetServerMap() {
+			server := server
+			if err := routes.SetNetmakerServerRoutes(config.Netclient().DefaultInterface, &server); err != nil {
+				logger.Log(2, "failed to set route(s) for", server.Name, err.Error())
+			}
 		}
 		if err := routes.SetNetmakerPeerEndpointRoutes(config.Netclient().DefaultInterface); err != nil {
-			logger.Log(2, "failed to set route(s) for", server.Name, err.Error())
+			logger.Log(2, "failed to set peer endpoint route(s)", err.Error())
 		}
 		return true
 	}
@@ -10,6 +10,7 @@ import (
 	"github.com/gravitl/txeh"
 	"github.com/guumaster/hostctl/pkg/file"
 	"github.com/guumaster/hostctl/pkg/types"
+	"golang.org/x/exp/slog"
 )
 
 const etcHostsComment = "netmaker"
@@ -62,6 +63,9 @@ func deleteAllDNS() error {
 			addressesToDelete = append(addressesToDelete, line.Address)
 		}
 	}
+	if len(addressesToDelete) == 0 {
+		return nil
+	}
 	hosts.RemoveAddresses(addressesToDelete, etcHostsComment)
 	if err := hosts.Save(); err != nil {
 		return err
@@ -69,7 +73,10 @@ func deleteAllDNS() error {
 	return nil
 }
 
+// deleteNetworkDNS - removes the names of the network from the dns table and the hosts file,
+// a line is removed if one of its names is in the domain of the network
 func deleteNetworkDNS(network string) error {
+	meshDNS.dropNetwork(network)
 	temp := os.TempDir()
 	lockfile := temp + "/netclient-lock"
 	if err := config.Lock(lockfile); err != nil {
@@ -84,11 +91,14 @@ func deleteNetworkDNS(network string) error {
 	addressesToRemove := []string{}
 	for _, line := range *lines {
 		if line.Comment == etcHostsComment {
-			if sliceContains(line.Hostnames, network) {
+			if anyInDomain(line.Hostnames, network) {
 				addressesToRemove = append(addressesToRemove, line.Address)
 			}
 		}
 	}
+	if len(addressesToRemove) == 0 {
+		return nil
+	}
 	hosts.RemoveAddresses(addressesToRemove, etcHostsComment)
 	if err := hosts.Save(); err != nil {
 		return err
@@ -96,9 +106,56 @@ func deleteNetworkDNS(network string) error {
 	return nil
 }
 
-func sliceContains(s []string, v string) bool {
-	for _, e := range s {
-		if strings.Contains(e, v) {
+// seedHostsDNS - loads the mesh names of the hosts file into the dns table before it is changed for the
+// first time, the table is empty if there was no snapshot to restore it from
+func seedHostsDNS() {
+	if config.Netclient().DNS.Resolver() {
+		return
+	}
+	meshDNS.mutex.RLock()
+	seeded := meshDNS.seeded
+	meshDNS.mutex.RUnlock()
+	if seeded {
+		return
+	}
+	hosts, err := txeh.NewHostsDefault()
+	if err != nil {
+		slog.Warn("failed to read hosts file, mesh names of other updates may be lost", "error", err)
+		return
+	}
+	meshDNS.seed(*hosts.GetHostFileLines())
+}
+
+// writeHostsDNS - replaces the mesh names in the hosts file with the names of the dns table,
+// names of search domain networks are also added without the network
+func writeHostsDNS() error {
+	hosts, err := txeh.NewHostsDefault()
+	if err != nil {
+		return err
+	}
+	lines := hosts.GetHostFileLines()
+	addressesToDelete := []string{}
+	for _, line := range *lines {
+		if line.Comment == etcHostsComment {
+			addressesToDelete = append(addressesToDelete, line.Address)
+		}
+	}
+	hosts.RemoveAddresses(addressesToDelete, etcHostsComment)
+	for _, record := range meshDNS.list(DNSFilter{}) {
+		for _, address := range record.Addresses {
+			hosts.AddHost(address, record.Name, etcHostsComment)
+			if record.Search {
+				hosts.AddHost(address, strings.TrimSuffix(record.Name, "."+record.Network), etcHostsComment)
+			}
+		}
+	}
+	return hosts.Save()
+}
+
+// anyInDomain - returns true if one of the names is in the domain
+func anyInDomain(names []string, domain string) bool {
+	for _, name := range names {
+		if inDomain(name, domain) {
 			return true
 		}
 	}
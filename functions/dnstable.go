@@ -0,0 +1,438 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/txeh"
+)
+
+// DNSRecord - addresses of a mesh name and the network and server it belongs to
+type DNSRecord struct {
+	Name      string   `json:"name"`
+	Network   string   `json:"network"`
+	Server    string   `json:"server"`
+	Addresses []string `json:"addresses"`
+	Search    bool     `json:"search"` // the short name resolves, the network is a search domain
+}
+
+// DNSFilter - selects records of the dns table, empty fields match all records
+type DNSFilter struct {
+	Network string `form:"network"`
+	Server  string `form:"server"`
+	Name    string `form:"name"`
+}
+
+// dnsOwner - network of a server mesh names are recorded for
+type dnsOwner struct {
+	server  string
+	network string
+}
+
+// dnsTable - addresses of the mesh names per network and server, the A and AAAA records of a name
+// and the PTR records of its addresses are answered from it
+type dnsTable struct {
+	mutex   sync.RWMutex
+	records map[dnsOwner]map[string][]net.IP
+	seeded  bool   // the mesh names of the hosts file were loaded
+	version uint64 // counts the changes of the records
+}
+
+var meshDNS = dnsTable{records: make(map[dnsOwner]map[string][]net.IP)}
+
+// dnsName - returns the name in the form it is stored in the table
+func dnsName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// inDomain - returns true if the name is the domain or a name below it
+func inDomain(name, domain string) bool {
+	name, domain = dnsName(name), dnsName(domain)
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// dnsNetwork - returns the network of the server a name belongs to, the network of the host with
+// the longest matching domain or the last label of the name for networks the host is not in
+func dnsNetwork(server, name string) string {
+	network := ""
+	for _, node := range config.GetNodes() {
+		if node.Server == server && inDomain(name, node.Network) && len(node.Network) > len(network) {
+			network = dnsName(node.Network)
+		}
+	}
+	if network != "" {
+		return network
+	}
+	labels := strings.Split(dnsName(name), ".")
+	return labels[len(labels)-1]
+}
+
+// dnsTable.owned - returns the names of the owner, created if missing, the caller holds the lock
+func (t *dnsTable) owned(owner dnsOwner) map[string][]net.IP {
+	names := t.records[owner]
+	if names == nil {
+		names = make(map[string][]net.IP)
+		t.records[owner] = names
+	}
+	return names
+}
+
+// dnsTable.apply - applies the dns update of the server, returns false if it could not be applied
+func (t *dnsTable) apply(server string, dns models.DNSUpdate) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	name := dnsName(dns.Name)
+	owner := dnsOwner{server: server, network: dnsNetwork(server, name)}
+	switch dns.Action {
+	case models.DNSInsert:
+		ip := net.ParseIP(dns.Address)
+		if ip == nil {
+			return false
+		}
+		names := t.owned(owner)
+		names[name] = appendIP(names[name], ip)
+	case models.DNSDeleteByName:
+		t.removeName(server, name)
+	case models.DNSDeleteByIP:
+		t.removeIP(server, net.ParseIP(dns.Address))
+	case models.DNSReplaceName:
+		ips := t.removeName(server, name)
+		if len(ips) == 0 {
+			return false
+		}
+		newName := dnsName(dns.NewName)
+		names := t.owned(dnsOwner{server: server, network: dnsNetwork(server, newName)})
+		for _, ip := range ips {
+			names[newName] = appendIP(names[newName], ip)
+		}
+	case models.DNSReplaceIP:
+		ip := net.ParseIP(dns.NewAddress)
+		if ip == nil {
+			return false
+		}
+		t.removeIP(server, net.ParseIP(dns.Address))
+		names := t.owned(owner)
+		names[name] = appendIP(names[name], ip)
+	default:
+		return false
+	}
+	t.version++
+	return true
+}
+
+// dnsTable.removeName - removes the name from the networks of the server, returns its addresses,
+// the caller holds the lock
+func (t *dnsTable) removeName(server, name string) []net.IP {
+	removed := []net.IP{}
+	for owner, names := range t.records {
+		if owner.server != server {
+			continue
+		}
+		for _, ip := range names[name] {
+			removed = appendIP(removed, ip)
+		}
+		delete(names, name)
+	}
+	return removed
+}
+
+// dnsTable.removeIP - removes the address from the names of the server, names left without
+// address are removed, the caller holds the lock
+func (t *dnsTable) removeIP(server string, ip net.IP) {
+	for owner, names := range t.records {
+		if owner.server != server {
+			continue
+		}
+		for name, ips := range names {
+			kept := []net.IP{}
+			for _, existing := range ips {
+				if !existing.Equal(ip) {
+					kept = append(kept, existing)
+				}
+			}
+			if len(kept) == 0 {
+				delete(names, name)
+				continue
+			}
+			names[name] = kept
+		}
+	}
+}
+
+// dnsTable.replace - replaces the names of the server with the inserts of the entries in one step,
+// lookups see either the previous or the new names of the server
+func (t *dnsTable) replace(server string, dns []models.DNSUpdate) {
+	records := make(map[dnsOwner]map[string][]net.IP)
+	for _, entry := range dns {
+		ip := net.ParseIP(entry.Address)
+		if entry.Action != models.DNSInsert || ip == nil {
+			continue
+		}
+		name := dnsName(entry.Name)
+		owner := dnsOwner{server: server, network: dnsNetwork(server, name)}
+		if records[owner] == nil {
+			records[owner] = make(map[string][]net.IP)
+		}
+		records[owner][name] = appendIP(records[owner][name], ip)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for owner := range t.records {
+		if owner.server == server {
+			delete(t.records, owner)
+		}
+	}
+	for owner, names := range records {
+		t.records[owner] = names
+	}
+	t.version++
+}
+
+// dnsTable.seed - adds the mesh names of the hosts file lines to the table once, the names of a server are
+// only kept in memory and the snapshot, without them the first write of the table to the hosts file
+// would remove them; names are owned by the server of the network of their domain, names of networks
+// the host is not in and the names of the host are left out
+func (t *dnsTable) seed(lines []txeh.HostFileLine) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.seeded {
+		return
+	}
+	t.seeded = true
+	t.version++
+	host := config.Netclient().Name
+	for _, line := range lines {
+		ip := net.ParseIP(line.Address)
+		if line.Comment != etcHostsComment || ip == nil {
+			continue
+		}
+		for _, hostname := range line.Hostnames {
+			name := dnsName(hostname)
+			var owner *dnsOwner
+			for _, node := range config.GetNodes() {
+				if inDomain(name, node.Network) && (owner == nil || len(dnsName(node.Network)) > len(owner.network)) {
+					owner = &dnsOwner{server: node.Server, network: dnsName(node.Network)}
+				}
+			}
+			if owner == nil || (host != "" && name == dnsName(host+"."+owner.network)) {
+				continue
+			}
+			names := t.owned(*owner)
+			names[name] = appendIP(names[name], ip)
+		}
+	}
+}
+
+// dnsTable.drop - removes the names of the server
+func (t *dnsTable) drop(server string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for owner := range t.records {
+		if owner.server == server {
+			delete(t.records, owner)
+		}
+	}
+	t.version++
+}
+
+// dnsTable.dropNetwork - removes the names of the network, of all servers
+func (t *dnsTable) dropNetwork(network string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for owner := range t.records {
+		if owner.network == dnsName(network) {
+			delete(t.records, owner)
+		}
+	}
+	t.version++
+}
+
+// dnsTable.changes - returns the number of changes of the records, callers compare it to tell whether the table changed
+func (t *dnsTable) changes() uint64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.version
+}
+
+// dnsTable.lookup - returns the addresses of the name, false if no server knows it
+func (t *dnsTable) lookup(name string) ([]net.IP, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	found := false
+	ips := []net.IP{}
+	for _, names := range t.merged() {
+		if addrs, ok := names[dnsName(name)]; ok {
+			found = true
+			for _, ip := range addrs {
+				ips = appendIP(ips, ip)
+			}
+		}
+	}
+	return ips, found
+}
+
+// dnsTable.reverse - returns the names of the address sorted
+func (t *dnsTable) reverse(ip net.IP) []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	names := []string{}
+	if ip == nil {
+		return names
+	}
+	for _, owned := range t.merged() {
+		for name, ips := range owned {
+			for _, existing := range ips {
+				if existing.Equal(ip) && !containsString(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dnsTable.merged - returns the names received from the servers together with the names of the host
+// in its networks, which carry the addresses of its nodes; the caller holds the lock
+func (t *dnsTable) merged() map[dnsOwner]map[string][]net.IP {
+	merged := make(map[dnsOwner]map[string][]net.IP, len(t.records))
+	for owner, names := range t.records {
+		merged[owner] = names
+	}
+	host := config.Netclient().Name
+	if host == "" {
+		return merged
+	}
+	for _, node := range config.GetNodes() {
+		owner := dnsOwner{server: node.Server, network: dnsName(node.Network)}
+		name := dnsName(host + "." + node.Network)
+		names := make(map[string][]net.IP, len(merged[owner])+1)
+		for n, ips := range merged[owner] {
+			names[n] = ips
+		}
+		ips := append([]net.IP{}, names[name]...)
+		for _, ip := range []net.IP{node.Address.IP, node.Address6.IP} {
+			if ip != nil && !ip.IsUnspecified() {
+				ips = appendIP(ips, ip)
+			}
+		}
+		if len(ips) > 0 {
+			names[name] = ips
+		}
+		merged[owner] = names
+	}
+	return merged
+}
+
+// dnsTable.lookupShort - resolves a name without domain in the search domains in their order
+func (t *dnsTable) lookupShort(name string, search []string) ([]net.IP, bool) {
+	if strings.Contains(dnsName(name), ".") {
+		return nil, false
+	}
+	for _, network := range search {
+		if ips, ok := t.lookup(dnsName(name) + "." + dnsName(network)); ok {
+			return ips, true
+		}
+	}
+	return nil, false
+}
+
+// dnsTable.list - returns the records matching the filter sorted by name, network and server
+func (t *dnsTable) list(filter DNSFilter) []DNSRecord {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	search := config.Netclient().DNS.Search
+	records := []DNSRecord{}
+	for owner, names := range t.merged() {
+		if (filter.Network != "" && owner.network != dnsName(filter.Network)) ||
+			(filter.Server != "" && owner.server != filter.Server) {
+			continue
+		}
+		for name, ips := range names {
+			if filter.Name != "" && name != dnsName(filter.Name) {
+				continue
+			}
+			record := DNSRecord{
+				Name:      name,
+				Network:   owner.network,
+				Server:    owner.server,
+				Addresses: []string{},
+				Search:    containsString(search, owner.network),
+			}
+			for _, ip := range ips {
+				record.Addresses = append(record.Addresses, ip.String())
+			}
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		if records[i].Network != records[j].Network {
+			return records[i].Network < records[j].Network
+		}
+		return records[i].Server < records[j].Server
+	})
+	return records
+}
+
+// GetDNSRecords - returns the records of the dns table matching the filter
+func GetDNSRecords(filter DNSFilter) []DNSRecord {
+	return meshDNS.list(filter)
+}
+
+// DNSCmd - prints the dns table of the daemon
+func DNSCmd(filter DNSFilter, output string) error {
+	query := url.Values{}
+	for key, value := range map[string]string{"network": filter.Network, "server": filter.Server, "name": filter.Name} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	path := "/dns"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	records := []DNSRecord{}
+	if err := daemonRequest(http.MethodGet, path, nil, &records); err != nil {
+		return err
+	}
+	if output == "json" {
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(records) == 0 {
+		fmt.Println("no dns records")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tNETWORK\tSERVER\tADDRESSES\tSEARCH")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", record.Name, record.Network, record.Server, strings.Join(record.Addresses, ","), record.Search)
+	}
+	return w.Flush()
+}
+
+func appendIP(ips []net.IP, ip net.IP) []net.IP {
+	for _, existing := range ips {
+		if existing.Equal(ip) {
+			return ips
+		}
+	}
+	return append(ips, ip)
+}
@@ -0,0 +1,136 @@
+package functions
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/txeh"
+	"github.com/matryer/is"
+)
+
+func TestDNSTable(t *testing.T) {
+	config.Nodes = config.NodeMap{
+		"dev":    config.Node{CommonNode: models.CommonNode{Network: "dev", Server: "server"}},
+		"devops": config.Node{CommonNode: models.CommonNode{Network: "devops", Server: "server"}},
+	}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	load := func() {
+		meshDNS.replace("server", []models.DNSUpdate{
+			{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.2"},
+			{Action: models.DNSInsert, Name: "web.devops", Address: "10.1.0.2"},
+			{Action: models.DNSInsert, Name: "ci.devops", Address: "10.1.0.3"},
+		})
+	}
+	defer meshDNS.drop("server")
+
+	t.Run("records owned by network", func(t *testing.T) {
+		is := is.New(t)
+		load()
+		records := meshDNS.list(DNSFilter{Network: "dev"})
+		is.Equal(len(records), 1)
+		is.Equal(records[0].Name, "web.dev")
+		is.Equal(len(meshDNS.list(DNSFilter{Network: "devops"})), 2)
+	})
+	t.Run("dropping a network keeps similar names", func(t *testing.T) {
+		is := is.New(t)
+		load()
+		meshDNS.dropNetwork("dev")
+		_, found := meshDNS.lookup("web.dev")
+		is.True(!found)
+		_, found = meshDNS.lookup("web.devops")
+		is.True(found)
+	})
+	t.Run("rename ipv6 only name", func(t *testing.T) {
+		is := is.New(t)
+		load()
+		is.True(meshDNS.apply("server", models.DNSUpdate{Action: models.DNSInsert, Name: "v6.dev", Address: "fd00::5"}))
+		is.True(meshDNS.apply("server", models.DNSUpdate{Action: models.DNSReplaceName, Name: "v6.dev", NewName: "six.dev"}))
+		ips, found := meshDNS.lookup("six.dev")
+		is.True(found)
+		is.Equal(ips[0].String(), "fd00::5")
+		is.Equal(meshDNS.reverse(net.ParseIP("fd00::5")), []string{"six.dev"})
+	})
+	t.Run("exact domain match", func(t *testing.T) {
+		is := is.New(t)
+		is.True(anyInDomain([]string{"web.dev"}, "dev"))
+		is.True(!anyInDomain([]string{"web.devops"}, "dev"))
+		is.True(!anyInDomain([]string{"dev.example"}, "dev"))
+	})
+	t.Run("short names in search domains", func(t *testing.T) {
+		is := is.New(t)
+		load()
+		ips, found := meshDNS.lookupShort("ci", []string{"dev", "devops"})
+		is.True(found)
+		is.Equal(ips[0].String(), "10.1.0.3")
+		ips, found = meshDNS.lookupShort("web", []string{"dev", "devops"})
+		is.True(found)
+		is.Equal(ips[0].String(), "10.0.0.2") // first search domain wins
+		_, found = meshDNS.lookupShort("ci", []string{"dev"})
+		is.True(!found)
+	})
+	t.Run("hosts file names are kept by the first update", func(t *testing.T) {
+		is := is.New(t)
+		meshDNS.drop("server")
+		meshDNS.seeded = false
+		defer func() { meshDNS.seeded = false }()
+		meshDNS.seed([]txeh.HostFileLine{
+			{Address: "10.0.0.2", Hostnames: []string{"web.dev", "web"}, Comment: etcHostsComment},
+			{Address: "10.1.0.3", Hostnames: []string{"ci.devops"}, Comment: etcHostsComment},
+			{Address: "10.9.0.1", Hostnames: []string{"db.other"}, Comment: etcHostsComment},
+			{Address: "192.168.1.1", Hostnames: []string{"router.dev"}},
+		})
+		is.True(meshDNS.apply("server", models.DNSUpdate{Action: models.DNSInsert, Name: "db.dev", Address: "10.0.0.4"}))
+		is.True(meshDNS.apply("server", models.DNSUpdate{Action: models.DNSReplaceName, Name: "ci.devops", NewName: "build.devops"}))
+		names := []string{}
+		for _, record := range meshDNS.list(DNSFilter{Server: "server"}) {
+			names = append(names, record.Name)
+		}
+		is.Equal(names, []string{"build.devops", "db.dev", "web.dev"})
+		// seeded once, later calls keep the table
+		meshDNS.seed([]txeh.HostFileLine{{Address: "10.0.0.9", Hostnames: []string{"old.dev"}, Comment: etcHostsComment}})
+		_, found := meshDNS.lookup("old.dev")
+		is.True(!found)
+	})
+	t.Run("replace in one step", func(t *testing.T) {
+		is := is.New(t)
+		load()
+		is.True(meshDNS.apply("other", models.DNSUpdate{Action: models.DNSInsert, Name: "db.dev", Address: "10.0.0.9"}))
+		defer meshDNS.drop("other")
+		version := meshDNS.changes()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 200; i++ {
+				load()
+			}
+		}()
+		// lookups never see the server without names while they are replaced
+		for running := true; running; {
+			select {
+			case <-done:
+				running = false
+			default:
+			}
+			_, found := meshDNS.lookup("web.dev")
+			is.True(found)
+		}
+		is.True(meshDNS.changes() >= version+200)
+		meshDNS.replace("server", []models.DNSUpdate{
+			{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.5"},
+			{Action: models.DNSDeleteByName, Name: "ci.devops"},
+			{Action: models.DNSInsert, Name: "bad.dev", Address: "not an address"},
+		})
+		ips, found := meshDNS.lookup("web.dev")
+		is.True(found)
+		is.Equal(len(ips), 1)
+		is.Equal(ips[0].String(), "10.0.0.5")
+		_, found = meshDNS.lookup("bad.dev")
+		is.True(!found)
+		is.Equal(len(meshDNS.list(DNSFilter{Network: "devops"})), 0)
+		// names of other servers are kept
+		_, found = meshDNS.lookup("db.dev")
+		is.True(found)
+	})
+}
@@ -3,16 +3,29 @@ package functions
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 
 	"golang.org/x/crypto/nacl/box"
 )
 
 const (
 	chunkSize = 16000 // 16000 bytes max message size
+	// freshnessMagic - marks a message carrying a freshness header, json payloads never start with it
+	freshnessMagic = "nmf\x01"
+	// freshnessSize - size of the freshness header: magic, unix nano timestamp and sequence number
+	freshnessSize = len(freshnessMagic) + 16
 )
 
+// Freshness - header prepended to a message before it is chunked so the receiver can reject replays,
+// the sequence increases with every message of the sender, also across restarts
+type Freshness struct {
+	Timestamp time.Time
+	Sequence  uint64
+}
+
 // BoxEncrypt - encrypts traffic box
 func BoxEncrypt(message []byte, recipientPubKey *[32]byte, senderPrivateKey *[32]byte) ([]byte, error) {
 	var nonce [24]byte // 192 bits of randomization
@@ -60,6 +73,29 @@ func Chunk(message []byte, recipientPubKey *[32]byte, senderPrivateKey *[32]byte
 	return chunkedMsg, nil
 }
 
+// ChunkFresh - chunks and encrypts a message like Chunk with the freshness header in front of it,
+// the header is part of the first encrypted chunk
+func ChunkFresh(message []byte, freshness Freshness, recipientPubKey *[32]byte, senderPrivateKey *[32]byte) ([]byte, error) {
+	header := make([]byte, freshnessSize, freshnessSize+len(message))
+	copy(header, freshnessMagic)
+	binary.BigEndian.PutUint64(header[len(freshnessMagic):], uint64(freshness.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(header[len(freshnessMagic)+8:], freshness.Sequence)
+	return Chunk(append(header, message...), recipientPubKey, senderPrivateKey)
+}
+
+// SplitFreshness - splits a decrypted message into its freshness header and payload,
+// returns false and the message as is if it carries no header
+func SplitFreshness(message []byte) (Freshness, []byte, bool) {
+	if len(message) < freshnessSize || !bytes.HasPrefix(message, []byte(freshnessMagic)) {
+		return Freshness{}, message, false
+	}
+	freshness := Freshness{
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(message[len(freshnessMagic):]))),
+		Sequence:  binary.BigEndian.Uint64(message[len(freshnessMagic)+8:]),
+	}
+	return freshness, message[freshnessSize:], true
+}
+
 // DeChunk - "de" chunks and decrypts a message
 func DeChunk(chunkedMsg []byte, senderPublicKey *[32]byte, recipientPrivateKey *[32]byte) ([]byte, error) {
 	chunks, err := convertMsgToBytes(chunkedMsg) // convert the message to it's original chunks form
@@ -77,6 +113,41 @@ func DeChunk(chunkedMsg []byte, senderPublicKey *[32]byte, recipientPrivateKey *
 	return totalMsg, nil
 }
 
+// kinds of private traffic keys of a keyring
+const (
+	trafficKeyCurrent = iota
+	trafficKeyPending
+	trafficKeyRetired
+)
+
+// trafficKeyring - private traffic keys of the host a message of a server may be encrypted for,
+// pending and retired are nil outside of a rotation and its grace window
+type trafficKeyring struct {
+	current *[32]byte
+	pending *[32]byte
+	retired *[32]byte
+}
+
+// trafficKeyring.deChunk - decrypts the message with the first key of the keyring that opens it,
+// returns the kind of the key that opened it
+func (k *trafficKeyring) deChunk(chunkedMsg []byte, senderPublicKey *[32]byte) ([]byte, int, error) {
+	decrypted, err := DeChunk(chunkedMsg, senderPublicKey, k.current)
+	if err == nil {
+		return decrypted, trafficKeyCurrent, nil
+	}
+	if k.pending != nil {
+		if decrypted, pendingErr := DeChunk(chunkedMsg, senderPublicKey, k.pending); pendingErr == nil {
+			return decrypted, trafficKeyPending, nil
+		}
+	}
+	if k.retired != nil {
+		if decrypted, retiredErr := DeChunk(chunkedMsg, senderPublicKey, k.retired); retiredErr == nil {
+			return decrypted, trafficKeyRetired, nil
+		}
+	}
+	return nil, trafficKeyCurrent, err
+}
+
 // == private ==
 
 var splitKey = []byte("|(,)(,)|")
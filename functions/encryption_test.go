@@ -0,0 +1,341 @@
+package functions
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestTrafficKeyTransition(t *testing.T) {
+	serverPub, serverPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPub, oldPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPub, newPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// messages of the server encrypted for the old and the new public key of the host
+	forOld, err := BoxEncrypt([]byte("for old key"), oldPub, serverPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forNew, err := BoxEncrypt([]byte("for new key"), newPub, serverPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("before the server switched", func(t *testing.T) {
+		is := is.New(t)
+		keyring := trafficKeyring{current: oldPriv, pending: newPriv}
+		decrypted, kind, err := keyring.deChunk(forOld, serverPub)
+		is.NoErr(err)
+		is.Equal(kind, trafficKeyCurrent)
+		is.Equal(string(decrypted), "for old key")
+	})
+	t.Run("server switched to the pending key", func(t *testing.T) {
+		is := is.New(t)
+		keyring := trafficKeyring{current: oldPriv, pending: newPriv}
+		decrypted, kind, err := keyring.deChunk(forNew, serverPub)
+		is.NoErr(err)
+		is.Equal(kind, trafficKeyPending)
+		is.Equal(string(decrypted), "for new key")
+	})
+	t.Run("old key accepted during grace window", func(t *testing.T) {
+		is := is.New(t)
+		keyring := trafficKeyring{current: newPriv, retired: oldPriv}
+		decrypted, kind, err := keyring.deChunk(forOld, serverPub)
+		is.NoErr(err)
+		is.Equal(kind, trafficKeyRetired)
+		is.Equal(string(decrypted), "for old key")
+		_, kind, err = keyring.deChunk(forNew, serverPub)
+		is.NoErr(err)
+		is.Equal(kind, trafficKeyCurrent)
+	})
+	t.Run("old key rejected after grace window", func(t *testing.T) {
+		is := is.New(t)
+		keyring := trafficKeyring{current: newPriv}
+		_, _, err := keyring.deChunk(forOld, serverPub)
+		is.True(err != nil)
+	})
+	t.Run("chunked message for pending key", func(t *testing.T) {
+		is := is.New(t)
+		message := make([]byte, chunkSize*2+10)
+		for i := range message {
+			message[i] = byte('a' + i%26)
+		}
+		chunked, err := Chunk(message, newPub, serverPriv)
+		is.NoErr(err)
+		keyring := trafficKeyring{current: oldPriv, pending: newPriv}
+		decrypted, kind, err := keyring.deChunk(chunked, serverPub)
+		is.NoErr(err)
+		is.Equal(kind, trafficKeyPending)
+		is.Equal(decrypted, message)
+	})
+}
+
+// trafficKeys - private and public traffic key of the host as stored in the config
+type trafficKeys struct {
+	private, public []byte
+}
+
+func newTrafficKeys(t *testing.T) trafficKeys {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privBytes, err := ncutils.ConvertKeyToBytes(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubBytes, err := ncutils.ConvertKeyToBytes(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trafficKeys{private: privBytes, public: pubBytes}
+}
+
+// pendingTrafficRotation - starts the test with a host of the servers rotating from the current to the
+// pending traffic key
+func pendingTrafficRotation(t *testing.T, servers ...string) (current, pending trafficKeys) {
+	useTempConfig(t)
+	current = newTrafficKeys(t)
+	pending = newTrafficKeys(t)
+	config.Servers = make(map[string]config.Server)
+	for _, server := range servers {
+		config.Servers[server] = config.Server{Name: server}
+	}
+	host := config.Netclient()
+	host.KeyRotation.TrafficKeys = true
+	host.TrafficKeyPrivate = current.private
+	host.TrafficKeyPublic = pending.public
+	host.PendingTrafficKey = &config.PendingTrafficKey{
+		Private:      pending.private,
+		Public:       pending.public,
+		Previous:     current.public,
+		Started:      time.Now(),
+		Acknowledged: []string{},
+	}
+	t.Cleanup(func() {
+		if trafficKeyTimer != nil {
+			trafficKeyTimer.Stop()
+		}
+		lastTrafficRotationError = ""
+	})
+	return current, pending
+}
+
+// sendingKey - returns the private traffic key messages to the server are encrypted with as stored in the config
+func sendingKey(t *testing.T, server string) []byte {
+	key, err := sendingTrafficKey(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ncutils.ConvertKeyToBytes(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAckTrafficKey(t *testing.T) {
+	t.Run("pending key of all servers", func(t *testing.T) {
+		is := is.New(t)
+		current, pending := pendingTrafficRotation(t, "a", "b")
+		ackTrafficKey("a")
+		ackTrafficKey("a")
+		is.Equal(config.Netclient().PendingTrafficKey.Acknowledged, []string{"a"})
+		// messages switch to the pending key per server
+		is.Equal(sendingKey(t, "a"), pending.private)
+		is.Equal(sendingKey(t, "b"), current.private)
+		ackTrafficKey("b")
+		host := config.Netclient()
+		is.True(host.PendingTrafficKey == nil)
+		is.Equal(host.TrafficKeyPrivate, pending.private)
+		is.Equal(host.TrafficKeyPublic, pending.public)
+		is.Equal(host.RetiredTrafficKey.Private, current.private)
+		is.Equal(sendingKey(t, "b"), pending.private)
+		// the acknowledgements and the switch are saved
+		stored, err := config.ReadNetclientConfig()
+		is.NoErr(err)
+		is.Equal(stored.TrafficKeyPrivate, pending.private)
+	})
+	t.Run("without rotation", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingTrafficRotation(t, "a")
+		config.Netclient().PendingTrafficKey = nil
+		ackTrafficKey("a")
+		is.Equal(config.Netclient().TrafficKeyPrivate, current.private)
+		is.True(config.Netclient().RetiredTrafficKey == nil)
+	})
+}
+
+func TestPromoteTrafficKey(t *testing.T) {
+	t.Run("grace window of the policy", func(t *testing.T) {
+		is := is.New(t)
+		current, pending := pendingTrafficRotation(t, "a")
+		config.Netclient().KeyRotation.TrafficKeyGrace = 30
+		trafficKeyMutex.Lock()
+		promoteTrafficKey()
+		trafficKeyMutex.Unlock()
+		host := config.Netclient()
+		is.Equal(host.TrafficKeyPrivate, pending.private)
+		is.Equal(host.RetiredTrafficKey.Private, current.private)
+		grace := time.Until(host.RetiredTrafficKey.Expires)
+		is.True(grace > time.Minute*29 && grace <= time.Minute*30)
+		status := GetTrafficKeyStatus()
+		is.True(!status.Pending)
+		is.Equal(status.GraceUntil, host.RetiredTrafficKey.Expires)
+	})
+	t.Run("drops the keys kept by servers", func(t *testing.T) {
+		is := is.New(t)
+		_, pending := pendingTrafficRotation(t, "a")
+		kept := newTrafficKeys(t)
+		config.Netclient().ServerTrafficKeys = map[string]config.ServerTrafficKey{"a": {Private: kept.private, Public: kept.public}}
+		ackTrafficKey("a")
+		is.True(config.Netclient().ServerTrafficKeys == nil)
+		is.Equal(sendingKey(t, "a"), pending.private)
+		is.Equal(config.Netclient().AdvertisedTrafficKey("a"), pending.public)
+	})
+	t.Run("without servers", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingTrafficRotation(t)
+		config.Netclient().PendingTrafficKey = nil
+		config.Netclient().TrafficKeyPublic = current.public
+		status, err := RotateTrafficKeys()
+		is.NoErr(err)
+		is.True(!status.Pending)
+		is.Equal(config.Netclient().RetiredTrafficKey.Private, current.private)
+		is.True(status.PublicKey != encodeTrafficKey(current.public))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingTrafficRotation(t, "a")
+		host := config.Netclient()
+		host.PendingTrafficKey = nil
+		host.TrafficKeyPublic = current.public
+		host.KeyRotation.TrafficKeys = false
+		_, err := RotateTrafficKeys()
+		is.Equal(err, ErrTrafficKeyRotationDisabled)
+		is.True(host.PendingTrafficKey == nil)
+		is.Equal(host.TrafficKeyPublic, current.public)
+	})
+}
+
+func TestRollbackTrafficKeyRotation(t *testing.T) {
+	t.Run("rollback", func(t *testing.T) {
+		is := is.New(t)
+		current, pending := pendingTrafficRotation(t, "a")
+		trafficKeyMutex.Lock()
+		is.Equal(rollbackTrafficKeyRotation("timed out"), []string{"a"})
+		trafficKeyMutex.Unlock()
+		host := config.Netclient()
+		is.True(host.PendingTrafficKey == nil)
+		is.Equal(host.TrafficKeyPrivate, current.private)
+		is.Equal(host.TrafficKeyPublic, current.public)
+		// servers that switched to the pending key may still encrypt for it
+		is.Equal(host.RetiredTrafficKey.Private, pending.private)
+		status := GetTrafficKeyStatus()
+		is.True(!status.Pending)
+		is.Equal(status.PublicKey, encodeTrafficKey(current.public))
+		is.Equal(status.LastError, "timed out")
+	})
+	t.Run("servers that switched keep the pending key", func(t *testing.T) {
+		is := is.New(t)
+		current, pending := pendingTrafficRotation(t, "a", "b")
+		config.Netclient().PendingTrafficKey.Acknowledged = []string{"a"}
+		trafficKeyMutex.Lock()
+		waiting := rollbackTrafficKeyRotation("timed out")
+		trafficKeyMutex.Unlock()
+		// only the servers that did not switch are sent the previous key
+		is.Equal(waiting, []string{"b"})
+		host := config.Netclient()
+		is.Equal(host.ServerTrafficKeys, map[string]config.ServerTrafficKey{"a": {Private: pending.private, Public: pending.public}})
+		is.Equal(sendingKey(t, "a"), pending.private)
+		is.Equal(sendingKey(t, "b"), current.private)
+		is.Equal(host.AdvertisedTrafficKey("a"), pending.public)
+		is.Equal(host.AdvertisedTrafficKey("b"), current.public)
+		keyring, err := hostTrafficKeyring("a")
+		is.NoErr(err)
+		pendingKey, err := ncutils.ConvertBytesToKey(pending.private)
+		is.NoErr(err)
+		is.Equal(keyring.current, pendingKey)
+		// the kept key survives a restart
+		stored, err := config.ReadNetclientConfig()
+		is.NoErr(err)
+		is.Equal(stored.ServerTrafficKeys["a"].Private, pending.private)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingTrafficRotation(t, "a", "b")
+		started := config.Netclient().PendingTrafficKey.Started
+		config.Netclient().PendingTrafficKey.Acknowledged = []string{"a"}
+		// the timeout of an earlier rotation does not roll back the current one
+		_, ok := expireTrafficKeyRotation(started.Add(-time.Hour))
+		is.True(!ok)
+		is.True(GetTrafficKeyStatus().Pending)
+		waiting, ok := expireTrafficKeyRotation(started)
+		is.True(ok)
+		is.Equal(waiting, []string{"b"})
+		status := GetTrafficKeyStatus()
+		is.True(!status.Pending)
+		is.Equal(status.PublicKey, encodeTrafficKey(current.public))
+		is.Equal(status.LastError, "timed out waiting for servers b")
+		_, ok = expireTrafficKeyRotation(started)
+		is.True(!ok)
+	})
+}
+
+func TestHostTrafficKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires time.Duration // of the retired key from now, no retired key if zero
+		pending bool
+		retired bool
+	}{
+		{name: "current key only"},
+		{name: "pending key", pending: true},
+		{name: "retired key in the grace window", expires: time.Minute, retired: true},
+		{name: "retired key expired", expires: -time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			current, pending := pendingTrafficRotation(t)
+			host := config.Netclient()
+			if !tt.pending {
+				host.PendingTrafficKey = nil
+			}
+			retired := newTrafficKeys(t)
+			if tt.expires != 0 {
+				host.RetiredTrafficKey = &config.RetiredTrafficKey{Private: retired.private, Expires: time.Now().Add(tt.expires)}
+			}
+			keyring, err := hostTrafficKeyring("a")
+			is.NoErr(err)
+			currentKey, err := ncutils.ConvertBytesToKey(current.private)
+			is.NoErr(err)
+			is.Equal(keyring.current, currentKey)
+			is.Equal(keyring.pending != nil, tt.pending)
+			if tt.pending {
+				pendingKey, err := ncutils.ConvertBytesToKey(pending.private)
+				is.NoErr(err)
+				is.Equal(keyring.pending, pendingKey)
+			}
+			is.Equal(keyring.retired != nil, tt.retired)
+			if tt.retired {
+				retiredKey, err := ncutils.ConvertBytesToKey(retired.private)
+				is.NoErr(err)
+				is.Equal(keyring.retired, retiredKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gravitl/netclient/nmproxy/router"
+)
+
+// FirewallFilter - selects the rules of a server and the format of the netmaker chains
+type FirewallFilter struct {
+	Server string `form:"server"`
+	Format string `form:"format"` // nft adds the chains in nft syntax
+}
+
+// GetFirewallRules - returns the netmaker chains, the rule ownership map and the drift against the kernel,
+// rules and drift of other servers are left out if the filter names a server
+func GetFirewallRules(filter FirewallFilter) (router.Ruleset, error) {
+	ruleset, err := router.Inspect()
+	if err != nil {
+		return ruleset, err
+	}
+	if filter.Server != "" {
+		rules := []router.OwnedRule{}
+		for _, rule := range ruleset.Rules {
+			if rule.Server == "" || rule.Server == filter.Server {
+				rules = append(rules, rule)
+			}
+		}
+		drift := []router.RuleDrift{}
+		for _, d := range ruleset.Drift {
+			if d.Server == "" || d.Server == filter.Server {
+				drift = append(drift, d)
+			}
+		}
+		ruleset.Rules, ruleset.Drift = rules, drift
+	}
+	if filter.Format == "nft" {
+		if ruleset.Nft, err = router.NftText(ruleset); err != nil {
+			return ruleset, err
+		}
+	}
+	return ruleset, nil
+}
+
+// FirewallShowCmd - prints the netmaker chains and rule ownership map of the daemon
+func FirewallShowCmd(server, output string) error {
+	query := url.Values{}
+	if server != "" {
+		query.Set("server", server)
+	}
+	if output == "nft" {
+		query.Set("format", "nft")
+	}
+	path := "/firewall"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var ruleset router.Ruleset
+	if err := daemonRequest(http.MethodGet, path, nil, &ruleset); err != nil {
+		return err
+	}
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(ruleset, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "nft":
+		fmt.Print(ruleset.Nft)
+		return nil
+	}
+	fmt.Println("backend:", ruleset.Backend)
+	repairs := ruleset.Repairs
+	fmt.Printf("repairs: %d chains, %d jump rules, %d peer rules in %d checks\n", repairs.Chains, repairs.JumpRules, repairs.PeerRules, repairs.Checks)
+	if repairs.LastError != "" {
+		fmt.Println("last check failed:", repairs.LastError)
+	}
+	for _, chain := range ruleset.Chains {
+		fmt.Printf("\n%s %s %s\n", chain.Family, chain.Table, chain.Chain)
+		for _, rule := range chain.Rules {
+			fmt.Println("  " + rule)
+		}
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tTABLE\tOWNER\tPEER\tCHAIN\tRULE\tINSTALLED")
+	for _, rule := range ruleset.Rules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%v\n", rule.Server, rule.RuleTable, rule.Owner, rule.Peer,
+			rule.Family+" "+rule.Table+" "+rule.Chain, rule.Rule, rule.Installed)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(ruleset.Drift) == 0 {
+		fmt.Println("\nno drift")
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DRIFT\tSERVER\tOWNER\tPEER\tCHAIN\tRULE")
+	for _, d := range ruleset.Drift {
+		rule := d.Rule
+		if rule == "" {
+			rule = "(chain)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Kind, d.Server, d.Owner, d.Peer, d.Family+" "+d.Table+" "+d.Chain, rule)
+	}
+	return w.Flush()
+}
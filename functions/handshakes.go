@@ -0,0 +1,65 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/nmproxy/turn"
+	"github.com/gravitl/netclient/nmproxy/wg"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// handshakeCheckInterval - interval between checks of the peers' handshake state
+const handshakeCheckInterval = time.Second * 15
+
+// watchHandshakes - publishes an event whenever the handshake of a peer goes stale or becomes active again
+func watchHandshakes(ctx context.Context, waitg *sync.WaitGroup) {
+	defer waitg.Done()
+	ticker := time.NewTicker(handshakeCheckInterval)
+	defer ticker.Stop()
+	connected := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			peers, err := wg.GetPeers(ncutils.GetInterfaceName())
+			if err != nil {
+				slog.Debug("failed to read peers for handshake check", "error", err)
+				continue
+			}
+			checkHandshakes(connected, peers)
+		}
+	}
+}
+
+// checkHandshakes - publishes the changes of the peers' handshake state against the connected
+// state of the previous check and records the current state, peers first seen are only recorded
+func checkHandshakes(connected map[string]bool, peers []wgtypes.Peer) {
+	seen := make(map[string]struct{}, len(peers))
+	for _, peer := range peers {
+		key := peer.PublicKey.String()
+		seen[key] = struct{}{}
+		active := !peer.LastHandshakeTime.IsZero() && time.Since(peer.LastHandshakeTime) <= turn.LastHandShakeThreshold
+		previous, known := connected[key]
+		connected[key] = active
+		if !known || previous == active {
+			continue
+		}
+		events.Publish(events.HandshakeChanged{
+			PublicKey:     key,
+			Endpoint:      udpAddrString(peer.Endpoint),
+			Connected:     active,
+			LastHandshake: peer.LastHandshakeTime,
+		})
+	}
+	for key := range connected {
+		if _, ok := seen[key]; !ok {
+			delete(connected, key)
+		}
+	}
+}
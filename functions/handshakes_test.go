@@ -0,0 +1,96 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/nmproxy/turn"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// handshakeEvents - returns the handshake events waiting in the subscription
+func handshakeEvents(sub *events.Subscription) []events.HandshakeChanged {
+	received := []events.HandshakeChanged{}
+	for {
+		select {
+		case envelope := <-sub.C:
+			received = append(received, envelope.Data.(events.HandshakeChanged))
+		default:
+			return received
+		}
+	}
+}
+
+func TestCheckHandshakes(t *testing.T) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := key.PublicKey()
+	active := time.Now().Add(-time.Second)
+	stale := time.Now().Add(-turn.LastHandShakeThreshold - time.Minute)
+	tests := []struct {
+		name      string
+		previous  map[string]bool
+		handshake time.Time // of the peer on the device, zero if it never had one
+		gone      bool
+		connected []bool // of the published events
+	}{
+		{name: "first seen active", previous: map[string]bool{}, handshake: active, connected: []bool{}},
+		{name: "first seen without handshake", previous: map[string]bool{}, connected: []bool{}},
+		{name: "still active", previous: map[string]bool{peer.String(): true}, handshake: active, connected: []bool{}},
+		{name: "went stale", previous: map[string]bool{peer.String(): true}, handshake: stale, connected: []bool{false}},
+		{name: "active again", previous: map[string]bool{peer.String(): false}, handshake: active, connected: []bool{true}},
+		{name: "never connected", previous: map[string]bool{peer.String(): false}, connected: []bool{}},
+		{name: "removed from the device", previous: map[string]bool{peer.String(): true}, gone: true, connected: []bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			sub := events.Subscribe(0, events.HandshakeChanged{}.EventName())
+			defer sub.Close()
+			peers := []wgtypes.Peer{}
+			if !tt.gone {
+				peers = append(peers, wgtypes.Peer{PublicKey: peer, LastHandshakeTime: tt.handshake})
+			}
+			connected := tt.previous
+			checkHandshakes(connected, peers)
+			published := []bool{}
+			for _, event := range handshakeEvents(sub) {
+				is.Equal(event.PublicKey, peer.String())
+				is.True(event.LastHandshake.Equal(tt.handshake))
+				published = append(published, event.Connected)
+			}
+			is.Equal(published, tt.connected)
+			// the state is kept for the next check, peers gone from the device are forgotten
+			state, ok := connected[peer.String()]
+			is.Equal(ok, !tt.gone)
+			if ok {
+				is.Equal(state, !tt.handshake.IsZero() && tt.handshake.Equal(active))
+			}
+		})
+	}
+}
+
+func TestWatchHandshakesStops(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	waitg := &sync.WaitGroup{}
+	waitg.Add(1)
+	go watchHandshakes(ctx, waitg)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		waitg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		is.Fail() // the watcher did not stop with its context
+	}
+}
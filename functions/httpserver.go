@@ -2,45 +2,89 @@ package functions
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 )
 
-type Network struct {
-	Node   config.Node
-	Server config.Server
-}
+// eventsKeepAlive - interval of keepalive comments on idle event streams
+const eventsKeepAlive = time.Second * 30
 
+// HttpServer - serves the local api on the root only unix socket (named pipe on windows),
+// and on a random localhost tcp port requiring the bearer token if enabled in the host config
 func HttpServer(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 	if config.Netclient().DisableGUIServer {
 		return
 	}
+	if _, err := config.EnsureAPIToken(); err != nil {
+		logger.Log(0, "failed to create local api token", err.Error())
+	}
+	router := SetupRouter()
+	servers := []*http.Server{}
+	listener, err := listenLocalAPI()
+	if err != nil {
+		logger.Log(0, "failed to listen on local api socket", err.Error())
+	} else {
+		config.SetGUISocket(localAPISocket())
+		svr := &http.Server{Handler: router}
+		servers = append(servers, svr)
+		logger.Log(3, "starting http server on socket ", localAPISocket())
+		go func() {
+			if err := svr.Serve(listener); err != nil && err != http.ErrServerClosed {
+				logger.Log(0, "http server err", err.Error())
+			}
+		}()
+	}
+	config.SetGUI("", "")
+	if config.Netclient().LocalAPITCP {
+		if svr := startTCPServer(router); svr != nil {
+			servers = append(servers, svr)
+		}
+	}
+	if err := config.WriteGUIConfig(); err != nil {
+		logger.Log(0, "failed to write gui config", err.Error())
+	}
+	<-ctx.Done()
+	logger.Log(3, "shutting down http server")
+	for _, svr := range servers {
+		if err := svr.Shutdown(ctx); err != nil {
+			logger.Log(0, "http server shutdown", err.Error())
+		}
+	}
+}
+
+// startTCPServer - serves the local api on a random localhost port, every request needs the bearer token
+func startTCPServer(router http.Handler) *http.Server {
+	if _, err := config.GetAPIToken(); err != nil {
+		logger.Log(0, "local api token not available, not starting tcp server", err.Error())
+		return nil
+	}
 	port, err := ncutils.GetFreeTCPPort()
 	if err != nil {
 		logger.Log(0, "failed to get free port", err.Error())
 		logger.Log(0, "unable to start http server", "exiting")
 		logger.Log(0, "netclient-gui will not be available")
-		return
+		return nil
 	}
 	config.SetGUI("127.0.0.1", port)
-	config.WriteGUIConfig()
-
-	router := SetupRouter()
 	svr := &http.Server{
 		Addr:    config.GetGUI().Address + ":" + config.GetGUI().Port,
-		Handler: router,
+		Handler: tokenHandler(router),
 	}
 	logger.Log(3, "starting http server on port ", port)
 	go func() {
@@ -48,217 +92,137 @@ func HttpServer(ctx context.Context, wg *sync.WaitGroup) {
 			logger.Log(0, "https server err", err.Error())
 		}
 	}()
-	<-ctx.Done()
-	logger.Log(3, "shutting down http server")
-	if err := svr.Shutdown(ctx); err != nil {
-		logger.Log(0, "http server shutdown", err.Error())
-	}
-}
-
-// SetupRoute - sets routes for http server
-func SetupRouter() *gin.Engine {
-	router := gin.Default()
-	router.GET("/status", status)
-	router.POST("/register", register)
-	router.GET("/network/:net", getNetwork)
-	router.GET("/allnetworks", getAllNetworks)
-	router.GET("/netclient", getNetclient)
-	router.POST("/connect/:net", connect)
-	router.POST("/leave/:net", leave)
-	router.GET("/servers", servers)
-	router.POST("/uninstall", uninstall)
-	router.GET("/pull/:net", pull)
-	router.POST("nodepeers", nodePeers)
-	router.POST("/join", join)
-	router.POST("/sso", sso)
-	return router
-}
-
-func status(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
-}
-
-func register(c *gin.Context) {
-	var token struct {
-		Token string
-	}
-	err := json.NewDecoder(c.Request.Body).Decode(&token)
-	if err != nil {
-		//if err := c.BindJSON(&token); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid data " + err.Error()})
-		log.Println("bind error ", err)
-		return
-	}
-	if err := Register(token.Token); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "invalid data " + err.Error()})
-		log.Println("join failed", err)
-		return
-	}
-	c.JSON(http.StatusOK, nil)
-}
-
-func getNetwork(c *gin.Context) {
-	network := c.Params.ByName("net")
-	nodes := config.GetNodes()
-	for _, node := range nodes {
-		node := node
-		if node.Network == network {
-			server := config.GetServer(node.Server)
-			if server == nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "server config not found"})
-				return
-			}
-			c.JSON(http.StatusOK, Network{node, *server})
-			return
-		}
-	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "unknown network"})
+	return svr
 }
 
-func getAllNetworks(c *gin.Context) {
-	configs := []Network{}
-	nodes := config.GetNodes()
-	for _, node := range nodes {
-		node := node
-		server := config.GetServer(node.Server)
-		if server == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "server config not found"})
-			return
-		}
-		configs = append(configs, Network{node, *server})
+// LocalAPITransport - returns an http transport connecting to the socket of the local api,
+// the host part of request urls is ignored
+func LocalAPITransport() *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialLocalAPI(ctx)
+		},
 	}
-	c.JSON(http.StatusOK, configs)
 }
 
-func getNetclient(c *gin.Context) {
-	conf, err := config.ReadNetclientConfig()
+// validAPIToken - checks the request carries the bearer token of the local api
+func validAPIToken(r *http.Request) bool {
+	token, err := config.GetAPIToken()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to read netclient config"})
-		return
+		return false
 	}
-	c.JSON(http.StatusOK, conf)
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	bearer := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
 }
 
-func connect(c *gin.Context) {
-	var connect struct {
-		Connect bool
-	}
-	net := c.Params.ByName("net")
-	if err := json.NewDecoder(c.Request.Body).Decode(&connect); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "unable to read request"})
-		return
-	}
-	if connect.Connect {
-		if err := Connect(net); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+// tokenHandler - rejects requests without the bearer token of the local api
+func tokenHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validAPIToken(r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(ErrorResponse{
+				Error: APIError{Code: ErrUnauthorized, Message: "missing or invalid bearer token"},
+			})
 			return
 		}
-	} else {
-		if err := Disconnect(net); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-			return
-		}
-	}
-	c.JSON(http.StatusOK, nil)
+		next.ServeHTTP(w, r)
+	})
 }
 
-func leave(c *gin.Context) {
-	net := c.Params.ByName("net")
-	errs, err := LeaveNetwork(net, true)
-	if err == nil {
-		c.JSON(http.StatusOK, nil)
+// requireToken - middleware for destructive routes, rejects requests without the bearer token
+// of the local api, also on the root only socket
+func requireToken(c *gin.Context) {
+	if !validAPIToken(c.Request) {
+		apiError(c, http.StatusUnauthorized, ErrUnauthorized, "missing or invalid bearer token")
 		return
 	}
-	builder := strings.Builder{}
-	for _, msg := range errs {
-		builder.WriteString(msg.Error() + " ")
-	}
-	c.JSON(http.StatusInternalServerError, gin.H{"error": builder.String()})
-}
-
-func servers(c *gin.Context) {
-	var servers struct {
-		Name []string
-	}
-	for name := range config.Servers {
-		name := name
-		servers.Name = append(servers.Name, name)
-	}
-	c.JSON(http.StatusOK, servers)
+	c.Next()
 }
 
-func uninstall(c *gin.Context) {
-	errs, err := Uninstall()
-	if err == nil {
-		c.JSON(http.StatusOK, nil)
-		return
-	}
-	builder := strings.Builder{}
-	for _, msg := range errs {
-		builder.WriteString(msg.Error() + " ")
+// SetupRoute - sets routes for http server, the versioned api and the
+// unversioned routes of existing clients
+func SetupRouter() *gin.Engine {
+	router := gin.Default()
+	v1 := router.Group(APIVersionPath)
+	for _, route := range apiRoutes() {
+		v1.Handle(route.Method, route.Path, routeHandlers(route)...)
 	}
-	c.JSON(http.StatusInternalServerError, gin.H{"error": builder.String()})
+	v1.GET("/openapi.json", getOpenAPI)
+	legacyRoutes(router, apiRoutes())
+	router.NoRoute(noRoute)
+	return router
 }
 
-func pull(c *gin.Context) {
-	net := c.Params.ByName("net")
-	err := Pull(true)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+// routeHandlers - returns the handler chain of the route
+func routeHandlers(route apiRoute) []gin.HandlerFunc {
+	if route.Token {
+		return []gin.HandlerFunc{requireToken, route.Handler}
 	}
-	node := config.GetNode(net)
-	server := config.GetServer(node.Server)
-	if server == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "server config not found"})
-		return
-	}
-	network := Network{
-		Node:   node,
-		Server: *server,
-	}
-	c.JSON(http.StatusOK, network)
+	return []gin.HandlerFunc{route.Handler}
 }
 
-func nodePeers(c *gin.Context) {
-	node := config.Node{}
-	if err := c.BindJSON(&node); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse request" + err.Error()})
-		return
-	}
-	peers, err := GetNodePeers(node)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
-	}
-	c.JSON(http.StatusOK, peers)
+// streamEvents - streams daemon events as server-sent events until the client goes away,
+// the optional names query parameter takes a comma separated list of event names to filter on
+func streamEvents(c *gin.Context) {
+	var names []string
+	if filter := c.Query("names"); filter != "" {
+		names = strings.Split(filter, ",")
+	}
+	sub := events.Subscribe(events.DefaultBuffer, names...)
+	defer sub.Close()
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Header("Content-Type", "text/event-stream")
+	// send the headers right away so clients see the stream open before the first event
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Name, event)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		}
+	})
 }
 
-func join(c *gin.Context) {
-	joinReq := RegisterSSO{}
-	if err := c.BindJSON(&joinReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse request" + err.Error()})
+func sso(c *gin.Context) {
+	registerData := RegisterSSO{}
+	if !bindRequest(c, &registerData) {
 		return
 	}
-	if err := RegisterWithSSO(&joinReq); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	endpoint, status, apiErr := requestSSO(registerData)
+	if apiErr != nil {
+		apiError(c, status, apiErr.Code, apiErr.Message, apiErr.Details...)
 		return
 	}
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, SSOResponse{AuthEndpoint: endpoint})
 }
 
-func sso(c *gin.Context) {
-	registerData := RegisterSSO{}
-	if err := c.BindJSON(&registerData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not parse request" + err.Error()})
-		return
-	}
+// requestSSO - asks the server for the endpoint of an sso registration, returns the status and
+// error of the request if it failed
+func requestSSO(registerData RegisterSSO) (string, int, *APIError) {
 	socketUrl := fmt.Sprintf("wss://%s/api/v1/auth-register/host", registerData.API)
 	// Dial the netmaker server controller
 	conn, _, err := websocket.DefaultDialer.Dial(socketUrl, nil)
 	if err != nil {
 		logger.Log(0, fmt.Sprintf("error connecting to %s : %s", registerData.API, err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
+		return "", http.StatusBadGateway, &APIError{Code: ErrUpstream, Message: "error connecting to " + registerData.API, Details: []string{err.Error()}}
 	}
 	host := hostForSSO()
 	request := models.RegisterMsg{
@@ -272,33 +236,27 @@ func sso(c *gin.Context) {
 	defer conn.Close()
 	reqData, err := json.Marshal(&request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
+		return "", http.StatusInternalServerError, &APIError{Code: ErrInternal, Message: "failed to encode register message", Details: []string{err.Error()}}
 	}
 	if err := conn.WriteMessage(websocket.TextMessage, reqData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
+		return "", http.StatusBadGateway, &APIError{Code: ErrUpstream, Message: "failed to send register message", Details: []string{err.Error()}}
 	}
 	for {
 		msgType, msg, err := conn.ReadMessage()
 		if err != nil {
 			if msgType < 0 {
 				logger.Log(1, "received close message from server")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
+				return "", http.StatusBadGateway, &APIError{Code: ErrUpstream, Message: "websocket closed", Details: []string{err.Error()}}
 			}
 			logger.Log(0, "read:", err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return "", http.StatusBadGateway, &APIError{Code: ErrUpstream, Message: "failed to read from server", Details: []string{err.Error()}}
 		}
 		if msgType == websocket.CloseMessage {
 			logger.Log(1, "received close message from server")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "websocket closed"})
-			return
+			return "", http.StatusBadGateway, &APIError{Code: ErrUpstream, Message: "websocket closed"}
 		}
 		if strings.Contains(string(msg), "oauth/register") { // TODO: maybe send to channel for GUI in future?
-			c.JSON(http.StatusOK, gin.H{"authendpoint": string(msg)})
-			return
+			return string(msg), http.StatusOK, nil
 		}
 	}
 }
@@ -0,0 +1,161 @@
+package functions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/matryer/is"
+)
+
+// openEventStream - opens the event stream at the path of the server, returns the response
+// with the stream reader
+func openEventStream(t *testing.T, server *httptest.Server, path string) (*http.Response, *bufio.Reader) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	return response, bufio.NewReader(response.Body)
+}
+
+// readEvent - returns the name and data of the next event of the stream, skipping comments
+func readEvent(t *testing.T, stream *bufio.Reader) (string, string) {
+	var name, data string
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(line, "data:")
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	server := httptest.NewServer(testRouter(t))
+	defer server.Close()
+	for name, path := range map[string]string{"versioned": "/api/v1/events", "unversioned": "/events"} {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			response, stream := openEventStream(t, server, path+"?names=peer_removed,node_updated")
+			is.Equal(response.StatusCode, http.StatusOK)
+			is.Equal(response.Header.Get("Content-Type"), "text/event-stream")
+			is.Equal(response.Header.Get("Cache-Control"), "no-cache")
+			// the stream subscribes before it sends the headers, events published now are delivered
+			events.Publish(events.PeerAdded{Server: "server", PublicKey: "filtered"})
+			events.Publish(events.PeerRemoved{Server: "server", PublicKey: "key"})
+			events.Publish(events.NodeUpdated{Server: "server", Network: "dev"})
+			name, data := readEvent(t, stream)
+			is.Equal(name, "peer_removed")
+			var envelope struct {
+				Name string             `json:"name"`
+				Data events.PeerRemoved `json:"data"`
+			}
+			is.NoErr(json.Unmarshal([]byte(data), &envelope))
+			is.Equal(envelope.Name, "peer_removed")
+			is.Equal(envelope.Data, events.PeerRemoved{Server: "server", PublicKey: "key"})
+			name, _ = readEvent(t, stream)
+			is.Equal(name, "node_updated")
+		})
+	}
+	t.Run("ends when the client goes away", func(t *testing.T) {
+		is := is.New(t)
+		server := httptest.NewServer(testRouter(t))
+		ctx, cancel := context.WithCancel(context.Background())
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/events", nil)
+		is.NoErr(err)
+		response, err := http.DefaultClient.Do(request)
+		is.NoErr(err)
+		cancel()
+		response.Body.Close()
+		// closing the server waits for the stream handler to return
+		closed := make(chan struct{})
+		go func() {
+			server.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(time.Second * 5):
+			is.Fail() // the stream kept running after the client went away
+		}
+	})
+}
+
+func TestTokenMiddleware(t *testing.T) {
+	useTempConfig(t)
+	token, err := config.EnsureAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", requireToken, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{name: "valid token", authorization: "Bearer " + token, status: http.StatusNoContent},
+		{name: "missing token", status: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic " + token, status: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer " + strings.Repeat("0", len(token)), status: http.StatusUnauthorized},
+		{name: "token prefix", authorization: "Bearer " + token[:10], status: http.StatusUnauthorized},
+	}
+	handlers := map[string]http.Handler{"tokenHandler": tokenHandler(ok), "requireToken": router}
+	for name, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				is := is.New(t)
+				w := httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodGet, "/", nil)
+				if tt.authorization != "" {
+					request.Header.Set("Authorization", tt.authorization)
+				}
+				handler.ServeHTTP(w, request)
+				is.Equal(w.Code, tt.status)
+				if tt.status != http.StatusUnauthorized {
+					return
+				}
+				var response ErrorResponse
+				is.NoErr(json.Unmarshal(w.Body.Bytes(), &response))
+				is.Equal(response.Error.Code, ErrUnauthorized)
+			})
+		}
+	}
+	t.Run("without token file", func(t *testing.T) {
+		is := is.New(t)
+		is.NoErr(os.Remove(config.GetNetclientPath() + config.GUITokenFile))
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer ")
+		tokenHandler(ok).ServeHTTP(w, request)
+		is.Equal(w.Code, http.StatusUnauthorized)
+	})
+}
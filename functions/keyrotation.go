@@ -0,0 +1,324 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// keyRotationCheckInterval - time between two checks whether a scheduled key rotation is due
+const keyRotationCheckInterval = time.Minute * 10
+
+// ErrKeyRotationPending - a key rotation is already waiting for the servers
+var ErrKeyRotationPending = errors.New("a key rotation is already in progress")
+
+var (
+	rotationMutex     sync.Mutex // guards the keys of the host during a rotation
+	rotationTimer     *time.Timer
+	lastRotationError string
+)
+
+// KeyRotationStatus - state of the wireguard key rotation of the host
+type KeyRotationStatus struct {
+	Pending      bool      `json:"pending"`
+	PublicKey    string    `json:"public_key"` // key in use on the interface
+	PendingKey   string    `json:"pending_key,omitempty"`
+	Started      time.Time `json:"started"`
+	Acknowledged []string  `json:"acknowledged"`
+	Waiting      []string  `json:"waiting"`
+	LastRotation time.Time `json:"last_rotation"`
+	LastError    string    `json:"last_error,omitempty"`
+	Interval     int       `json:"interval"` // hours between scheduled rotations
+}
+
+// RotateKeys - starts a rotation of the wireguard keys: the new public key is published to all servers
+// as the key of the host while the interface keeps the current key; the interface switches once every
+// server sent a peer update carrying the new key, the servers are set back to the current key if they
+// do not in time
+func RotateKeys() (KeyRotationStatus, error) {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+	host := config.Netclient()
+	if host.PendingKey != nil {
+		return keyRotationStatus(), ErrKeyRotationPending
+	}
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return keyRotationStatus(), err
+	}
+	host.PendingKey = &config.PendingKey{
+		PrivateKey:   key,
+		Started:      time.Now(),
+		Acknowledged: []string{},
+	}
+	if err := config.WriteNetclientConfig(); err != nil {
+		host.PendingKey = nil
+		return keyRotationStatus(), fmt.Errorf("error saving pending key: %w", err)
+	}
+	lastRotationError = ""
+	slog.Info("rotating wireguard keys", "pending", key.PublicKey().String())
+	events.Publish(events.KeyRotationStarted{PublicKey: key.PublicKey().String()})
+	if len(config.GetServerMap()) == 0 {
+		swapKeys()
+		return keyRotationStatus(), nil
+	}
+	for _, server := range config.GetServerMap() {
+		if err := PublishHostUpdate(server.Name, models.UpdateHost); err != nil {
+			slog.Error("failed to publish pending key", "server", server.Name, "error", err)
+		}
+	}
+	armKeyRotationTimeout()
+	return keyRotationStatus(), nil
+}
+
+// GetKeyRotationStatus - returns the state of the key rotation
+func GetKeyRotationStatus() KeyRotationStatus {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+	return keyRotationStatus()
+}
+
+func keyRotationStatus() KeyRotationStatus {
+	host := config.Netclient()
+	status := KeyRotationStatus{
+		PublicKey:    host.PrivateKey.PublicKey().String(),
+		Acknowledged: []string{},
+		Waiting:      []string{},
+		LastRotation: host.LastKeyRotation,
+		LastError:    lastRotationError,
+		Interval:     host.KeyRotation.Interval,
+	}
+	if host.PendingKey == nil {
+		return status
+	}
+	status.Pending = true
+	status.PendingKey = host.PendingKey.PrivateKey.PublicKey().String()
+	status.Started = host.PendingKey.Started
+	status.Acknowledged = append(status.Acknowledged, host.PendingKey.Acknowledged...)
+	status.Waiting = waitingServers(host.PendingKey.Acknowledged)
+	return status
+}
+
+// waitingServers - returns the servers that did not acknowledge a pending key yet
+func waitingServers(acknowledged []string) []string {
+	waiting := []string{}
+	for name := range config.GetServerMap() {
+		if !containsString(acknowledged, name) {
+			waiting = append(waiting, name)
+		}
+	}
+	sort.Strings(waiting)
+	return waiting
+}
+
+// pendingPublicKey - returns the public key of a pending rotation, nil if there is none; it does not
+// take the rotation lock, the rotation publishes host updates while holding it
+func pendingPublicKey() *wgtypes.Key {
+	pending := config.Netclient().PendingKey
+	if pending == nil {
+		return nil
+	}
+	key := pending.PrivateKey.PublicKey()
+	return &key
+}
+
+// advertisedHost - returns the host as published to the server, carrying the pending key during a rotation
+// and the traffic key the server encrypts for
+func advertisedHost(server string) models.Host {
+	host := config.Netclient().Host
+	if key := pendingPublicKey(); key != nil {
+		host.PublicKey = *key
+	}
+	host.TrafficKeyPublic = config.Netclient().AdvertisedTrafficKey(server)
+	return host
+}
+
+// ackKeyRotation - records that the server configured the peers for the pending key, which it shows as
+// the key of the host in its peer updates; switches the interface to the pending key once all servers did
+func ackKeyRotation(server string, key wgtypes.Key) {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+	pending := config.Netclient().PendingKey
+	if pending == nil || key != pending.PrivateKey.PublicKey() || containsString(pending.Acknowledged, server) {
+		return
+	}
+	pending.Acknowledged = append(pending.Acknowledged, server)
+	slog.Info("server acknowledged pending wireguard key", "server", server)
+	if len(waitingServers(pending.Acknowledged)) > 0 {
+		if err := config.WriteNetclientConfig(); err != nil {
+			slog.Warn("failed to save key acknowledgement", "error", err)
+		}
+		return
+	}
+	swapKeys()
+}
+
+// rotateKeysNow - switches the interface to a new key without waiting for the servers,
+// a pending rotation is superseded
+func rotateKeysNow() error {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+	config.Netclient().PendingKey = &config.PendingKey{PrivateKey: key, Started: time.Now(), Acknowledged: []string{}}
+	lastRotationError = ""
+	swapKeys()
+	return nil
+}
+
+// swapKeys - switches the interface to the pending key and publishes it to the servers,
+// the caller holds the rotation lock
+func swapKeys() {
+	host := config.Netclient()
+	previous := host.PrivateKey.PublicKey()
+	host.PrivateKey = host.PendingKey.PrivateKey
+	host.PublicKey = host.PrivateKey.PublicKey()
+	host.PendingKey = nil
+	host.LastKeyRotation = time.Now()
+	if rotationTimer != nil {
+		rotationTimer.Stop()
+	}
+	if err := config.WriteNetclientConfig(); err != nil {
+		slog.Error("error saving netclient config:", "error", err)
+	}
+	for _, server := range config.GetServerMap() {
+		if err := PublishHostUpdate(server.Name, models.UpdateHost); err != nil {
+			slog.Error("failed to publish new key", "server", server.Name, "error", err)
+		}
+	}
+	// the reload re-keys the interface in place, the peers stay configured
+	scheduleReload()
+	slog.Info("rotated wireguard keys", "key", host.PublicKey.String(), "previous", previous.String())
+	events.Publish(events.KeyRotated{PublicKey: host.PublicKey.String(), Previous: previous.String()})
+}
+
+// rollbackKeyRotation - drops the pending key and sets the servers back to the key in use,
+// the caller holds the rotation lock
+func rollbackKeyRotation(reason string) {
+	host := config.Netclient()
+	pending := host.PendingKey.PrivateKey.PublicKey()
+	host.PendingKey = nil
+	lastRotationError = reason
+	if err := config.WriteNetclientConfig(); err != nil {
+		slog.Error("error saving netclient config:", "error", err)
+	}
+	for _, server := range config.GetServerMap() {
+		if err := PublishHostUpdate(server.Name, models.UpdateHost); err != nil {
+			slog.Error("failed to publish key rollback", "server", server.Name, "error", err)
+		}
+	}
+	slog.Warn("rolled back wireguard key rotation", "reason", reason, "key", host.PublicKey.String())
+	events.Publish(events.KeyRotationRolledBack{PublicKey: pending.String(), Reason: reason})
+}
+
+// armKeyRotationTimeout - rolls the pending rotation back once its timeout expires,
+// the caller holds the rotation lock
+func armKeyRotationTimeout() {
+	if rotationTimer != nil {
+		rotationTimer.Stop()
+	}
+	host := config.Netclient()
+	key := host.PendingKey.PrivateKey
+	wait := time.Until(host.PendingKey.Started.Add(host.KeyRotation.GetTimeout()))
+	rotationTimer = time.AfterFunc(wait, func() {
+		rotationMutex.Lock()
+		defer rotationMutex.Unlock()
+		pending := config.Netclient().PendingKey
+		if pending == nil || pending.PrivateKey != key {
+			return
+		}
+		rollbackKeyRotation("timed out waiting for servers " + strings.Join(waitingServers(pending.Acknowledged), ", "))
+	})
+}
+
+// resumeKeyRotation - keeps waiting for the servers on a rotation started before the daemon was restarted
+func resumeKeyRotation() {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+	host := config.Netclient()
+	if host.PendingKey == nil {
+		return
+	}
+	slog.Info("resuming wireguard key rotation", "pending", host.PendingKey.PrivateKey.PublicKey().String())
+	armKeyRotationTimeout()
+}
+
+// scheduleKeyRotation - rotates the wireguard keys on the interval of the rotation policy
+func scheduleKeyRotation(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(keyRotationCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !keyRotationDue() {
+				continue
+			}
+			if _, err := RotateKeys(); err != nil {
+				slog.Warn("scheduled key rotation failed", "error", err)
+			}
+		}
+	}
+}
+
+// keyRotationDue - returns true if the interval of the rotation policy passed since the last rotation,
+// the interval of a host that never rotated its keys starts with the first check
+func keyRotationDue() bool {
+	rotationMutex.Lock()
+	defer rotationMutex.Unlock()
+	host := config.Netclient()
+	if host.KeyRotation.Interval <= 0 || host.PendingKey != nil {
+		return false
+	}
+	if host.LastKeyRotation.IsZero() {
+		host.LastKeyRotation = time.Now()
+		if err := config.WriteNetclientConfig(); err != nil {
+			slog.Warn("error saving netclient config:", "error", err)
+		}
+		return false
+	}
+	return time.Since(host.LastKeyRotation) >= time.Duration(host.KeyRotation.Interval)*time.Hour
+}
+
+// RotateKeysCmd - starts a key rotation in the daemon, waiting for its result if wait is set
+func RotateKeysCmd(wait bool) error {
+	var status KeyRotationStatus
+	if err := daemonRequest(http.MethodPost, "/keys/rotate", nil, &status); err != nil {
+		return err
+	}
+	if !status.Pending {
+		fmt.Println("rotated wireguard keys, public key", status.PublicKey)
+		return nil
+	}
+	fmt.Println("advertised new public key", status.PendingKey, "waiting for", strings.Join(status.Waiting, ", "))
+	if !wait {
+		return nil
+	}
+	pendingKey := status.PendingKey
+	for status.Pending && status.PendingKey == pendingKey {
+		time.Sleep(time.Second * 2)
+		if err := daemonRequest(http.MethodGet, "/keys/rotation", nil, &status); err != nil {
+			return err
+		}
+	}
+	if status.PublicKey != pendingKey {
+		return errors.New("key rotation rolled back: " + status.LastError)
+	}
+	fmt.Println("rotated wireguard keys, public key", status.PublicKey)
+	return nil
+}
@@ -0,0 +1,204 @@
+package functions
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// useTempConfig - points the netclient files to a temporary directory and starts the test with an
+// empty host config, the host config and the servers are reset when the test ends
+func useTempConfig(t *testing.T) {
+	config.SetNetclientPath(t.TempDir() + string(os.PathSeparator))
+	config.UpdateNetclient(config.Config{})
+	t.Cleanup(func() {
+		config.SetNetclientPath("")
+		config.UpdateNetclient(config.Config{})
+		config.Servers = make(map[string]config.Server)
+	})
+}
+
+// pendingRotation - starts the test with a host of the servers rotating from the current to the pending key
+func pendingRotation(t *testing.T, servers ...string) (current, pending wgtypes.Key) {
+	is := is.New(t)
+	useTempConfig(t)
+	current, err := wgtypes.GeneratePrivateKey()
+	is.NoErr(err)
+	pending, err = wgtypes.GeneratePrivateKey()
+	is.NoErr(err)
+	config.Servers = make(map[string]config.Server)
+	for _, server := range servers {
+		config.Servers[server] = config.Server{Name: server}
+	}
+	host := config.Netclient()
+	host.PrivateKey = current
+	host.PublicKey = current.PublicKey()
+	host.PendingKey = &config.PendingKey{PrivateKey: pending, Started: time.Now(), Acknowledged: []string{}}
+	t.Cleanup(func() {
+		if rotationTimer != nil {
+			rotationTimer.Stop()
+		}
+		lastRotationError = ""
+		select {
+		case <-reloadChan:
+		default:
+		}
+	})
+	return current, pending
+}
+
+func TestAckKeyRotation(t *testing.T) {
+	t.Run("pending key of all servers", func(t *testing.T) {
+		is := is.New(t)
+		current, pending := pendingRotation(t, "a", "b")
+		other, err := wgtypes.GeneratePrivateKey()
+		is.NoErr(err)
+		pendingKey := pending.PublicKey()
+		// peer updates showing another key of the host do not acknowledge the rotation
+		ackKeyRotation("a", current.PublicKey())
+		ackKeyRotation("a", other.PublicKey())
+		is.Equal(config.Netclient().PendingKey.Acknowledged, []string{})
+		ackKeyRotation("a", pendingKey)
+		ackKeyRotation("a", pendingKey)
+		is.Equal(config.Netclient().PendingKey.Acknowledged, []string{"a"})
+		// the interface stays on the current key until all servers configured the peers for the new one
+		is.Equal(config.Netclient().PrivateKey, current)
+		is.Equal(config.Netclient().PublicKey, current.PublicKey())
+		ackKeyRotation("b", pendingKey)
+		host := config.Netclient()
+		is.True(host.PendingKey == nil)
+		is.Equal(host.PrivateKey, pending)
+		is.Equal(host.PublicKey, pendingKey)
+		is.True(!host.LastKeyRotation.IsZero())
+		is.Equal(len(reloadChan), 1) // the interface is re-keyed by a reload
+	})
+	t.Run("without rotation", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingRotation(t, "a")
+		config.Netclient().PendingKey = nil
+		ackKeyRotation("a", current.PublicKey())
+		is.Equal(config.Netclient().PrivateKey, current)
+		is.True(config.Netclient().LastKeyRotation.IsZero())
+	})
+}
+
+func TestRotateKeys(t *testing.T) {
+	t.Run("pending key is sent next to the current key", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingRotation(t, "a")
+		config.Netclient().PendingKey = nil
+		status, err := RotateKeys()
+		is.NoErr(err)
+		is.True(status.Pending)
+		is.Equal(status.PublicKey, current.PublicKey().String())
+		is.Equal(status.Waiting, []string{"a"})
+		is.Equal(config.Netclient().PublicKey, current.PublicKey())
+		pendingKey := config.Netclient().PendingKey.PrivateKey.PublicKey()
+		is.Equal(pendingPublicKey(), &pendingKey)
+		_, err = RotateKeys()
+		is.Equal(err, ErrKeyRotationPending)
+	})
+	t.Run("without servers", func(t *testing.T) {
+		is := is.New(t)
+		pendingRotation(t)
+		config.Netclient().PendingKey = nil
+		status, err := RotateKeys()
+		is.NoErr(err)
+		is.True(!status.Pending)
+		is.Equal(config.Netclient().PublicKey, config.Netclient().PrivateKey.PublicKey())
+		is.True(pendingPublicKey() == nil)
+	})
+	t.Run("host updates carry the pending key", func(t *testing.T) {
+		is := is.New(t)
+		current, pending := pendingRotation(t)
+		is.Equal(advertisedHost("a").PublicKey, pending.PublicKey())
+		config.Netclient().PendingKey = nil
+		is.Equal(advertisedHost("a").PublicKey, current.PublicKey())
+	})
+}
+
+func TestUpdateKeys(t *testing.T) {
+	is := is.New(t)
+	current, pending := pendingRotation(t, "a")
+	is.NoErr(UpdateKeys())
+	// a server request switches to a new key right away and supersedes a pending rotation
+	host := config.Netclient()
+	is.True(host.PendingKey == nil)
+	is.True(host.PrivateKey != current)
+	is.True(host.PrivateKey != pending)
+	is.Equal(host.PublicKey, host.PrivateKey.PublicKey())
+	is.Equal(advertisedHost("a").PublicKey, host.PublicKey)
+	is.Equal(len(reloadChan), 1)
+}
+
+func TestRollbackKeyRotation(t *testing.T) {
+	t.Run("rollback", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingRotation(t, "a")
+		rotationMutex.Lock()
+		rollbackKeyRotation("timed out")
+		rotationMutex.Unlock()
+		status := GetKeyRotationStatus()
+		is.True(!status.Pending)
+		is.Equal(status.PublicKey, current.PublicKey().String())
+		is.Equal(status.LastError, "timed out")
+		is.Equal(config.Netclient().PrivateKey, current)
+		is.True(pendingPublicKey() == nil)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		is := is.New(t)
+		current, _ := pendingRotation(t, "a", "b")
+		config.Netclient().PendingKey.Started = time.Now().Add(-time.Hour)
+		config.Netclient().PendingKey.Acknowledged = []string{"a"}
+		rotationMutex.Lock()
+		armKeyRotationTimeout()
+		rotationMutex.Unlock()
+		deadline := time.Now().Add(time.Second * 5)
+		for GetKeyRotationStatus().Pending && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond * 10)
+		}
+		status := GetKeyRotationStatus()
+		is.True(!status.Pending)
+		is.Equal(status.PublicKey, current.PublicKey().String())
+		is.Equal(status.LastError, "timed out waiting for servers b")
+	})
+}
+
+func TestKeyRotationDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int
+		last     time.Duration // since the last rotation, never rotated if zero
+		pending  bool
+		due      bool
+	}{
+		{name: "disabled", interval: 0, last: time.Hour * 48},
+		{name: "never rotated", interval: 1},
+		{name: "interval passed", interval: 1, last: time.Hour * 2, due: true},
+		{name: "interval not passed", interval: 24, last: time.Hour * 2},
+		{name: "rotation pending", interval: 1, last: time.Hour * 2, pending: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			pendingRotation(t)
+			host := config.Netclient()
+			if !tt.pending {
+				host.PendingKey = nil
+			}
+			host.KeyRotation.Interval = tt.interval
+			if tt.last != 0 {
+				host.LastKeyRotation = time.Now().Add(-tt.last)
+			}
+			is.Equal(keyRotationDue(), tt.due)
+			if tt.last == 0 && tt.interval > 0 {
+				// the interval starts with the first check
+				is.True(!host.LastKeyRotation.IsZero())
+			}
+		})
+	}
+}
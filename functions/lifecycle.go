@@ -0,0 +1,69 @@
+package functions
+
+import (
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/hooks"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+)
+
+// interfaceUp - announces the configured netmaker interface and runs the post_up hooks
+func interfaceUp() {
+	addresses := []string{}
+	for _, node := range config.GetNodes() {
+		if node.Address.IP != nil {
+			addresses = append(addresses, node.Address.String())
+		}
+		if node.Address6.IP != nil {
+			addresses = append(addresses, node.Address6.String())
+		}
+	}
+	e := events.PostUp{
+		Interface: ncutils.GetInterfaceName(),
+		Addresses: addresses,
+	}
+	events.Publish(e)
+	if err := hooks.Run(e); err != nil {
+		slog.Warn("post_up hooks aborted", "error", err)
+	}
+}
+
+// interfaceDown - runs the pre_down hooks before the netmaker interface is taken down,
+// returns an error if a hook asked to abort
+func interfaceDown(reason string) error {
+	e := events.PreDown{
+		Interface: ncutils.GetInterfaceName(),
+		Reason:    reason,
+	}
+	events.Publish(e)
+	return hooks.Run(e)
+}
+
+// gatewayChanged - announces the default gateway set to or removed from an internet gateway peer
+func gatewayChanged(action string, gateway *net.IPNet) {
+	events.Publish(events.GatewayChanged{
+		Action:  action,
+		Gateway: gateway.IP.String(),
+	})
+}
+
+// serverJoined - announces the registration with a server and runs the server_joined hooks
+func serverJoined(server string) {
+	e := events.ServerJoined{Server: server}
+	events.Publish(e)
+	if err := hooks.Run(e); err != nil {
+		slog.Warn("server_joined hooks aborted", "error", err)
+	}
+}
+
+// serverLeft - announces the removal from a server and runs the server_left hooks
+func serverLeft(server string) {
+	e := events.ServerLeft{Server: server}
+	events.Publish(e)
+	if err := hooks.Run(e); err != nil {
+		slog.Warn("server_left hooks aborted", "error", err)
+	}
+}
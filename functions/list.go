@@ -4,37 +4,152 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/devilcove/httpclient"
 	"github.com/gravitl/netclient/auth"
 	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/nmproxy/wg"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// peersFromServer - peers were fetched from the server
+	peersFromServer = "server"
+	// peersFromLocal - the server was unreachable, peers are taken from the local host peers
+	peersFromLocal = "local"
 )
 
 type output struct {
-	Network   string    `json:"network"`
-	NodeID    string    `json:"node_id"`
-	Connected bool      `json:"connected"`
-	Ipv4Addr  string    `json:"ipv4_addr"`
-	Ipv6Addr  string    `json:"ipv6_addr"`
-	Peers     []peerOut `json:"peers,omitempty"`
+	Network     string    `json:"network" yaml:"network"`
+	NodeID      string    `json:"node_id" yaml:"node_id"`
+	Connected   bool      `json:"connected" yaml:"connected"`
+	Ipv4Addr    string    `json:"ipv4_addr" yaml:"ipv4_addr"`
+	Ipv6Addr    string    `json:"ipv6_addr" yaml:"ipv6_addr"`
+	PeersSource string    `json:"peers_source,omitempty" yaml:"peers_source,omitempty"`
+	Peers       []peerOut `json:"peers,omitempty" yaml:"peers,omitempty"`
 }
 
 type peerOut struct {
-	PublicKey  string   `json:"public_key"`
-	Endpoint   string   `json:"endpoint"`
-	AllowedIps []string `json:"allowed_ips"`
+	PublicKey     string     `json:"public_key" yaml:"public_key"`
+	Name          string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Endpoint      string     `json:"endpoint" yaml:"endpoint"`
+	AllowedIps    []string   `json:"allowed_ips" yaml:"allowed_ips"`
+	LastHandshake *time.Time `json:"last_handshake,omitempty" yaml:"last_handshake,omitempty"`
+	ReceiveBytes  int64      `json:"rx_bytes,omitempty" yaml:"rx_bytes,omitempty"`
+	TransmitBytes int64      `json:"tx_bytes,omitempty" yaml:"tx_bytes,omitempty"`
+	Gateways      []string   `json:"gateways,omitempty" yaml:"gateways,omitempty"`
 }
 
 // List - list network details for specified networks
-// long flag passed passed to cmd line will list additional details about network including peers
-func List(net string, long bool) {
+// long flag passed passed to cmd line will list additional details about network including peers;
+// output is one of json (default), yaml, table or wide, wide always includes the peers
+func List(net string, long bool, output string) error {
+	return list(net, long, output, nil)
+}
+
+// WatchList - prints the list every interval until the process is stopped, the servers are
+// authenticated with once and their tokens reused by every refresh
+func WatchList(net string, long bool, output string, interval time.Duration) error {
+	if output == "wide" {
+		long = true
+	}
+	var tokens map[string]string
+	if long {
+		tokens = authenticateServers(net)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// clear the terminal and move the cursor home
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("every %s: netclient list    %s\n\n", interval, time.Now().Format(time.RFC1123))
+		// pick up changes written by the daemon since the last refresh
+		if _, err := config.ReadNetclientConfig(); err != nil {
+			logger.Log(1, "failed to read netclient config", err.Error())
+		}
+		if err := config.ReadNodeConfig(); err != nil {
+			logger.Log(1, "failed to read node config", err.Error())
+		}
+		if err := config.ReadServerConf(); err != nil {
+			logger.Log(1, "failed to read server config", err.Error())
+		}
+		if err := list(net, long, output, tokens); err != nil {
+			return err
+		}
+		<-ticker.C
+	}
+}
+
+// list - prints the list, the peers are fetched with the tokens of the servers
+// or after authenticating with them if tokens is nil
+func list(net string, long bool, output string, tokens map[string]string) error {
+	switch output {
+	case "", "json", "yaml", "table":
+	case "wide":
+		long = true
+	default:
+		return errors.New("unsupported output format " + output)
+	}
+	listOutput, found := listNetworks(net, long, tokens)
+	if !found {
+		fmt.Println("\nno such network")
+		return nil
+	}
+	return printList(os.Stdout, listOutput, output, long)
+}
+
+// authenticateServers - returns the tokens of the servers of the listed networks by server name,
+// servers failing to authenticate are left out
+func authenticateServers(net string) map[string]string {
+	tokens := make(map[string]string)
+	failed := make(map[string]struct{})
+	host := config.Netclient()
+	for _, node := range config.GetNodes() {
+		if node.Network != net && net != "" {
+			continue
+		}
+		if _, ok := tokens[node.Server]; ok {
+			continue
+		}
+		if _, ok := failed[node.Server]; ok {
+			continue
+		}
+		server := config.GetServer(node.Server)
+		if server == nil {
+			continue
+		}
+		token, err := auth.Authenticate(server, host)
+		if err != nil {
+			logger.Log(1, "failed to authenticate with server", node.Server, err.Error(), ", using local peers")
+			failed[node.Server] = struct{}{}
+			continue
+		}
+		tokens[node.Server] = token
+	}
+	return tokens
+}
+
+// listNetworks - collects the details of the networks, with peers if long is set
+func listNetworks(net string, long bool, tokens map[string]string) ([]output, bool) {
 	listOutput := []output{}
 	found := false
+	var devicePeers map[string]wgtypes.Peer
+	if long {
+		devicePeers = getDevicePeers()
+	}
 	nodes := config.GetNodes()
 	for _, node := range nodes {
 		if node.Network == net || net == "" {
@@ -52,57 +167,234 @@ func List(net string, long bool) {
 				output.Ipv6Addr = node.Address6.String()
 			}
 			if long {
-				peers, err := GetNodePeers(node)
+				output.PeersSource = peersFromServer
+				nodeGet, err := getNodeGet(node, tokens)
 				if err != nil {
-					logger.Log(1, "failed to get peers for node: ", node.ID.String(), " Err: ", err.Error())
-					continue
+					logger.Log(1, "failed to get peers for node: ", node.ID.String(), " Err: ", err.Error(), ", using local peers")
+					output.PeersSource = peersFromLocal
+					nodeGet.Peers = localNodePeers(node)
 				}
-				if len(peers) == 0 {
+				if len(nodeGet.Peers) == 0 {
 					logger.Log(1, "no peers present on network", node.Network)
-					continue
 				}
-				for _, peer := range peers {
+				for _, peer := range nodeGet.Peers {
 					p := peerOut{
 						PublicKey: peer.PublicKey.String(),
+						Name:      nodeGet.PeerIDs[peer.PublicKey.String()].Name,
+						Gateways:  peerGateways(node, peer.AllowedIPs),
 					}
 					if peer.Endpoint != nil {
 						p.Endpoint = peer.Endpoint.String()
 					}
-
 					for _, cidr := range peer.AllowedIPs {
 						p.AllowedIps = append(p.AllowedIps, cidr.String())
 					}
+					if device, ok := devicePeers[p.PublicKey]; ok {
+						if !device.LastHandshakeTime.IsZero() {
+							handshake := device.LastHandshakeTime
+							p.LastHandshake = &handshake
+						}
+						p.ReceiveBytes = device.ReceiveBytes
+						p.TransmitBytes = device.TransmitBytes
+					}
 					output.Peers = append(output.Peers, p)
 				}
 			}
 			listOutput = append(listOutput, output)
 		}
 	}
-	if !found {
-		fmt.Println("\nno such network")
-	} else {
+	sort.Slice(listOutput, func(i, j int) bool {
+		return listOutput[i].Network < listOutput[j].Network
+	})
+	return listOutput, found
+}
+
+// getDevicePeers - returns the peers of the netmaker interface by public key, empty if the interface is down
+func getDevicePeers() map[string]wgtypes.Peer {
+	devicePeers := make(map[string]wgtypes.Peer)
+	peers, err := wg.GetPeers(ncutils.GetInterfaceName())
+	if err != nil {
+		logger.Log(2, "failed to read interface peers", err.Error())
+		return devicePeers
+	}
+	for _, peer := range peers {
+		devicePeers[peer.PublicKey.String()] = peer
+	}
+	return devicePeers
+}
+
+// localNodePeers - returns the peers of the node's server that have an address in the node's network
+func localNodePeers(node config.Node) []wgtypes.PeerConfig {
+	peers := []wgtypes.PeerConfig{}
+	for _, peer := range config.GetServerPeers(node.Server) {
+		if peer.Remove {
+			continue
+		}
+		for _, cidr := range peer.AllowedIPs {
+			if inNetwork(node, cidr.IP) {
+				peers = append(peers, peer)
+				break
+			}
+		}
+	}
+	return peers
+}
+
+// inNetwork - checks if the ip is in one of the node's network ranges
+func inNetwork(node config.Node, ip net.IP) bool {
+	return (node.NetworkRange.IP != nil && node.NetworkRange.Contains(ip)) ||
+		(node.NetworkRange6.IP != nil && node.NetworkRange6.Contains(ip))
+}
+
+// inHostNetworks - checks if the ip is in the network range of any node of the host
+func inHostNetworks(ip net.IP) bool {
+	for _, node := range config.GetNodes() {
+		if inNetwork(node, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerGateways - returns the gateway roles of a peer derived from its allowed ips: a default route
+// makes it an internet gateway, ranges outside all networks of the host an egress gateway and more
+// than one address in the node's network an ingress gateway for the external clients behind it
+func peerGateways(node config.Node, allowedIPs []net.IPNet) []string {
+	var internet, egress bool
+	addresses := 0
+	for _, cidr := range allowedIPs {
+		ones, bits := cidr.Mask.Size()
+		switch {
+		case ones == 0:
+			internet = true
+		case inNetwork(node, cidr.IP):
+			if ones == bits {
+				addresses++
+			}
+		case !inHostNetworks(cidr.IP):
+			egress = true
+		}
+	}
+	gateways := []string{}
+	if internet {
+		gateways = append(gateways, "internet")
+	}
+	if egress {
+		gateways = append(gateways, "egress")
+	}
+	if addresses > 1 {
+		gateways = append(gateways, "ingress")
+	}
+	return gateways
+}
+
+// printList - writes the list in the output format
+func printList(w io.Writer, listOutput []output, format string, long bool) error {
+	switch format {
+	case "", "json":
 		out, err := json.MarshalIndent(listOutput, "", " ")
 		if err != nil {
-			logger.Log(0, "failed to marshal list output: ", err.Error())
+			return err
 		}
-		fmt.Println(string(out))
+		fmt.Fprintln(w, string(out))
+	case "yaml":
+		out, err := yaml.Marshal(listOutput)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, string(out))
+	case "table":
+		printNetworkTable(w, listOutput)
+		if long {
+			printPeerTable(w, listOutput, false)
+		}
+	case "wide":
+		printNetworkTable(w, listOutput)
+		printPeerTable(w, listOutput, true)
+	}
+	return nil
+}
+
+func printNetworkTable(w io.Writer, listOutput []output) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NETWORK\tNODE ID\tCONNECTED\tIPV4\tIPV6")
+	for _, network := range listOutput {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", network.Network, network.NodeID, network.Connected,
+			valueOr(network.Ipv4Addr, "-"), valueOr(network.Ipv6Addr, "-"))
 	}
+	tw.Flush()
+}
+
+func printPeerTable(w io.Writer, listOutput []output, wide bool) {
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if wide {
+		fmt.Fprintln(tw, "NETWORK\tHOSTNAME\tPUBLIC KEY\tENDPOINT\tALLOWED IPS\tHANDSHAKE\tRX\tTX\tGATEWAY\tSOURCE")
+	} else {
+		fmt.Fprintln(tw, "NETWORK\tPUBLIC KEY\tENDPOINT\tALLOWED IPS")
+	}
+	for _, network := range listOutput {
+		for _, peer := range network.Peers {
+			if !wide {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", network.Network, peer.PublicKey,
+					valueOr(peer.Endpoint, "-"), strings.Join(peer.AllowedIps, ","))
+				continue
+			}
+			handshake := "never"
+			if peer.LastHandshake != nil {
+				handshake = time.Since(*peer.LastHandshake).Round(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", network.Network, valueOr(peer.Name, "-"),
+				peer.PublicKey, valueOr(peer.Endpoint, "-"), strings.Join(peer.AllowedIps, ","), handshake,
+				formatBytes(peer.ReceiveBytes), formatBytes(peer.TransmitBytes),
+				valueOr(strings.Join(peer.Gateways, ","), "-"), network.PeersSource)
+		}
+	}
+	tw.Flush()
+}
+
+// formatBytes - formats a byte count with a binary unit
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return strconv.FormatInt(b, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
 // GetNodePeers returns the peers for a given node
 func GetNodePeers(node config.Node) ([]wgtypes.PeerConfig, error) {
+	nodeGet, err := getNodeGet(node, nil)
+	if err != nil {
+		return nil, err
+	}
+	return nodeGet.Peers, nil
+}
 
+// getNodeGet - fetches the node with its peers from the server, with the token of the server
+// or after authenticating with it if tokens is nil
+func getNodeGet(node config.Node, tokens map[string]string) (models.NodeGet, error) {
 	server := config.GetServer(node.Server)
 	if server == nil {
-		return []wgtypes.PeerConfig{}, errors.New("server config not found")
+		return models.NodeGet{}, errors.New("server config not found")
 	}
 	host := config.Netclient()
 	if host == nil {
-		return nil, fmt.Errorf("no configured host found")
+		return models.NodeGet{}, fmt.Errorf("no configured host found")
 	}
-	token, err := auth.Authenticate(server, host)
-	if err != nil {
-		return nil, err
+	token, ok := tokens[node.Server]
+	if tokens == nil {
+		var err error
+		if token, err = auth.Authenticate(server, host); err != nil {
+			return models.NodeGet{}, err
+		}
+	} else if !ok {
+		return models.NodeGet{}, errors.New("not authenticated with server " + node.Server)
 	}
 	endpoint := httpclient.JSONEndpoint[models.NodeGet, models.ErrorResponse]{
 		URL:           "https://" + server.API,
@@ -117,7 +409,7 @@ func GetNodePeers(node config.Node) ([]wgtypes.PeerConfig, error) {
 		if errors.Is(err, httpclient.ErrStatus) {
 			logger.Log(0, "error getting node", strconv.Itoa(errData.Code), errData.Message)
 		}
-		return nil, err
+		return models.NodeGet{}, err
 	}
-	return nodeGet.Peers, nil
+	return nodeGet, nil
 }
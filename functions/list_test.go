@@ -0,0 +1,127 @@
+package functions
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// listNode - returns the node of the network on the server with the address range
+func listNode(network, server, cidr string) config.Node {
+	return config.Node{CommonNode: models.CommonNode{Network: network, Server: server, NetworkRange: mustCIDR(cidr)}}
+}
+
+func TestPeerGateways(t *testing.T) {
+	dev := listNode("dev", "server", "10.0.0.0/16")
+	config.Nodes = config.NodeMap{"dev": dev, "prod": listNode("prod", "server", "10.1.0.0/16")}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	tests := []struct {
+		name       string
+		allowedIPs []string
+		want       []string
+	}{
+		{name: "peer", allowedIPs: []string{"10.0.0.2/32"}, want: []string{}},
+		{name: "internet gateway", allowedIPs: []string{"10.0.0.2/32", "0.0.0.0/0"}, want: []string{"internet"}},
+		{name: "ipv6 internet gateway", allowedIPs: []string{"10.0.0.2/32", "::/0"}, want: []string{"internet"}},
+		{name: "egress gateway", allowedIPs: []string{"10.0.0.2/32", "192.168.0.0/24"}, want: []string{"egress"}},
+		{name: "range of another network of the host", allowedIPs: []string{"10.0.0.2/32", "10.1.0.0/24"}, want: []string{}},
+		{name: "ingress gateway", allowedIPs: []string{"10.0.0.2/32", "10.0.0.3/32"}, want: []string{"ingress"}},
+		{name: "range in the network", allowedIPs: []string{"10.0.0.2/32", "10.0.0.128/25"}, want: []string{}},
+		{
+			name:       "all roles",
+			allowedIPs: []string{"10.0.0.2/32", "10.0.0.3/32", "0.0.0.0/0", "192.168.0.0/24"},
+			want:       []string{"internet", "egress", "ingress"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(peerGateways(dev, planTestPeer(wgtypes.Key{}, tt.allowedIPs...).AllowedIPs), tt.want)
+		})
+	}
+}
+
+// countingServer - returns the address of a server closing every connection and the number of
+// connections it accepted
+func countingServer(t *testing.T) (string, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	accepted := &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), accepted
+}
+
+func TestListTokens(t *testing.T) {
+	useTempConfig(t)
+	api, accepted := countingServer(t)
+	server := config.Server{Name: "a"}
+	server.API = api
+	config.Servers = map[string]config.Server{"a": server}
+	config.Nodes = config.NodeMap{"dev": listNode("dev", "a", "10.0.0.0/16"), "prod": listNode("prod", "a", "10.1.0.0/16")}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	peer := planTestPeer(wgtypes.Key{1}, "10.0.0.2/32")
+	config.UpdateHostPeers("a", []wgtypes.PeerConfig{peer})
+
+	t.Run("authenticated once per server", func(t *testing.T) {
+		is := is.New(t)
+		accepted.Store(0)
+		tokens := authenticateServers("")
+		is.Equal(tokens, map[string]string{}) // the server fails to authenticate
+		is.Equal(accepted.Load(), int32(1))
+	})
+	t.Run("refresh without token", func(t *testing.T) {
+		is := is.New(t)
+		accepted.Store(0)
+		listOutput, found := listNetworks("", true, map[string]string{})
+		is.True(found)
+		// no authentication is attempted, the peers are taken from the host
+		is.Equal(accepted.Load(), int32(0))
+		is.Equal(len(listOutput), 2)
+		is.Equal(listOutput[0].Network, "dev")
+		is.Equal(listOutput[0].PeersSource, peersFromLocal)
+		is.Equal(len(listOutput[0].Peers), 1)
+		is.Equal(listOutput[0].Peers[0].PublicKey, peer.PublicKey.String())
+		is.Equal(len(listOutput[1].Peers), 0)
+	})
+	t.Run("refresh with token", func(t *testing.T) {
+		is := is.New(t)
+		accepted.Store(0)
+		listOutput, found := listNetworks("dev", true, map[string]string{"a": "token"})
+		is.True(found)
+		// the node is fetched with the token, without authenticating first
+		is.Equal(accepted.Load(), int32(1))
+		is.Equal(len(listOutput), 1)
+		is.Equal(listOutput[0].PeersSource, peersFromLocal)
+	})
+	t.Run("without peers", func(t *testing.T) {
+		is := is.New(t)
+		accepted.Store(0)
+		listOutput, found := listNetworks("dev", false, nil)
+		is.True(found)
+		is.Equal(accepted.Load(), int32(0))
+		is.Equal(listOutput[0].PeersSource, "")
+		is.Equal(len(listOutput[0].Peers), 0)
+	})
+	t.Run("no such network", func(t *testing.T) {
+		is := is.New(t)
+		_, found := listNetworks("test", true, map[string]string{})
+		is.True(!found)
+	})
+}
@@ -0,0 +1,62 @@
+package functions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// localAPITimeout - time to wait for the daemon to answer a request of the cli
+const localAPITimeout = time.Second * 30
+
+// daemonRequest - sends a request to the local api of the running daemon with the api token,
+// decodes the response into response if not nil and returns the message of an api error
+func daemonRequest(method, path string, request, response any) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), localAPITimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, "http://netclient"+APIVersionPath+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token, err := config.GetAPIToken(); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Transport: LocalAPITransport()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error.Message == "" {
+			return fmt.Errorf("daemon returned %s", resp.Status)
+		}
+		message := apiErr.Error.Message
+		if len(apiErr.Error.Details) > 0 {
+			message += ": " + strings.Join(apiErr.Error.Details, ", ")
+		}
+		return errors.New(message)
+	}
+	if response == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package functions
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// localAPISocket - path of the unix socket the local api listens on
+func localAPISocket() string {
+	return config.GetNetclientPath() + "netclient.sock"
+}
+
+// listenLocalAPI - listens on the unix socket of the local api, the socket is only accessible by root
+func listenLocalAPI() (net.Listener, error) {
+	socket := localAPISocket()
+	if err := os.MkdirAll(config.GetNetclientPath(), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// create the socket without group/other permissions
+	mask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", socket)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chown(socket, 0, 0); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// dialLocalAPI - connects to the unix socket of the local api
+func dialLocalAPI(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", localAPISocket())
+}
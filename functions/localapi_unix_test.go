@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package functions
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestListenLocalAPI(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("the socket is handed to root")
+	}
+	is := is.New(t)
+	useTempConfig(t)
+	// a socket left behind by an earlier daemon is replaced
+	is.NoErr(os.WriteFile(localAPISocket(), nil, 0644))
+	listener, err := listenLocalAPI()
+	is.NoErr(err)
+	defer listener.Close()
+	info, err := os.Stat(localAPISocket())
+	is.NoErr(err)
+	is.Equal(info.Mode()&os.ModeSocket, os.ModeSocket)
+	is.Equal(info.Mode().Perm(), os.FileMode(0600)) // only root can connect
+	conn, err := dialLocalAPI(context.Background())
+	is.NoErr(err)
+	conn.Close()
+}
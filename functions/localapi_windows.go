@@ -0,0 +1,32 @@
+package functions
+
+import (
+	"context"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+const (
+	// localAPIPipe - named pipe the local api listens on
+	localAPIPipe = `\\.\pipe\netclient`
+	// localAPIPipeSDDL - only SYSTEM and administrators can access the pipe
+	localAPIPipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)"
+)
+
+// localAPISocket - name of the pipe the local api listens on
+func localAPISocket() string {
+	return localAPIPipe
+}
+
+// listenLocalAPI - listens on the named pipe of the local api
+func listenLocalAPI() (net.Listener, error) {
+	return winio.ListenPipe(localAPIPipe, &winio.PipeConfig{
+		SecurityDescriptor: localAPIPipeSDDL,
+	})
+}
+
+// dialLocalAPI - connects to the named pipe of the local api
+func dialLocalAPI(ctx context.Context) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, localAPIPipe)
+}
@@ -0,0 +1,232 @@
+package functions
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker - minimal in-process MQTT 3.1.1 broker for tests, supports connect,
+// qos 0/1 publish with exact topic routing, subscribe, unsubscribe and ping
+type testBroker struct {
+	listener  net.Listener
+	mutex     sync.Mutex
+	conns     map[net.Conn]map[string]bool // client connections and their subscriptions
+	connects  int
+	published []testPublish
+	delay     time.Duration // before acknowledging a connect
+}
+
+type testPublish struct {
+	topic   string
+	payload []byte
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{
+		listener: listener,
+		conns:    make(map[net.Conn]map[string]bool),
+	}
+	go b.serve()
+	t.Cleanup(b.close)
+	return b
+}
+
+// deadBrokerURL - returns a broker url nothing is listening on
+func deadBrokerURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "tcp://" + addr
+}
+
+func (b *testBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) close() {
+	b.listener.Close()
+	b.dropConnections()
+}
+
+// dropConnections - closes all client connections to simulate a broker outage
+func (b *testBroker) dropConnections() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for conn := range b.conns {
+		conn.Close()
+		delete(b.conns, conn)
+	}
+}
+
+// delayConnects - acknowledges the following connects after the delay
+func (b *testBroker) delayConnects(delay time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.delay = delay
+}
+
+// connections - returns the number of open client connections
+func (b *testBroker) connections() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.conns)
+}
+
+func (b *testBroker) connectCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.connects
+}
+
+func (b *testBroker) publishes() []testPublish {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]testPublish{}, b.published...)
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer func() {
+		b.mutex.Lock()
+		delete(b.conns, conn)
+		b.mutex.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.mutex.Lock()
+			b.conns[conn] = make(map[string]bool)
+			b.connects++
+			delay := b.delay
+			b.mutex.Unlock()
+			time.Sleep(delay)
+			b.write(conn, []byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			topicLen := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+topicLen])
+			rest := body[2+topicLen:]
+			if qos > 0 {
+				b.write(conn, []byte{0x40, 0x02, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			b.route(topic, rest)
+		case 8: // SUBSCRIBE
+			ack := []byte{0x90, 0, body[0], body[1]}
+			for payload := body[2:]; len(payload) > 2; {
+				topicLen := int(binary.BigEndian.Uint16(payload))
+				topic := string(payload[2 : 2+topicLen])
+				b.mutex.Lock()
+				if subs, ok := b.conns[conn]; ok {
+					subs[topic] = true
+				}
+				b.mutex.Unlock()
+				ack = append(ack, 0x00)
+				payload = payload[3+topicLen:]
+			}
+			ack[1] = byte(len(ack) - 2)
+			b.write(conn, ack)
+		case 10: // UNSUBSCRIBE
+			b.write(conn, []byte{0xb0, 0x02, body[0], body[1]})
+		case 12: // PINGREQ
+			b.write(conn, []byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// route - records the publish and forwards it with qos 0 to subscribers of the exact topic
+func (b *testBroker) route(topic string, payload []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.published = append(b.published, testPublish{topic: topic, payload: append([]byte{}, payload...)})
+	packet := []byte{0x30}
+	packet = append(packet, encodeLength(2+len(topic)+len(payload))...)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(topic)))
+	packet = append(packet, topic...)
+	packet = append(packet, payload...)
+	for conn, subs := range b.conns {
+		if subs[topic] {
+			conn.Write(packet)
+		}
+	}
+}
+
+func (b *testBroker) write(conn net.Conn, packet []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	conn.Write(packet)
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func encodeLength(length int) []byte {
+	encoded := []byte{}
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		encoded = append(encoded, digit)
+		if length == 0 {
+			return encoded
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package functions
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netmaker/logger"
+)
+
+var (
+	// mqBackoffBase - wait before the second connect attempt, doubled on every further failure
+	mqBackoffBase = time.Second
+	// mqBackoffMax - upper bound of the wait between connect attempts
+	mqBackoffMax = time.Minute
+)
+
+// BrokerStatus - status of the connection to the broker of a server
+type BrokerStatus struct {
+	Server           string    `json:"server"`
+	Broker           string    `json:"broker"`
+	Brokers          []string  `json:"brokers"`
+	Attempts         int       `json:"attempts"`
+	Connected        bool      `json:"connected"`
+	Subscriptions    []string  `json:"subscriptions"`
+	LastConnected    time.Time `json:"last_connected"`
+	LastDisconnected time.Time `json:"last_disconnected"`
+	LastCheckin      time.Time `json:"last_checkin"`
+	LastError        string    `json:"last_error,omitempty"`
+}
+
+// mqClient - connection and subscription state for the brokers of a single server
+type mqClient struct {
+	server           string
+	brokers          []string                                // ordered failover list
+	options          func(broker string) *mqtt.ClientOptions // builds the client options for a broker
+	singleton        bool                                    // created for a single cli operation, not owned by the daemon
+	ctx              context.Context
+	cancel           context.CancelFunc
+	mutex            sync.RWMutex
+	client           mqtt.Client
+	broker           string // broker currently in use
+	attempts         int    // consecutive failed connect attempts
+	subscriptions    map[string]byte
+	lastConnected    time.Time
+	lastDisconnected time.Time
+	lastCheckin      time.Time
+	lastError        error
+}
+
+// mqRegistry - mq clients keyed by server name
+type mqRegistry struct {
+	mutex   sync.RWMutex
+	clients map[string]*mqClient
+}
+
+var mqclients = &mqRegistry{clients: make(map[string]*mqClient)}
+
+// newMQClient - returns an mq client for the brokers of the server, the client is closed with the context
+func newMQClient(parent context.Context, server string, brokers []string, singleton bool, options func(broker string) *mqtt.ClientOptions) *mqClient {
+	ctx, cancel := context.WithCancel(parent)
+	mq := &mqClient{
+		server:        server,
+		brokers:       brokers,
+		options:       options,
+		singleton:     singleton,
+		ctx:           ctx,
+		cancel:        cancel,
+		subscriptions: make(map[string]byte),
+	}
+	if len(brokers) > 0 {
+		mq.broker = brokers[0]
+	}
+	return mq
+}
+
+// get - returns the mq client of a server, nil if there is none
+func (r *mqRegistry) get(server string) *mqClient {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.clients[server]
+}
+
+// add - registers the mq client for its server, replacing any previous client
+func (r *mqRegistry) add(mq *mqClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clients[mq.server] = mq
+}
+
+// remove - removes the given mq client from the registry if it is still registered
+func (r *mqRegistry) remove(mq *mqClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.clients[mq.server] == mq {
+		delete(r.clients, mq.server)
+	}
+}
+
+// all - returns all registered mq clients
+func (r *mqRegistry) all() []*mqClient {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	clients := make([]*mqClient, 0, len(r.clients))
+	for _, mq := range r.clients {
+		clients = append(clients, mq)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].server < clients[j].server
+	})
+	return clients
+}
+
+// connect - connects to the brokers of the server, starting with the current broker and moving
+// to the next one after every failure, waiting with exponential backoff and jitter in between;
+// gives up after maxAttempts failures, or keeps trying until disconnect if maxAttempts <= 0
+func (mq *mqClient) connect(maxAttempts int) error {
+	if len(mq.brokers) == 0 {
+		return errors.New("no brokers for server " + mq.server)
+	}
+	mq.mutex.RLock()
+	next := 0
+	for i := range mq.brokers {
+		if mq.brokers[i] == mq.broker {
+			next = i
+		}
+	}
+	mq.mutex.RUnlock()
+	for {
+		if mq.ctx.Err() != nil {
+			return errors.New("mq client for " + mq.server + " closed")
+		}
+		broker := mq.brokers[next%len(mq.brokers)]
+		client := mqtt.NewClient(mq.clientOptions(broker))
+		mq.mutex.Lock()
+		mq.client = client
+		mq.broker = broker
+		mq.mutex.Unlock()
+		var connecterr error
+		if token := client.Connect(); !token.WaitTimeout(MQTimeout*time.Second) || token.Error() != nil {
+			if token.Error() == nil {
+				connecterr = errors.New("connect timeout")
+			} else {
+				connecterr = token.Error()
+			}
+		}
+		if connecterr == nil {
+			mq.mutex.Lock()
+			if mq.ctx.Err() != nil {
+				// closed while connecting, a disconnect may not have seen this client
+				mq.mutex.Unlock()
+				client.Disconnect(250)
+				return errors.New("mq client for " + mq.server + " closed")
+			}
+			mq.attempts = 0
+			mq.mutex.Unlock()
+			return nil
+		}
+		mq.mutex.Lock()
+		mq.attempts++
+		mq.lastError = connecterr
+		attempts := mq.attempts
+		mq.mutex.Unlock()
+		logger.Log(0, "unable to connect to broker", broker, "for server", mq.server, "attempt", strconv.Itoa(attempts), connecterr.Error())
+		if maxAttempts > 0 && attempts >= maxAttempts {
+			return connecterr
+		}
+		next++
+		select {
+		case <-mq.ctx.Done():
+		case <-time.After(mqBackoff(attempts)):
+		}
+	}
+}
+
+// clientOptions - returns the client options for the broker, with reconnects handled by connect
+// instead of the paho client so that brokers are rotated
+func (mq *mqClient) clientOptions(broker string) *mqtt.ClientOptions {
+	opts := mq.options(broker)
+	opts.SetAutoReconnect(false)
+	opts.SetConnectRetry(false)
+	onConnect := opts.OnConnect
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		mq.setConnected()
+		if onConnect != nil {
+			onConnect(client)
+		}
+	})
+	onConnectionLost := opts.OnConnectionLost
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		mq.setConnectionLost(err)
+		if onConnectionLost != nil {
+			onConnectionLost(client, err)
+		}
+		if mq.singleton {
+			return
+		}
+		go func() {
+			if err := mq.connect(0); err != nil {
+				logger.Log(1, "stopped reconnecting to broker for server", mq.server, err.Error())
+			}
+		}()
+	})
+	return opts
+}
+
+// mqBackoff - returns the wait after the given number of failed attempts, the base
+// wait doubles per attempt up to mqBackoffMax and a random half of it is added as jitter
+func mqBackoff(attempts int) time.Duration {
+	wait := mqBackoffMax
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts < 32 && mqBackoffBase<<(attempts-1) < mqBackoffMax {
+		wait = mqBackoffBase << (attempts - 1)
+	}
+	half := wait / 2
+	jitter, err := rand.Int(rand.Reader, big.NewInt(int64(half)+1))
+	if err != nil {
+		return wait
+	}
+	return half + time.Duration(jitter.Int64())
+}
+
+// disconnect - disconnects from the broker, stops reconnecting and removes the client from the registry
+func (mq *mqClient) disconnect() {
+	mq.cancel()
+	mqclients.remove(mq)
+	client := mq.getClient()
+	if client == nil {
+		return
+	}
+	connected := client.IsConnected()
+	client.Disconnect(250)
+	mq.mutex.Lock()
+	mq.lastDisconnected = time.Now()
+	broker := mq.broker
+	mq.mutex.Unlock()
+	if connected && !mq.singleton {
+		events.Publish(events.BrokerDisconnected{
+			Server: mq.server,
+			Broker: broker,
+		})
+	}
+}
+
+func (mq *mqClient) getClient() mqtt.Client {
+	mq.mutex.RLock()
+	defer mq.mutex.RUnlock()
+	return mq.client
+}
+
+// isConnected - reports whether the client is currently connected to the broker
+func (mq *mqClient) isConnected() bool {
+	client := mq.getClient()
+	return client != nil && client.IsConnected()
+}
+
+// subscribe - subscribes to the topic and records the subscription
+func (mq *mqClient) subscribe(topic string, qos byte, handler mqtt.MessageHandler) error {
+	client := mq.getClient()
+	if client == nil {
+		return errors.New("not connected")
+	}
+	token := client.Subscribe(topic, qos, handler)
+	if !token.WaitTimeout(MQTimeout * time.Second) {
+		return errors.New("connection timeout")
+	}
+	if token.Error() != nil {
+		return token.Error()
+	}
+	mq.mutex.Lock()
+	mq.subscriptions[topic] = qos
+	mq.mutex.Unlock()
+	return nil
+}
+
+// unsubscribe - unsubscribes from the topic and drops the recorded subscription
+func (mq *mqClient) unsubscribe(topic string) error {
+	mq.mutex.Lock()
+	delete(mq.subscriptions, topic)
+	mq.mutex.Unlock()
+	client := mq.getClient()
+	if client == nil {
+		return errors.New("not connected")
+	}
+	token := client.Unsubscribe(topic)
+	if !token.WaitTimeout(MQTimeout * time.Second) {
+		return errors.New("connection timeout")
+	}
+	return token.Error()
+}
+
+// publish - publishes the payload to the topic on the broker
+func (mq *mqClient) publish(topic string, qos byte, payload []byte) error {
+	client := mq.getClient()
+	if client == nil {
+		return errors.New("not connected")
+	}
+	token := client.Publish(topic, qos, false, payload)
+	if !token.WaitTimeout(MQTimeout * time.Second) {
+		return errors.New("connection timeout")
+	}
+	return token.Error()
+}
+
+func (mq *mqClient) setConnected() {
+	mq.mutex.Lock()
+	mq.lastConnected = time.Now()
+	mq.lastError = nil
+	broker := mq.broker
+	mq.mutex.Unlock()
+	if !mq.singleton {
+		events.Publish(events.BrokerConnected{
+			Server: mq.server,
+			Broker: broker,
+		})
+	}
+}
+
+func (mq *mqClient) setConnectionLost(err error) {
+	mq.mutex.Lock()
+	mq.lastDisconnected = time.Now()
+	mq.lastError = err
+	broker := mq.broker
+	mq.mutex.Unlock()
+	if !mq.singleton {
+		disconnected := events.BrokerDisconnected{
+			Server: mq.server,
+			Broker: broker,
+		}
+		if err != nil {
+			disconnected.Error = err.Error()
+		}
+		events.Publish(disconnected)
+	}
+}
+
+// setCheckin - records a successful checkin with the server
+func (mq *mqClient) setCheckin() {
+	mq.mutex.Lock()
+	mq.lastCheckin = time.Now()
+	mq.mutex.Unlock()
+}
+
+// status - returns the current status of the client
+func (mq *mqClient) status() BrokerStatus {
+	connected := mq.isConnected()
+	mq.mutex.RLock()
+	defer mq.mutex.RUnlock()
+	status := BrokerStatus{
+		Server:           mq.server,
+		Broker:           mq.broker,
+		Brokers:          append([]string{}, mq.brokers...),
+		Attempts:         mq.attempts,
+		Connected:        connected,
+		Subscriptions:    make([]string, 0, len(mq.subscriptions)),
+		LastConnected:    mq.lastConnected,
+		LastDisconnected: mq.lastDisconnected,
+		LastCheckin:      mq.lastCheckin,
+	}
+	for topic := range mq.subscriptions {
+		status.Subscriptions = append(status.Subscriptions, topic)
+	}
+	sort.Strings(status.Subscriptions)
+	if mq.lastError != nil {
+		status.LastError = mq.lastError.Error()
+	}
+	return status
+}
+
+// GetBrokerStatus - returns the broker connection status for the given server
+func GetBrokerStatus(server string) (BrokerStatus, bool) {
+	mq := mqclients.get(server)
+	if mq == nil {
+		return BrokerStatus{}, false
+	}
+	return mq.status(), true
+}
+
+// GetBrokerStatuses - returns the broker connection status of all servers with an mq client
+func GetBrokerStatuses() []BrokerStatus {
+	statuses := []BrokerStatus{}
+	for _, mq := range mqclients.all() {
+		statuses = append(statuses, mq.status())
+	}
+	return statuses
+}
@@ -0,0 +1,298 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gravitl/netclient/config"
+	"github.com/matryer/is"
+)
+
+func testMQOptions(broker string) *mqtt.ClientOptions {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(broker)
+	opts.SetClientID("netclient-test")
+	opts.SetConnectTimeout(time.Second)
+	return opts
+}
+
+func setTestBackoff(t *testing.T) {
+	base, max := mqBackoffBase, mqBackoffMax
+	mqBackoffBase, mqBackoffMax = time.Millisecond*10, time.Millisecond*50
+	t.Cleanup(func() {
+		mqBackoffBase, mqBackoffMax = base, max
+	})
+}
+
+func waitFor(t *testing.T, condition func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return false
+}
+
+func TestMQBackoff(t *testing.T) {
+	is := is.New(t)
+	t.Run("doubles per attempt with jitter", func(t *testing.T) {
+		for attempts, wait := range map[int]time.Duration{1: time.Second, 2: time.Second * 2, 4: time.Second * 8} {
+			backoff := mqBackoff(attempts)
+			is.True(backoff >= wait/2)
+			is.True(backoff <= wait)
+		}
+	})
+	t.Run("capped at max", func(t *testing.T) {
+		for _, attempts := range []int{7, 31, 32, 1000} {
+			backoff := mqBackoff(attempts)
+			is.True(backoff >= mqBackoffMax/2)
+			is.True(backoff <= mqBackoffMax)
+		}
+	})
+}
+
+func TestMQClientConnect(t *testing.T) {
+	is := is.New(t)
+	setTestBackoff(t)
+	t.Run("connects once on success", func(t *testing.T) {
+		broker := newTestBroker(t)
+		mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(3))
+		is.Equal(broker.connectCount(), 1)
+		status := mq.status()
+		is.True(status.Connected)
+		is.Equal(status.Broker, broker.url())
+		is.Equal(status.Attempts, 0)
+	})
+	t.Run("fails over to next broker", func(t *testing.T) {
+		broker := newTestBroker(t)
+		dead := deadBrokerURL(t)
+		mq := newMQClient(context.Background(), "test", []string{dead, broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(3))
+		status := mq.status()
+		is.True(status.Connected)
+		is.Equal(status.Broker, broker.url())
+		is.Equal(status.Brokers, []string{dead, broker.url()})
+	})
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		mq := newMQClient(context.Background(), "test", []string{deadBrokerURL(t), deadBrokerURL(t)}, false, testMQOptions)
+		defer mq.disconnect()
+		is.True(mq.connect(3) != nil)
+		status := mq.status()
+		is.True(!status.Connected)
+		is.Equal(status.Attempts, 3)
+		is.True(status.LastError != "")
+	})
+	t.Run("reconnects after connection lost", func(t *testing.T) {
+		broker := newTestBroker(t)
+		mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(0))
+		broker.dropConnections()
+		is.True(waitFor(t, func() bool {
+			return broker.connectCount() == 2 && mq.isConnected()
+		}))
+		is.True(!mq.status().LastDisconnected.IsZero())
+	})
+	t.Run("rotates to backup broker on outage", func(t *testing.T) {
+		primary := newTestBroker(t)
+		backup := newTestBroker(t)
+		mq := newMQClient(context.Background(), "test", []string{primary.url(), backup.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(0))
+		is.Equal(mq.status().Broker, primary.url())
+		primary.close()
+		is.True(waitFor(t, func() bool {
+			return mq.isConnected() && mq.status().Broker == backup.url()
+		}))
+	})
+	t.Run("stops reconnecting after disconnect", func(t *testing.T) {
+		broker := newTestBroker(t)
+		mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+		is.NoErr(mq.connect(0))
+		mq.disconnect()
+		is.True(mq.connect(0) != nil)
+		is.Equal(broker.connectCount(), 1)
+	})
+	t.Run("closed while connecting", func(t *testing.T) {
+		broker := newTestBroker(t)
+		broker.delayConnects(time.Millisecond * 300)
+		mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		result := make(chan error, 1)
+		go func() {
+			result <- mq.connect(0)
+		}()
+		is.True(waitFor(t, func() bool { return broker.connectCount() == 1 }))
+		// the context is closed without reaching the client being connected
+		mq.cancel()
+		is.True((<-result) != nil)
+		is.True(!mq.isConnected())
+		is.True(waitFor(t, func() bool { return broker.connections() == 0 }))
+	})
+}
+
+func TestMQClientSubscribe(t *testing.T) {
+	is := is.New(t)
+	broker := newTestBroker(t)
+	mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+	defer mq.disconnect()
+	is.NoErr(mq.connect(1))
+	received := make(chan []byte, 1)
+	is.NoErr(mq.subscribe("test/topic", 0, func(c mqtt.Client, m mqtt.Message) {
+		received <- m.Payload()
+	}))
+	is.Equal(mq.status().Subscriptions, []string{"test/topic"})
+	is.NoErr(mq.publish("test/topic", 1, []byte("hello")))
+	select {
+	case payload := <-received:
+		is.Equal(string(payload), "hello")
+	case <-time.After(time.Second * 5):
+		t.Fatal("message not received")
+	}
+	is.NoErr(mq.unsubscribe("test/topic"))
+	is.Equal(len(mq.status().Subscriptions), 0)
+}
+
+func TestSetupMQTTSingleton(t *testing.T) {
+	setTestBackoff(t)
+	t.Run("replaces the previous singleton", func(t *testing.T) {
+		is := is.New(t)
+		broker := newTestBroker(t)
+		server := &config.Server{Name: "test"}
+		server.Broker = broker.url()
+		defer closeMQTTSingleton("test")
+		is.NoErr(setupMQTTSingleton(server, true))
+		first := mqclients.get("test")
+		is.NoErr(setupMQTTSingleton(server, true))
+		second := mqclients.get("test")
+		is.True(first != second)
+		// the first client is disconnected and stops reconnecting
+		is.True(!first.isConnected())
+		is.True(first.ctx.Err() != nil)
+		is.True(second.isConnected())
+		is.Equal(broker.connectCount(), 2)
+	})
+	t.Run("uses the client of the daemon", func(t *testing.T) {
+		is := is.New(t)
+		broker := newTestBroker(t)
+		mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(0))
+		mqclients.add(mq)
+		server := &config.Server{Name: "test"}
+		server.Broker = broker.url()
+		is.NoErr(setupMQTTSingleton(server, true))
+		closeMQTTSingleton("test")
+		is.True(mqclients.get("test") == mq)
+		is.True(mq.isConnected())
+		is.Equal(broker.connectCount(), 1)
+	})
+}
+
+func TestMessageQueue(t *testing.T) {
+	setTestBackoff(t)
+	// startQueue - runs the message queue of a server with an unreachable broker until it is registered
+	startQueue := func(t *testing.T) (*mqClient, context.CancelFunc, *sync.WaitGroup) {
+		useTempConfig(t)
+		server := &config.Server{Name: "test"}
+		server.Broker = deadBrokerURL(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go messageQueue(ctx, wg, server)
+		if !waitFor(t, func() bool { return mqclients.get("test") != nil }) {
+			t.Fatal("message queue did not register a client")
+		}
+		return mqclients.get("test"), cancel, wg
+	}
+	// stopped - returns true if the message queue returns in time
+	stopped := func(wg *sync.WaitGroup) bool {
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return true
+		case <-time.After(time.Second * 5):
+			return false
+		}
+	}
+	t.Run("cancel stops connecting", func(t *testing.T) {
+		is := is.New(t)
+		mq, cancel, wg := startQueue(t)
+		cancel()
+		is.True(stopped(wg))
+		is.True(mq.ctx.Err() != nil)
+		is.True(mqclients.get("test") == nil)
+	})
+	t.Run("disconnects its own client", func(t *testing.T) {
+		is := is.New(t)
+		mq, cancel, wg := startQueue(t)
+		// the server was removed and added again by a reload
+		other := newMQClient(context.Background(), "test", []string{deadBrokerURL(t)}, false, testMQOptions)
+		defer other.disconnect()
+		mqclients.add(other)
+		cancel()
+		is.True(stopped(wg))
+		is.True(mq.ctx.Err() != nil)
+		is.True(mqclients.get("test") == other)
+		is.NoErr(other.ctx.Err())
+	})
+}
+
+func TestStartServers(t *testing.T) {
+	is := is.New(t)
+	setTestBackoff(t)
+	useTempConfig(t)
+	// unreachable brokers keep the clients connecting without running the connect handlers
+	brokers := map[string]string{"one": deadBrokerURL(t), "two": deadBrokerURL(t)}
+	servers := make(map[string]config.Server)
+	for name, broker := range brokers {
+		server := config.Server{Name: name}
+		server.Broker = broker
+		servers[name] = server
+	}
+	config.Servers = servers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wg := &sync.WaitGroup{}
+	state := newDaemonState(ctx)
+	state.startServers(wg)
+	is.Equal(sortedKeys(state.servers), []string{"one", "two"})
+	// each server gets a message queue for its own brokers
+	clients := make(map[string]*mqClient)
+	for name, broker := range brokers {
+		name := name
+		is.True(waitFor(t, func() bool { return mqclients.get(name) != nil }))
+		clients[name] = mqclients.get(name)
+		is.Equal(clients[name].status().Brokers, []string{broker})
+	}
+	// stopping one server leaves the others running
+	state.servers["one"]()
+	is.True(waitFor(t, func() bool { return mqclients.get("one") == nil }))
+	is.True(clients["one"].ctx.Err() != nil)
+	is.NoErr(clients["two"].ctx.Err())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("message queues did not stop")
+	}
+	is.True(mqclients.get("two") == nil)
+}
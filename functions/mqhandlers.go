@@ -10,7 +10,7 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gravitl/netclient/config"
-	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/events"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netclient/networking"
 	proxyCfg "github.com/gravitl/netclient/nmproxy/config"
@@ -18,7 +18,6 @@ import (
 	"github.com/gravitl/netclient/routes"
 	"github.com/gravitl/netclient/wireguard"
 	"github.com/gravitl/netmaker/models"
-	"github.com/gravitl/txeh"
 	"golang.org/x/exp/slog"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -36,8 +35,7 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 	network := parseNetworkFromTopic(msg.Topic())
 	slog.Info("processing node update for network", "network", network)
 	node := config.GetNode(network)
-	server := config.Servers[node.Server]
-	data, err := decryptMsg(server.Name, msg.Payload())
+	data, err := decryptMsg(node.Server, msg.Topic(), msg.Payload())
 	if err != nil {
 		slog.Error("error decrypting message", "error", err)
 		return
@@ -64,7 +62,7 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 	switch newNode.Action {
 	case models.NODE_DELETE:
 		slog.Info("received delete request for", "node", newNode.ID, "network", newNode.Network)
-		unsubscribeNode(client, &newNode)
+		unsubscribeNode(&newNode)
 		if _, err = LeaveNetwork(newNode.Network, true); err != nil {
 			if !strings.Contains("rpc error", err.Error()) {
 				slog.Error("failed to leave network, please check that local files for network were removed", "network", newNode.Network, "error", err)
@@ -72,6 +70,11 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 			}
 		}
 		slog.Info("node was deleted", "node", newNode.ID, "network", newNode.Network)
+		events.Publish(events.NodeDeleted{
+			Server:  newNode.Server,
+			Network: newNode.Network,
+			NodeID:  newNode.ID.String(),
+		})
 		return
 	case models.NODE_FORCE_UPDATE:
 		ifaceDelta = true
@@ -89,6 +92,13 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 		slog.Error("could not configure netmaker interface", "error", err)
 		return
 	}
+	events.Publish(events.NodeUpdated{
+		Server:    newNode.Server,
+		Network:   newNode.Network,
+		NodeID:    newNode.ID.String(),
+		Action:    serverNode.Action,
+		Connected: newNode.Connected,
+	})
 	time.Sleep(time.Second)
 	if ifaceDelta { // if a change caused an ifacedelta we need to notify the server to update the peers
 		doneErr := publishSignal(&newNode, DONE)
@@ -116,7 +126,7 @@ func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 	slog.Info("processing peer update for server", "server", serverName)
-	data, err := decryptMsg(serverName, msg.Payload())
+	data, err := decryptMsg(serverName, msg.Topic(), msg.Payload())
 	if err != nil {
 		return
 	}
@@ -140,16 +150,30 @@ func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 		server.Version = peerUpdate.ServerVersion
 		config.WriteServerConfig()
 	}
+	// the server configured the peers for a pending key once it shows it as the key of the host
+	ackKeyRotation(serverName, peerUpdate.Host.PublicKey)
+	if config.Netclient().PlanMode && recordPeerPlan(serverName, &peerUpdate) {
+		return
+	}
+	applyPeerUpdate(serverName, &peerUpdate)
+}
+
+// applyPeerUpdate - applies a peer update of the server to the interface, routes, gateways and proxy
+func applyPeerUpdate(serverName string, peerUpdate *models.HostPeerUpdate) {
+	supersedeProxySnapshot(serverName)
 	// endpoint detection always comes from the server
 	config.Netclient().Host.EndpointDetection = peerUpdate.Host.EndpointDetection
 	gwDetected := config.GW4PeerDetected || config.GW6PeerDetected
 	currentGW4 := config.GW4Addr
 	currentGW6 := config.GW6Addr
-	isInetGW := config.UpdateHostPeers(peerUpdate.Peers)
+	previousPeers := config.GetServerPeers(serverName)
+	isInetGW := config.UpdateHostPeers(serverName, peerUpdate.Peers)
 	_ = config.WriteNetclientConfig()
 	_ = wireguard.SetPeers(false)
+	publishPeerEvents(serverName, previousPeers, peerUpdate.Peers)
+	saveSnapshotPeers(serverName, peerUpdate)
 	wireguard.GetInterface().GetPeerRoutes()
-	if err = routes.SetNetmakerPeerEndpointRoutes(config.Netclient().DefaultInterface); err != nil {
+	if err := routes.SetNetmakerPeerEndpointRoutes(config.Netclient().DefaultInterface); err != nil {
 		slog.Warn("error when setting peer routes after peer update", "error", err)
 	}
 	_ = wireguard.GetInterface().ApplyAddrs(true)
@@ -167,15 +191,14 @@ func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 	)
 	if config.Netclient().Host.EndpointDetection {
 		slog.Debug("endpoint detection enabled")
-		go handleEndpointDetection(&peerUpdate)
+		go handleEndpointDetection(peerUpdate)
 	} else {
 		slog.Debug("endpoint detection disabled")
 	}
 	if proxyCfg.GetCfg().IsProxyRunning() {
 		time.Sleep(time.Second * 2) // sleep required to avoid race condition
-		ProxyManagerChan <- &peerUpdate
+		ProxyManagerChan <- peerUpdate
 	}
-
 }
 
 // HostUpdate - mq handler for host update host/update/<HOSTID>/<SERVERNAME>
@@ -183,12 +206,11 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 	var hostUpdate models.HostUpdate
 	var err error
 	serverName := parseServerFromTopic(msg.Topic())
-	server := config.GetServer(serverName)
-	if server == nil {
+	if config.GetServer(serverName) == nil {
 		slog.Error("server not found in config", "server", serverName)
 		return
 	}
-	data, err := decryptMsg(serverName, msg.Payload())
+	data, err := decryptMsg(serverName, msg.Topic(), msg.Payload())
 	if err != nil {
 		slog.Error("error decrypting message", "error", err)
 		return
@@ -199,64 +221,110 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 	slog.Info("processing host update", "server", serverName, "action", hostUpdate.Action)
-	var resetInterface, restartDaemon, clearMsg bool
+	if config.Netclient().PlanMode && heldInPlan(hostUpdate.Action) && recordHostPlan(serverName, &hostUpdate, data) {
+		// the plan keeps the update, it is not delivered again
+		clearRetainedMsg(client, msg.Topic())
+		return
+	}
+	applyHostUpdate(serverName, &hostUpdate, data, func() {
+		clearRetainedMsg(client, msg.Topic())
+	})
+}
+
+// heldInPlan - returns true for the host updates recorded in the plan while plan mode is on,
+// they change the networks, the interface or the acl policies of the host
+func heldInPlan(action models.HostMqAction) bool {
+	switch action {
+	case models.JoinHostToNetwork, models.DeleteHost, models.UpdateHost, UpdateAclPolicy:
+		return true
+	}
+	return false
+}
+
+// applyHostUpdate - applies a host update of the server, clearRetained clears the retained
+// message the update came with
+func applyHostUpdate(serverName string, hostUpdate *models.HostUpdate, data []byte, clearRetained func()) {
+	server := config.GetServer(serverName)
+	if server == nil {
+		slog.Error("server not found in config", "server", serverName)
+		return
+	}
+	var err error
+	var resetInterface, reload, clearMsg bool
 	switch hostUpdate.Action {
 	case models.JoinHostToNetwork:
+		// the interface is reset with the new node, the hooks run against it as it is before the join
+		if !resetAllowed(serverName, hostUpdate) {
+			return
+		}
 		commonNode := hostUpdate.Node.CommonNode
 		nodeCfg := config.Node{
 			CommonNode: commonNode,
 		}
 		config.UpdateNodeMap(hostUpdate.Node.Network, nodeCfg)
-		server := config.GetServer(serverName)
-		if server == nil {
-			return
-		}
 		server.Nodes[hostUpdate.Node.Network] = true
 		config.UpdateServer(serverName, *server)
 		config.WriteNodeConfig()
 		config.WriteServerConfig()
 		slog.Info("added node to network", "network", hostUpdate.Node.Network, "server", serverName)
-		clearRetainedMsg(client, msg.Topic()) // clear message before ACK
+		clearRetained() // clear message before ACK
 		if err = PublishHostUpdate(serverName, models.Acknowledgement); err != nil {
 			slog.Error("failed to response with ACK to server", "server", serverName, "error", err)
 		}
 		resetInterface = true
 	case models.DeleteHost:
-		clearRetainedMsg(client, msg.Topic())
-		unsubscribeHost(client, serverName)
-		deleteHostCfg(client, serverName)
+		clearRetained()
+		unsubscribeHost(serverName)
+		deleteHostCfg(serverName)
 		config.WriteNodeConfig()
 		config.WriteServerConfig()
-		restartDaemon = true
+		reload = true
 	case models.UpdateHost:
-		resetInterface, restartDaemon = config.UpdateHost(&hostUpdate.Host)
+		// a reload rebinds the ports without taking the interface down
+		if resetInterface, reload = config.HostChanges(&hostUpdate.Host); resetInterface && !reload && !resetAllowed(serverName, hostUpdate) {
+			return
+		}
+		config.UpdateHost(&hostUpdate.Host)
 		clearMsg = true
 	case models.RequestAck:
-		clearRetainedMsg(client, msg.Topic()) // clear message before ACK
+		clearRetained() // clear message before ACK
 		if err = PublishHostUpdate(serverName, models.Acknowledgement); err != nil {
 			slog.Error("failed to response with ACK to server", "server", serverName, "error", err)
 		}
 	case models.SignalHost:
 		turn.PeerSignalCh <- hostUpdate.Signal
 	case models.UpdateKeys:
-		clearRetainedMsg(client, msg.Topic()) // clear message
+		clearRetained() // clear message
 		UpdateKeys()
+	case UpdateAclPolicy:
+		clearRetained() // the policy is kept on disk
+		if err = updateAclPolicy(serverName, hostUpdate.Node.Network, data); err != nil {
+			slog.Error("failed to update acl policy", "server", serverName, "network", hostUpdate.Node.Network, "error", err)
+			return
+		}
 	default:
 		slog.Error("unknown host action", "action", hostUpdate.Action)
 		return
 	}
 	if err = config.WriteNetclientConfig(); err != nil {
 		slog.Error("failed to write host config", "error", err)
-		return
+		if !resetInterface || reload {
+			return
+		}
+		// the pre_down hooks ran, the interface is reset with the update applied in memory
 	}
+	events.Publish(events.HostUpdated{
+		Server:  serverName,
+		Action:  string(hostUpdate.Action),
+		Network: hostUpdate.Node.Network,
+	})
 
-	if restartDaemon {
+	if reload {
 		if clearMsg {
-			clearRetainedMsg(client, msg.Topic())
-		}
-		if err := daemon.Restart(); err != nil {
-			slog.Error("failed to restart daemon", "error", err)
+			clearRetained()
 		}
+		// rebinds the ports or stops the message queue of a deleted host without taking the interface down
+		scheduleReload()
 		return
 	}
 	if resetInterface {
@@ -268,6 +336,8 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 			slog.Error("could not configure netmaker interface", "error", err)
 			return
 		}
+		interfaceUp()
+		applyAclPolicies()
 
 		if err = wireguard.SetPeers(false); err == nil {
 			if err = routes.SetNetmakerPeerEndpointRoutes(config.Netclient().DefaultInterface); err != nil {
@@ -277,6 +347,23 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 	}
 }
 
+// resetAllowed - runs the pre_down hooks before a host update of the server resets the interface,
+// returns false and announces the refused update if a hook aborted the reset
+func resetAllowed(serverName string, hostUpdate *models.HostUpdate) bool {
+	err := interfaceDown("interface reset")
+	if err == nil {
+		return true
+	}
+	slog.Warn("pre_down hooks aborted, not applying host update", "server", serverName, "action", hostUpdate.Action, "network", hostUpdate.Node.Network, "error", err)
+	events.Publish(events.HostUpdateRefused{
+		Server:  serverName,
+		Action:  string(hostUpdate.Action),
+		Network: hostUpdate.Node.Network,
+		Reason:  err.Error(),
+	})
+	return false
+}
+
 // handleEndpointDetection - select best interface for each peer and set it as endpoint
 func handleEndpointDetection(peerUpdate *models.HostPeerUpdate) {
 	hostPubKey := config.Netclient().PublicKey.String()
@@ -314,17 +401,91 @@ func handleEndpointDetection(peerUpdate *models.HostPeerUpdate) {
 	}
 }
 
-func deleteHostCfg(client mqtt.Client, server string) {
-	config.DeleteServerHostPeerCfg()
+// publishPeerEvents - publishes the peer changes of a server's peer update, peers of the
+// previous update missing from the current one were removed
+func publishPeerEvents(server string, previous, current []wgtypes.PeerConfig) {
+	known := make(map[wgtypes.Key]wgtypes.PeerConfig)
+	for _, peer := range previous {
+		if !peer.Remove {
+			known[peer.PublicKey] = peer
+		}
+	}
+	seen := make(map[wgtypes.Key]struct{}, len(current))
+	for _, peer := range current {
+		seen[peer.PublicKey] = struct{}{}
+		old, ok := known[peer.PublicKey]
+		switch {
+		case peer.Remove:
+			if ok {
+				events.Publish(events.PeerRemoved{
+					Server:    server,
+					PublicKey: peer.PublicKey.String(),
+				})
+			}
+		case !ok:
+			events.Publish(events.PeerAdded{
+				Server:     server,
+				PublicKey:  peer.PublicKey.String(),
+				Endpoint:   udpAddrString(peer.Endpoint),
+				AllowedIPs: ipNetStrings(peer.AllowedIPs),
+			})
+		case udpAddrString(old.Endpoint) != udpAddrString(peer.Endpoint) ||
+			strings.Join(ipNetStrings(old.AllowedIPs), ",") != strings.Join(ipNetStrings(peer.AllowedIPs), ","):
+			events.Publish(events.PeerUpdated{
+				Server:     server,
+				PublicKey:  peer.PublicKey.String(),
+				Endpoint:   udpAddrString(peer.Endpoint),
+				AllowedIPs: ipNetStrings(peer.AllowedIPs),
+			})
+		}
+	}
+	for _, peer := range previous {
+		if _, ok := seen[peer.PublicKey]; ok || peer.Remove {
+			continue
+		}
+		// a peer listed twice in the previous update is only removed once
+		seen[peer.PublicKey] = struct{}{}
+		events.Publish(events.PeerRemoved{
+			Server:    server,
+			PublicKey: peer.PublicKey.String(),
+		})
+	}
+}
+
+func udpAddrString(addr *net.UDPAddr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func ipNetStrings(ipNets []net.IPNet) []string {
+	out := make([]string, 0, len(ipNets))
+	for i := range ipNets {
+		out = append(out, ipNets[i].String())
+	}
+	return out
+}
+
+func deleteHostCfg(server string) {
+	config.DeleteServerHostPeerCfg(server)
 	nodes := config.GetNodes()
 	for k, node := range nodes {
 		node := node
 		if node.Server == server {
-			unsubscribeNode(client, &node)
+			unsubscribeNode(&node)
 			config.DeleteNode(k)
 		}
 	}
 	config.DeleteServer(server)
+	dropOutbox(server)
+	dropSnapshot(server)
+	dropPlan(server)
+	dropReplay(server)
+	meshDNS.drop(server)
+	dropAclPolicies(server)
+	applyAclPolicies()
+	serverLeft(server)
 }
 
 func parseNetworkFromTopic(topic string) string {
@@ -351,7 +512,7 @@ func dnsUpdate(client mqtt.Client, msg mqtt.Message) {
 		slog.Error("server not found in config", "server", serverName)
 		return
 	}
-	data, err := decryptMsg(serverName, msg.Payload())
+	data, err := decryptMsg(serverName, msg.Topic(), msg.Payload())
 	if err != nil {
 		return
 	}
@@ -368,42 +529,48 @@ func dnsUpdate(client mqtt.Client, msg mqtt.Message) {
 	}
 	insert("dns", lastDNSUpdate, string(data))
 	slog.Info("received dns update", "name", dns.Name, "address", dns.Address, "action", dns.Action)
-	applyDNSUpdate(dns)
+	if config.Netclient().PlanMode && recordDNSPlan(serverName, config.PlanDNS{Entries: []models.DNSUpdate{dns}}) {
+		return
+	}
+	commitDNSUpdate(serverName, dns)
+}
+
+// commitDNSUpdate - applies a dns update of the server and records it in the snapshot
+func commitDNSUpdate(serverName string, dns models.DNSUpdate) {
+	if applyDNSUpdate(serverName, dns) {
+		saveSnapshotDNS(serverName, dns)
+		events.Publish(events.DNSUpdated{
+			Server:     serverName,
+			Action:     dns.Action.String(),
+			Name:       dns.Name,
+			NewName:    dns.NewName,
+			Address:    dns.Address,
+			NewAddress: dns.NewAddress,
+		})
+	}
 }
 
-func applyDNSUpdate(dns models.DNSUpdate) {
+// applyDNSUpdate - applies the dns update of the server to the dns table and, in hosts mode,
+// writes the table to the hosts file, returns true if it was applied
+func applyDNSUpdate(serverName string, dns models.DNSUpdate) bool {
 	if config.Netclient().Debug {
 		log.Println(dns)
 	}
-	hosts, err := txeh.NewHostsDefault()
-	if err != nil {
-		slog.Error("failed to read hosts file", "error", err)
-		return
+	seedHostsDNS()
+	if !meshDNS.apply(serverName, dns) {
+		slog.Error("failed to apply dns update", "action", int(dns.Action), "name", dns.Name, "address", dns.Address)
+		return false
 	}
-	switch dns.Action {
-	case models.DNSInsert:
-		hosts.AddHost(dns.Address, dns.Name, etcHostsComment)
-	case models.DNSDeleteByName:
-		hosts.RemoveHost(dns.Name, etcHostsComment)
-	case models.DNSDeleteByIP:
-		hosts.RemoveAddress(dns.Address, etcHostsComment)
-	case models.DNSReplaceName:
-		ok, ip, _ := hosts.HostAddressLookup(dns.Name, txeh.IPFamilyV4, etcHostsComment)
-		if !ok {
-			slog.Error("failed to find dns address for host", "host", dns.Name)
-			return
-		}
-		dns.Address = ip
-		hosts.RemoveHost(dns.Name, etcHostsComment)
-		hosts.AddHost(dns.Address, dns.NewName, etcHostsComment)
-	case models.DNSReplaceIP:
-		hosts.RemoveAddress(dns.Address, etcHostsComment)
-		hosts.AddHost(dns.NewAddress, dns.Name, etcHostsComment)
-	}
-	if err := hosts.Save(); err != nil {
+	// sources of the acl policies may name the peer
+	applyAclPolicies()
+	if config.Netclient().DNS.Resolver() {
+		return true
+	}
+	if err := writeHostsDNS(); err != nil {
 		slog.Error("error saving hosts file", "error", err)
-		return
+		return false
 	}
+	return true
 }
 
 // dnsAll- mq handler for host update dnsall/<HOSTID>/server
@@ -422,7 +589,7 @@ func dnsAll(client mqtt.Client, msg mqtt.Message) {
 		slog.Error("server not found in config", "server", serverName)
 		return
 	}
-	data, err := decryptMsg(serverName, msg.Payload())
+	data, err := decryptMsg(serverName, msg.Topic(), msg.Payload())
 	if err != nil {
 		return
 	}
@@ -442,27 +609,42 @@ func dnsAll(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 	insert("dnsall", lastALLDNSUpdate, string(data))
-	applyAllDNS(dns)
+	if config.Netclient().PlanMode && recordDNSPlan(serverName, config.PlanDNS{Replace: true, Entries: dns}) {
+		return
+	}
+	commitAllDNS(serverName, dns)
 }
 
-func applyAllDNS(dns []models.DNSUpdate) {
-	hosts, err := txeh.NewHostsDefault()
-	if err != nil {
-		slog.Error("failed to read hosts file", "error", err)
-		return
+// commitAllDNS - applies the full set of dns entries of the server and records it in the snapshot
+func commitAllDNS(serverName string, dns []models.DNSUpdate) {
+	if applyAllDNS(serverName, dns) {
+		replaceSnapshotDNS(serverName, dns)
+		events.Publish(events.DNSReplaced{
+			Server:  serverName,
+			Entries: len(dns),
+		})
 	}
+}
+
+// applyAllDNS - replaces the names of the server in the dns table with the dns entries and,
+// in hosts mode, writes the table to the hosts file, returns true if they were applied
+func applyAllDNS(serverName string, dns []models.DNSUpdate) bool {
 	for _, entry := range dns {
 		if entry.Action != models.DNSInsert {
 			slog.Info("invalid dns actions", "action", entry.Action)
-			continue
 		}
-		hosts.AddHost(entry.Address, entry.Name, etcHostsComment)
 	}
-
-	if err := hosts.Save(); err != nil {
+	seedHostsDNS()
+	meshDNS.replace(serverName, dns)
+	applyAclPolicies()
+	if config.Netclient().DNS.Resolver() {
+		return true
+	}
+	if err := writeHostsDNS(); err != nil {
 		slog.Error("error saving hosts file", "error", err)
-		return
+		return false
 	}
+	return true
 }
 
 func getAllAllowedIPs(peers []wgtypes.PeerConfig) (cidrs []net.IPNet) {
@@ -495,31 +677,45 @@ func handlePeerInetGateways(gwDetected, isHostInetGateway, gwDelta bool, origina
 		if config.GW4PeerDetected {
 			if err := routes.RemoveDefaultGW(originalGW); err != nil {
 				slog.Error("failed to remove default gateway from peer", "gateway", originalGW, "error", err)
+			} else {
+				gatewayChanged("removed", originalGW)
 			}
 			if err := routes.SetDefaultGateway(&config.GW4Addr); err != nil {
 				slog.Error("failed to set default gateway to peer", "gateway", config.GW4Addr, "error", err)
+			} else {
+				gatewayChanged("set", &config.GW4Addr)
 			}
 		} else if config.GW6PeerDetected {
 			if err := routes.SetDefaultGateway(&config.GW6Addr); err != nil {
 				slog.Error("failed to set default gateway to peer", "gateway", config.GW6Addr, "error", err)
+			} else {
+				gatewayChanged("set", &config.GW6Addr)
 			}
 		}
 	} else {
 		if !gwDetected && config.GW4PeerDetected && !isHostInetGateway { // ipv4 gateways take priority
 			if err := routes.SetDefaultGateway(&config.GW4Addr); err != nil {
 				slog.Error("failed to set default gateway to peer", "gateway", config.GW4Addr, "error", err)
+			} else {
+				gatewayChanged("set", &config.GW4Addr)
 			}
 		} else if gwDetected && !config.GW4PeerDetected {
 			if err := routes.RemoveDefaultGW(&config.GW4Addr); err != nil {
 				slog.Error("failed to remove default gateway to peer", "gateway", config.GW4Addr, "error", err)
+			} else {
+				gatewayChanged("removed", &config.GW4Addr)
 			}
 		} else if !gwDetected && config.GW6PeerDetected && !isHostInetGateway {
 			if err := routes.SetDefaultGateway(&config.GW6Addr); err != nil {
 				slog.Error("failed to set default gateway to peer", "gateway", config.GW6Addr, "error", err)
+			} else {
+				gatewayChanged("set", &config.GW6Addr)
 			}
 		} else if gwDetected && !config.GW6PeerDetected {
 			if err := routes.RemoveDefaultGW(&config.GW6Addr); err != nil {
 				slog.Error("failed to remove default gateway to peer", "gateway", config.GW6Addr, "error", err)
+			} else {
+				gatewayChanged("removed", &config.GW6Addr)
 			}
 		}
 	}
@@ -0,0 +1,154 @@
+package functions
+
+import (
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// peerEvents - returns the name and peer of the events received by the subscription
+func peerEvents(t *testing.T, sub *events.Subscription, keys map[string]wgtypes.Key) []string {
+	names := make(map[string]string, len(keys))
+	for name, key := range keys {
+		names[key.String()] = name
+	}
+	received := []string{}
+	for {
+		select {
+		case envelope := <-sub.C:
+			var key string
+			switch event := envelope.Data.(type) {
+			case events.PeerAdded:
+				key = event.PublicKey
+			case events.PeerUpdated:
+				key = event.PublicKey
+			case events.PeerRemoved:
+				key = event.PublicKey
+			default:
+				t.Fatalf("unexpected event %s", envelope.Name)
+			}
+			received = append(received, envelope.Name+" "+names[key])
+		default:
+			return received
+		}
+	}
+}
+
+func TestPublishPeerEvents(t *testing.T) {
+	keys := map[string]wgtypes.Key{}
+	for _, name := range []string{"a", "b", "c"} {
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key.PublicKey()
+	}
+	endpoint := &net.UDPAddr{IP: net.ParseIP("1.1.1.1"), Port: 51821}
+	moved := &net.UDPAddr{IP: net.ParseIP("2.2.2.2"), Port: 51821}
+	tests := []struct {
+		name     string
+		previous []wgtypes.PeerConfig
+		current  []wgtypes.PeerConfig
+		want     []string
+	}{
+		{
+			name:    "added",
+			current: []wgtypes.PeerConfig{{PublicKey: keys["a"], Endpoint: endpoint}},
+			want:    []string{"peer_added a"},
+		},
+		{
+			name:     "unchanged",
+			previous: []wgtypes.PeerConfig{{PublicKey: keys["a"], Endpoint: endpoint}},
+			current:  []wgtypes.PeerConfig{{PublicKey: keys["a"], Endpoint: endpoint}},
+			want:     []string{},
+		},
+		{
+			name:     "updated",
+			previous: []wgtypes.PeerConfig{{PublicKey: keys["a"], Endpoint: endpoint}},
+			current:  []wgtypes.PeerConfig{{PublicKey: keys["a"], Endpoint: moved}},
+			want:     []string{"peer_updated a"},
+		},
+		{
+			name:     "removed by the server",
+			previous: []wgtypes.PeerConfig{{PublicKey: keys["a"]}, {PublicKey: keys["b"]}},
+			current:  []wgtypes.PeerConfig{{PublicKey: keys["a"], Remove: true}, {PublicKey: keys["b"]}},
+			want:     []string{"peer_removed a"},
+		},
+		{
+			name:     "missing from the update",
+			previous: []wgtypes.PeerConfig{{PublicKey: keys["a"]}, {PublicKey: keys["b"]}, {PublicKey: keys["c"]}},
+			current:  []wgtypes.PeerConfig{{PublicKey: keys["b"]}},
+			want:     []string{"peer_removed a", "peer_removed c"},
+		},
+		{
+			name:     "removed before",
+			previous: []wgtypes.PeerConfig{{PublicKey: keys["a"], Remove: true}},
+			current:  []wgtypes.PeerConfig{{PublicKey: keys["a"], Remove: true}},
+			want:     []string{},
+		},
+		{
+			name:     "replaced",
+			previous: []wgtypes.PeerConfig{{PublicKey: keys["a"]}},
+			current:  []wgtypes.PeerConfig{{PublicKey: keys["b"]}},
+			want:     []string{"peer_added b", "peer_removed a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			sub := events.Subscribe(0, events.PeerAdded{}.EventName(), events.PeerUpdated{}.EventName(), events.PeerRemoved{}.EventName())
+			defer sub.Close()
+			publishPeerEvents("server", tt.previous, tt.current)
+			is.Equal(peerEvents(t, sub, keys), tt.want)
+		})
+	}
+}
+
+func TestResetAllowed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run with /bin/sh")
+	}
+	tests := []struct {
+		name      string
+		onFailure string
+		allowed   bool
+	}{
+		{name: "failing hook warns", onFailure: config.HookWarn, allowed: true},
+		{name: "failing hook aborts", onFailure: config.HookAbort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			useTempConfig(t)
+			config.Netclient().Hooks = []config.Hook{{
+				Event:     events.PreDown{}.EventName(),
+				Command:   "/bin/sh",
+				Args:      []string{"-c", "exit 1"},
+				OnFailure: tt.onFailure,
+			}}
+			sub := events.Subscribe(events.DefaultBuffer, events.HostUpdateRefused{}.EventName())
+			defer sub.Close()
+			hostUpdate := models.HostUpdate{Action: models.JoinHostToNetwork}
+			hostUpdate.Node.Network = "netmaker"
+			is.Equal(resetAllowed("server", &hostUpdate), tt.allowed)
+			select {
+			case envelope := <-sub.C:
+				is.True(!tt.allowed)
+				refused := envelope.Data.(events.HostUpdateRefused)
+				is.Equal(refused.Server, "server")
+				is.Equal(refused.Action, string(models.JoinHostToNetwork))
+				is.Equal(refused.Network, "netmaker")
+				is.True(refused.Reason != "")
+			default:
+				// a refused update is announced
+				is.True(tt.allowed)
+			}
+		})
+	}
+}
@@ -46,29 +46,39 @@ func Checkin(ctx context.Context, wg *sync.WaitGroup) {
 			logger.Log(0, "checkin routine closed")
 			return
 		case <-ticker.C:
-
-			if Mqclient == nil || !Mqclient.IsConnected() {
-				logger.Log(0, "MQ client is not connected, skipping checkin for server", config.CurrServer)
-				continue
+			// check/update host settings once for all servers; publish if changed
+			if err := UpdateHostSettings(); err != nil {
+				logger.Log(0, "failed to update host settings", err.Error())
 			}
-
-			if config.CurrServer != "" {
-				checkin()
+			for _, mq := range mqclients.all() {
+				if !mq.isConnected() {
+					logger.Log(0, "MQ client is not connected, skipping checkin for server", mq.server)
+					continue
+				}
+				publishCheckin(mq.server)
 			}
 		}
 	}
 }
 
-func checkin() {
+// checkin - updates host settings and checks in with the given server
+func checkin(server string) {
 	// check/update host settings; publish if changed
 	if err := UpdateHostSettings(); err != nil {
 		logger.Log(0, "failed to update host settings", err.Error())
 		return
 	}
-	if err := PublishHostUpdate(config.CurrServer, models.HostMqAction(models.CheckIn)); err != nil {
-		logger.Log(0, "error publishing checkin", err.Error())
+	publishCheckin(server)
+}
+
+func publishCheckin(server string) {
+	if err := PublishHostUpdate(server, models.HostMqAction(models.CheckIn)); err != nil {
+		logger.Log(0, "error publishing checkin to server", server, err.Error())
 		return
 	}
+	if mq := mqclients.get(server); mq != nil {
+		mq.setCheckin()
+	}
 }
 
 // PublishNodeUpdate -- pushes node to broker
@@ -81,7 +91,8 @@ func PublishNodeUpdate(node *config.Node) error {
 	if err != nil {
 		return err
 	}
-	if err = publish(node.Server, fmt.Sprintf("update/%s/%s", node.Server, node.ID), data, 1); err != nil {
+	topic := fmt.Sprintf("update/%s/%s", node.Server, node.ID)
+	if err = publishDurable(node.Server, topic, topic, data, 1); err != nil {
 		return err
 	}
 
@@ -94,13 +105,18 @@ func PublishHostUpdate(server string, hostAction models.HostMqAction) error {
 	hostCfg := config.Netclient()
 	hostUpdate := models.HostUpdate{
 		Action: hostAction,
-		Host:   hostCfg.Host,
+		Host:   advertisedHost(server),
 	}
 	data, err := json.Marshal(hostUpdate)
 	if err != nil {
 		return err
 	}
-	if err = publish(server, fmt.Sprintf("host/serverupdate/%s/%s", server, hostCfg.ID.String()), data, 1); err != nil {
+	topic := fmt.Sprintf("host/serverupdate/%s/%s", server, hostCfg.ID.String())
+	if hostAction == models.UpdateHost {
+		// host updates must reach the server, queue them if the broker is unreachable
+		return publishDurable(server, topic, topic+"/"+string(hostAction), data, 1)
+	}
+	if err = publish(server, topic, data, 1); err != nil {
 		return err
 	}
 	return nil
@@ -181,36 +197,62 @@ func publishMetrics(node *config.Node) {
 }
 
 func publish(serverName, dest string, msg []byte, qos byte) error {
-	// setup the keys
-	server := config.GetServer(serverName)
-	if server == nil {
-		return errors.New("server config is nil")
-	}
-	serverPubKey, err := ncutils.ConvertBytesToKey(server.TrafficKey)
+	encrypted, err := encryptMsg(serverName, msg)
 	if err != nil {
 		return err
 	}
-	privateKey, err := ncutils.ConvertBytesToKey(config.Netclient().TrafficKeyPrivate)
-	if err != nil {
-		return err
+	mq := mqclients.get(serverName)
+	if mq == nil {
+		return errors.New("no mq client for server " + serverName)
 	}
-	encrypted, err := Chunk(msg, serverPubKey, privateKey)
-	if err != nil {
+	if err := mq.publish(dest, qos, encrypted); err != nil {
+		logger.Log(0, "could not connect to broker at "+serverName)
 		return err
 	}
-	if token := Mqclient.Publish(dest, qos, false, encrypted); !token.WaitTimeout(30*time.Second) || token.Error() != nil {
-		logger.Log(0, "could not connect to broker at "+serverName)
-		var err error
-		if token.Error() == nil {
-			err = errors.New("connection timeout")
-		} else {
-			err = token.Error()
-		}
+	return nil
+}
+
+// publishDurable - publishes like publish, but if the broker can not be reached the message
+// is stored in the outbox and sent on the next connect; a pending message with the same key is replaced
+func publishDurable(serverName, dest, key string, msg []byte, qos byte) error {
+	if mq := mqclients.get(serverName); mq != nil && mq.isConnected() {
+		encrypted, err := encryptMsg(serverName, msg)
 		if err != nil {
 			return err
 		}
+		if err = mq.publish(dest, qos, encrypted); err == nil {
+			return nil
+		}
 	}
-	return nil
+	logger.Log(0, "could not connect to broker at", serverName+",", "queueing message for", dest)
+	return queueMessage(serverName, config.OutboxMessage{
+		Key:     key,
+		Topic:   dest,
+		QoS:     qos,
+		Payload: msg,
+		Queued:  time.Now(),
+	})
+}
+
+// encryptMsg - encrypts the message for the given server
+func encryptMsg(serverName string, msg []byte) ([]byte, error) {
+	// setup the keys
+	server := config.GetServer(serverName)
+	if server == nil {
+		return nil, errors.New("server config is nil")
+	}
+	serverPubKey, err := ncutils.ConvertBytesToKey(server.TrafficKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := sendingTrafficKey(serverName)
+	if err != nil {
+		return nil, err
+	}
+	if sendsFreshness(serverName) {
+		return ChunkFresh(msg, nextFreshness(), serverPubKey, privateKey)
+	}
+	return Chunk(msg, serverPubKey, privateKey)
 }
 
 // UpdateHostSettings - checks local host settings, if different, mod config and publish
@@ -223,9 +265,8 @@ func UpdateHostSettings() error {
 		publishMsg bool
 	)
 
-	server := config.GetServer(config.CurrServer)
-	if server == nil {
-		return errors.New("server config is nil")
+	if len(config.GetServerMap()) == 0 {
+		return errors.New("no servers configured")
 	}
 	if !config.Netclient().IsStatic {
 		if config.Netclient().EndpointIP == nil {
@@ -246,15 +287,14 @@ func UpdateHostSettings() error {
 		config.Netclient().Host.NatType = hostNatInfo.NatType
 		publishMsg = true
 	}
-	if server.Is_EE {
-		serverNodes := config.GetNodes()
-		for _, node := range serverNodes {
-			node := node
-			if node.Connected {
-				logger.Log(0, "collecting metrics for network", node.Network)
-				publishMetrics(&node)
-			}
+	for _, node := range config.GetNodes() {
+		node := node
+		server := config.GetServer(node.Server)
+		if server == nil || !server.Is_EE || !node.Connected {
+			continue
 		}
+		logger.Log(0, "collecting metrics for network", node.Network)
+		publishMetrics(&node)
 	}
 
 	ifacename := ncutils.GetInterfaceName()
@@ -329,8 +369,10 @@ func UpdateHostSettings() error {
 			return err
 		}
 		logger.Log(0, "publishing global host update for endpoint changes")
-		if err := PublishHostUpdate(config.CurrServer, models.UpdateHost); err != nil {
-			logger.Log(0, "could not publish endpoint change", err.Error())
+		for _, server := range config.GetServerMap() {
+			if err := PublishHostUpdate(server.Name, models.UpdateHost); err != nil {
+				logger.Log(0, "could not publish endpoint change to server", server.Name, err.Error())
+			}
 		}
 	}
 
@@ -339,7 +381,8 @@ func UpdateHostSettings() error {
 
 // publishes a message to server to update peers on this peer's behalf
 func publishSignal(node *config.Node, signal byte) error {
-	if err := publish(node.Server, fmt.Sprintf("signal/%s/%s", node.Server, node.ID), []byte{signal}, 1); err != nil {
+	topic := fmt.Sprintf("signal/%s/%s", node.Server, node.ID)
+	if err := publishDurable(node.Server, topic, topic, []byte{signal}, 1); err != nil {
 		return err
 	}
 	return nil
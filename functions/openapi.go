@@ -0,0 +1,285 @@
+package functions
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// OpenAPI - openapi 3 document of the local api
+type OpenAPI struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       OpenAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                      `json:"components"`
+}
+
+// OpenAPIInfo - title and version of the api
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIOperation - a method on a path
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody               `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+// OpenAPIParameter - a path or query parameter
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIBody - request body of an operation
+type OpenAPIBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse - response of an operation
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType - schema of a body
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema - schema of a value
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPIComponents - named schemas and security schemes
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+// OpenAPISecurityScheme - authentication of the api
+type OpenAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// openAPIDocument - generates the openapi document of the routes from their request and response types
+func openAPIDocument(routes []apiRoute) OpenAPI {
+	doc := OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:   "netclient local api",
+			Version: config.Version,
+		},
+		Paths: make(map[string]map[string]OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]*OpenAPISchema),
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+	errorSchema := doc.schema(reflect.TypeOf(ErrorResponse{}))
+	for _, route := range routes {
+		op := OpenAPIOperation{
+			Summary:     route.Summary,
+			OperationID: operationID(route),
+			Responses:   make(map[string]OpenAPIResponse),
+		}
+		segments := strings.Split(route.Path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") {
+				name := strings.TrimPrefix(segment, ":")
+				segments[i] = "{" + name + "}"
+				op.Parameters = append(op.Parameters, OpenAPIParameter{
+					Name:     name,
+					In:       "path",
+					Required: true,
+					Schema:   &OpenAPISchema{Type: "string"},
+				})
+			}
+		}
+		if route.Request != nil {
+			op.RequestBody = &OpenAPIBody{
+				Required: true,
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {Schema: doc.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+		switch {
+		case route.Stream:
+			op.Parameters = append(op.Parameters, OpenAPIParameter{
+				Name:   "names",
+				In:     "query",
+				Schema: &OpenAPISchema{Type: "string"},
+			})
+			op.Responses[strconv.Itoa(http.StatusOK)] = OpenAPIResponse{
+				Description: "server-sent events, the data of each event is the json encoded schema",
+				Content: map[string]OpenAPIMediaType{
+					"text/event-stream": {Schema: doc.schema(reflect.TypeOf(route.Response))},
+				},
+			}
+		case route.Response != nil:
+			op.Responses[strconv.Itoa(http.StatusOK)] = OpenAPIResponse{
+				Description: http.StatusText(http.StatusOK),
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {Schema: doc.schema(reflect.TypeOf(route.Response))},
+				},
+			}
+		default:
+			op.Responses[strconv.Itoa(http.StatusNoContent)] = OpenAPIResponse{
+				Description: http.StatusText(http.StatusNoContent),
+			}
+		}
+		if route.Token {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+		op.Responses["default"] = OpenAPIResponse{
+			Description: "error",
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: errorSchema},
+			},
+		}
+		p := APIVersionPath + strings.Join(segments, "/")
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = make(map[string]OpenAPIOperation)
+		}
+		doc.Paths[p][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+// operationID - returns an id of the route like getNetworksNetPeers
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.Method)
+	for _, segment := range strings.Split(route.Path, "/") {
+		segment = strings.TrimPrefix(segment, ":")
+		if segment == "" {
+			continue
+		}
+		id += strings.ToUpper(segment[:1]) + segment[1:]
+	}
+	return id
+}
+
+// schema - returns the schema of the type, named struct types are added to the
+// components and referenced so that recursive types terminate
+func (doc *OpenAPI) schema(t reflect.Type) *OpenAPISchema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+	switch {
+	case t == timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time", Nullable: nullable}
+	case t == durationType:
+		return &OpenAPISchema{Type: "integer", Format: "int64", Nullable: nullable}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return &OpenAPISchema{Nullable: nullable}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &OpenAPISchema{Type: "string", Nullable: nullable}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean", Nullable: nullable}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Nullable: nullable}
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number", Nullable: nullable}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string", Nullable: nullable}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte", Nullable: true}
+		}
+		return &OpenAPISchema{Type: "array", Items: doc.schema(t.Elem()), Nullable: true}
+	case reflect.Array:
+		return &OpenAPISchema{Type: "array", Items: doc.schema(t.Elem()), Nullable: nullable}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: doc.schema(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			// reserve the name before descending into the fields
+			doc.Components.Schemas[name] = nil
+			doc.Components.Schemas[name] = doc.structSchema(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name, Nullable: nullable}
+	default:
+		// interfaces and anything else encoding/json handles dynamically
+		return &OpenAPISchema{}
+	}
+}
+
+// structSchema - returns the object schema of the exported fields of the struct following
+// the encoding/json rules for tags and embedded structs
+func (doc *OpenAPI) structSchema(t reflect.Type) *OpenAPISchema {
+	s := &OpenAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*OpenAPISchema),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded := doc.structSchema(fieldType)
+			for k, v := range embedded.Properties {
+				if _, ok := s.Properties[k]; !ok {
+					s.Properties[k] = v
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = doc.schema(field.Type)
+	}
+	return s
+}
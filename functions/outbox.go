@@ -0,0 +1,102 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// outboxMaxMessages - max number of pending publishes kept per server, oldest are dropped first
+	outboxMaxMessages = 100
+	// outboxMaxAge - pending publishes older than this are dropped instead of sent
+	outboxMaxAge = time.Hour * 24
+)
+
+// queueMessage - stores a publish in the outbox to be encrypted and sent once the broker is reachable,
+// a pending message with the same key is replaced so only the latest one is delivered
+func queueMessage(server string, msg config.OutboxMessage) error {
+	return config.UpdateOutbox(func(outbox config.Outbox) {
+		messages := removeOutboxKey(outbox[server], msg.Key)
+		messages = append(messages, msg)
+		if len(messages) > outboxMaxMessages {
+			slog.Warn("outbox full, dropping oldest messages", "server", server, "dropped", len(messages)-outboxMaxMessages)
+			messages = messages[len(messages)-outboxMaxMessages:]
+		}
+		outbox[server] = messages
+	})
+}
+
+// flushOutbox - encrypts and sends the pending publishes of the server in the order they were queued,
+// stops at the first failure and keeps the remaining messages for the next connect
+func flushOutbox(mq *mqClient) {
+	outbox, err := config.ReadOutbox()
+	if err != nil {
+		slog.Error("failed to read outbox", "server", mq.server, "error", err)
+		return
+	}
+	pending := outbox[mq.server]
+	if len(pending) == 0 {
+		return
+	}
+	slog.Info("flushing outbox", "server", mq.server, "messages", len(pending))
+	done := []config.OutboxMessage{}
+	for _, msg := range pending {
+		if time.Since(msg.Queued) > outboxMaxAge {
+			slog.Warn("dropping expired outbox message", "server", mq.server, "topic", msg.Topic)
+			done = append(done, msg)
+			continue
+		}
+		payload, err := encryptMsg(mq.server, msg.Payload)
+		if err != nil {
+			slog.Warn("failed to encrypt outbox message, will retry on next connect", "server", mq.server, "topic", msg.Topic, "error", err)
+			break
+		}
+		if err := mq.publish(msg.Topic, msg.QoS, payload); err != nil {
+			slog.Warn("failed to flush outbox, will retry on next connect", "server", mq.server, "topic", msg.Topic, "error", err)
+			break
+		}
+		done = append(done, msg)
+	}
+	if err := config.UpdateOutbox(func(outbox config.Outbox) {
+		messages := outbox[mq.server]
+		for _, msg := range done {
+			messages = removeOutboxMessage(messages, msg)
+		}
+		outbox[mq.server] = messages
+	}); err != nil {
+		slog.Error("failed to update outbox", "server", mq.server, "error", err)
+	}
+}
+
+// dropOutbox - discards the pending publishes of a server
+func dropOutbox(server string) {
+	if err := config.UpdateOutbox(func(outbox config.Outbox) {
+		delete(outbox, server)
+	}); err != nil {
+		slog.Error("failed to drop outbox", "server", server, "error", err)
+	}
+}
+
+func removeOutboxKey(messages []config.OutboxMessage, key string) []config.OutboxMessage {
+	kept := []config.OutboxMessage{}
+	for _, msg := range messages {
+		if msg.Key != key {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// removeOutboxMessage - removes the message if it was not replaced by a newer one while it was being sent
+func removeOutboxMessage(messages []config.OutboxMessage, sent config.OutboxMessage) []config.OutboxMessage {
+	kept := []config.OutboxMessage{}
+	for _, msg := range messages {
+		if msg.Key == sent.Key && msg.Queued.Equal(sent.Queued) {
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	return kept
+}
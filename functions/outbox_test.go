@@ -0,0 +1,122 @@
+package functions
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// outboxKeys - configures the traffic keys of the host and of the server, returns the keys the
+// server decrypts the messages of the host with
+func outboxKeys(t *testing.T, server string) (hostPub, serverPriv *[32]byte) {
+	is := is.New(t)
+	hostPub, hostPriv, err := box.GenerateKey(rand.Reader)
+	is.NoErr(err)
+	serverPub, serverPriv, err := box.GenerateKey(rand.Reader)
+	is.NoErr(err)
+	hostPrivBytes, err := ncutils.ConvertKeyToBytes(hostPriv)
+	is.NoErr(err)
+	serverPubBytes, err := ncutils.ConvertKeyToBytes(serverPub)
+	is.NoErr(err)
+	config.Netclient().TrafficKeyPrivate = hostPrivBytes
+	serverCfg := config.Server{Name: server}
+	serverCfg.TrafficKey = serverPubBytes
+	config.Servers = map[string]config.Server{server: serverCfg}
+	return hostPub, serverPriv
+}
+
+// outboxKeysOf - returns the keys of the messages queued for the server
+func outboxKeysOf(t *testing.T, server string) []string {
+	is := is.New(t)
+	outbox, err := config.ReadOutbox()
+	is.NoErr(err)
+	keys := []string{}
+	for _, msg := range outbox[server] {
+		keys = append(keys, msg.Key)
+	}
+	return keys
+}
+
+func TestQueueMessage(t *testing.T) {
+	t.Run("latest message of a key", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "a", Payload: []byte("1"), Queued: time.Now()}))
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "b", Payload: []byte("2"), Queued: time.Now()}))
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "a", Payload: []byte("3"), Queued: time.Now()}))
+		outbox, err := config.ReadOutbox()
+		is.NoErr(err)
+		is.Equal(len(outbox["test"]), 2)
+		is.Equal(outbox["test"][0].Key, "b")
+		is.Equal(string(outbox["test"][1].Payload), "3")
+	})
+	t.Run("oldest messages are dropped", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		for i := 0; i < outboxMaxMessages+5; i++ {
+			is.NoErr(queueMessage("test", config.OutboxMessage{Key: fmt.Sprint(i), Queued: time.Now()}))
+		}
+		keys := outboxKeysOf(t, "test")
+		is.Equal(len(keys), outboxMaxMessages)
+		is.Equal(keys[0], "5")
+		is.Equal(keys[len(keys)-1], fmt.Sprint(outboxMaxMessages+4))
+	})
+}
+
+func TestFlushOutbox(t *testing.T) {
+	setTestBackoff(t)
+	t.Run("encrypted when sent", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		hostPub, serverPriv := outboxKeys(t, "test")
+		broker := newTestBroker(t)
+		mq := newMQClient(context.Background(), "test", []string{broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(3))
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "old", Topic: "old", Payload: []byte("old"), Queued: time.Now().Add(-outboxMaxAge - time.Minute)}))
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "first", Topic: "first", Payload: []byte("first"), Queued: time.Now()}))
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "second", Topic: "second", Payload: []byte("second"), Queued: time.Now()}))
+		// the outbox holds the messages as they were queued
+		outbox, err := config.ReadOutbox()
+		is.NoErr(err)
+		is.Equal(string(outbox["test"][1].Payload), "first")
+		flushOutbox(mq)
+		is.True(waitFor(t, func() bool { return len(broker.publishes()) == 2 }))
+		// expired messages are dropped, the others are sent in the order they were queued
+		for i, want := range []string{"first", "second"} {
+			published := broker.publishes()[i]
+			is.Equal(published.topic, want)
+			decrypted, err := DeChunk(published.payload, hostPub, serverPriv)
+			is.NoErr(err)
+			is.Equal(string(decrypted), want)
+		}
+		is.Equal(outboxKeysOf(t, "test"), []string{})
+	})
+	t.Run("kept if the broker is unreachable", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		outboxKeys(t, "test")
+		mq := newMQClient(context.Background(), "test", []string{deadBrokerURL(t)}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(queueMessage("test", config.OutboxMessage{Key: "first", Topic: "first", Payload: []byte("first"), Queued: time.Now()}))
+		flushOutbox(mq)
+		is.Equal(outboxKeysOf(t, "test"), []string{"first"})
+	})
+}
+
+func TestDropOutbox(t *testing.T) {
+	is := is.New(t)
+	useTempConfig(t)
+	is.NoErr(queueMessage("a", config.OutboxMessage{Key: "1", Queued: time.Now()}))
+	is.NoErr(queueMessage("b", config.OutboxMessage{Key: "2", Queued: time.Now()}))
+	dropOutbox("a")
+	is.Equal(outboxKeysOf(t, "a"), []string{})
+	is.Equal(outboxKeysOf(t, "b"), []string{"2"})
+}
@@ -0,0 +1,129 @@
+package functions
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gravitl/netclient/cache"
+	"github.com/gravitl/netclient/ncutils"
+	proxy_config "github.com/gravitl/netclient/nmproxy/config"
+	"github.com/gravitl/netclient/nmproxy/turn"
+	"github.com/gravitl/netclient/nmproxy/wg"
+)
+
+// PeerStatus - live state of a peer on the netmaker interface
+type PeerStatus struct {
+	PublicKey       string        `json:"public_key"`
+	Endpoint        string        `json:"endpoint,omitempty"`
+	AllowedIPs      []string      `json:"allowed_ips"`
+	LastHandshake   time.Time     `json:"last_handshake"`
+	Connected       bool          `json:"connected"`
+	ReceiveBytes    int64         `json:"rx_bytes"`
+	TransmitBytes   int64         `json:"tx_bytes"`
+	Proxied         bool          `json:"proxied"`
+	ProxyEndpoint   string        `json:"proxy_endpoint,omitempty"`
+	Relayed         bool          `json:"relayed"`
+	RelayedEndpoint string        `json:"relayed_endpoint,omitempty"`
+	Turn            bool          `json:"turn"`
+	TurnEndpoint    string        `json:"turn_endpoint,omitempty"`
+	BestEndpoint    *BestEndpoint `json:"best_endpoint,omitempty"`
+	Nodes           []PeerNode    `json:"nodes"`
+}
+
+// BestEndpoint - endpoint of a peer chosen by endpoint detection
+type BestEndpoint struct {
+	Address string        `json:"address"`
+	Latency time.Duration `json:"latency"`
+}
+
+// PeerNode - node of a peer in a network
+type PeerNode struct {
+	Server  string `json:"server"`
+	Network string `json:"network"`
+	NodeID  string `json:"node_id"`
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// GetPeerStatuses - returns the device state of the peers on the netmaker interface
+// together with their proxy, relay and turn state and the nodes they belong to
+func GetPeerStatuses() ([]PeerStatus, error) {
+	peers, err := wg.GetPeers(ncutils.GetInterfaceName())
+	if err != nil {
+		return nil, err
+	}
+	statuses := []PeerStatus{}
+	proxyMaps := proxy_config.GetCfg().CopyPeerMaps()
+	for _, peer := range peers {
+		key := peer.PublicKey.String()
+		status := PeerStatus{
+			PublicKey:     key,
+			Endpoint:      udpAddrString(peer.Endpoint),
+			AllowedIPs:    ipNetStrings(peer.AllowedIPs),
+			LastHandshake: peer.LastHandshakeTime,
+			Connected:     !peer.LastHandshakeTime.IsZero() && time.Since(peer.LastHandshakeTime) <= turn.LastHandShakeThreshold,
+			ReceiveBytes:  peer.ReceiveBytes,
+			TransmitBytes: peer.TransmitBytes,
+			Nodes:         []PeerNode{},
+		}
+		if best, ok := cache.EndpointCache.Load(fmt.Sprintf("%v", sha1.Sum([]byte(key)))); ok {
+			value := best.(cache.EndpointCacheValue)
+			status.BestEndpoint = &BestEndpoint{
+				Address: value.Endpoint.String(),
+				Latency: value.Latency,
+			}
+		}
+		setProxyStatus(proxyMaps, &status)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].PublicKey < statuses[j].PublicKey
+	})
+	return statuses, nil
+}
+
+// setProxyStatus - sets the proxy, relay and turn state and the nodes of the peer from copies of the
+// proxy config maps, the proxy manager updates the maps concurrently
+func setProxyStatus(maps proxy_config.PeerMaps, status *PeerStatus) {
+	if conn, ok := maps.Peers[status.PublicKey]; ok {
+		status.Proxied = true
+		status.ProxyEndpoint = udpAddrString(conn.Config.RemoteConnAddr)
+		status.Relayed = conn.IsRelayed
+		if conn.IsRelayed {
+			status.RelayedEndpoint = udpAddrString(conn.RelayedEndpoint)
+		}
+	}
+	servers := []string{}
+	for server := range maps.Nodes {
+		servers = append(servers, server)
+	}
+	for server := range maps.TurnPeers {
+		if _, ok := maps.Nodes[server]; !ok {
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		if turnCfg, ok := maps.TurnPeers[server][status.PublicKey]; ok && turnCfg.PeerTurnAddr != "" {
+			status.Turn = true
+			status.TurnEndpoint = turnCfg.PeerTurnAddr
+		}
+		for _, id := range maps.Nodes[server][status.PublicKey] {
+			status.Nodes = append(status.Nodes, PeerNode{
+				Server:  server,
+				Network: id.Network,
+				NodeID:  id.ID,
+				Name:    id.Name,
+				Address: id.Address,
+			})
+		}
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		if status.Nodes[i].Network != status.Nodes[j].Network {
+			return status.Nodes[i].Network < status.Nodes[j].Network
+		}
+		return status.Nodes[i].NodeID < status.Nodes[j].NodeID
+	})
+}
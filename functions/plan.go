@@ -0,0 +1,659 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// PlanSettings - plan mode of the host and the networks whose updates are applied without approval
+type PlanSettings struct {
+	Enabled   bool     `json:"enabled"`
+	AutoApply []string `json:"auto_apply"`
+}
+
+// recordHostPlan - records the host update in the pending plan of the server instead of applying it,
+// returns false if the update should be applied right away because it only touches an auto-apply network
+func recordHostPlan(server string, hostUpdate *models.HostUpdate, message []byte) bool {
+	return recordPlan(server, func(plan *config.Plan) {
+		plan.HostUpdates = append(plan.HostUpdates, config.PlanHostUpdate{
+			Action:  hostUpdate.Action,
+			Network: hostUpdate.Node.Network,
+			Message: append(json.RawMessage{}, message...),
+		})
+	})
+}
+
+// recordPeerPlan - records the peer update in the pending plan of the server instead of applying it,
+// returns false if the update should be applied right away because it only touches auto-apply networks
+func recordPeerPlan(server string, peerUpdate *models.HostPeerUpdate) bool {
+	return recordPlan(server, func(plan *config.Plan) {
+		plan.PeerUpdate = peerUpdate
+	})
+}
+
+// recordDNSPlan - records the dns update in the pending plan of the server instead of applying it,
+// returns false if the update should be applied right away because it only touches auto-apply networks
+func recordDNSPlan(server string, dns config.PlanDNS) bool {
+	return recordPlan(server, func(plan *config.Plan) {
+		if dns.Replace {
+			// the full set of entries supersedes the dns updates recorded before
+			plan.DNS = []config.PlanDNS{}
+		}
+		plan.DNS = append(plan.DNS, dns)
+	})
+}
+
+func recordPlan(server string, fn func(*config.Plan)) bool {
+	if _, err := config.GetPlan(server); errors.Is(err, config.ErrNoPlan) {
+		// updates are only applied out of band while nothing is pending for the server
+		candidate := config.Plan{Server: server}
+		fn(&candidate)
+		if attributed := updatePlanChanges(&candidate); candidate.Changes.Empty() || attributed && autoApplyNetworks(candidate.Networks) {
+			slog.Info("auto applying update", "server", server, "networks", candidate.Networks)
+			return false
+		}
+	}
+	plan, err := config.UpdatePlan(server, func(plan *config.Plan) {
+		fn(plan)
+		updatePlanChanges(plan)
+	})
+	if err != nil {
+		// fail closed, the next update of the server carries the full state again
+		slog.Error("failed to record plan, update not applied", "server", server, "error", err)
+		return true
+	}
+	slog.Info("recorded plan, waiting for approval", "server", server, "plan", plan.ID, "networks", plan.Networks)
+	events.Publish(events.PlanRecorded{
+		Server:   server,
+		ID:       plan.ID,
+		Networks: plan.Networks,
+	})
+	return true
+}
+
+// autoApplyNetworks - returns true if all networks are set to auto-apply
+func autoApplyNetworks(networks []string) bool {
+	if len(networks) == 0 {
+		return false
+	}
+	for _, network := range networks {
+		if !config.IsAutoApply(network) {
+			return false
+		}
+	}
+	return true
+}
+
+// ApprovePlan - applies the pending plan of the server
+func ApprovePlan(server string) error {
+	if config.GetServer(server) == nil {
+		// the plan is kept until the server is removed
+		return errors.New("server not found " + server)
+	}
+	plan, err := config.TakePlan(server)
+	if err != nil {
+		return err
+	}
+	for _, update := range plan.HostUpdates {
+		var hostUpdate models.HostUpdate
+		if err := json.Unmarshal(update.Message, &hostUpdate); err != nil {
+			slog.Error("failed to read recorded host update", "server", server, "action", update.Action, "error", err)
+			continue
+		}
+		// the retained message was cleared when the update was recorded
+		applyHostUpdate(server, &hostUpdate, update.Message, func() {})
+	}
+	// a recorded delete of the host drops the other updates of the server with it
+	removed := config.GetServer(server) == nil
+	if !removed && plan.PeerUpdate != nil && len(config.GetNodes()) > 0 {
+		applyPeerUpdate(server, plan.PeerUpdate)
+	}
+	if !removed && len(plan.DNS) > 0 {
+		lockfile := os.TempDir() + "/netclient-lock"
+		if err := config.Lock(lockfile); err != nil {
+			return fmt.Errorf("could not create lock file %w", err)
+		}
+		for _, dns := range plan.DNS {
+			if dns.Replace {
+				commitAllDNS(server, dns.Entries)
+				continue
+			}
+			for _, entry := range dns.Entries {
+				commitDNSUpdate(server, entry)
+			}
+		}
+		config.Unlock(lockfile)
+	}
+	slog.Info("applied plan", "server", server, "plan", plan.ID)
+	events.Publish(events.PlanApplied{Server: server, ID: plan.ID})
+	return nil
+}
+
+// DiscardPlan - drops the pending plan of the server without applying it
+func DiscardPlan(server string) error {
+	plan, err := config.TakePlan(server)
+	if err != nil {
+		return err
+	}
+	slog.Info("discarded plan", "server", server, "plan", plan.ID)
+	events.Publish(events.PlanDiscarded{Server: server, ID: plan.ID})
+	return nil
+}
+
+// dropPlan - discards the pending plan of a server that was removed
+func dropPlan(server string) {
+	if _, err := config.TakePlan(server); err != nil && !errors.Is(err, config.ErrNoPlan) {
+		slog.Error("failed to drop plan", "server", server, "error", err)
+	}
+}
+
+// GetPlanSettings - returns the plan mode settings of the host
+func GetPlanSettings() PlanSettings {
+	settings := PlanSettings{
+		Enabled:   config.Netclient().PlanMode,
+		AutoApply: append([]string{}, config.Netclient().AutoApplyNetworks...),
+	}
+	sort.Strings(settings.AutoApply)
+	return settings
+}
+
+// SetPlanSettings - updates the plan mode settings of the host, turning plan mode off
+// applies the pending plans since updates are no longer held back, returns the errors
+// of the plans that could not be applied
+func SetPlanSettings(settings PlanSettings) ([]error, error) {
+	config.Netclient().PlanMode = settings.Enabled
+	config.Netclient().AutoApplyNetworks = settings.AutoApply
+	if err := config.WriteNetclientConfig(); err != nil {
+		return nil, err
+	}
+	if settings.Enabled {
+		return nil, nil
+	}
+	plans, err := config.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	faults := []error{}
+	for _, server := range sortedKeys(plans) {
+		if err := ApprovePlan(server); err != nil {
+			faults = append(faults, fmt.Errorf("failed to apply plan of server %s: %w", server, err))
+		}
+	}
+	if len(faults) > 0 {
+		return faults, fmt.Errorf("failed to apply %d of %d pending plans", len(faults), len(plans))
+	}
+	return nil, nil
+}
+
+// GetPlans - returns the pending plans sorted by server
+func GetPlans() ([]config.Plan, error) {
+	plans, err := config.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	list := []config.Plan{}
+	for _, plan := range plans {
+		list = append(list, plan)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Server < list[j].Server
+	})
+	return list, nil
+}
+
+// updatePlanChanges - computes the changes of the plan against the state applied from the server,
+// returns false if a change could not be tied to a network, such plans always need approval
+func updatePlanChanges(plan *config.Plan) bool {
+	snapshot, err := config.ReadSnapshot()
+	if err != nil {
+		slog.Warn("failed to read snapshot for plan", "error", err)
+	}
+	applied := snapshot.Servers[plan.Server]
+	currentPeers := config.GetServerPeers(plan.Server)
+	if applied.HasPeers {
+		// the snapshot holds the peers as received, the in memory peers may carry detected endpoints
+		currentPeers = applied.PeerUpdate.Peers
+	}
+	current := applied.PeerUpdate
+	next := current
+	nextPeers := currentPeers
+	if plan.PeerUpdate != nil {
+		next = *plan.PeerUpdate
+		nextPeers = plan.PeerUpdate.Peers
+	}
+	nodeNetworks := planNodeNetworks()
+	changes := config.PlanChanges{
+		HostUpdates:     []string{},
+		PeersAdded:      []config.PlanPeer{},
+		PeersRemoved:    []config.PlanPeer{},
+		PeersUpdated:    []config.PlanPeer{},
+		FirewallAdded:   []string{},
+		FirewallRemoved: []string{},
+	}
+	networks := make(map[string]struct{})
+	attributed := true
+	peerNetworks := func(key string) []string {
+		names := []string{}
+		for _, ids := range []models.HostPeerMap{next.HostPeerIDs, current.HostPeerIDs} {
+			for _, id := range ids[key] {
+				if id.Network != "" && !containsString(names, id.Network) {
+					names = append(names, id.Network)
+				}
+			}
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			attributed = false
+		}
+		for _, name := range names {
+			networks[name] = struct{}{}
+		}
+		return names
+	}
+	for _, update := range plan.HostUpdates {
+		changes.HostUpdates = append(changes.HostUpdates, strings.TrimSpace(string(update.Action)+" "+update.Network))
+		// updates of the host itself are not tied to a network
+		addNetwork(networks, update.Network, &attributed)
+	}
+	before := activePeers(currentPeers)
+	after := activePeers(nextPeers)
+	for key, peer := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			changes.PeersAdded = append(changes.PeersAdded, planPeer(peer, peerNetworks(key)))
+		case peerString(old) != peerString(peer):
+			changes.PeersUpdated = append(changes.PeersUpdated, planPeer(peer, peerNetworks(key)))
+		}
+	}
+	for key, peer := range before {
+		if _, ok := after[key]; !ok {
+			changes.PeersRemoved = append(changes.PeersRemoved, planPeer(peer, peerNetworks(key)))
+		}
+	}
+	sortPlanPeers(changes.PeersAdded)
+	sortPlanPeers(changes.PeersUpdated)
+	sortPlanPeers(changes.PeersRemoved)
+	changes.RoutesAdded, changes.RoutesRemoved = diffStrings(peerRoutes(before, nodeNetworks), peerRoutes(after, nodeNetworks))
+	changes.GatewayBefore = gatewayPeer(before)
+	changes.GatewayAfter = gatewayPeer(after)
+	beforeRules := firewallRules(current, nodeNetworks)
+	afterRules := firewallRules(next, nodeNetworks)
+	for rule, network := range afterRules {
+		if _, ok := beforeRules[rule]; !ok {
+			changes.FirewallAdded = append(changes.FirewallAdded, rule)
+			addNetwork(networks, network, &attributed)
+		}
+	}
+	for rule, network := range beforeRules {
+		if _, ok := afterRules[rule]; !ok {
+			changes.FirewallRemoved = append(changes.FirewallRemoved, rule)
+			addNetwork(networks, network, &attributed)
+		}
+	}
+	sort.Strings(changes.FirewallAdded)
+	sort.Strings(changes.FirewallRemoved)
+	dns := append([]models.DNSUpdate{}, applied.DNS...)
+	for _, update := range plan.DNS {
+		if update.Replace {
+			dns = []models.DNSUpdate{}
+		}
+		for _, entry := range update.Entries {
+			dns = applyDNSEntry(dns, entry)
+		}
+	}
+	changes.HostsAdded, changes.HostsRemoved = diffStrings(hostsEntries(applied.DNS), hostsEntries(dns))
+	for _, entry := range append(append([]string{}, changes.HostsAdded...), changes.HostsRemoved...) {
+		addNetwork(networks, hostsEntryNetwork(entry, nodeNetworks), &attributed)
+	}
+	plan.Changes = changes
+	plan.Networks = []string{}
+	for name := range networks {
+		plan.Networks = append(plan.Networks, name)
+	}
+	sort.Strings(plan.Networks)
+	return attributed
+}
+
+func addNetwork(networks map[string]struct{}, network string, attributed *bool) {
+	if network == "" {
+		*attributed = false
+		return
+	}
+	networks[network] = struct{}{}
+}
+
+// planNodeNetworks - returns the address ranges of the networks of the host by network name
+func planNodeNetworks() map[string][]net.IPNet {
+	ranges := make(map[string][]net.IPNet)
+	for name, node := range config.GetNodes() {
+		if node.NetworkRange.IP != nil {
+			ranges[name] = append(ranges[name], node.NetworkRange)
+		}
+		if node.NetworkRange6.IP != nil {
+			ranges[name] = append(ranges[name], node.NetworkRange6)
+		}
+	}
+	return ranges
+}
+
+// networkOf - returns the name of the network containing the address range
+func networkOf(ipnet net.IPNet, nodeNetworks map[string][]net.IPNet) string {
+	for name, ranges := range nodeNetworks {
+		for _, r := range ranges {
+			if r.Contains(ipnet.IP) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func activePeers(peers []wgtypes.PeerConfig) map[string]wgtypes.PeerConfig {
+	active := make(map[string]wgtypes.PeerConfig)
+	for _, peer := range peers {
+		if !peer.Remove {
+			active[peer.PublicKey.String()] = peer
+		}
+	}
+	return active
+}
+
+func planPeer(peer wgtypes.PeerConfig, networks []string) config.PlanPeer {
+	p := config.PlanPeer{
+		PublicKey:  peer.PublicKey.String(),
+		AllowedIPs: ipNetStrings(peer.AllowedIPs),
+		Networks:   networks,
+	}
+	if peer.Endpoint != nil {
+		p.Endpoint = peer.Endpoint.String()
+	}
+	return p
+}
+
+// peerString - returns the parts of the peer config a plan compares
+func peerString(peer wgtypes.PeerConfig) string {
+	ips := ipNetStrings(peer.AllowedIPs)
+	sort.Strings(ips)
+	endpoint := ""
+	if peer.Endpoint != nil {
+		endpoint = peer.Endpoint.String()
+	}
+	keepalive := ""
+	if peer.PersistentKeepaliveInterval != nil {
+		keepalive = peer.PersistentKeepaliveInterval.String()
+	}
+	return strings.Join(ips, ",") + "|" + endpoint + "|" + keepalive
+}
+
+func sortPlanPeers(peers []config.PlanPeer) {
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PublicKey < peers[j].PublicKey
+	})
+}
+
+// peerRoutes - returns the routes added to the interface for allowed ips outside of the host's networks
+func peerRoutes(peers map[string]wgtypes.PeerConfig, nodeNetworks map[string][]net.IPNet) []string {
+	routes := []string{}
+	for _, peer := range peers {
+		for _, allowedIP := range peer.AllowedIPs {
+			cidr := allowedIP.String()
+			if cidr == "0.0.0.0/0" || cidr == "::/0" || networkOf(allowedIP, nodeNetworks) != "" ||
+				containsString(routes, cidr) {
+				continue
+			}
+			routes = append(routes, cidr)
+		}
+	}
+	return routes
+}
+
+// gatewayPeer - returns the peer acting as internet gateway
+func gatewayPeer(peers map[string]wgtypes.PeerConfig) string {
+	gateways := []string{}
+	for key, peer := range peers {
+		for _, allowedIP := range peer.AllowedIPs {
+			if cidr := allowedIP.String(); cidr == "0.0.0.0/0" || cidr == "::/0" {
+				gateways = append(gateways, key+" ("+cidr+")")
+			}
+		}
+	}
+	sort.Strings(gateways)
+	return strings.Join(gateways, ", ")
+}
+
+// firewallRules - describes the ingress and egress rules the firewall controller sets up for the
+// update, mapped to the network they belong to
+func firewallRules(update models.HostPeerUpdate, nodeNetworks map[string][]net.IPNet) map[string]string {
+	rules := make(map[string]string)
+	for _, ext := range update.IngressInfo.ExtPeers {
+		network := networkOf(ext.Network, nodeNetworks)
+		rules[fmt.Sprintf("ingress forward %s (%s) masquerade=%t", ext.ExtPeerKey, ext.ExtPeerAddr.String(), ext.Masquerade)] = network
+		for _, peer := range ext.Peers {
+			if peer.PeerKey == ext.ExtPeerKey {
+				continue
+			}
+			rules[fmt.Sprintf("ingress %s (%s) <-> %s (%s) allow=%t", ext.ExtPeerKey, ext.ExtPeerAddr.String(),
+				peer.PeerKey, peer.PeerAddr.String(), peer.Allow)] = network
+		}
+		for _, egressRange := range update.IngressInfo.EgressRanges {
+			rules[fmt.Sprintf("ingress %s (%s) -> egress range %s", ext.ExtPeerKey, ext.ExtPeerAddr.String(), egressRange)] = network
+		}
+	}
+	for nodeID, egress := range update.EgressInfo {
+		network := egress.EgressGWCfg.NetID
+		if network == "" {
+			network = networkOf(egress.Network, nodeNetworks)
+		}
+		ranges := append([]string{}, egress.EgressGWCfg.Ranges...)
+		sort.Strings(ranges)
+		rules[fmt.Sprintf("egress gateway %s ranges %s nat=%s", nodeID, strings.Join(ranges, ","), egress.EgressGWCfg.NatEnabled)] = network
+		for _, peer := range egress.GwPeers {
+			rules[fmt.Sprintf("egress gateway %s <- %s (%s) allow=%t", nodeID, peer.PeerKey, peer.PeerAddr.String(), peer.Allow)] = network
+		}
+	}
+	return rules
+}
+
+// hostsEntries - returns the hosts file lines of the dns entries
+func hostsEntries(dns []models.DNSUpdate) []string {
+	entries := []string{}
+	for _, entry := range dns {
+		if entry.Action == models.DNSInsert {
+			entries = append(entries, entry.Address+" "+entry.Name)
+		}
+	}
+	return entries
+}
+
+// hostsEntryNetwork - returns the network of a hosts entry from its address or its network suffix
+func hostsEntryNetwork(entry string, nodeNetworks map[string][]net.IPNet) string {
+	address, name, _ := strings.Cut(entry, " ")
+	if ip := net.ParseIP(address); ip != nil {
+		if network := networkOf(net.IPNet{IP: ip}, nodeNetworks); network != "" {
+			return network
+		}
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		if _, ok := nodeNetworks[name[i+1:]]; ok {
+			return name[i+1:]
+		}
+	}
+	return ""
+}
+
+// diffStrings - returns the entries only in after and the entries only in before, sorted
+func diffStrings(before, after []string) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	for _, s := range after {
+		if !containsString(before, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range before {
+		if !containsString(after, s) {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ShowPlans - prints the pending plans, of a single server if given
+func ShowPlans(server, output string) error {
+	plans := []config.Plan{}
+	if server != "" {
+		plan := config.Plan{}
+		if err := daemonRequest(http.MethodGet, "/plans/"+server, nil, &plan); err != nil {
+			return err
+		}
+		plans = append(plans, plan)
+	} else if err := daemonRequest(http.MethodGet, "/plans", nil, &plans); err != nil {
+		return err
+	}
+	switch output {
+	case "json":
+		out, err := json.MarshalIndent(plans, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	case "":
+		if len(plans) == 0 {
+			fmt.Println("no pending plans")
+		}
+		for _, plan := range plans {
+			printPlan(plan)
+		}
+		return nil
+	default:
+		return errors.New("unsupported output format " + output)
+	}
+}
+
+func printPlan(plan config.Plan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "plan %s for server %s\n", plan.ID, plan.Server)
+	fmt.Fprintf(w, "  recorded:\t%s, updated %s\n", plan.Created.Format(time.RFC3339), plan.Updated.Format(time.RFC3339))
+	fmt.Fprintf(w, "  networks:\t%s\n", valueOr(strings.Join(plan.Networks, ", "), "unknown"))
+	changes := plan.Changes
+	if changes.Empty() {
+		fmt.Fprintln(w, "  no changes")
+	}
+	for _, update := range changes.HostUpdates {
+		fmt.Fprintf(w, "  ~ host\t%s\n", update)
+	}
+	for _, peer := range changes.PeersAdded {
+		fmt.Fprintf(w, "  + peer\t%s\t%s\t%s\n", peer.PublicKey, valueOr(peer.Endpoint, "-"), strings.Join(peer.AllowedIPs, ","))
+	}
+	for _, peer := range changes.PeersUpdated {
+		fmt.Fprintf(w, "  ~ peer\t%s\t%s\t%s\n", peer.PublicKey, valueOr(peer.Endpoint, "-"), strings.Join(peer.AllowedIPs, ","))
+	}
+	for _, peer := range changes.PeersRemoved {
+		fmt.Fprintf(w, "  - peer\t%s\t%s\t%s\n", peer.PublicKey, valueOr(peer.Endpoint, "-"), strings.Join(peer.AllowedIPs, ","))
+	}
+	for _, route := range changes.RoutesAdded {
+		fmt.Fprintf(w, "  + route\t%s\n", route)
+	}
+	for _, route := range changes.RoutesRemoved {
+		fmt.Fprintf(w, "  - route\t%s\n", route)
+	}
+	if changes.GatewayBefore != changes.GatewayAfter {
+		fmt.Fprintf(w, "  ~ gateway\t%s -> %s\n", valueOr(changes.GatewayBefore, "none"), valueOr(changes.GatewayAfter, "none"))
+	}
+	for _, rule := range changes.FirewallAdded {
+		fmt.Fprintf(w, "  + rule\t%s\n", rule)
+	}
+	for _, rule := range changes.FirewallRemoved {
+		fmt.Fprintf(w, "  - rule\t%s\n", rule)
+	}
+	for _, entry := range changes.HostsAdded {
+		fmt.Fprintf(w, "  + hosts\t%s\n", entry)
+	}
+	for _, entry := range changes.HostsRemoved {
+		fmt.Fprintf(w, "  - hosts\t%s\n", entry)
+	}
+	w.Flush()
+}
+
+// ApprovePlanCmd - asks the daemon to apply the pending plan of the server
+func ApprovePlanCmd(server string) error {
+	return daemonRequest(http.MethodPost, "/plans/"+server+"/approve", nil, nil)
+}
+
+// DiscardPlanCmd - asks the daemon to drop the pending plan of the server
+func DiscardPlanCmd(server string) error {
+	return daemonRequest(http.MethodDelete, "/plans/"+server, nil, nil)
+}
+
+// PlanMode - prints the plan mode settings, enabling or disabling plan mode if mode is on or off
+func PlanMode(mode string) error {
+	settings := PlanSettings{}
+	if err := daemonRequest(http.MethodGet, "/planmode", nil, &settings); err != nil {
+		return err
+	}
+	switch mode {
+	case "":
+	case "on", "off":
+		settings.Enabled = mode == "on"
+		if err := daemonRequest(http.MethodPut, "/planmode", settings, &settings); err != nil {
+			return err
+		}
+	default:
+		return errors.New("plan mode must be on or off")
+	}
+	state := "off"
+	if settings.Enabled {
+		state = "on"
+	}
+	fmt.Println("plan mode: ", state)
+	fmt.Println("auto-apply:", valueOr(strings.Join(settings.AutoApply, ", "), "none"))
+	return nil
+}
+
+// PlanAutoApply - sets whether updates for the network are applied without approval in plan mode
+func PlanAutoApply(network string, enabled bool) error {
+	if _, ok := config.GetNodes()[network]; !ok {
+		return errors.New("no such network " + network)
+	}
+	settings := PlanSettings{}
+	if err := daemonRequest(http.MethodGet, "/planmode", nil, &settings); err != nil {
+		return err
+	}
+	autoApply := []string{}
+	for _, name := range settings.AutoApply {
+		if name != network {
+			autoApply = append(autoApply, name)
+		}
+	}
+	if enabled {
+		autoApply = append(autoApply, network)
+	}
+	settings.AutoApply = autoApply
+	return daemonRequest(http.MethodPut, "/planmode", settings, nil)
+}
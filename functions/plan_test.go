@@ -0,0 +1,383 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// planNetworks - address ranges of the networks dev and prod
+var planNetworks = map[string][]net.IPNet{
+	"dev":  {mustCIDR("10.0.0.0/24")},
+	"prod": {mustCIDR("10.1.0.0/24"), mustCIDR("fd00::/64")},
+}
+
+func mustCIDR(cidr string) net.IPNet {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return *ipnet
+}
+
+// planTestPeer - returns a peer with the allowed ips
+func planTestPeer(key wgtypes.Key, allowedIPs ...string) wgtypes.PeerConfig {
+	peer := wgtypes.PeerConfig{PublicKey: key}
+	for _, cidr := range allowedIPs {
+		peer.AllowedIPs = append(peer.AllowedIPs, mustCIDR(cidr))
+	}
+	return peer
+}
+
+func TestDiffStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  []string
+		after   []string
+		added   []string
+		removed []string
+	}{
+		{name: "empty", added: []string{}, removed: []string{}},
+		{name: "unchanged", before: []string{"a", "b"}, after: []string{"b", "a"}, added: []string{}, removed: []string{}},
+		{name: "added and removed", before: []string{"c", "a"}, after: []string{"d", "a", "b"}, added: []string{"b", "d"}, removed: []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			added, removed := diffStrings(tt.before, tt.after)
+			is.Equal(added, tt.added)
+			is.Equal(removed, tt.removed)
+		})
+	}
+}
+
+func TestPeerRoutes(t *testing.T) {
+	keys := make([]wgtypes.Key, 3)
+	for i := range keys {
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key.PublicKey()
+	}
+	tests := []struct {
+		name  string
+		peers []wgtypes.PeerConfig
+		want  []string
+	}{
+		{name: "no peers", want: []string{}},
+		{name: "addresses in the networks", peers: []wgtypes.PeerConfig{planTestPeer(keys[0], "10.0.0.2/32", "fd00::2/128")}, want: []string{}},
+		{name: "internet gateway", peers: []wgtypes.PeerConfig{planTestPeer(keys[0], "10.0.0.2/32", "0.0.0.0/0", "::/0")}, want: []string{}},
+		{
+			name: "egress ranges once",
+			peers: []wgtypes.PeerConfig{
+				planTestPeer(keys[0], "10.0.0.2/32", "192.168.1.0/24"),
+				planTestPeer(keys[1], "10.1.0.2/32", "192.168.1.0/24"),
+			},
+			want: []string{"192.168.1.0/24"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(peerRoutes(activePeers(tt.peers), planNetworks), tt.want)
+		})
+	}
+}
+
+func TestHostsEntryNetwork(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{name: "address in a network", entry: "10.1.0.5 db.example", want: "prod"},
+		{name: "ipv6 address in a network", entry: "fd00::5 db.example", want: "prod"},
+		{name: "network suffix", entry: "192.168.1.5 web.dev", want: "dev"},
+		{name: "address wins over suffix", entry: "10.0.0.5 web.prod", want: "dev"},
+		{name: "unknown", entry: "192.168.1.5 web.example", want: ""},
+		{name: "no name", entry: "192.168.1.5", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(hostsEntryNetwork(tt.entry, planNetworks), tt.want)
+		})
+	}
+}
+
+func TestUpdatePlanChanges(t *testing.T) {
+	keys := make([]wgtypes.Key, 3)
+	for i := range keys {
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key.PublicKey()
+	}
+	ids := func(networks ...string) map[string]models.IDandAddr {
+		m := make(map[string]models.IDandAddr)
+		for _, network := range networks {
+			m[network+"-node"] = models.IDandAddr{Network: network}
+		}
+		return m
+	}
+	applied := models.HostPeerUpdate{
+		ServerVersion: "v1",
+		Peers: []wgtypes.PeerConfig{
+			planTestPeer(keys[0], "10.0.0.2/32"),
+			planTestPeer(keys[1], "10.0.0.3/32", "192.168.1.0/24"),
+		},
+		HostPeerIDs: models.HostPeerMap{keys[0].String(): ids("dev"), keys[1].String(): ids("dev")},
+	}
+	// next - returns the applied peer update changed by fn
+	next := func(fn func(*models.HostPeerUpdate)) *models.HostPeerUpdate {
+		update := applied
+		update.Peers = append([]wgtypes.PeerConfig{}, applied.Peers...)
+		update.HostPeerIDs = models.HostPeerMap{}
+		for key, value := range applied.HostPeerIDs {
+			update.HostPeerIDs[key] = value
+		}
+		fn(&update)
+		return &update
+	}
+	tests := []struct {
+		name       string
+		plan       config.Plan
+		attributed bool
+		networks   []string
+		check      func(is *is.I, changes config.PlanChanges)
+	}{
+		{
+			name:       "unchanged",
+			plan:       config.Plan{PeerUpdate: next(func(*models.HostPeerUpdate) {})},
+			attributed: true,
+			networks:   []string{},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.True(changes.Empty())
+			},
+		},
+		{
+			name: "peer added",
+			plan: config.Plan{PeerUpdate: next(func(update *models.HostPeerUpdate) {
+				update.Peers = append(update.Peers, planTestPeer(keys[2], "10.1.0.4/32"))
+				update.HostPeerIDs[keys[2].String()] = ids("prod")
+			})},
+			attributed: true,
+			networks:   []string{"prod"},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(changes.PeersAdded, []config.PlanPeer{{PublicKey: keys[2].String(), AllowedIPs: []string{"10.1.0.4/32"}, Networks: []string{"prod"}}})
+			},
+		},
+		{
+			name: "peer removed with its route",
+			plan: config.Plan{PeerUpdate: next(func(update *models.HostPeerUpdate) {
+				update.Peers[1].Remove = true
+			})},
+			attributed: true,
+			networks:   []string{"dev"},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(len(changes.PeersRemoved), 1)
+				is.Equal(changes.PeersRemoved[0].PublicKey, keys[1].String())
+				is.Equal(changes.RoutesRemoved, []string{"192.168.1.0/24"})
+				is.Equal(changes.RoutesAdded, []string{})
+			},
+		},
+		{
+			name: "peer updated",
+			plan: config.Plan{PeerUpdate: next(func(update *models.HostPeerUpdate) {
+				update.Peers[0].Endpoint = &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 51821}
+			})},
+			attributed: true,
+			networks:   []string{"dev"},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(len(changes.PeersUpdated), 1)
+				is.Equal(changes.PeersUpdated[0].Endpoint, "203.0.113.1:51821")
+			},
+		},
+		{
+			name: "gateway of no network",
+			plan: config.Plan{PeerUpdate: next(func(update *models.HostPeerUpdate) {
+				update.Peers = append(update.Peers, planTestPeer(keys[2], "0.0.0.0/0"))
+			})},
+			networks: []string{},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(changes.GatewayBefore, "")
+				is.Equal(changes.GatewayAfter, keys[2].String()+" (0.0.0.0/0)")
+			},
+		},
+		{
+			name: "host updates",
+			plan: config.Plan{HostUpdates: []config.PlanHostUpdate{
+				{Action: models.JoinHostToNetwork, Network: "prod"},
+				{Action: models.UpdateHost},
+			}},
+			networks: []string{"prod"},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(changes.HostUpdates, []string{"JOIN_HOST_TO_NETWORK prod", "UPDATE_HOST"})
+				is.True(!changes.Empty())
+			},
+		},
+		{
+			name: "dns entries",
+			plan: config.Plan{DNS: []config.PlanDNS{
+				{Entries: []models.DNSUpdate{{Action: models.DNSInsert, Name: "db.prod", Address: "10.1.0.9"}}},
+				{Entries: []models.DNSUpdate{{Action: models.DNSDeleteByName, Name: "web.dev"}}},
+			}},
+			attributed: true,
+			networks:   []string{"dev", "prod"},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(changes.HostsAdded, []string{"10.1.0.9 db.prod"})
+				is.Equal(changes.HostsRemoved, []string{"10.0.0.2 web.dev"})
+			},
+		},
+		{
+			name: "dns entries replaced outside the networks",
+			plan: config.Plan{DNS: []config.PlanDNS{
+				{Replace: true, Entries: []models.DNSUpdate{{Action: models.DNSInsert, Name: "web.example", Address: "192.168.1.5"}}},
+			}},
+			networks: []string{"dev"},
+			check: func(is *is.I, changes config.PlanChanges) {
+				is.Equal(changes.HostsAdded, []string{"192.168.1.5 web.example"})
+				is.Equal(changes.HostsRemoved, []string{"10.0.0.2 web.dev"})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			useTempConfig(t)
+			config.Nodes = config.NodeMap{
+				"dev":  config.Node{CommonNode: models.CommonNode{Network: "dev", NetworkRange: planNetworks["dev"][0]}},
+				"prod": config.Node{CommonNode: models.CommonNode{Network: "prod", NetworkRange: planNetworks["prod"][0]}},
+			}
+			t.Cleanup(func() { config.Nodes = make(config.NodeMap) })
+			saveSnapshotPeers("server", &applied)
+			replaceSnapshotDNS("server", []models.DNSUpdate{{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.2"}})
+			plan := tt.plan
+			plan.Server = "server"
+			is.Equal(updatePlanChanges(&plan), tt.attributed)
+			is.Equal(plan.Networks, tt.networks)
+			tt.check(is, plan.Changes)
+		})
+	}
+	t.Run("in memory peers without a peer snapshot", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		replaceSnapshotDNS("server", []models.DNSUpdate{})
+		config.UpdateHostPeers("server", applied.Peers)
+		plan := config.Plan{Server: "server", PeerUpdate: next(func(*models.HostPeerUpdate) {})}
+		updatePlanChanges(&plan)
+		is.True(plan.Changes.Empty())
+	})
+}
+
+func TestRecordHostPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		update   models.HostUpdate
+		recorded bool
+	}{
+		{name: "host update", update: models.HostUpdate{Action: models.UpdateHost}, recorded: true},
+		{name: "join of a network", update: models.HostUpdate{Action: models.JoinHostToNetwork}, recorded: true},
+		{name: "join of an auto-apply network", update: models.HostUpdate{Action: models.JoinHostToNetwork}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			useTempConfig(t)
+			replaceSnapshotDNS("server", []models.DNSUpdate{})
+			config.Netclient().PlanMode = true
+			config.Netclient().AutoApplyNetworks = []string{"dev"}
+			network := "prod"
+			if !tt.recorded {
+				network = "dev"
+			}
+			update := tt.update
+			update.Node.Network = network
+			message, err := json.Marshal(update)
+			is.NoErr(err)
+			is.Equal(recordHostPlan("server", &update, message), tt.recorded)
+			plan, err := config.GetPlan("server")
+			if !tt.recorded {
+				is.True(errors.Is(err, config.ErrNoPlan))
+				return
+			}
+			is.NoErr(err)
+			is.Equal(len(plan.HostUpdates), 1)
+			is.Equal(plan.HostUpdates[0].Action, update.Action)
+			// the message is kept as received to be applied on approval
+			var recorded models.HostUpdate
+			is.NoErr(json.Unmarshal(plan.HostUpdates[0].Message, &recorded))
+			is.Equal(recorded.Action, update.Action)
+			is.Equal(recorded.Node.Network, network)
+		})
+	}
+	t.Run("held actions", func(t *testing.T) {
+		is := is.New(t)
+		for _, action := range []models.HostMqAction{models.JoinHostToNetwork, models.DeleteHost, models.UpdateHost, UpdateAclPolicy} {
+			is.True(heldInPlan(action))
+		}
+		for _, action := range []models.HostMqAction{models.RequestAck, models.SignalHost, models.UpdateKeys} {
+			is.True(!heldInPlan(action))
+		}
+	})
+}
+
+func TestApprovePlan(t *testing.T) {
+	t.Run("unknown server keeps its plan", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		_, err := config.UpdatePlan("gone", func(*config.Plan) {})
+		is.NoErr(err)
+		is.True(ApprovePlan("gone") != nil)
+		_, err = config.GetPlan("gone")
+		is.NoErr(err)
+	})
+	t.Run("no plan", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		config.Servers = map[string]config.Server{"server": {Name: "server"}}
+		is.True(errors.Is(ApprovePlan("server"), config.ErrNoPlan))
+	})
+}
+
+func TestSetPlanSettings(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		_, err := config.UpdatePlan("gone", func(*config.Plan) {})
+		is.NoErr(err)
+		errs, err := SetPlanSettings(PlanSettings{Enabled: true, AutoApply: []string{"dev"}})
+		is.NoErr(err)
+		is.Equal(len(errs), 0)
+		is.True(config.Netclient().PlanMode)
+		is.True(config.IsAutoApply("dev"))
+		_, err = config.GetPlan("gone")
+		is.NoErr(err)
+	})
+	t.Run("disabled applies all plans", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		config.Netclient().PlanMode = true
+		config.Servers = map[string]config.Server{"server": {Name: "server"}}
+		for _, server := range []string{"a", "server", "b"} {
+			_, err := config.UpdatePlan(server, func(*config.Plan) {})
+			is.NoErr(err)
+		}
+		errs, err := SetPlanSettings(PlanSettings{})
+		is.True(err != nil)
+		// the plans of the unknown servers fail without keeping the others from being applied
+		is.Equal(len(errs), 2)
+		plans, err := config.GetPlans()
+		is.NoErr(err)
+		is.Equal(sortedKeys(plans), []string{"a", "b"})
+		is.True(!config.Netclient().PlanMode)
+	})
+}
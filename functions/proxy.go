@@ -1,11 +1,9 @@
 package functions
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/gravitl/netclient/config"
-	"github.com/gravitl/netclient/daemon"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 )
@@ -14,29 +12,28 @@ import (
 func ChangeProxyStatus(status bool) error {
 	logger.Log(1, fmt.Sprint("changing proxy status to ", status))
 
-	serverCfg := config.GetServer(config.CurrServer)
-	if serverCfg == nil {
-		return errors.New("server config is nil")
-	}
-	err := setupMQTTSingleton(serverCfg, true)
-	if err != nil {
-		logger.Log(0, "failed to set up mq conn for server ", config.CurrServer)
-	}
-
 	config.Netclient().ProxyEnabled = status
 	if err := config.WriteNetclientConfig(); err != nil {
 		return err
 	}
-	if err := PublishHostUpdate(config.CurrServer, models.UpdateHost); err != nil {
-		return err
+	for _, server := range config.GetServerMap() {
+		server := server
+		if err := setupMQTTSingleton(&server, true); err != nil {
+			logger.Log(0, "failed to set up mq conn for server ", server.Name)
+			continue
+		}
+		if err := PublishHostUpdate(server.Name, models.UpdateHost); err != nil {
+			logger.Log(0, "failed to publish host update to server ", server.Name, err.Error())
+		}
+		closeMQTTSingleton(server.Name)
 	}
 	if status {
 		fmt.Println("proxy is switched on")
 	} else {
 		fmt.Println("proxy is switched off")
 	}
-	if err := daemon.Restart(); err != nil {
-		logger.Log(0, "failed to restart daemon: ", err.Error())
+	if err := reloadDaemon(); err != nil {
+		logger.Log(0, "failed to reload daemon: ", err.Error())
 	}
 	return nil
 }
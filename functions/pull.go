@@ -9,19 +9,38 @@ import (
 	"github.com/devilcove/httpclient"
 	"github.com/gravitl/netclient/auth"
 	"github.com/gravitl/netclient/config"
-	"github.com/gravitl/netclient/daemon"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 )
 
-// Pull - pulls the latest config from the server, if manual it will overwrite
+// Pull - pulls the latest config from all servers, if manual it will overwrite
 func Pull(restart bool) error {
-
-	serverName := config.CurrServer
-	server := config.GetServer(serverName)
-	if server == nil {
+	if len(config.GetServerMap()) == 0 {
 		return errors.New("server config not found")
 	}
+	var pullErr error
+	for _, server := range config.GetServerMap() {
+		server := server
+		if err := pullServer(&server); err != nil {
+			logger.Log(0, "failed to pull from server", server.Name, err.Error())
+			if pullErr == nil {
+				pullErr = err
+			}
+		}
+	}
+	_ = config.WriteServerConfig()
+	_ = config.WriteNetclientConfig()
+	_ = config.WriteNodeConfig()
+	if restart {
+		logger.Log(3, "reloading daemon")
+		return reloadDaemon()
+	}
+	return pullErr
+}
+
+// pullServer - pulls the latest host config from the given server into the in memory config
+func pullServer(server *config.Server) error {
+	serverName := server.Name
 	token, err := auth.Authenticate(server, config.Netclient())
 	if err != nil {
 		return err
@@ -41,17 +60,10 @@ func Pull(restart bool) error {
 		}
 		return err
 	}
-	_ = config.UpdateHostPeers(pullResponse.Peers)
+	_ = config.UpdateHostPeers(serverName, pullResponse.Peers)
 	pullResponse.ServerConfig.MQPassword = server.MQPassword // pwd can't change currently
 	config.UpdateServerConfig(&pullResponse.ServerConfig)
-	config.SetNodes(pullResponse.Nodes)
+	config.SetNodes(serverName, pullResponse.Nodes)
 	fmt.Printf("completed pull for server %s\n", serverName)
-	_ = config.WriteServerConfig()
-	_ = config.WriteNetclientConfig()
-	_ = config.WriteNodeConfig()
-	if restart {
-		logger.Log(3, "restarting daemon")
-		return daemon.Restart()
-	}
 	return nil
 }
@@ -111,6 +111,8 @@ func handleRegisterResponse(registerResponse *models.RegisterResponse) {
 	server := config.GetServer(registerResponse.ServerConf.Server)
 	if err := config.SaveServer(registerResponse.ServerConf.Server, *server); err != nil {
 		logger.Log(0, "failed to save server", err.Error())
+	} else {
+		serverJoined(server.Server)
 	}
 	config.UpdateHost(&registerResponse.RequestedHost)
 	config.SetCurrServerCtxInFile(server.Server)
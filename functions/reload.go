@@ -0,0 +1,354 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/networking"
+	proxy_cfg "github.com/gravitl/netclient/nmproxy/config"
+	"github.com/gravitl/netclient/routes"
+	"github.com/gravitl/netclient/wireguard"
+	"github.com/gravitl/netmaker/logger"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// reloadTimeout - time a caller waits for the daemon to reload, below the timeout of the local api client
+	reloadTimeout = time.Second * 20
+	// proxyStopTimeout - time to wait for the proxy to shut down before it is started on its new port
+	proxyStopTimeout = time.Second * 5
+)
+
+// errFullReload - the changes can not be applied in place, the daemon has to reset its routines
+var errFullReload = errors.New("changes require a full reset")
+
+// ReloadRequest - reloads the daemon, a full reload resets all routines and the interface like SIGHUP
+type ReloadRequest struct {
+	Full bool `json:"full"`
+}
+
+// ReloadResponse - changes applied by a reload
+type ReloadResponse struct {
+	Changes []string `json:"changes"`
+}
+
+// reloadRequest - reload queued for the daemon loop, result is nil if nobody waits for the reload
+type reloadRequest struct {
+	full       bool
+	readConfig bool // changes were written to disk by another process
+	result     chan reloadResult
+}
+
+type reloadResult struct {
+	changes []string
+	err     error
+}
+
+// reloadChan - reloads queued for the daemon loop, a queued reload picks up all changes made
+// before it runs, so reloads requested while one is pending are dropped
+var reloadChan = make(chan reloadRequest, 1)
+
+// daemonState - servers, nodes and ports the routines of the daemon run with, only used from the daemon loop
+type daemonState struct {
+	ctx             context.Context
+	servers         map[string]context.CancelFunc
+	nodes           map[string]config.Node
+	listenPort      int
+	proxyListenPort int
+}
+
+var running daemonState
+
+// daemonRunning - set once the daemon loop runs in this process
+var daemonRunning atomic.Bool
+
+// newDaemonState - state of routines started with ctx from the in memory config
+func newDaemonState(ctx context.Context) daemonState {
+	d := daemonState{
+		ctx:             ctx,
+		servers:         make(map[string]context.CancelFunc),
+		nodes:           make(map[string]config.Node),
+		listenPort:      config.Netclient().ListenPort,
+		proxyListenPort: config.Netclient().ProxyListenPort,
+	}
+	for network, node := range config.GetNodes() {
+		d.nodes[network] = node
+	}
+	return d
+}
+
+// daemonState.startServers - starts the routines of each server of the host
+func (d *daemonState) startServers(wg *sync.WaitGroup) {
+	for _, server := range config.GetServerMap() {
+		d.startServer(wg, server)
+	}
+}
+
+// daemonState.startServer - sets the routes to the server and starts its message queue,
+// the message queue stops with the daemon routines or when the server is removed on reload
+func (d *daemonState) startServer(wg *sync.WaitGroup, server config.Server) {
+	logger.Log(1, "started daemon for server ", server.Name)
+	networking.StoreServerAddresses(&server)
+	if err := routes.SetNetmakerServerRoutes(config.Netclient().DefaultInterface, &server); err != nil {
+		logger.Log(2, "failed to set route(s) for", server.Name, err.Error())
+	}
+	ctx, cancel := context.WithCancel(d.ctx)
+	d.servers[server.Name] = cancel
+	wg.Add(1)
+	go messageQueue(ctx, wg, &server)
+}
+
+// Reload - asks the running daemon to apply the config on disk, returns the changes it applied
+func Reload(full bool) ([]string, error) {
+	result := make(chan reloadResult, 1)
+	timer := time.NewTimer(reloadTimeout)
+	defer timer.Stop()
+	select {
+	case reloadChan <- reloadRequest{full: full, readConfig: true, result: result}:
+	case <-timer.C:
+		return nil, errors.New("timed out waiting for the daemon to start the reload")
+	}
+	select {
+	case r := <-result:
+		return r.changes, r.err
+	case <-timer.C:
+		return nil, errors.New("timed out waiting for the daemon to finish the reload")
+	}
+}
+
+// scheduleReload - queues a reload of the in memory config for the daemon loop without waiting for it,
+// safe to call from mq handlers as the reload may disconnect their client
+func scheduleReload() {
+	select {
+	case reloadChan <- reloadRequest{}:
+	default:
+		slog.Debug("reload already pending")
+	}
+}
+
+// runReload - runs a reload in the daemon loop, falling back to a reset of the daemon if the changes
+// can not be applied in place, returns the cancel functions of the routines and the proxy
+func runReload(wg *sync.WaitGroup, request reloadRequest, cancel, stopProxy context.CancelFunc) (context.CancelFunc, context.CancelFunc) {
+	var changes []string
+	var err error
+	if !request.full {
+		changes, err = running.reload(wg, &stopProxy, request.readConfig)
+	}
+	if request.full || errors.Is(err, errFullReload) {
+		cancel, stopProxy = resetDaemon(wg, cancel, stopProxy)
+		changes, err = []string{"reset daemon"}, nil
+	} else if err != nil {
+		slog.Error("reload failed", "error", err)
+	} else {
+		publishReload(changes)
+	}
+	if request.result != nil {
+		request.result <- reloadResult{changes: changes, err: err}
+	}
+	return cancel, stopProxy
+}
+
+// daemonState.reload - applies the changes of the config to the running daemon in place, the interface
+// and the peers that did not change stay up
+func (d *daemonState) reload(wg *sync.WaitGroup, stopProxy *context.CancelFunc, readConfig bool) ([]string, error) {
+	if readConfig {
+		if _, err := config.ReadNetclientConfig(); err != nil {
+			return nil, fmt.Errorf("error reading netclient config: %w", err)
+		}
+		config.UpdateNetclient(*config.Netclient())
+		if err := config.ReadServerConf(); err != nil {
+			slog.Warn("error reading server map from disk", "error", err)
+		}
+		if err := config.ReadNodeConfig(); err != nil {
+			slog.Warn("error reading nodes from disk", "error", err)
+		}
+	}
+	servers := config.GetServerMap()
+	if len(d.servers) == 0 && len(servers) > 0 {
+		// the routines shared by all servers were never started
+		return nil, errFullReload
+	}
+	host := config.Netclient()
+	changes := []string{}
+
+	// message queues of removed and added servers
+	for _, name := range sortedKeys(d.servers) {
+		if _, ok := servers[name]; ok {
+			continue
+		}
+		d.servers[name]()
+		delete(d.servers, name)
+		changes = append(changes, "stopped message queue of server "+name)
+	}
+	started := make(map[string]bool)
+	for _, name := range sortedKeys(servers) {
+		if _, ok := d.servers[name]; ok {
+			continue
+		}
+		d.startServer(wg, servers[name])
+		started[name] = true
+		changes = append(changes, "started message queue of server "+name)
+	}
+
+	// node subscriptions, the message queue of a new server subscribes on connect
+	nodes := config.GetNodes()
+	for _, network := range sortedKeys(d.nodes) {
+		old := d.nodes[network]
+		if node, ok := nodes[network]; ok && node.ID == old.ID && node.Server == old.Server {
+			continue
+		}
+		if _, ok := d.servers[old.Server]; ok {
+			unsubscribeNode(&old)
+		}
+		changes = append(changes, "unsubscribed from node updates of network "+network)
+	}
+	for _, network := range sortedKeys(nodes) {
+		node := nodes[network]
+		if old, ok := d.nodes[network]; ok && node.ID == old.ID && node.Server == old.Server {
+			continue
+		}
+		if mq := mqclients.get(node.Server); mq != nil && !started[node.Server] {
+			setSubscriptions(mq, &node)
+		}
+		changes = append(changes, "subscribed to node updates of network "+network)
+	}
+
+	// stun the new port while it is still free, wireguard binds it below
+	if host.ListenPort != d.listenPort {
+		config.HostPublicIP, config.WgPublicListenPort = holePunchWgPort()
+	}
+	drifts, err := wireguard.Reload(host, nodes)
+	for _, drift := range drifts {
+		changes = append(changes, describeDrift(drift))
+	}
+	if err != nil {
+		return changes, fmt.Errorf("failed to reload netmaker interface: %w", err)
+	}
+	if len(drifts) > 0 {
+		if err := routes.SetNetmakerPeerEndpointRoutes(host.DefaultInterface); err != nil {
+			slog.Warn("failed to set peer routes after reload", "error", err)
+		}
+	}
+	if host.ListenPort != d.listenPort {
+		// publish the new public port to the servers
+		for name := range d.servers {
+			if !started[name] {
+				checkin(name)
+			}
+		}
+	}
+	if host.ProxyListenPort != d.proxyListenPort {
+		*stopProxy = restartProxy(wg, *stopProxy)
+		changes = append(changes, fmt.Sprintf("proxy listen port %d -> %d", d.proxyListenPort, host.ProxyListenPort))
+	}
+
+	d.nodes = make(map[string]config.Node)
+	for network, node := range nodes {
+		d.nodes[network] = node
+	}
+	d.listenPort = host.ListenPort
+	d.proxyListenPort = host.ProxyListenPort
+	// the dns mode or the addresses of the resolver may have changed
+	syncDNSResolver()
+	// local acl policies are read again
+	forgetAclPolicies()
+	applyAclPolicies()
+	return changes, nil
+}
+
+// restartProxy - stops the proxy and starts it on the current proxy listen port
+func restartProxy(wg *sync.WaitGroup, stop context.CancelFunc) context.CancelFunc {
+	stop()
+	deadline := time.Now().Add(proxyStopTimeout)
+	for proxy_cfg.GetCfg().IsProxyRunning() {
+		if time.Now().After(deadline) {
+			slog.Warn("proxy did not stop in time, it restarts with the next reset")
+			return stop
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	hostNatInfo = nil
+	setNatInfo()
+	return startProxy(wg)
+}
+
+// describeDrift - describes a correction of the interface made by a reload
+func describeDrift(drift wireguard.Drift) string {
+	parts := []string{drift.Kind}
+	if drift.PublicKey != "" {
+		parts = append(parts, drift.PublicKey)
+	}
+	if drift.Desired != "" {
+		parts = append(parts, drift.Desired)
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// reloadDaemon - applies config changes through the running daemon, from the cli it asks the daemon
+// to reload the config on disk and restarts the daemon service if it can not be reached
+func reloadDaemon() error {
+	if daemonRunning.Load() {
+		scheduleReload()
+		return nil
+	}
+	var response ReloadResponse
+	if err := daemonRequest(http.MethodPost, "/reload", ReloadRequest{}, &response); err != nil {
+		slog.Debug("reload through the daemon failed, restarting it", "error", err)
+		return daemon.Restart()
+	}
+	return nil
+}
+
+// ReloadCmd - reloads the running daemon and prints the changes it applied
+func ReloadCmd(full bool, output string) error {
+	var response ReloadResponse
+	if err := daemonRequest(http.MethodPost, "/reload", ReloadRequest{Full: full}, &response); err != nil {
+		return err
+	}
+	if output == "json" {
+		data, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(response.Changes) == 0 {
+		fmt.Println("nothing to reload")
+		return nil
+	}
+	for _, change := range response.Changes {
+		fmt.Println(change)
+	}
+	return nil
+}
+
+// publishReload - reports a reload that changed the daemon
+func publishReload(changes []string) {
+	if len(changes) == 0 {
+		slog.Info("reload found no changes")
+		return
+	}
+	slog.Info("reloaded daemon", "changes", strings.Join(changes, "; "))
+	events.Publish(events.DaemonReloaded{Changes: changes})
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package functions
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals - signals that make the daemon reload its config in place
+var reloadSignals = []os.Signal{syscall.SIGUSR1}
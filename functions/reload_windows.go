@@ -0,0 +1,6 @@
+package functions
+
+import "os"
+
+// reloadSignals - windows has no signal for a reload, it is only triggered through the local api
+var reloadSignals = []os.Signal{}
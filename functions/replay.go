@@ -0,0 +1,302 @@
+package functions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// replayWindowSize - number of sequence numbers below the highest one that are still accepted once
+	replayWindowSize = 64
+	// replayMaxAge - messages with an older timestamp are rejected, also after the replay state was lost
+	replayMaxAge = time.Hour * 24
+	// replayMaxSkew - messages with a timestamp further in the future are rejected
+	replayMaxSkew = time.Minute * 5
+	// replayLegacyDigests - digests of messages without freshness header kept per server and topic
+	replayLegacyDigests = 256
+	// replaySaveDelay - changes of the replay state are written at most once per delay, a crash loses
+	// the messages of the last delay only
+	replaySaveDelay = time.Second * 5
+)
+
+// reasons a message is rejected for
+const (
+	replayDuplicate = "duplicate"
+	replayStale     = "stale"
+	replayFuture    = "future"
+	replayDowngrade = "downgrade"
+)
+
+// ErrReplayed - the message was received before or is too old to be accepted
+var ErrReplayed = errors.New("replayed message")
+
+// ReplayCounters - messages accepted and rejected on a topic of a server
+type ReplayCounters struct {
+	Server        string    `json:"server"`
+	Topic         string    `json:"topic"`
+	Accepted      uint64    `json:"accepted"`
+	Legacy        uint64    `json:"legacy"` // accepted without freshness header
+	Duplicate     uint64    `json:"duplicate"`
+	Stale         uint64    `json:"stale"`
+	Future        uint64    `json:"future"`
+	Downgrade     uint64    `json:"downgrade"` // without freshness header from a server that sends it
+	LastSequence  uint64    `json:"last_sequence"`
+	LastTimestamp time.Time `json:"last_timestamp"`
+}
+
+type replayKey struct {
+	server string
+	topic  string
+}
+
+// replayGuard - replay windows and legacy digests of the servers, loaded from disk with the first message
+type replayGuard struct {
+	mutex    sync.Mutex
+	load     sync.Once
+	state    config.ReplayState
+	counters map[replayKey]*ReplayCounters
+	pending  *time.Timer // write of the changed state, nil if the state on disk is current
+}
+
+var (
+	replay       replayGuard
+	sendSequence atomic.Uint64
+)
+
+// replayGuard.init - reads the replay state stored by the previous run, the caller holds the lock
+func (g *replayGuard) init() {
+	g.load.Do(func() {
+		state, err := config.ReadReplayState()
+		if err != nil {
+			slog.Warn("failed to read replay state", "error", err)
+		}
+		if state.Servers == nil {
+			state.Servers = make(map[string]config.ServerReplayState)
+		}
+		g.state = state
+		g.counters = make(map[replayKey]*ReplayCounters)
+	})
+}
+
+// replayGuard.save - schedules writing the changed state, the changes of replaySaveDelay are written
+// together; the caller holds the lock
+func (g *replayGuard) save() {
+	if g.pending != nil {
+		return
+	}
+	g.pending = time.AfterFunc(replaySaveDelay, g.flush)
+}
+
+// replayGuard.flush - writes the state if it changed since the last write
+func (g *replayGuard) flush() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.pending != nil {
+		g.write()
+	}
+}
+
+// replayGuard.write - writes the state and cancels the scheduled write, the caller holds the lock
+func (g *replayGuard) write() {
+	if g.pending != nil {
+		g.pending.Stop()
+		g.pending = nil
+	}
+	if err := config.WriteReplayState(g.state); err != nil {
+		slog.Warn("failed to save replay state", "error", err)
+	}
+}
+
+// flushReplay - writes the pending changes of the replay state when the daemon stops
+func flushReplay() {
+	replay.flush()
+}
+
+// checkReplay - checks the decrypted message of a server on a topic against the replay window of the topic,
+// returns the payload without its freshness header or ErrReplayed
+func checkReplay(server, topic string, encrypted, decrypted []byte) ([]byte, error) {
+	freshness, payload, ok := SplitFreshness(decrypted)
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+	replay.init()
+	key := replayKey{server: server, topic: topic}
+	counters := replay.counters[key]
+	if counters == nil {
+		counters = &ReplayCounters{Server: server, Topic: topic}
+		replay.counters[key] = counters
+	}
+	var reason string
+	if ok {
+		reason = replay.acceptFresh(key, freshness)
+	} else {
+		reason = replay.acceptLegacy(key, encrypted)
+	}
+	switch reason {
+	case "":
+		if ok {
+			counters.Accepted++
+			counters.LastSequence = freshness.Sequence
+			counters.LastTimestamp = freshness.Timestamp
+		} else {
+			counters.Legacy++
+		}
+		return payload, nil
+	case replayDuplicate:
+		counters.Duplicate++
+	case replayStale:
+		counters.Stale++
+	case replayFuture:
+		counters.Future++
+	case replayDowngrade:
+		counters.Downgrade++
+	}
+	slog.Warn("rejected message", "server", server, "topic", topic, "reason", reason)
+	events.Publish(events.ReplayRejected{Server: server, Topic: topic, Reason: reason})
+	return nil, fmt.Errorf("%w: %s", ErrReplayed, reason)
+}
+
+// replayGuard.acceptFresh - records the sequence number of a message with freshness header,
+// returns the reason it is rejected for, the caller holds the lock
+func (g *replayGuard) acceptFresh(key replayKey, freshness Freshness) string {
+	now := time.Now()
+	if freshness.Timestamp.Before(now.Add(-replayMaxAge)) {
+		return replayStale
+	}
+	if freshness.Timestamp.After(now.Add(replayMaxSkew)) {
+		return replayFuture
+	}
+	server := g.state.Servers[key.server]
+	if server.Windows == nil {
+		server.Windows = make(map[string]config.ReplayWindow)
+	}
+	window, seen := server.Windows[key.topic]
+	if seen {
+		if reason := advanceWindow(&window, freshness.Sequence); reason != "" {
+			return reason
+		}
+	} else {
+		window = config.ReplayWindow{Highest: freshness.Sequence, Bitmap: 1}
+	}
+	server.Fresh = true
+	server.Windows[key.topic] = window
+	// servers sending freshness headers never get a legacy message accepted again
+	server.Digests = nil
+	g.state.Servers[key.server] = server
+	g.save()
+	return ""
+}
+
+// advanceWindow - marks the sequence number as received in the window,
+// returns the reason it is rejected for if it was received before or is below the window
+func advanceWindow(window *config.ReplayWindow, sequence uint64) string {
+	if sequence > window.Highest {
+		shift := sequence - window.Highest
+		if shift >= replayWindowSize {
+			window.Bitmap = 0
+		} else {
+			window.Bitmap <<= shift
+		}
+		window.Bitmap |= 1
+		window.Highest = sequence
+		return ""
+	}
+	offset := window.Highest - sequence
+	if offset >= replayWindowSize {
+		return replayStale
+	}
+	if window.Bitmap&(1<<offset) != 0 {
+		return replayDuplicate
+	}
+	window.Bitmap |= 1 << offset
+	return ""
+}
+
+// replayGuard.acceptLegacy - accepts a message without freshness header from servers that never sent one,
+// those messages carry a random nonce, so a replay is an exact copy of a message received before; the
+// digests are stored with the replay state so copies are also rejected after a restart, the caller holds the lock
+func (g *replayGuard) acceptLegacy(key replayKey, encrypted []byte) string {
+	server := g.state.Servers[key.server]
+	if server.Fresh {
+		return replayDowngrade
+	}
+	sum := sha256.Sum256(encrypted)
+	digest := hex.EncodeToString(sum[:])
+	digests := server.Digests[key.topic]
+	for i := range digests {
+		if digests[i] == digest {
+			return replayDuplicate
+		}
+	}
+	digests = append(digests, digest)
+	if len(digests) > replayLegacyDigests {
+		digests = digests[len(digests)-replayLegacyDigests:]
+	}
+	if server.Digests == nil {
+		server.Digests = make(map[string][]string)
+	}
+	server.Digests[key.topic] = digests
+	g.state.Servers[key.server] = server
+	g.save()
+	return ""
+}
+
+// sendsFreshness - returns true if the server sends messages with freshness header and expects them in return
+func sendsFreshness(server string) bool {
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+	replay.init()
+	return replay.state.Servers[server].Fresh
+}
+
+// nextFreshness - returns the freshness header of the next message of the host, the sequence starts
+// at the clock so it keeps increasing across restarts
+func nextFreshness() Freshness {
+	now := time.Now()
+	sendSequence.CompareAndSwap(0, uint64(now.UnixNano()))
+	return Freshness{Timestamp: now, Sequence: sendSequence.Add(1)}
+}
+
+// GetReplayCounters - returns the counters of the topics messages were received on, sorted by server and topic
+func GetReplayCounters() []ReplayCounters {
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+	replay.init()
+	counters := make([]ReplayCounters, 0, len(replay.counters))
+	for _, c := range replay.counters {
+		counters = append(counters, *c)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Server != counters[j].Server {
+			return counters[i].Server < counters[j].Server
+		}
+		return counters[i].Topic < counters[j].Topic
+	})
+	return counters
+}
+
+// dropReplay - forgets the replay windows and counters of a server the host left
+func dropReplay(server string) {
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+	replay.init()
+	for key := range replay.counters {
+		if key.server == server {
+			delete(replay.counters, key)
+		}
+	}
+	if _, ok := replay.state.Servers[server]; !ok {
+		return
+	}
+	delete(replay.state.Servers, server)
+	replay.write()
+}
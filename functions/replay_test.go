@@ -0,0 +1,134 @@
+package functions
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestAdvanceWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   config.ReplayWindow
+		sequence uint64
+		reason   string
+		highest  uint64
+	}{
+		{name: "next", window: config.ReplayWindow{Highest: 10, Bitmap: 1}, sequence: 11, highest: 11},
+		{name: "jump past window", window: config.ReplayWindow{Highest: 10, Bitmap: 1}, sequence: 500, highest: 500},
+		{name: "duplicate", window: config.ReplayWindow{Highest: 10, Bitmap: 1}, sequence: 10, reason: replayDuplicate, highest: 10},
+		{name: "late in window", window: config.ReplayWindow{Highest: 10, Bitmap: 1}, sequence: 5, highest: 10},
+		{name: "late duplicate", window: config.ReplayWindow{Highest: 10, Bitmap: 1 | 1<<5}, sequence: 5, reason: replayDuplicate, highest: 10},
+		{name: "below window", window: config.ReplayWindow{Highest: 100, Bitmap: 1}, sequence: 100 - replayWindowSize, reason: replayStale, highest: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			window := tt.window
+			is.Equal(advanceWindow(&window, tt.sequence), tt.reason)
+			is.Equal(window.Highest, tt.highest)
+			if tt.reason == "" {
+				is.Equal(advanceWindow(&window, tt.sequence), replayDuplicate) // accepted once only
+			}
+		})
+	}
+}
+
+func TestChunkFresh(t *testing.T) {
+	is := is.New(t)
+	serverPub, serverPriv, err := box.GenerateKey(rand.Reader)
+	is.NoErr(err)
+	hostPub, hostPriv, err := box.GenerateKey(rand.Reader)
+	is.NoErr(err)
+	t.Run("header round trip", func(t *testing.T) {
+		is := is.New(t)
+		freshness := Freshness{Timestamp: time.Unix(0, time.Now().UnixNano()), Sequence: 42}
+		chunked, err := ChunkFresh([]byte(`{"action":"UPDATE_KEYS"}`), freshness, hostPub, serverPriv)
+		is.NoErr(err)
+		decrypted, err := DeChunk(chunked, serverPub, hostPriv)
+		is.NoErr(err)
+		got, payload, ok := SplitFreshness(decrypted)
+		is.True(ok)
+		is.True(got.Timestamp.Equal(freshness.Timestamp))
+		is.Equal(got.Sequence, freshness.Sequence)
+		is.Equal(string(payload), `{"action":"UPDATE_KEYS"}`)
+	})
+	t.Run("legacy message", func(t *testing.T) {
+		is := is.New(t)
+		_, payload, ok := SplitFreshness([]byte(`{"action":"UPDATE_KEYS"}`))
+		is.True(!ok)
+		is.Equal(string(payload), `{"action":"UPDATE_KEYS"}`)
+	})
+}
+
+// testReplayGuard - returns a loaded replay guard with the state, the scheduled writes are cancelled
+// when the test ends
+func testReplayGuard(t *testing.T, state config.ReplayState) *replayGuard {
+	g := &replayGuard{state: state, counters: make(map[replayKey]*ReplayCounters)}
+	g.load.Do(func() {})
+	t.Cleanup(func() {
+		if g.pending != nil {
+			g.pending.Stop()
+		}
+	})
+	return g
+}
+
+func TestAcceptLegacy(t *testing.T) {
+	key := replayKey{server: "server", topic: "host/update"}
+	t.Run("copies are rejected", func(t *testing.T) {
+		is := is.New(t)
+		g := testReplayGuard(t, config.ReplayState{Servers: make(map[string]config.ServerReplayState)})
+		is.Equal(g.acceptLegacy(key, []byte("one")), "")
+		is.Equal(g.acceptLegacy(key, []byte("two")), "")
+		is.Equal(g.acceptLegacy(key, []byte("one")), replayDuplicate)
+		// other topics keep their own digests
+		is.Equal(g.acceptLegacy(replayKey{server: "server", topic: "peers"}, []byte("one")), "")
+	})
+	t.Run("digests outlive a restart", func(t *testing.T) {
+		is := is.New(t)
+		g := testReplayGuard(t, config.ReplayState{Servers: make(map[string]config.ServerReplayState)})
+		is.Equal(g.acceptLegacy(key, []byte("one")), "")
+		restarted := testReplayGuard(t, g.state)
+		is.Equal(restarted.acceptLegacy(key, []byte("one")), replayDuplicate)
+	})
+	t.Run("oldest digests are dropped", func(t *testing.T) {
+		is := is.New(t)
+		g := testReplayGuard(t, config.ReplayState{Servers: make(map[string]config.ServerReplayState)})
+		for i := 0; i <= replayLegacyDigests; i++ {
+			is.Equal(g.acceptLegacy(key, []byte(fmt.Sprint(i))), "")
+		}
+		is.Equal(len(g.state.Servers["server"].Digests[key.topic]), replayLegacyDigests)
+		is.Equal(g.acceptLegacy(key, []byte(fmt.Sprint(replayLegacyDigests))), replayDuplicate)
+		is.Equal(g.acceptLegacy(key, []byte("0")), "")
+	})
+	t.Run("downgrade", func(t *testing.T) {
+		is := is.New(t)
+		g := testReplayGuard(t, config.ReplayState{Servers: map[string]config.ServerReplayState{"server": {Fresh: true}}})
+		is.Equal(g.acceptLegacy(key, []byte("one")), replayDowngrade)
+	})
+}
+
+func TestReplaySave(t *testing.T) {
+	is := is.New(t)
+	g := testReplayGuard(t, config.ReplayState{Servers: make(map[string]config.ServerReplayState)})
+	key := replayKey{server: "server", topic: "host/update"}
+	is.Equal(g.acceptFresh(key, Freshness{Timestamp: time.Now(), Sequence: 1}), "")
+	pending := g.pending
+	is.True(pending != nil)
+	// later messages are written with the first one
+	is.Equal(g.acceptFresh(key, Freshness{Timestamp: time.Now(), Sequence: 2}), "")
+	is.Equal(g.acceptLegacy(replayKey{server: "legacy", topic: "peers"}, []byte("one")), "")
+	is.True(g.pending == pending)
+	// rejected messages do not change the state
+	g.pending.Stop()
+	g.pending = nil
+	is.Equal(g.acceptFresh(key, Freshness{Timestamp: time.Now(), Sequence: 2}), replayDuplicate)
+	is.Equal(g.acceptFresh(key, Freshness{Timestamp: time.Now().Add(-replayMaxAge * 2), Sequence: 3}), replayStale)
+	is.True(g.pending == nil)
+}
@@ -0,0 +1,634 @@
+package functions
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// resolverPort - port the resolver listens on, the only port resolvers forward to per link
+	resolverPort = "53"
+	// resolverTTL - seconds clients may cache answers for mesh names
+	resolverTTL = 30
+	// resolverSyncInterval - time between two checks of the addresses the resolver listens on
+	resolverSyncInterval = time.Second * 30
+	// upstreamTimeout - time to wait for an upstream server to answer a forwarded query
+	upstreamTimeout = time.Second * 3
+	// maxUDPResponse - size of a response over udp that does not need to be truncated
+	maxUDPResponse = 512
+)
+
+// meshZones - returns the domains the resolver answers for, a domain per network of the host
+func meshZones() []string {
+	zones := []string{}
+	for network := range config.GetNodes() {
+		zones = append(zones, dnsName(network))
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// inMeshZone - returns true if the name belongs to one of the zones
+func inMeshZone(name string, zones []string) bool {
+	for _, zone := range zones {
+		if inDomain(name, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseZones - returns the reverse domains of the network ranges of the host, the domains cover
+// the ranges exactly so queries for addresses outside of them go to the other resolvers of the host
+func reverseZones() []string {
+	zones := []string{}
+	for _, node := range config.GetNodes() {
+		for _, r := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if r.IP == nil {
+				continue
+			}
+			for _, zone := range rangeReverseZones(r) {
+				if !containsString(zones, zone) {
+					zones = append(zones, zone)
+				}
+			}
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// rangeReverseZones - returns the reverse domains of the range, a range not on an octet (ipv4) or
+// nibble (ipv6) boundary is split into the domains of the longer prefixes on the next boundary
+func rangeReverseZones(r net.IPNet) []string {
+	ones, bits := r.Mask.Size()
+	ip, step := r.IP.To4(), 8
+	if bits == 128 {
+		ip, step = r.IP.To16(), 4
+	}
+	if ip == nil || (bits != 32 && bits != 128) {
+		return nil
+	}
+	length := (ones + step - 1) / step * step
+	if length == 0 {
+		length = step
+	}
+	mask := net.CIDRMask(length, bits)
+	base := new(big.Int).SetBytes(ip.Mask(r.Mask))
+	zones := []string{}
+	for i := int64(0); i < 1<<(length-ones); i++ {
+		prefix := new(big.Int).Add(base, new(big.Int).Lsh(big.NewInt(i), uint(bits-length)))
+		zones = append(zones, reverseZone(net.IPNet{IP: prefix.FillBytes(make([]byte, len(ip))), Mask: mask}))
+	}
+	return zones
+}
+
+// reverseZone - returns the reverse domain of a range on an octet (ipv4) or nibble (ipv6) boundary
+func reverseZone(r net.IPNet) string {
+	ones, bits := r.Mask.Size()
+	if ip4 := r.IP.To4(); ip4 != nil && bits == 32 {
+		labels := []string{}
+		for i := ones / 8; i > 0; i-- {
+			labels = append(labels, fmt.Sprint(ip4[i-1]))
+		}
+		return strings.Join(append(labels, "in-addr", "arpa"), ".")
+	}
+	ip6 := r.IP.To16()
+	if ip6 == nil || bits != 128 {
+		return ""
+	}
+	labels := []string{}
+	for i := ones/4 - 1; i >= 0; i-- {
+		nibble := ip6[i/2] >> 4
+		if i%2 == 1 {
+			nibble = ip6[i/2] & 0x0f
+		}
+		labels = append(labels, fmt.Sprintf("%x", nibble))
+	}
+	return strings.Join(append(labels, "ip6", "arpa"), ".")
+}
+
+// isReverseName - returns true if the name is in a reverse domain
+func isReverseName(name string) bool {
+	return inDomain(name, "in-addr.arpa") || inDomain(name, "ip6.arpa")
+}
+
+// parseReverseName - returns the address of a reverse name, nil if the name is not a full address
+func parseReverseName(name string) net.IP {
+	name = dnsName(name)
+	if labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), "."); len(labels) == 4 && inDomain(name, "in-addr.arpa") {
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	}
+	labels := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+	if len(labels) != 32 || !inDomain(name, "ip6.arpa") {
+		return nil
+	}
+	hex := ""
+	for i := len(labels) - 1; i >= 0; i-- {
+		if len(labels[i]) != 1 {
+			return nil
+		}
+		hex += labels[i]
+		if i%4 == 0 && i > 0 {
+			hex += ":"
+		}
+	}
+	return net.ParseIP(hex)
+}
+
+// linkDomains - returns the domains of the zones for the interface, routing only domains
+// prefixed with ~ unless the network is a search domain
+func linkDomains(zones, search []string) []string {
+	domains := []string{}
+	for _, zone := range zones {
+		if containsString(search, zone) {
+			domains = append(domains, zone)
+			continue
+		}
+		domains = append(domains, "~"+zone)
+	}
+	return domains
+}
+
+// dnsListener - udp and tcp sockets of the resolver on an address of the interface
+type dnsListener struct {
+	udp net.PacketConn
+	tcp net.Listener
+}
+
+func (l *dnsListener) close() {
+	l.udp.Close()
+	l.tcp.Close()
+}
+
+// dnsResolver - listeners of the resolver and the per link dns configured for them
+type dnsResolver struct {
+	listeners map[string]*dnsListener
+	link      string // addresses and domains configured on the interface
+	mode      string
+	search    string // search domains the hosts file was written with
+}
+
+var resolverSyncChan = make(chan struct{}, 1)
+
+// syncDNSResolver - asks the resolver to check its addresses and the dns mode without waiting for it
+func syncDNSResolver() {
+	select {
+	case resolverSyncChan <- struct{}{}:
+	default:
+	}
+}
+
+// runDNSResolver - answers queries for mesh names on the addresses of the host on the netmaker interface
+// while the resolver dns mode is set, and forwards the other queries upstream
+func runDNSResolver(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	r := dnsResolver{listeners: make(map[string]*dnsListener)}
+	ticker := time.NewTicker(resolverSyncInterval)
+	defer ticker.Stop()
+	r.sync()
+	for {
+		select {
+		case <-ctx.Done():
+			r.stop()
+			return
+		case <-ticker.C:
+			r.sync()
+		case <-resolverSyncChan:
+			r.sync()
+		}
+	}
+}
+
+// dnsResolver.sync - listens on the current addresses of the host and moves the mesh names
+// between the hosts file and the resolver when the dns mode changed
+func (r *dnsResolver) sync() {
+	mode := config.DNSModeHosts
+	if config.Netclient().DNS.Resolver() {
+		mode = config.DNSModeResolver
+	}
+	if mode != r.mode {
+		r.switchMode(mode)
+	}
+	if mode != config.DNSModeResolver {
+		if search := strings.Join(config.Netclient().DNS.Search, ","); search != r.search {
+			r.search = search
+			r.writeHosts()
+		}
+		return
+	}
+	addrs := []string{}
+	for _, node := range config.GetNodes() {
+		for _, ip := range []net.IP{node.Address.IP, node.Address6.IP} {
+			if ip != nil && !ip.IsUnspecified() {
+				addrs = append(addrs, ip.String())
+			}
+		}
+	}
+	sort.Strings(addrs)
+	for addr, l := range r.listeners {
+		if !containsString(addrs, addr) {
+			l.close()
+			delete(r.listeners, addr)
+			slog.Info("stopped dns resolver", "address", addr)
+		}
+	}
+	for _, addr := range addrs {
+		if _, ok := r.listeners[addr]; ok {
+			continue
+		}
+		l, err := listenDNS(addr)
+		if err != nil {
+			// the address may not be on the interface yet, retried with the next sync
+			slog.Warn("failed to start dns resolver", "address", addr, "error", err)
+			continue
+		}
+		r.listeners[addr] = l
+		slog.Info("started dns resolver", "address", addr)
+	}
+	listening := sortedKeys(r.listeners)
+	if len(listening) == 0 {
+		r.stop()
+		return
+	}
+	domains := linkDomains(meshZones(), config.Netclient().DNS.Search)
+	for _, zone := range reverseZones() {
+		domains = append(domains, "~"+zone)
+	}
+	link := strings.Join(listening, ",") + "|" + strings.Join(domains, ",")
+	if link == r.link {
+		return
+	}
+	if err := configureLinkDNS(ncutils.GetInterfaceName(), listening, domains); err != nil {
+		slog.Warn("failed to configure dns of the netmaker interface", "error", err)
+		return
+	}
+	r.link = link
+}
+
+// dnsResolver.switchMode - moves the mesh names into the hosts file or out of it
+func (r *dnsResolver) switchMode(mode string) {
+	previous := r.mode
+	r.mode = mode
+	if mode == config.DNSModeResolver {
+		// entries written in hosts mode, also by a previous run
+		if err := deleteAllDNS(); err != nil {
+			slog.Warn("failed to remove mesh names from hosts file", "error", err)
+		}
+		return
+	}
+	r.stop()
+	if previous == config.DNSModeResolver {
+		r.search = strings.Join(config.Netclient().DNS.Search, ",")
+		r.writeHosts()
+	}
+}
+
+// dnsResolver.writeHosts - writes the names of the dns table to the hosts file
+func (r *dnsResolver) writeHosts() {
+	lockfile := os.TempDir() + "/netclient-lock"
+	if err := config.Lock(lockfile); err != nil {
+		slog.Error("could not create lock file", "error", err)
+		return
+	}
+	defer config.Unlock(lockfile)
+	if err := writeHostsDNS(); err != nil {
+		slog.Error("error saving hosts file", "error", err)
+	}
+}
+
+// dnsResolver.stop - closes the listeners and reverts the dns of the interface
+func (r *dnsResolver) stop() {
+	for addr, l := range r.listeners {
+		l.close()
+		delete(r.listeners, addr)
+	}
+	if r.link != "" {
+		if err := revertLinkDNS(ncutils.GetInterfaceName()); err != nil {
+			slog.Warn("failed to revert dns of the netmaker interface", "error", err)
+		}
+		r.link = ""
+	}
+}
+
+// listenDNS - opens the udp and tcp sockets of the resolver on the address
+func listenDNS(addr string) (*dnsListener, error) {
+	hostport := net.JoinHostPort(addr, resolverPort)
+	udp, err := net.ListenPacket("udp", hostport)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", hostport)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	go serveDNSUDP(udp)
+	go serveDNSTCP(tcp)
+	return &dnsListener{udp: udp, tcp: tcp}, nil
+}
+
+func serveDNSUDP(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Warn("dns resolver stopped", "error", err)
+			}
+			return
+		}
+		query := append([]byte{}, buf[:n]...)
+		go func() {
+			response := answerDNS(query, "udp", localDNSClient(addr))
+			if response == nil {
+				return
+			}
+			if _, err := conn.WriteTo(response, addr); err != nil {
+				slog.Debug("failed to send dns response", "client", addr.String(), "error", err)
+			}
+		}()
+	}
+}
+
+func serveDNSTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Warn("dns resolver stopped", "error", err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			local := localDNSClient(conn.RemoteAddr())
+			for {
+				conn.SetDeadline(time.Now().Add(upstreamTimeout * 4))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				response := answerDNS(query, "tcp", local)
+				if response == nil || writeTCPMessage(conn, response) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func readTCPMessage(conn io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeTCPMessage(conn io.Writer, msg []byte) error {
+	buf := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	_, err := conn.Write(append(buf, msg...))
+	return err
+}
+
+// localDNSClient - returns true if the query was sent by the host itself, from a loopback address
+// or an address of the host in a network
+func localDNSClient(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, node := range config.GetNodes() {
+		if ip.Equal(node.Address.IP) || ip.Equal(node.Address6.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// answerDNS - answers a query for a mesh name or an address with a mesh name from the table
+// and forwards the others upstream if the query was sent by the host itself, peers only get
+// answers for mesh names; returns nil if the query can not be parsed
+func answerDNS(query []byte, network string, local bool) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return dnsResponse(header, nil, dnsmessage.RCodeFormatError, nil)
+	}
+	forward := func() []byte {
+		if !local {
+			return dnsResponse(header, &question, dnsmessage.RCodeRefused, nil)
+		}
+		return forwardDNS(query, header, question, network)
+	}
+	name := question.Name.String()
+	var answers []dnsmessage.Resource
+	if isReverseName(name) {
+		if !inMeshZone(name, reverseZones()) {
+			return forward()
+		}
+		names := meshDNS.reverse(parseReverseName(name))
+		if len(names) == 0 {
+			// addresses of the ranges without a mesh name may be known upstream
+			return forward()
+		}
+		if question.Type == dnsmessage.TypePTR {
+			answers = ptrAnswers(question, names)
+		}
+	} else {
+		ips, found := meshDNS.lookupShort(name, config.Netclient().DNS.Search)
+		if !found {
+			if !inMeshZone(name, meshZones()) {
+				return forward()
+			}
+			if ips, found = meshDNS.lookup(name); !found {
+				return dnsResponse(header, &question, dnsmessage.RCodeNameError, nil)
+			}
+		}
+		answers = addressAnswers(question, ips)
+	}
+	response := dnsResponse(header, &question, dnsmessage.RCodeSuccess, answers)
+	if network == "udp" && len(response) > maxUDPResponse {
+		header.Truncated = true
+		return dnsResponse(header, &question, dnsmessage.RCodeSuccess, nil)
+	}
+	return response
+}
+
+// addressAnswers - returns the A or AAAA records of the addresses the question asks for
+func addressAnswers(question dnsmessage.Question, ips []net.IP) []dnsmessage.Resource {
+	answers := []dnsmessage.Resource{}
+	resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: resolverTTL}
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		switch {
+		case question.Type == dnsmessage.TypeA && ip4 != nil:
+			a := dnsmessage.AResource{}
+			copy(a.A[:], ip4)
+			answers = append(answers, dnsmessage.Resource{Header: resource, Body: &a})
+		case question.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			aaaa := dnsmessage.AAAAResource{}
+			copy(aaaa.AAAA[:], ip.To16())
+			answers = append(answers, dnsmessage.Resource{Header: resource, Body: &aaaa})
+		}
+	}
+	return answers
+}
+
+// ptrAnswers - returns the PTR records of the names
+func ptrAnswers(question dnsmessage.Question, names []string) []dnsmessage.Resource {
+	answers := []dnsmessage.Resource{}
+	resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: resolverTTL}
+	for _, name := range names {
+		target, err := dnsmessage.NewName(name + ".")
+		if err != nil {
+			continue
+		}
+		answers = append(answers, dnsmessage.Resource{Header: resource, Body: &dnsmessage.PTRResource{PTR: target}})
+	}
+	return answers
+}
+
+// dnsResponse - builds an authoritative response to the query with the answers
+func dnsResponse(query dnsmessage.Header, question *dnsmessage.Question, rcode dnsmessage.RCode, answers []dnsmessage.Resource) []byte {
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			OpCode:             query.OpCode,
+			Authoritative:      question != nil && rcode != dnsmessage.RCodeServerFailure && rcode != dnsmessage.RCodeRefused,
+			Truncated:          query.Truncated,
+			RecursionDesired:   query.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              rcode,
+		},
+		Answers: answers,
+	}
+	if question != nil {
+		response.Questions = []dnsmessage.Question{*question}
+	}
+	packed, err := response.Pack()
+	if err != nil {
+		slog.Debug("failed to pack dns response", "error", err)
+		return nil
+	}
+	return packed
+}
+
+// forwardDNS - relays the query to the first upstream server that answers it
+func forwardDNS(query []byte, header dnsmessage.Header, question dnsmessage.Question, network string) []byte {
+	for _, upstream := range dnsUpstreams() {
+		response, err := exchangeDNS(query, upstream, network)
+		if err != nil {
+			slog.Debug("upstream dns server failed", "upstream", upstream, "error", err)
+			continue
+		}
+		return response
+	}
+	return dnsResponse(header, &question, dnsmessage.RCodeServerFailure, nil)
+}
+
+func exchangeDNS(query []byte, upstream, network string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// dnsUpstreams - returns the servers queries outside the mesh are forwarded to, the configured upstreams
+// or the nameservers of resolv.conf, never the addresses the resolver listens on
+func dnsUpstreams() []string {
+	servers := config.Netclient().DNS.Upstreams
+	if len(servers) == 0 {
+		servers = resolvConfServers("/etc/resolv.conf")
+	}
+	own := map[string]bool{}
+	for _, node := range config.GetNodes() {
+		own[node.Address.IP.String()] = true
+		own[node.Address6.IP.String()] = true
+	}
+	upstreams := []string{}
+	for _, server := range servers {
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			host, port = server, resolverPort
+		}
+		if own[host] {
+			continue
+		}
+		upstreams = append(upstreams, net.JoinHostPort(host, port))
+	}
+	return upstreams
+}
+
+// resolvConfServers - returns the nameservers of a resolv.conf file
+func resolvConfServers(path string) []string {
+	servers := []string{}
+	f, err := os.Open(path)
+	if err != nil {
+		return servers
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
@@ -0,0 +1,49 @@
+package functions
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// configureLinkDNS - points systemd-resolved at the resolver for the mesh domains on the interface,
+// domains prefixed with ~ only route queries, the others are also search domains;
+// without systemd-resolved the resolver has to be added to the resolver configuration by hand
+func configureLinkDNS(iface string, addrs, domains []string) error {
+	if !resolvedRunning() {
+		slog.Warn("systemd-resolved is not running, add the dns resolver to the resolver configuration", "addresses", strings.Join(addrs, ", "))
+		return nil
+	}
+	if out, err := exec.Command("resolvectl", append([]string{"dns", iface}, addrs...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("resolvectl dns: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	// only names of the mesh are sent to the resolver
+	if out, err := exec.Command("resolvectl", append([]string{"domain", iface}, domains...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("resolvectl domain: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	slog.Info("configured dns of the netmaker interface", "interface", iface, "domains", strings.Join(domains, ", "))
+	return nil
+}
+
+// revertLinkDNS - drops the dns settings of the interface from systemd-resolved
+func revertLinkDNS(iface string) error {
+	if !resolvedRunning() {
+		return nil
+	}
+	if out, err := exec.Command("resolvectl", "revert", iface).CombinedOutput(); err != nil {
+		return fmt.Errorf("resolvectl revert: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// resolvedRunning - returns true if systemd-resolved manages the dns of the links
+func resolvedRunning() bool {
+	if _, err := exec.LookPath("resolvectl"); err != nil {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/resolve/")
+	return err == nil
+}
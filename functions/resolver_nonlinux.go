@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// configureLinkDNS - the resolver has to be added to the resolver configuration by hand
+func configureLinkDNS(iface string, addrs, domains []string) error {
+	slog.Warn("add the dns resolver to the resolver configuration", "addresses", strings.Join(addrs, ", "), "domains", strings.Join(domains, ", "))
+	return nil
+}
+
+// revertLinkDNS - nothing was configured on the interface
+func revertLinkDNS(iface string) error {
+	return nil
+}
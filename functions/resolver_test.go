@@ -0,0 +1,218 @@
+package functions
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestAnswerDNS(t *testing.T) {
+	fakeUpstream(t)
+	config.Nodes = config.NodeMap{"mesh": config.Node{}}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	meshDNS.replace("server", []models.DNSUpdate{
+		{Action: models.DNSInsert, Name: "web.mesh", Address: "10.0.0.2"},
+		{Action: models.DNSInsert, Name: "web.mesh", Address: "fd00::2"},
+		{Action: models.DNSInsert, Name: "db.mesh", Address: "10.0.0.3"},
+	})
+	defer meshDNS.drop("server")
+	tests := []struct {
+		name          string
+		qname         string
+		qtype         dnsmessage.Type
+		peer          bool // the query was sent by a peer instead of the host
+		rcode         dnsmessage.RCode
+		answers       int
+		authoritative bool
+	}{
+		{name: "a record", qname: "web.mesh.", qtype: dnsmessage.TypeA, answers: 1, authoritative: true},
+		{name: "aaaa record", qname: "web.mesh.", qtype: dnsmessage.TypeAAAA, answers: 1, authoritative: true},
+		{name: "case insensitive", qname: "DB.Mesh.", qtype: dnsmessage.TypeA, answers: 1, authoritative: true},
+		{name: "no aaaa record", qname: "db.mesh.", qtype: dnsmessage.TypeAAAA, authoritative: true},
+		{name: "unknown name", qname: "mail.mesh.", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError, authoritative: true},
+		{name: "forwarded for the host", qname: "example.com.", qtype: dnsmessage.TypeA, rcode: dnsmessage.RCodeNameError},
+		{name: "mesh name for a peer", qname: "web.mesh.", qtype: dnsmessage.TypeA, peer: true, answers: 1, authoritative: true},
+		{name: "refused for a peer", qname: "example.com.", qtype: dnsmessage.TypeA, peer: true, rcode: dnsmessage.RCodeRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7, RecursionDesired: true})
+			is.NoErr(builder.StartQuestions())
+			is.NoErr(builder.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(tt.qname), Type: tt.qtype, Class: dnsmessage.ClassINET}))
+			query, err := builder.Finish()
+			is.NoErr(err)
+			var response dnsmessage.Message
+			is.NoErr(response.Unpack(answerDNS(query, "udp", !tt.peer)))
+			is.Equal(response.ID, uint16(7))
+			is.Equal(response.Authoritative, tt.authoritative)
+			is.Equal(response.RCode, tt.rcode)
+			is.Equal(len(response.Answers), tt.answers)
+		})
+	}
+}
+
+func TestLocalDNSClient(t *testing.T) {
+	config.Nodes = config.NodeMap{"mesh": config.Node{CommonNode: models.CommonNode{
+		Network:  "mesh",
+		Address:  net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)},
+		Address6: net.IPNet{IP: net.ParseIP("fd00::1"), Mask: net.CIDRMask(64, 128)},
+	}}}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	tests := []struct {
+		name  string
+		addr  net.Addr
+		local bool
+	}{
+		{name: "loopback", addr: &net.UDPAddr{IP: net.ParseIP("127.0.0.53"), Port: 5353}, local: true},
+		{name: "address of the host", addr: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5353}, local: true},
+		{name: "ipv6 address of the host over tcp", addr: &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 5353}, local: true},
+		{name: "peer", addr: &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5353}},
+		{name: "other address", addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 5353}},
+		{name: "unknown network", addr: &net.UnixAddr{Name: "/tmp/dns", Net: "unix"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(localDNSClient(tt.addr), tt.local)
+		})
+	}
+}
+
+// fakeUpstream - starts an upstream dns server answering all queries with a non authoritative
+// name error, the host forwards to it until the test ends
+func fakeUpstream(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var parser dnsmessage.Parser
+			header, err := parser.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			question, err := parser.Question()
+			if err != nil {
+				continue
+			}
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+				Questions: []dnsmessage.Question{question},
+			}
+			packed, err := response.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+	upstreams := config.Netclient().DNS.Upstreams
+	config.Netclient().DNS.Upstreams = []string{conn.LocalAddr().String()}
+	t.Cleanup(func() {
+		conn.Close()
+		config.Netclient().DNS.Upstreams = upstreams
+	})
+}
+
+func TestRangeReverseZones(t *testing.T) {
+	tests := []struct {
+		name  string
+		cidr  string
+		count int
+		first string
+		last  string
+	}{
+		{name: "octet boundary", cidr: "10.20.0.0/16", count: 1, first: "20.10.in-addr.arpa", last: "20.10.in-addr.arpa"},
+		{name: "split into the next octet", cidr: "10.20.16.0/20", count: 16, first: "16.20.10.in-addr.arpa", last: "31.20.10.in-addr.arpa"},
+		{name: "shorter than an octet", cidr: "10.0.0.0/7", count: 2, first: "10.in-addr.arpa", last: "11.in-addr.arpa"},
+		{name: "whole ipv4 space", cidr: "0.0.0.0/0", count: 256, first: "0.in-addr.arpa", last: "255.in-addr.arpa"},
+		{name: "longer than an octet", cidr: "10.0.0.4/30", count: 4, first: "4.0.0.10.in-addr.arpa", last: "7.0.0.10.in-addr.arpa"},
+		{name: "host address", cidr: "10.0.0.4/32", count: 1, first: "4.0.0.10.in-addr.arpa", last: "4.0.0.10.in-addr.arpa"},
+		{name: "nibble boundary", cidr: "fd00::/16", count: 1, first: "0.0.d.f.ip6.arpa", last: "0.0.d.f.ip6.arpa"},
+		{name: "split into the next nibble", cidr: "fd00::/15", count: 2, first: "0.0.d.f.ip6.arpa", last: "1.0.d.f.ip6.arpa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			_, r, err := net.ParseCIDR(tt.cidr)
+			is.NoErr(err)
+			zones := rangeReverseZones(*r)
+			is.Equal(len(zones), tt.count)
+			is.Equal(zones[0], tt.first)
+			is.Equal(zones[len(zones)-1], tt.last)
+		})
+	}
+}
+
+func TestReverseDNS(t *testing.T) {
+	fakeUpstream(t)
+	_, range4, _ := net.ParseCIDR("10.20.0.0/16")
+	_, range6, _ := net.ParseCIDR("fd00:1234::/64")
+	_, range20, _ := net.ParseCIDR("10.30.16.0/20")
+	config.Nodes = config.NodeMap{
+		"mesh":  config.Node{CommonNode: models.CommonNode{Network: "mesh", NetworkRange: *range4, NetworkRange6: *range6}},
+		"split": config.Node{CommonNode: models.CommonNode{Network: "split", NetworkRange: *range20}},
+	}
+	defer func() { config.Nodes = make(config.NodeMap) }()
+	meshDNS.replace("server", []models.DNSUpdate{
+		{Action: models.DNSInsert, Name: "web.mesh", Address: "10.20.0.2"},
+		{Action: models.DNSInsert, Name: "web.mesh", Address: "fd00:1234::2"},
+		{Action: models.DNSInsert, Name: "web.mesh", Address: "10.30.17.2"},
+	})
+	defer meshDNS.drop("server")
+
+	t.Run("reverse zones", func(t *testing.T) {
+		is := is.New(t)
+		zones := reverseZones()
+		is.Equal(len(zones), 18)
+		is.True(containsString(zones, "0.0.0.0.0.0.0.0.4.3.2.1.0.0.d.f.ip6.arpa"))
+		is.True(containsString(zones, "20.10.in-addr.arpa"))
+		for i := 16; i < 32; i++ {
+			is.True(containsString(zones, fmt.Sprintf("%d.30.10.in-addr.arpa", i)))
+		}
+	})
+	tests := []struct {
+		name      string
+		qname     string
+		rcode     dnsmessage.RCode
+		answers   int
+		forwarded bool
+	}{
+		{name: "ipv4 address", qname: "2.0.20.10.in-addr.arpa.", answers: 1},
+		{name: "ipv6 address", qname: "2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.4.3.2.1.0.0.d.f.ip6.arpa.", answers: 1},
+		{name: "address of a range split into zones", qname: "2.17.30.10.in-addr.arpa.", answers: 1},
+		{name: "unknown address in range", qname: "9.0.20.10.in-addr.arpa.", rcode: dnsmessage.RCodeNameError, forwarded: true},
+		{name: "address next to a split range", qname: "2.32.30.10.in-addr.arpa.", rcode: dnsmessage.RCodeNameError, forwarded: true},
+		{name: "zone of a range", qname: "20.10.in-addr.arpa.", rcode: dnsmessage.RCodeNameError, forwarded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 9})
+			is.NoErr(builder.StartQuestions())
+			is.NoErr(builder.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(tt.qname), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}))
+			query, err := builder.Finish()
+			is.NoErr(err)
+			var response dnsmessage.Message
+			is.NoErr(response.Unpack(answerDNS(query, "udp", true)))
+			is.Equal(response.RCode, tt.rcode)
+			is.Equal(response.Authoritative, !tt.forwarded)
+			is.Equal(len(response.Answers), tt.answers)
+			if tt.answers > 0 {
+				is.Equal(response.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String(), "web.mesh.")
+			}
+		})
+	}
+}
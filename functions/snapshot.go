@@ -0,0 +1,188 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	proxy_cfg "github.com/gravitl/netclient/nmproxy/config"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+// proxySnapshotWait - time the restored peer updates wait for the proxy to start before they are discarded
+const proxySnapshotWait = time.Second * 30
+
+// proxySnapshot - restored peer updates waiting for the proxy manager, per server; a peer update of
+// the server received meanwhile supersedes the restored one
+var proxySnapshot = struct {
+	mutex   sync.Mutex
+	updates map[string]*models.HostPeerUpdate
+}{updates: make(map[string]*models.HostPeerUpdate)}
+
+// saveSnapshotPeers - records the peer update applied from the server as last known good state
+func saveSnapshotPeers(server string, peerUpdate *models.HostPeerUpdate) {
+	if err := config.UpdateSnapshot(server, func(snapshot *config.ServerSnapshot) {
+		snapshot.ServerVersion = peerUpdate.ServerVersion
+		snapshot.HasPeers = true
+		snapshot.PeerUpdate = *peerUpdate
+	}); err != nil {
+		slog.Error("failed to save peer snapshot", "server", server, "error", err)
+	}
+}
+
+// saveSnapshotDNS - records a dns update applied from the server in the snapshot
+func saveSnapshotDNS(server string, dns models.DNSUpdate) {
+	if err := config.UpdateSnapshot(server, func(snapshot *config.ServerSnapshot) {
+		snapshot.DNS = applyDNSEntry(snapshot.DNS, dns)
+	}); err != nil {
+		slog.Error("failed to save dns snapshot", "server", server, "error", err)
+	}
+}
+
+// replaceSnapshotDNS - replaces the dns entries of the server in the snapshot
+func replaceSnapshotDNS(server string, dns []models.DNSUpdate) {
+	if err := config.UpdateSnapshot(server, func(snapshot *config.ServerSnapshot) {
+		snapshot.DNS = []models.DNSUpdate{}
+		for _, entry := range dns {
+			snapshot.DNS = applyDNSEntry(snapshot.DNS, entry)
+		}
+	}); err != nil {
+		slog.Error("failed to save dns snapshot", "server", server, "error", err)
+	}
+}
+
+// dropSnapshot - discards the snapshot of a server
+func dropSnapshot(server string) {
+	if err := config.DeleteServerSnapshot(server); err != nil {
+		slog.Error("failed to drop snapshot", "server", server, "error", err)
+	}
+}
+
+// applyDNSEntry - applies the dns update to the entries, which only hold inserts like the hosts file
+func applyDNSEntry(entries []models.DNSUpdate, dns models.DNSUpdate) []models.DNSUpdate {
+	kept := []models.DNSUpdate{}
+	switch dns.Action {
+	case models.DNSInsert:
+		for _, entry := range entries {
+			if entry.Name != dns.Name {
+				kept = append(kept, entry)
+			}
+		}
+		kept = append(kept, models.DNSUpdate{Action: models.DNSInsert, Name: dns.Name, Address: dns.Address})
+	case models.DNSDeleteByName:
+		for _, entry := range entries {
+			if entry.Name != dns.Name {
+				kept = append(kept, entry)
+			}
+		}
+	case models.DNSDeleteByIP:
+		for _, entry := range entries {
+			if entry.Address != dns.Address {
+				kept = append(kept, entry)
+			}
+		}
+	case models.DNSReplaceName:
+		for _, entry := range entries {
+			if entry.Name == dns.Name {
+				entry.Name = dns.NewName
+			}
+			kept = append(kept, entry)
+		}
+	case models.DNSReplaceIP:
+		for _, entry := range entries {
+			if entry.Address == dns.Address {
+				entry.Address = dns.NewAddress
+			}
+			kept = append(kept, entry)
+		}
+	default:
+		return entries
+	}
+	return kept
+}
+
+// restoreSnapshot - applies the last known good peers, dns entries and gateway info of all
+// servers so the mesh can be brought up before the servers are reachable, returns true if
+// a snapshot was restored; the state is reconciled by the next pull or peer update
+func restoreSnapshot() bool {
+	snapshot, err := config.ReadSnapshot()
+	if err != nil {
+		slog.Error("failed to read snapshot", "error", err)
+		return false
+	}
+	restored := false
+	for server, serverSnapshot := range snapshot.Servers {
+		if config.GetServer(server) == nil {
+			slog.Info("dropping snapshot of unknown server", "server", server)
+			dropSnapshot(server)
+			continue
+		}
+		serverSnapshot := serverSnapshot
+		slog.Info("restoring last known good state", "server", server, "serial", serverSnapshot.Serial,
+			"age", time.Since(serverSnapshot.Updated).Round(time.Second).String())
+		if len(serverSnapshot.DNS) > 0 {
+			applyAllDNS(server, serverSnapshot.DNS)
+		}
+		restored = true
+		if !serverSnapshot.HasPeers {
+			continue
+		}
+		config.UpdateHostPeers(server, serverSnapshot.PeerUpdate.Peers)
+		// held for the proxy manager, which also sets up the ingress/egress rules
+		proxySnapshot.mutex.Lock()
+		proxySnapshot.updates[server] = &serverSnapshot.PeerUpdate
+		proxySnapshot.mutex.Unlock()
+	}
+	if proxy_cfg.GetCfg().IsProxyRunning() {
+		pushProxySnapshot()
+	}
+	return restored
+}
+
+// waitProxySnapshot - hands the restored peer updates to the proxy manager once the proxy runs,
+// they are discarded if it does not start in time
+func waitProxySnapshot(ctx context.Context) {
+	ticker := time.NewTicker(time.Millisecond * 500)
+	defer ticker.Stop()
+	timeout := time.NewTimer(proxySnapshotWait)
+	defer timeout.Stop()
+	for !proxy_cfg.GetCfg().IsProxyRunning() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			proxySnapshot.mutex.Lock()
+			defer proxySnapshot.mutex.Unlock()
+			if len(proxySnapshot.updates) > 0 {
+				slog.Info("proxy is not running, not restoring gateway state")
+				proxySnapshot.updates = make(map[string]*models.HostPeerUpdate)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+	pushProxySnapshot()
+}
+
+// pushProxySnapshot - queues the restored peer updates for the running proxy manager
+func pushProxySnapshot() {
+	proxySnapshot.mutex.Lock()
+	defer proxySnapshot.mutex.Unlock()
+	for server, update := range proxySnapshot.updates {
+		select {
+		case ProxyManagerChan <- update:
+		default:
+			slog.Warn("proxy manager queue full, not restoring gateway state", "server", server)
+		}
+	}
+	proxySnapshot.updates = make(map[string]*models.HostPeerUpdate)
+}
+
+// supersedeProxySnapshot - discards the restored peer update of a server that sent a newer one
+func supersedeProxySnapshot(server string) {
+	proxySnapshot.mutex.Lock()
+	defer proxySnapshot.mutex.Unlock()
+	delete(proxySnapshot.updates, server)
+}
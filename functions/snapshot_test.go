@@ -0,0 +1,173 @@
+package functions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	proxy_cfg "github.com/gravitl/netclient/nmproxy/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+)
+
+func TestApplyDNSEntry(t *testing.T) {
+	entries := []models.DNSUpdate{
+		{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.2"},
+		{Action: models.DNSInsert, Name: "ci.dev", Address: "10.0.0.3"},
+	}
+	tests := []struct {
+		name string
+		dns  models.DNSUpdate
+		want []models.DNSUpdate
+	}{
+		{
+			name: "insert",
+			dns:  models.DNSUpdate{Action: models.DNSInsert, Name: "db.dev", Address: "10.0.0.4"},
+			want: append(append([]models.DNSUpdate{}, entries...), models.DNSUpdate{Action: models.DNSInsert, Name: "db.dev", Address: "10.0.0.4"}),
+		},
+		{
+			name: "insert replaces the name",
+			dns:  models.DNSUpdate{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.9"},
+			want: []models.DNSUpdate{entries[1], {Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.9"}},
+		},
+		{
+			name: "delete by name",
+			dns:  models.DNSUpdate{Action: models.DNSDeleteByName, Name: "web.dev"},
+			want: []models.DNSUpdate{entries[1]},
+		},
+		{
+			name: "delete by address",
+			dns:  models.DNSUpdate{Action: models.DNSDeleteByIP, Address: "10.0.0.3"},
+			want: []models.DNSUpdate{entries[0]},
+		},
+		{
+			name: "replace name",
+			dns:  models.DNSUpdate{Action: models.DNSReplaceName, Name: "ci.dev", NewName: "build.dev"},
+			want: []models.DNSUpdate{entries[0], {Action: models.DNSInsert, Name: "build.dev", Address: "10.0.0.3"}},
+		},
+		{
+			name: "replace address",
+			dns:  models.DNSUpdate{Action: models.DNSReplaceIP, Address: "10.0.0.2", NewAddress: "10.0.0.8"},
+			want: []models.DNSUpdate{{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.8"}, entries[1]},
+		},
+		{
+			name: "unknown action",
+			dns:  models.DNSUpdate{Action: models.DNSUpdateAction(99), Name: "web.dev"},
+			want: entries,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			original := append([]models.DNSUpdate{}, entries...)
+			is.Equal(applyDNSEntry(entries, tt.dns), tt.want)
+			is.Equal(entries, original) // the entries are not changed in place
+		})
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	is := is.New(t)
+	useTempConfig(t)
+	saveSnapshotDNS("dns", models.DNSUpdate{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.2"})
+	saveSnapshotPeers("peers", &models.HostPeerUpdate{ServerVersion: "v1"})
+	replaceSnapshotDNS("peers", []models.DNSUpdate{
+		{Action: models.DNSInsert, Name: "web.dev", Address: "10.0.0.2"},
+		{Action: models.DNSDeleteByName, Name: "web.dev"},
+		{Action: models.DNSInsert, Name: "ci.dev", Address: "10.0.0.3"},
+	})
+	snapshot, err := config.ReadSnapshot()
+	is.NoErr(err)
+	is.True(!snapshot.Servers["dns"].HasPeers)
+	is.Equal(len(snapshot.Servers["dns"].DNS), 1)
+	is.True(snapshot.Servers["peers"].HasPeers)
+	is.Equal(snapshot.Servers["peers"].ServerVersion, "v1")
+	is.Equal(snapshot.Servers["peers"].DNS, []models.DNSUpdate{{Action: models.DNSInsert, Name: "ci.dev", Address: "10.0.0.3"}})
+	is.Equal(snapshot.Servers["peers"].Serial, uint64(2))
+	dropSnapshot("peers")
+	snapshot, err = config.ReadSnapshot()
+	is.NoErr(err)
+	_, ok := snapshot.Servers["peers"]
+	is.True(!ok)
+}
+
+// restoreTestSnapshot - stores a snapshot with the peers of server a, no peers of server b and
+// the peers of the unknown server gone
+func restoreTestSnapshot(t *testing.T) {
+	useTempConfig(t)
+	config.Servers = map[string]config.Server{"a": {Name: "a"}, "b": {Name: "b"}}
+	saveSnapshotPeers("a", &models.HostPeerUpdate{ServerVersion: "v1"})
+	saveSnapshotPeers("gone", &models.HostPeerUpdate{ServerVersion: "v1"})
+	if err := config.UpdateSnapshot("b", func(*config.ServerSnapshot) {}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		proxy_cfg.GetCfg().ProxyStatus = false
+		supersedeProxySnapshot("a")
+		for len(ProxyManagerChan) > 0 {
+			<-ProxyManagerChan
+		}
+	})
+}
+
+// heldProxySnapshot - returns the servers of the restored peer updates waiting for the proxy
+func heldProxySnapshot() []string {
+	proxySnapshot.mutex.Lock()
+	defer proxySnapshot.mutex.Unlock()
+	servers := []string{}
+	for server := range proxySnapshot.updates {
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	t.Run("held until the proxy runs", func(t *testing.T) {
+		is := is.New(t)
+		restoreTestSnapshot(t)
+		is.True(restoreSnapshot())
+		is.Equal(heldProxySnapshot(), []string{"a"})
+		is.Equal(len(ProxyManagerChan), 0)
+		// the snapshot of the unknown server is dropped
+		snapshot, err := config.ReadSnapshot()
+		is.NoErr(err)
+		_, ok := snapshot.Servers["gone"]
+		is.True(!ok)
+		proxy_cfg.GetCfg().ProxyStatus = true
+		waitProxySnapshot(context.Background())
+		is.Equal(len(ProxyManagerChan), 1)
+		is.Equal((<-ProxyManagerChan).ServerVersion, "v1")
+		is.Equal(heldProxySnapshot(), []string{})
+	})
+	t.Run("pushed right away if the proxy runs", func(t *testing.T) {
+		is := is.New(t)
+		restoreTestSnapshot(t)
+		proxy_cfg.GetCfg().ProxyStatus = true
+		is.True(restoreSnapshot())
+		is.Equal(len(ProxyManagerChan), 1)
+		is.Equal(heldProxySnapshot(), []string{})
+	})
+	t.Run("superseded by a peer update", func(t *testing.T) {
+		is := is.New(t)
+		restoreTestSnapshot(t)
+		is.True(restoreSnapshot())
+		supersedeProxySnapshot("a")
+		proxy_cfg.GetCfg().ProxyStatus = true
+		waitProxySnapshot(context.Background())
+		is.Equal(len(ProxyManagerChan), 0)
+	})
+	t.Run("discarded if the proxy stops", func(t *testing.T) {
+		is := is.New(t)
+		restoreTestSnapshot(t)
+		is.True(restoreSnapshot())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		waitProxySnapshot(ctx)
+		is.Equal(len(ProxyManagerChan), 0)
+	})
+	t.Run("nothing to restore", func(t *testing.T) {
+		is := is.New(t)
+		useTempConfig(t)
+		is.True(!restoreSnapshot())
+	})
+}
@@ -0,0 +1,206 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	proxy_config "github.com/gravitl/netclient/nmproxy/config"
+	"github.com/gravitl/netclient/nmproxy/router"
+)
+
+// statusTimeout - time to wait for the daemon to answer a status request
+const statusTimeout = time.Second * 3
+
+// ServerStatus - connection state of the host with a server
+type ServerStatus struct {
+	Name    string        `json:"name"`
+	Current bool          `json:"current"`
+	Broker  *BrokerStatus `json:"broker,omitempty"`
+	UseTurn bool          `json:"use_turn"`
+	Turn    bool          `json:"turn"`
+}
+
+// GetStatus - returns the status of the running daemon
+func GetStatus() StatusResponse {
+	status := diskStatus()
+	status.Status = "running"
+	status.Daemon = true
+	for i := range status.Servers {
+		if broker, ok := GetBrokerStatus(status.Servers[i].Name); ok {
+			broker := broker
+			status.Servers[i].Broker = &broker
+		}
+	}
+	if hostNatInfo != nil {
+		status.NatType = hostNatInfo.NatType
+	}
+	if cfg := proxy_config.GetCfg(); cfg != nil {
+		status.ProxyRunning = cfg.IsProxyRunning()
+		status.Firewall = cfg.GetFwStatus()
+		for i := range status.Servers {
+			if turnCfg, ok := cfg.GetTurnCfg(status.Servers[i].Name); ok {
+				status.Servers[i].Turn = turnCfg.Status
+			}
+		}
+	}
+	if status.Firewall {
+		status.FirewallBackend = router.Backend()
+	}
+	return status
+}
+
+// diskStatus - returns the status as far as it is known from the on-disk config
+func diskStatus() StatusResponse {
+	host := config.Netclient()
+	status := StatusResponse{
+		Status:        "stopped",
+		Version:       config.Version,
+		Host:          host.Name,
+		CurrentServer: config.CurrServer,
+		NatType:       host.NatType,
+		ProxyEnabled:  host.ProxyEnabled,
+		Servers:       []ServerStatus{},
+	}
+	for name, server := range config.GetServerMap() {
+		status.Servers = append(status.Servers, ServerStatus{
+			Name:    name,
+			Current: name == config.CurrServer,
+			UseTurn: server.UseTurn,
+		})
+	}
+	sort.Slice(status.Servers, func(i, j int) bool {
+		return status.Servers[i].Name < status.Servers[j].Name
+	})
+	return status
+}
+
+// daemonStatus - requests the status from the local api of the running daemon
+func daemonStatus() (StatusResponse, error) {
+	var status StatusResponse
+	client := http.Client{
+		Transport: LocalAPITransport(),
+		Timeout:   statusTimeout,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://netclient"+APIVersionPath+"/status", nil)
+	if err != nil {
+		return status, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return status, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("daemon returned %s", response.Status)
+	}
+	err = json.NewDecoder(response.Body).Decode(&status)
+	return status, err
+}
+
+// Status - prints the status of the daemon, falls back to the on-disk config if the daemon is not reachable
+func Status(output string) error {
+	status, err := daemonStatus()
+	if err != nil {
+		status = diskStatus()
+		status.Error = "daemon not reachable: " + err.Error()
+	}
+	switch output {
+	case "json":
+		out, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "":
+		printStatus(status)
+	default:
+		return errors.New("unsupported output format " + output)
+	}
+	return nil
+}
+
+func printStatus(status StatusResponse) {
+	w := os.Stdout
+	if status.Daemon {
+		fmt.Fprintf(w, "daemon:       %s (%s)\n", status.Status, status.Version)
+	} else {
+		fmt.Fprintf(w, "daemon:       %s\n", status.Status)
+		fmt.Fprintf(w, "              %s, showing on-disk config\n", status.Error)
+	}
+	fmt.Fprintf(w, "host:         %s\n", status.Host)
+	fmt.Fprintf(w, "nat type:     %s\n", valueOr(status.NatType, "unknown"))
+	proxy := "disabled"
+	if status.ProxyEnabled {
+		proxy = "enabled"
+		if status.Daemon && !status.ProxyRunning {
+			proxy += ", not running"
+		}
+	}
+	fmt.Fprintf(w, "proxy:        %s\n", proxy)
+	if status.Daemon {
+		firewall := "not in use"
+		if status.Firewall {
+			firewall = status.FirewallBackend
+		}
+		fmt.Fprintf(w, "firewall:     %s\n", firewall)
+	}
+	if len(status.Servers) == 0 {
+		fmt.Fprintln(w, "servers:      none")
+	}
+	for _, server := range status.Servers {
+		current := ""
+		if server.Current {
+			current = " (current)"
+		}
+		fmt.Fprintf(w, "server:       %s%s\n", server.Name, current)
+		if server.Broker != nil {
+			state := "disconnected"
+			if server.Broker.Connected {
+				state = "connected"
+			}
+			fmt.Fprintf(w, "  broker:       %s %s\n", server.Broker.Broker, state)
+			if server.Broker.LastError != "" && !server.Broker.Connected {
+				fmt.Fprintf(w, "  last error:   %s\n", server.Broker.LastError)
+			}
+			fmt.Fprintf(w, "  last checkin: %s\n", formatTime(server.Broker.LastCheckin))
+		} else if status.Daemon {
+			fmt.Fprintln(w, "  broker:       no client")
+		}
+		turn := "not used"
+		if server.UseTurn {
+			turn = "enabled"
+			if status.Daemon {
+				if server.Turn {
+					turn += ", registered"
+				} else {
+					turn += ", not registered"
+				}
+			}
+		}
+		fmt.Fprintf(w, "  turn:         %s\n", turn)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Round(time.Second))
+}
+
+func valueOr(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
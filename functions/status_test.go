@@ -0,0 +1,93 @@
+package functions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+	proxy_config "github.com/gravitl/netclient/nmproxy/config"
+	ncmodels "github.com/gravitl/netclient/nmproxy/models"
+	"github.com/matryer/is"
+)
+
+// statusServers - configures the servers a, the current one using turn, and b
+func statusServers(t *testing.T) {
+	useTempConfig(t)
+	turnServer := config.Server{Name: "a"}
+	turnServer.UseTurn = true
+	config.Servers = map[string]config.Server{"a": turnServer, "b": {Name: "b"}}
+	config.CurrServer = "a"
+	config.Netclient().Name = "host"
+	config.Netclient().NatType = "symmetric"
+	config.Netclient().ProxyEnabled = true
+	t.Cleanup(func() {
+		config.CurrServer = ""
+	})
+}
+
+func TestDiskStatus(t *testing.T) {
+	is := is.New(t)
+	statusServers(t)
+	status := diskStatus()
+	is.Equal(status.Status, "stopped")
+	is.True(!status.Daemon)
+	is.Equal(status.Version, config.Version)
+	is.Equal(status.Host, "host")
+	is.Equal(status.CurrentServer, "a")
+	is.Equal(status.NatType, "symmetric")
+	is.True(status.ProxyEnabled)
+	// servers are sorted by name, the broker and turn state is only known to the daemon
+	is.Equal(status.Servers, []ServerStatus{
+		{Name: "a", Current: true, UseTurn: true},
+		{Name: "b"},
+	})
+}
+
+func TestGetStatus(t *testing.T) {
+	setTestBackoff(t)
+	t.Run("daemon state", func(t *testing.T) {
+		is := is.New(t)
+		statusServers(t)
+		broker := newTestBroker(t)
+		mq := newMQClient(context.Background(), "a", []string{broker.url()}, false, testMQOptions)
+		defer mq.disconnect()
+		is.NoErr(mq.connect(0))
+		mqclients.add(mq)
+		hostNatInfo = &ncmodels.HostInfo{NatType: "asymmetric"}
+		proxy_config.InitializeCfg()
+		proxy_config.GetCfg().SetTurnCfg("a", ncmodels.TurnCfg{Status: true})
+		t.Cleanup(func() {
+			hostNatInfo = nil
+			proxy_config.InitializeCfg()
+			proxy_config.GetCfg().ProxyStatus = false
+		})
+		status := GetStatus()
+		is.Equal(status.Status, "running")
+		is.True(status.Daemon)
+		is.Equal(status.NatType, "asymmetric") // detected by the daemon
+		is.True(status.ProxyRunning)
+		is.True(!status.Firewall)
+		is.Equal(status.FirewallBackend, "")
+		is.Equal(len(status.Servers), 2)
+		a, b := status.Servers[0], status.Servers[1]
+		is.True(a.Current)
+		is.True(a.Turn)
+		is.True(a.Broker != nil)
+		is.True(a.Broker.Connected)
+		is.Equal(a.Broker.Broker, broker.url())
+		is.True(!b.Turn)
+		is.True(b.Broker == nil) // no mq client for the server
+	})
+	t.Run("before the daemon detected its state", func(t *testing.T) {
+		is := is.New(t)
+		statusServers(t)
+		status := GetStatus()
+		is.Equal(status.Status, "running")
+		is.Equal(status.NatType, "symmetric")
+		is.True(!status.ProxyRunning)
+		for _, server := range status.Servers {
+			is.True(server.Broker == nil)
+			is.True(!server.Turn)
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package functions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	// ErrTrafficKeyRotationPending - a traffic key rotation is already waiting for the servers
+	ErrTrafficKeyRotationPending = errors.New("a traffic key rotation is already in progress")
+	// ErrTrafficKeyRotationDisabled - traffic key rotations are not enabled in the key rotation policy
+	ErrTrafficKeyRotationDisabled = errors.New("traffic key rotation is disabled, it needs servers storing the traffic key of the host (keyrotation.traffickeys)")
+)
+
+var (
+	trafficKeyMutex          sync.Mutex // guards the traffic keys of the host
+	trafficKeyTimer          *time.Timer
+	lastTrafficRotationError string
+)
+
+// TrafficKeyStatus - state of the traffic key rotation of the host
+type TrafficKeyStatus struct {
+	Pending      bool      `json:"pending"`
+	PublicKey    string    `json:"public_key"` // key messages are encrypted with, base64
+	PendingKey   string    `json:"pending_key,omitempty"`
+	Started      time.Time `json:"started"`
+	Acknowledged []string  `json:"acknowledged"`
+	Waiting      []string  `json:"waiting"`
+	GraceUntil   time.Time `json:"grace_until"` // messages for the replaced key are accepted until then
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// RotateTrafficKeys - starts a rotation of the traffic keypair used to encrypt mq messages: the new public
+// key is advertised to all servers, messages to a server switch to the new key once the server encrypted
+// a message for it, messages for the replaced key are accepted during the grace window of the policy;
+// the rotation has to be enabled in the policy as it needs servers that store the advertised key
+func RotateTrafficKeys() (TrafficKeyStatus, error) {
+	status, err := startTrafficKeyRotation()
+	if err != nil || !status.Pending {
+		return status, err
+	}
+	// published without the lock, encrypting the messages needs the traffic keys
+	publishTrafficKey(config.GetServers(), "failed to publish pending traffic key")
+	return status, nil
+}
+
+func startTrafficKeyRotation() (TrafficKeyStatus, error) {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	host := config.Netclient()
+	if !host.KeyRotation.TrafficKeys {
+		return trafficKeyStatus(), ErrTrafficKeyRotationDisabled
+	}
+	if host.PendingTrafficKey != nil {
+		return trafficKeyStatus(), ErrTrafficKeyRotationPending
+	}
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return trafficKeyStatus(), err
+	}
+	privBytes, err := ncutils.ConvertKeyToBytes(priv)
+	if err != nil {
+		return trafficKeyStatus(), err
+	}
+	pubBytes, err := ncutils.ConvertKeyToBytes(pub)
+	if err != nil {
+		return trafficKeyStatus(), err
+	}
+	previous := host.TrafficKeyPublic
+	host.PendingTrafficKey = &config.PendingTrafficKey{
+		Private:      privBytes,
+		Public:       pubBytes,
+		Previous:     previous,
+		Started:      time.Now(),
+		Acknowledged: []string{},
+	}
+	host.TrafficKeyPublic = pubBytes
+	if err := config.WriteNetclientConfig(); err != nil {
+		host.PendingTrafficKey = nil
+		host.TrafficKeyPublic = previous
+		return trafficKeyStatus(), fmt.Errorf("error saving pending traffic key: %w", err)
+	}
+	lastTrafficRotationError = ""
+	slog.Info("rotating traffic keys")
+	events.Publish(events.TrafficKeyRotationStarted{})
+	if len(config.GetServers()) == 0 {
+		promoteTrafficKey()
+		return trafficKeyStatus(), nil
+	}
+	armTrafficKeyTimeout()
+	return trafficKeyStatus(), nil
+}
+
+// publishTrafficKey - publishes the host with the advertised traffic key to the servers
+func publishTrafficKey(servers []string, failure string) {
+	for _, server := range servers {
+		if err := PublishHostUpdate(server, models.UpdateHost); err != nil {
+			slog.Error(failure, "server", server, "error", err)
+		}
+	}
+}
+
+// GetTrafficKeyStatus - returns the state of the traffic key rotation
+func GetTrafficKeyStatus() TrafficKeyStatus {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	return trafficKeyStatus()
+}
+
+func trafficKeyStatus() TrafficKeyStatus {
+	host := config.Netclient()
+	status := TrafficKeyStatus{
+		Acknowledged: []string{},
+		Waiting:      []string{},
+		LastError:    lastTrafficRotationError,
+	}
+	if host.RetiredTrafficKey != nil && time.Now().Before(host.RetiredTrafficKey.Expires) {
+		status.GraceUntil = host.RetiredTrafficKey.Expires
+	}
+	if host.PendingTrafficKey == nil {
+		status.PublicKey = encodeTrafficKey(host.TrafficKeyPublic)
+		return status
+	}
+	status.Pending = true
+	status.PublicKey = encodeTrafficKey(host.PendingTrafficKey.Previous)
+	status.PendingKey = encodeTrafficKey(host.PendingTrafficKey.Public)
+	status.Started = host.PendingTrafficKey.Started
+	status.Acknowledged = append(status.Acknowledged, host.PendingTrafficKey.Acknowledged...)
+	status.Waiting = waitingServers(host.PendingTrafficKey.Acknowledged)
+	return status
+}
+
+// encodeTrafficKey - returns the base64 form of a traffic key stored in the config
+func encodeTrafficKey(data []byte) string {
+	key, err := ncutils.ConvertBytesToKey(data)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// hostTrafficKeyring - returns the private traffic keys messages of the server may be encrypted for
+func hostTrafficKeyring(server string) (trafficKeyring, error) {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	host := config.Netclient()
+	private := host.TrafficKeyPrivate
+	if key, ok := host.ServerTrafficKeys[server]; ok {
+		private = key.Private
+	}
+	current, err := ncutils.ConvertBytesToKey(private)
+	if err != nil {
+		return trafficKeyring{}, err
+	}
+	keyring := trafficKeyring{current: current}
+	if host.PendingTrafficKey != nil {
+		if keyring.pending, err = ncutils.ConvertBytesToKey(host.PendingTrafficKey.Private); err != nil {
+			slog.Warn("unreadable pending traffic key", "error", err)
+		}
+	}
+	if host.RetiredTrafficKey != nil && time.Now().Before(host.RetiredTrafficKey.Expires) {
+		if keyring.retired, err = ncutils.ConvertBytesToKey(host.RetiredTrafficKey.Private); err != nil {
+			slog.Warn("unreadable retired traffic key", "error", err)
+		}
+	}
+	return keyring, nil
+}
+
+// sendingTrafficKey - returns the private traffic key messages to the server are encrypted with,
+// during a rotation that is the pending key once the server encrypted a message for it
+func sendingTrafficKey(server string) (*[32]byte, error) {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	host := config.Netclient()
+	if pending := host.PendingTrafficKey; pending != nil && containsString(pending.Acknowledged, server) {
+		return ncutils.ConvertBytesToKey(pending.Private)
+	}
+	if key, ok := host.ServerTrafficKeys[server]; ok {
+		return ncutils.ConvertBytesToKey(key.Private)
+	}
+	return ncutils.ConvertBytesToKey(host.TrafficKeyPrivate)
+}
+
+// ackTrafficKey - records that the server encrypts for the pending traffic key,
+// the host switches to it once all servers do
+func ackTrafficKey(server string) {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	pending := config.Netclient().PendingTrafficKey
+	if pending == nil || containsString(pending.Acknowledged, server) {
+		return
+	}
+	pending.Acknowledged = append(pending.Acknowledged, server)
+	slog.Info("server switched to pending traffic key", "server", server)
+	if len(waitingServers(pending.Acknowledged)) > 0 {
+		if err := config.WriteNetclientConfig(); err != nil {
+			slog.Warn("failed to save traffic key acknowledgement", "error", err)
+		}
+		return
+	}
+	promoteTrafficKey()
+}
+
+// promoteTrafficKey - switches to the pending traffic key and retires the replaced one, the keys servers
+// kept from earlier rotations are dropped as all servers switched, the caller holds the traffic key lock
+func promoteTrafficKey() {
+	host := config.Netclient()
+	host.RetiredTrafficKey = &config.RetiredTrafficKey{
+		Private: host.TrafficKeyPrivate,
+		Expires: time.Now().Add(host.KeyRotation.GetTrafficKeyGrace()),
+	}
+	host.TrafficKeyPrivate = host.PendingTrafficKey.Private
+	host.TrafficKeyPublic = host.PendingTrafficKey.Public
+	host.PendingTrafficKey = nil
+	host.ServerTrafficKeys = nil
+	if trafficKeyTimer != nil {
+		trafficKeyTimer.Stop()
+	}
+	if err := config.WriteNetclientConfig(); err != nil {
+		slog.Error("error saving netclient config:", "error", err)
+	}
+	slog.Info("rotated traffic keys, accepting the old key during the grace window", "expires", host.RetiredTrafficKey.Expires)
+	events.Publish(events.TrafficKeyRotated{GraceUntil: host.RetiredTrafficKey.Expires})
+}
+
+// rollbackTrafficKeyRotation - drops the pending traffic key for the servers that did not switch to it,
+// the servers that did keep it; the pending key is also retired as the other servers may have stored it,
+// returns the servers to publish the previous key to, the caller holds the traffic key lock
+func rollbackTrafficKeyRotation(reason string) []string {
+	host := config.Netclient()
+	pending := host.PendingTrafficKey
+	host.RetiredTrafficKey = &config.RetiredTrafficKey{
+		Private: pending.Private,
+		Expires: time.Now().Add(host.KeyRotation.GetTrafficKeyGrace()),
+	}
+	if len(pending.Acknowledged) > 0 {
+		kept := make(map[string]config.ServerTrafficKey, len(host.ServerTrafficKeys)+len(pending.Acknowledged))
+		for server, key := range host.ServerTrafficKeys {
+			kept[server] = key
+		}
+		for _, server := range pending.Acknowledged {
+			kept[server] = config.ServerTrafficKey{Private: pending.Private, Public: pending.Public}
+		}
+		host.ServerTrafficKeys = kept
+	}
+	waiting := waitingServers(pending.Acknowledged)
+	host.TrafficKeyPublic = pending.Previous
+	host.PendingTrafficKey = nil
+	lastTrafficRotationError = reason
+	if err := config.WriteNetclientConfig(); err != nil {
+		slog.Error("error saving netclient config:", "error", err)
+	}
+	slog.Warn("rolled back traffic key rotation", "reason", reason, "kept", strings.Join(pending.Acknowledged, ", "))
+	events.Publish(events.TrafficKeyRotationRolledBack{Reason: reason})
+	return waiting
+}
+
+// armTrafficKeyTimeout - rolls the pending traffic key rotation back once its timeout expires,
+// the caller holds the traffic key lock
+func armTrafficKeyTimeout() {
+	if trafficKeyTimer != nil {
+		trafficKeyTimer.Stop()
+	}
+	host := config.Netclient()
+	started := host.PendingTrafficKey.Started
+	wait := time.Until(started.Add(host.KeyRotation.GetTimeout()))
+	trafficKeyTimer = time.AfterFunc(wait, func() {
+		if waiting, ok := expireTrafficKeyRotation(started); ok {
+			// advertise the previous key again to the servers that did not switch
+			publishTrafficKey(waiting, "failed to publish traffic key rollback")
+		}
+	})
+}
+
+// expireTrafficKeyRotation - rolls back the rotation started at the given time if it is still pending,
+// returns the servers that did not switch to the pending key and true if it was rolled back
+func expireTrafficKeyRotation(started time.Time) ([]string, bool) {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	pending := config.Netclient().PendingTrafficKey
+	if pending == nil || !pending.Started.Equal(started) {
+		return nil, false
+	}
+	return rollbackTrafficKeyRotation("timed out waiting for servers " + strings.Join(waitingServers(pending.Acknowledged), ", ")), true
+}
+
+// resumeTrafficKeyRotation - keeps waiting for the servers on a rotation started before the daemon was restarted
+func resumeTrafficKeyRotation() {
+	trafficKeyMutex.Lock()
+	defer trafficKeyMutex.Unlock()
+	host := config.Netclient()
+	if host.PendingTrafficKey == nil {
+		return
+	}
+	host.TrafficKeyPublic = host.PendingTrafficKey.Public
+	slog.Info("resuming traffic key rotation")
+	armTrafficKeyTimeout()
+}
+
+// RotateTrafficKeysCmd - starts a traffic key rotation in the daemon, waiting for its result if wait is set
+func RotateTrafficKeysCmd(wait bool) error {
+	var status TrafficKeyStatus
+	if err := daemonRequest(http.MethodPost, "/keys/traffic/rotate", nil, &status); err != nil {
+		return err
+	}
+	if !status.Pending {
+		fmt.Println("rotated traffic keys, public key", status.PublicKey)
+		return nil
+	}
+	fmt.Println("advertised new traffic key", status.PendingKey, "waiting for", strings.Join(status.Waiting, ", "))
+	if !wait {
+		return nil
+	}
+	pendingKey := status.PendingKey
+	for status.Pending && status.PendingKey == pendingKey {
+		time.Sleep(time.Second * 2)
+		if err := daemonRequest(http.MethodGet, "/keys/traffic", nil, &status); err != nil {
+			return err
+		}
+	}
+	if status.PublicKey != pendingKey {
+		return errors.New("traffic key rotation rolled back: " + status.LastError)
+	}
+	fmt.Println("rotated traffic keys, public key", status.PublicKey, "old key accepted until", status.GraceUntil.Format(time.RFC3339))
+	return nil
+}
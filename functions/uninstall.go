@@ -20,7 +20,10 @@ import (
 func Uninstall() ([]error, error) {
 	allfaults := []error{}
 	var err error
-	for _, v := range config.Servers {
+	if err = interfaceDown("uninstall"); err != nil {
+		logger.Log(0, "pre_down hooks aborted, the uninstall still takes the interface down", err.Error())
+	}
+	for _, v := range config.GetServerMap() {
 		v := v
 		if err = setupMQTTSingleton(&v, true); err != nil {
 			logger.Log(0, "failed to connect to server on uninstall", v.Name)
@@ -31,7 +34,7 @@ func Uninstall() ([]error, error) {
 			logger.Log(0, "failed to notify server", v.Name, "of host removal")
 			allfaults = append(allfaults, err)
 		}
-		Mqclient.Disconnect(250)
+		closeMQTTSingleton(v.Name)
 	}
 	if err := deleteAllDNS(); err != nil {
 		logger.Log(0, "failed to delete entries from /etc/hosts", err.Error())
@@ -60,6 +63,7 @@ func LeaveNetwork(network string, isDaemon bool) ([]error, error) {
 	if err := deleteNetworkDNS(network); err != nil {
 		faults = append(faults, fmt.Errorf("error deleting dns entries %w", err))
 	}
+	dropAclPolicy(network)
 	// re-configure interface if daemon is calling leave
 	if isDaemon {
 		nc := wireguard.GetInterface()
@@ -75,7 +79,9 @@ func LeaveNetwork(network string, isDaemon bool) ([]error, error) {
 			if err = routes.SetNetmakerPeerEndpointRoutes(config.Netclient().DefaultInterface); err != nil {
 				faults = append(faults, fmt.Errorf("issue setting peers routes after node removal - %v", err.Error()))
 			}
+			interfaceUp()
 		}
+		applyAclPolicies()
 	} else { // was called from CLI so restart daemon
 		if err := daemon.Restart(); err != nil {
 			faults = append(faults, fmt.Errorf("could not restart daemon after leave - %v", err.Error()))
@@ -137,7 +143,7 @@ func deleteLocalNetwork(node *config.Node) error {
 		delete(server.Nodes, node.Network)
 		if len(server.Nodes) == 0 {
 			logger.Log(3, "removing server peers", server.Name)
-			config.DeleteServerHostPeerCfg()
+			config.DeleteServerHostPeerCfg(server.Name)
 		}
 	}
 
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/devilcove/httpclient"
@@ -22,7 +23,7 @@ var headers []httpclient.Header
 func (app *App) GoGetStatus() (any, error) {
 	// set timeout to low value
 	httpclient.Client.Timeout = 5 * time.Second
-	_, err := httpclient.GetResponse(nil, http.MethodGet, url+"/status", "", headers)
+	_, err := httpclient.GetResponse(nil, http.MethodGet, url+functions.APIVersionPath+"/status", "", headers)
 	if err != nil {
 		return nil, errors.New("netclient http server is not running")
 	}
@@ -32,12 +33,12 @@ func (app *App) GoGetStatus() (any, error) {
 // App.GoGetKnownNetworks returns all known network configs (node, server)
 func (app *App) GoGetKnownNetworks() ([]Network, error) {
 	networks := []Network{}
-	response, err := httpclient.GetResponse(nil, http.MethodGet, url+"/allnetworks", "", headers)
+	response, err := httpclient.GetResponse(nil, http.MethodGet, url+functions.APIVersionPath+"/networks", "", headers)
 	if err != nil {
 		return networks, err
 	}
 	if response.StatusCode != http.StatusOK {
-		return networks, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+		return networks, apiError(response)
 	}
 	if err := json.NewDecoder(response.Body).Decode(&networks); err != nil {
 		return networks, err
@@ -48,12 +49,12 @@ func (app *App) GoGetKnownNetworks() ([]Network, error) {
 // App.GoGetNetwork returns node, server configs for the given network
 func (app *App) GoGetNetwork(networkName string) (Network, error) {
 	network := Network{}
-	response, err := httpclient.GetResponse(nil, http.MethodGet, url+"/networks/"+networkName, "", headers)
+	response, err := httpclient.GetResponse(nil, http.MethodGet, url+functions.APIVersionPath+"/networks/"+networkName, "", headers)
 	if err != nil {
 		return network, err
 	}
 	if response.StatusCode != http.StatusOK {
-		return network, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+		return network, apiError(response)
 	}
 	if err := json.NewDecoder(response.Body).Decode(&network); err != nil {
 		return network, err
@@ -65,12 +66,12 @@ func (app *App) GoGetNetwork(networkName string) (Network, error) {
 // (params the remain constant regardless the networks nc is connected to)
 func (app *App) GoGetNetclientConfig() (NcConfig, error) {
 	config := NcConfig{}
-	response, err := httpclient.GetResponse(nil, http.MethodGet, url+"/netclient", "", headers)
+	response, err := httpclient.GetResponse(nil, http.MethodGet, url+functions.APIVersionPath+"/netclient", "", headers)
 	if err != nil {
 		return config, err
 	}
 	if response.StatusCode != http.StatusOK {
-		return config, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+		return config, apiError(response)
 	}
 	if err := json.NewDecoder(response.Body).Decode(&config); err != nil {
 		return config, err
@@ -85,12 +86,12 @@ func (app *App) GoConnectToNetwork(networkName string) (any, error) {
 	}{
 		Connect: true,
 	}
-	response, err := httpclient.GetResponse(connect, http.MethodPost, url+"/connect/"+networkName, "", headers)
+	response, err := httpclient.GetResponse(connect, http.MethodPost, url+functions.APIVersionPath+"/networks/"+networkName+"/connect", "", headers)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	if response.StatusCode != http.StatusNoContent {
+		return nil, apiError(response)
 	}
 	return nil, nil
 }
@@ -102,44 +103,42 @@ func (app *App) GoDisconnectFromNetwork(networkName string) (any, error) {
 	}{
 		Connect: false,
 	}
-	response, err := httpclient.GetResponse(connect, http.MethodPost, url+"/connect/"+networkName, "", headers)
+	response, err := httpclient.GetResponse(connect, http.MethodPost, url+functions.APIVersionPath+"/networks/"+networkName+"/connect", "", headers)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	if response.StatusCode != http.StatusNoContent {
+		return nil, apiError(response)
 	}
 	return nil, nil
 }
 
 // App.GoLeaveNetwork leaves a known network
 func (app *App) GoLeaveNetwork(networkName string) (any, error) {
-	response, err := httpclient.GetResponse("", http.MethodPost, url+"/leave/"+networkName, "", headers)
+	response, err := httpclient.GetResponse(nil, http.MethodPost, url+functions.APIVersionPath+"/networks/"+networkName+"/leave", "", headers)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	if response.StatusCode != http.StatusNoContent {
+		return nil, apiError(response)
 	}
 	return nil, nil
 }
 
 // App.GoGetRecentServerNames returns names of all known (joined) servers
 func (app *App) GoGetRecentServerNames() ([]string, error) {
-	var servers struct {
-		Name []string
-	}
-	response, err := httpclient.GetResponse(nil, http.MethodGet, url+"/servers", "", headers)
+	var servers functions.ServerList
+	response, err := httpclient.GetResponse(nil, http.MethodGet, url+functions.APIVersionPath+"/servers", "", headers)
 	if err != nil {
 		return []string{}, err
 	}
 	if response.StatusCode != http.StatusOK {
-		return []string{}, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+		return []string{}, apiError(response)
 	}
 	if err := json.NewDecoder(response.Body).Decode(&servers); err != nil {
 		return []string{}, err
 	}
-	return servers.Name, nil
+	return servers.Names, nil
 }
 
 // App.GoJoinNetworkBySso joins a network by SSO
@@ -152,12 +151,12 @@ func (app *App) GoJoinNetworkBySso(serverName, networkName string) (SsoJoinResDt
 	}
 	res := SsoJoinResDto{}
 
-	response, err := httpclient.GetResponse(payload, http.MethodPost, url+"/sso/", "", headers)
+	response, err := httpclient.GetResponse(payload, http.MethodPost, url+functions.APIVersionPath+"/sso", "", headers)
 	if err != nil {
 		return res, err
 	}
 	if response.StatusCode != http.StatusOK {
-		return res, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+		return res, apiError(response)
 	}
 
 	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
@@ -177,24 +176,24 @@ func (app *App) GoJoinNetworkByBasicAuth(serverName, username, networkName, pass
 		AllNetworks: false,
 	}
 
-	response, err := httpclient.GetResponse(payload, http.MethodPost, url+"/join/", "", headers)
+	response, err := httpclient.GetResponse(payload, http.MethodPost, url+functions.APIVersionPath+"/join", "", headers)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	if response.StatusCode != http.StatusNoContent {
+		return nil, apiError(response)
 	}
 	return nil, nil
 }
 
 // App.GoUninstall uninstalls netclient form the machine
 func (app *App) GoUninstall() (any, error) {
-	response, err := httpclient.GetResponse("", http.MethodPost, url+"/uninstall/", "", headers)
+	response, err := httpclient.GetResponse(nil, http.MethodPost, url+functions.APIVersionPath+"/uninstall", "", headers)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	if response.StatusCode != http.StatusNoContent {
+		return nil, apiError(response)
 	}
 	return nil, nil
 }
@@ -239,12 +238,12 @@ func (app *App) GoPullLatestNodeConfig(network string) (Network, error) {
 // App.GoGetNodePeers returns the peers for the given node
 func (app *App) GoGetNodePeers(node config.Node) ([]wgtypes.PeerConfig, error) {
 	var peers []wgtypes.PeerConfig
-	response, err := httpclient.GetResponse(node, http.MethodPost, url+"/nodepeers", "", headers)
+	response, err := httpclient.GetResponse(nil, http.MethodGet, url+functions.APIVersionPath+"/networks/"+node.Network+"/peers", "", headers)
 	if err != nil {
 		return peers, err
 	}
 	if response.StatusCode != http.StatusOK {
-		return peers, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+		return peers, apiError(response)
 	}
 	if err := json.NewDecoder(response.Body).Decode(&peers); err != nil {
 		return peers, err
@@ -266,12 +265,24 @@ func (app *App) GoRegisterWithEnrollmentKey(key string) (any, error) {
 	}{
 		Token: key,
 	}
-	response, err := httpclient.GetResponse(token, http.MethodPost, url+"/register/", "", headers)
+	response, err := httpclient.GetResponse(token, http.MethodPost, url+functions.APIVersionPath+"/register", "", headers)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	if response.StatusCode != http.StatusNoContent {
+		return nil, apiError(response)
 	}
 	return nil, nil
 }
+
+// apiError returns the error of a failed local api request
+func apiError(response *http.Response) error {
+	var apiErr functions.ErrorResponse
+	if err := json.NewDecoder(response.Body).Decode(&apiErr); err != nil || apiErr.Error.Message == "" {
+		return fmt.Errorf("http status err %d %s", response.StatusCode, response.Status)
+	}
+	if len(apiErr.Error.Details) > 0 {
+		return fmt.Errorf("%s: %s", apiErr.Error.Message, strings.Join(apiErr.Error.Details, ", "))
+	}
+	return errors.New(apiErr.Error.Message)
+}
@@ -4,7 +4,9 @@ import (
 	"embed"
 	"log"
 
+	"github.com/devilcove/httpclient"
 	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/functions"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -30,7 +32,20 @@ func main() {
 	if err != nil {
 		logger.FatalLog("error reading gui config", err.Error())
 	}
-	url = "http://" + http.Address + ":" + http.Port
+	if http.Socket != "" {
+		// the host part is ignored by the socket transport
+		url = "http://netclient"
+		httpclient.Client.Transport = functions.LocalAPITransport()
+	} else if http.Port != "" {
+		url = "http://" + http.Address + ":" + http.Port
+	} else {
+		logger.FatalLog("netclient local api is not reachable, enable localapitcp in the netclient config")
+	}
+	token, err := config.GetAPIToken()
+	if err != nil {
+		logger.FatalLog("error reading local api token", err.Error())
+	}
+	headers = append(headers, httpclient.Header{Name: "Authorization", Value: "Bearer " + token})
 	// Create an instance of the guiApp structure
 	guiApp := NewApp()
 	guiApp.GoGetNetclientConfig()
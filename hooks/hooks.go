@@ -0,0 +1,203 @@
+// Package hooks runs site specific commands on lifecycle events of the daemon
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"golang.org/x/exp/slog"
+)
+
+// syncEvents - events whose hooks are run by the code raising the event with Run,
+// so they finish before the operation continues and an abort can cancel it
+var syncEvents = map[string]struct{}{
+	events.PostUp{}.EventName():       {},
+	events.PreDown{}.EventName():      {},
+	events.ServerJoined{}.EventName(): {},
+	events.ServerLeft{}.EventName():   {},
+}
+
+// hook - command to run for an event
+type hook struct {
+	name      string
+	command   string
+	args      []string
+	timeout   time.Duration
+	onFailure string
+}
+
+// Start - runs the hooks of the events published on the bus one after the other, in the order
+// the events were published; the hooks of sync events are left to Run
+func Start(ctx context.Context, waitg *sync.WaitGroup) {
+	defer waitg.Done()
+	sub := events.Subscribe(events.DefaultBuffer)
+	defer sub.Close()
+	var dropped uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case envelope, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if n := sub.Dropped(); n > dropped {
+				slog.Warn("hooks fell behind, events were skipped", "skipped", n-dropped)
+				dropped = n
+			}
+			if _, ok := syncEvents[envelope.Name]; ok {
+				continue
+			}
+			if err := run(envelope); err != nil {
+				slog.Warn("hooks aborted", "event", envelope.Name, "error", err)
+			}
+		}
+	}
+}
+
+// Run - runs the hooks of the event and waits for them, returns an error if a hook
+// with the abort policy failed
+func Run(e events.Event) error {
+	return run(events.Envelope{
+		Name: e.EventName(),
+		Time: time.Now(),
+		Data: e,
+	})
+}
+
+func run(envelope events.Envelope) error {
+	hooks := getHooks(envelope.Name)
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		if err := h.exec(envelope.Name, payload); err != nil {
+			if h.onFailure == config.HookAbort {
+				return fmt.Errorf("hook %s failed: %w", h.name, err)
+			}
+			slog.Warn("hook failed", "event", envelope.Name, "hook", h.name, "error", err)
+		}
+	}
+	return nil
+}
+
+// getHooks - returns the hooks of the event, the configured hooks in order followed by
+// the scripts of the event's hooks directory sorted by name
+func getHooks(event string) []hook {
+	hooks := []hook{}
+	for _, h := range config.Netclient().Hooks {
+		if h.Event != event || h.Command == "" {
+			continue
+		}
+		timeout := h.Timeout
+		if timeout <= 0 {
+			timeout = config.DefaultHookTimeout
+		}
+		onFailure := h.OnFailure
+		if onFailure != config.HookAbort {
+			onFailure = config.HookWarn
+		}
+		hooks = append(hooks, hook{
+			name:      h.Command,
+			command:   h.Command,
+			args:      h.Args,
+			timeout:   time.Duration(timeout) * time.Second,
+			onFailure: onFailure,
+		})
+	}
+	dir := filepath.Join(config.GetHooksPath(), event)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read hooks directory", "dir", dir, "error", err)
+		}
+		return hooks
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+			slog.Debug("skipping hook that is not executable", "hook", filepath.Join(dir, entry.Name()))
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hooks = append(hooks, hook{
+			name:      filepath.Join(dir, name),
+			command:   filepath.Join(dir, name),
+			timeout:   config.DefaultHookTimeout * time.Second,
+			onFailure: config.HookWarn,
+		})
+	}
+	return hooks
+}
+
+// hook.exec - runs the hook with the payload on stdin, killing it and the processes it started
+// once it exceeds its timeout
+func (h *hook) exec(event string, payload []byte) error {
+	cmd := exec.Command(h.command, h.args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "NETCLIENT_EVENT="+event)
+	setProcessGroup(cmd)
+	// output goes to a file rather than a pipe, so children the hook leaves behind
+	// do not keep it from returning
+	output, err := os.CreateTemp("", "netclient-hook-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+	case <-timer.C:
+		if killErr := killProcessGroup(cmd); killErr != nil {
+			slog.Warn("failed to kill hook", "hook", h.name, "error", killErr)
+		}
+		<-done
+		err = fmt.Errorf("timed out after %s", h.timeout)
+	}
+	if err != nil {
+		if out, readErr := os.ReadFile(output.Name()); readErr == nil && len(bytes.TrimSpace(out)) > 0 {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+		}
+		return err
+	}
+	slog.Debug("ran hook", "event", event, "hook", h.name, "duration", time.Since(start).String())
+	return nil
+}
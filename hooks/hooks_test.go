@@ -0,0 +1,164 @@
+//go:build linux
+// +build linux
+
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/matryer/is"
+)
+
+// useHooks - points the netclient files to a temporary directory without configured hooks,
+// returns the directory
+func useHooks(t *testing.T) string {
+	dir := t.TempDir()
+	config.SetNetclientPath(dir + string(os.PathSeparator))
+	config.UpdateNetclient(config.Config{})
+	t.Cleanup(func() {
+		config.SetNetclientPath("")
+		config.UpdateNetclient(config.Config{})
+	})
+	return dir
+}
+
+// shellHook - returns a hook of the event running the shell script
+func shellHook(event, script string, timeout int, onFailure string) config.Hook {
+	return config.Hook{Event: event, Command: "/bin/sh", Args: []string{"-c", script}, Timeout: timeout, OnFailure: onFailure}
+}
+
+// writeScript - writes a hook script of the event to the hooks directory
+func writeScript(t *testing.T, event, name, script string, perm os.FileMode) {
+	dir := filepath.Join(config.GetHooksPath(), event)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLines - returns the lines of the file, none if it does not exist
+func readLines(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []string{}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+// processRunning - returns true if the process exists and has not exited
+func processRunning(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z" && fields[0] != "X"
+}
+
+func TestRunOrder(t *testing.T) {
+	is := is.New(t)
+	event := events.PreDown{}.EventName()
+	dir := useHooks(t)
+	log := filepath.Join(dir, "log")
+	config.Netclient().Hooks = []config.Hook{
+		shellHook(event, "echo config-1 >> "+log, 0, ""),
+		shellHook("post_up", "echo other-event >> "+log, 0, ""),
+		shellHook(event, "echo config-2 >> "+log, 0, ""),
+	}
+	writeScript(t, event, "20-b", "echo script-b >> "+log, 0755)
+	writeScript(t, event, "10-a", "echo script-a >> "+log, 0755)
+	writeScript(t, event, "30-c", "echo not-executable >> "+log, 0644)
+	writeScript(t, event, ".hidden", "echo hidden >> "+log, 0755)
+	is.NoErr(Run(events.PreDown{Interface: "netmaker", Reason: "test"}))
+	// configured hooks run in order before the scripts sorted by name
+	is.Equal(readLines(t, log), []string{"config-1", "config-2", "script-a", "script-b"})
+}
+
+func TestRunPayload(t *testing.T) {
+	is := is.New(t)
+	event := events.PreDown{}.EventName()
+	dir := useHooks(t)
+	stdin := filepath.Join(dir, "stdin")
+	env := filepath.Join(dir, "env")
+	config.Netclient().Hooks = []config.Hook{shellHook(event, "cat > "+stdin+"; echo $NETCLIENT_EVENT > "+env, 0, "")}
+	is.NoErr(Run(events.PreDown{Interface: "netmaker", Reason: "test"}))
+	var envelope struct {
+		Name string         `json:"name"`
+		Data events.PreDown `json:"data"`
+	}
+	data, err := os.ReadFile(stdin)
+	is.NoErr(err)
+	is.NoErr(json.Unmarshal(data, &envelope))
+	is.Equal(envelope.Data.Reason, "test")
+	is.Equal(readLines(t, env), []string{event})
+}
+
+func TestRunFailurePolicy(t *testing.T) {
+	event := events.PreDown{}.EventName()
+	tests := []struct {
+		name      string
+		onFailure string
+		aborted   bool
+	}{
+		{name: "warn", onFailure: config.HookWarn},
+		{name: "default", onFailure: "unknown"},
+		{name: "abort", onFailure: config.HookAbort, aborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			dir := useHooks(t)
+			log := filepath.Join(dir, "log")
+			config.Netclient().Hooks = []config.Hook{
+				shellHook(event, "echo failing >&2; exit 3", 0, tt.onFailure),
+				shellHook(event, "echo next >> "+log, 0, ""),
+			}
+			err := Run(events.PreDown{})
+			is.Equal(err != nil, tt.aborted)
+			if tt.aborted {
+				is.True(strings.Contains(err.Error(), "failing")) // the output of the hook is part of the error
+				is.Equal(readLines(t, log), []string{})
+				return
+			}
+			is.Equal(readLines(t, log), []string{"next"})
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	is := is.New(t)
+	event := events.PreDown{}.EventName()
+	dir := useHooks(t)
+	pidfile := filepath.Join(dir, "pid")
+	// the hook leaves a child behind that outlives its timeout
+	config.Netclient().Hooks = []config.Hook{shellHook(event, "sleep 60 & echo $! > "+pidfile+"; wait", 1, config.HookAbort)}
+	start := time.Now()
+	err := Run(events.PreDown{})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "timed out"))
+	is.True(time.Since(start) < time.Second*10)
+	lines := readLines(t, pidfile)
+	is.Equal(len(lines), 1)
+	pid, err := strconv.Atoi(lines[0])
+	is.NoErr(err)
+	// the process group of the hook is killed with it
+	deadline := time.Now().Add(time.Second * 5)
+	for processRunning(pid) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 50)
+	}
+	is.True(!processRunning(pid))
+}
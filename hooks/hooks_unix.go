@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package hooks
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup - starts the hook in a process group of its own, so the processes it starts
+// can be killed with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup - kills the hook and the processes it started
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,11 @@
+package hooks
+
+import "os/exec"
+
+// setProcessGroup - windows has no process groups to kill, only the hook itself is killed
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup - kills the hook
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -15,7 +15,7 @@ import (
 
 var (
 	// contains all the config related to proxy
-	config        = &Config{}
+	config        = &Config{mutex: &sync.RWMutex{}}
 	natAutoSwitch bool
 	// DumpSignalChan - channel to signal dump proxy conns info
 	DumpSignalChan = make(chan struct{}, 5)
@@ -105,7 +105,7 @@ func (c *Config) GetHostInfo() proxyModels.HostInfo {
 
 // Reset - resets Config // to be called only when proxy is shutting down
 func Reset() {
-	config = &Config{}
+	config = &Config{mutex: &sync.RWMutex{}}
 }
 
 // GetCfg - fethes Config
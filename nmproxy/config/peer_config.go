@@ -89,27 +89,46 @@ func (c *Config) GetDevicePubKey() (publicKey wgtypes.Key) {
 	return
 }
 
-// Config.GetAllProxyPeers - fetches all peers in the network
+// Config.GetAllProxyPeers - fetches a copy of all peers in the network, changes to the map itself
+// are saved with UpdateProxyPeers
 func (c *Config) GetAllProxyPeers() models.PeerConnMap {
-	return c.ifaceConfig.proxyPeerMap
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	peers := make(models.PeerConnMap, len(c.ifaceConfig.proxyPeerMap))
+	for key, peer := range c.ifaceConfig.proxyPeerMap {
+		peers[key] = peer
+	}
+	return peers
 }
 
 // Config.UpdateProxyPeers - updates all peers in the network
 func (c *Config) UpdateProxyPeers(peers *models.PeerConnMap) {
 	if peers != nil {
+		c.mutex.Lock()
 		c.ifaceConfig.proxyPeerMap = *peers
+		c.mutex.Unlock()
 	}
 }
 
 // Config.SavePeer - saves peer to the config
 func (c *Config) SavePeer(connConf *models.Conn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.ifaceConfig.proxyPeerMap[connConf.Key.String()] = connConf
 }
 
+// Config.peer - fetches the peer by pubkey under the lock of the config
+func (c *Config) peer(peerPubKey string) (*models.Conn, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	peerConn, found := c.ifaceConfig.proxyPeerMap[peerPubKey]
+	return peerConn, found
+}
+
 // Config.GetPeer - fetches the peer by network and pubkey
 func (c *Config) GetPeer(peerPubKey string) (models.Conn, bool) {
 
-	if peerConn, found := c.ifaceConfig.proxyPeerMap[peerPubKey]; found {
+	if peerConn, found := c.peer(peerPubKey); found {
 		return *peerConn, found
 	}
 
@@ -119,9 +138,11 @@ func (c *Config) GetPeer(peerPubKey string) (models.Conn, bool) {
 // Config.UpdatePeer - updates peer by network
 func (c *Config) UpdatePeer(updatedPeer *models.Conn) {
 
-	if peerConf, found := c.ifaceConfig.proxyPeerMap[updatedPeer.Key.String()]; found {
+	if peerConf, found := c.peer(updatedPeer.Key.String()); found {
 		peerConf.Mutex.Lock()
+		c.mutex.Lock()
 		c.ifaceConfig.proxyPeerMap[updatedPeer.Key.String()] = updatedPeer
+		c.mutex.Unlock()
 		peerConf.Mutex.Unlock()
 	}
 }
@@ -129,7 +150,7 @@ func (c *Config) UpdatePeer(updatedPeer *models.Conn) {
 // Config.ResetPeer - resets the peer connection to proxy
 func (c *Config) ResetPeer(peerKey string) {
 
-	if peerConf, found := c.ifaceConfig.proxyPeerMap[peerKey]; found {
+	if peerConf, found := c.peer(peerKey); found {
 		peerConf.Mutex.Lock()
 		peerConf.ResetConn()
 		peerConf.Mutex.Unlock()
@@ -140,13 +161,16 @@ func (c *Config) ResetPeer(peerKey string) {
 // Config.RemovePeer - removes the peer from the network peer config
 func (c *Config) RemovePeer(peerPubKey string) {
 
-	if peerConf, found := c.ifaceConfig.proxyPeerMap[peerPubKey]; found {
+	c.mutex.Lock()
+	peerConf, found := c.ifaceConfig.proxyPeerMap[peerPubKey]
+	delete(c.ifaceConfig.proxyPeerMap, peerPubKey)
+	c.mutex.Unlock()
+	if found {
 
 		logger.Log(0, "----> Deleting Peer from proxy: ", peerConf.Key.String())
 		peerConf.Mutex.Lock()
 		peerConf.StopConn()
 		peerConf.Mutex.Unlock()
-		delete(c.ifaceConfig.proxyPeerMap, peerPubKey)
 		GetCfg().DeletePeerHash(peerConf.Key.String())
 		for server := range peerConf.ServerMap {
 			GetCfg().DeletePeerTurnCfg(server, peerPubKey)
@@ -158,7 +182,7 @@ func (c *Config) RemovePeer(peerPubKey string) {
 
 // Config.UpdatePeerNetwork - updates the peer network settings map
 func (c *Config) UpdatePeerNetwork(peerPubKey, network string, setting models.Settings) {
-	if peerConf, found := c.ifaceConfig.proxyPeerMap[peerPubKey]; found {
+	if peerConf, found := c.peer(peerPubKey); found {
 		peerConf.Mutex.Lock()
 		peerConf.NetworkSettings[network] = setting
 		peerConf.Mutex.Unlock()
@@ -168,13 +192,13 @@ func (c *Config) UpdatePeerNetwork(peerPubKey, network string, setting models.Se
 // Config.CheckIfPeerExists - checks if peer exists in the config
 func (c *Config) CheckIfPeerExists(peerPubKey string) bool {
 
-	_, found := c.ifaceConfig.proxyPeerMap[peerPubKey]
+	_, found := c.peer(peerPubKey)
 	return found
 }
 
-// Config.GetNetworkPeerMap - fetches all peers in the network
+// Config.GetNetworkPeerMap - fetches a copy of all peers in the network
 func (c *Config) GetNetworkPeerMap() models.PeerConnMap {
-	return c.ifaceConfig.proxyPeerMap
+	return c.GetAllProxyPeers()
 }
 
 // Config.SavePeerByHash - saves peer by its publicKey hash to the config
@@ -263,25 +287,84 @@ func (c *Config) UpdateWgIface(wgIface *wg.WGIface) {
 	c.ifaceConfig.iface = wgIface
 }
 
-// Config.GetAllPeersIDsAndAddrs - get all peers
+// Config.GetAllPeersIDsAndAddrs - get a copy of all peers per server
 func (c *Config) GetAllPeersIDsAndAddrs() map[string]nm_models.HostPeerMap {
-	return c.ifaceConfig.allPeersConf
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	all := make(map[string]nm_models.HostPeerMap, len(c.ifaceConfig.allPeersConf))
+	for server, peers := range c.ifaceConfig.allPeersConf {
+		all[server] = copyHostPeerMap(peers)
+	}
+	return all
 }
 
 // Config.SetPeersIDsAndAddrs - sets the peers in the config
 func (c *Config) SetPeersIDsAndAddrs(server string, peers nm_models.HostPeerMap) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.ifaceConfig.allPeersConf[server] = peers
 }
 
 // Config.GetPeersIDsAndAddrs - get peer conf
 func (c *Config) GetPeersIDsAndAddrs(server, peerKey string) (map[string]nm_models.IDandAddr, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	if peersIDsAndAddrs, ok := c.ifaceConfig.allPeersConf[server]; ok {
-		return peersIDsAndAddrs[peerKey], ok
+		ids := make(map[string]nm_models.IDandAddr, len(peersIDsAndAddrs[peerKey]))
+		for id, idAndAddr := range peersIDsAndAddrs[peerKey] {
+			ids[id] = idAndAddr
+		}
+		return ids, ok
 	}
 
 	return make(map[string]nm_models.IDandAddr), false
 }
 
+// copyHostPeerMap - returns a copy of the nodes of the peers
+func copyHostPeerMap(peers nm_models.HostPeerMap) nm_models.HostPeerMap {
+	copied := make(nm_models.HostPeerMap, len(peers))
+	for peerKey, ids := range peers {
+		copied[peerKey] = make(map[string]nm_models.IDandAddr, len(ids))
+		for id, idAndAddr := range ids {
+			copied[peerKey][id] = idAndAddr
+		}
+	}
+	return copied
+}
+
+// PeerMaps - copies of the proxy peers, the nodes of the peers per server and the turn configs of the
+// peers per server
+type PeerMaps struct {
+	Peers     map[string]models.Conn
+	Nodes     map[string]nm_models.HostPeerMap
+	TurnPeers map[string]map[string]models.TurnPeerCfg
+}
+
+// Config.CopyPeerMaps - copies the peer maps under the lock of the config, the copies can be read
+// while the proxy manager updates the config
+func (c *Config) CopyPeerMaps() PeerMaps {
+	maps := PeerMaps{
+		Peers:     make(map[string]models.Conn),
+		Nodes:     c.GetAllPeersIDsAndAddrs(),
+		TurnPeers: make(map[string]map[string]models.TurnPeerCfg),
+	}
+	for key, peer := range c.GetAllProxyPeers() {
+		// the proxy changes a peer under its own lock
+		peer.Mutex.RLock()
+		maps.Peers[key] = *peer
+		peer.Mutex.RUnlock()
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for server, peers := range c.ifaceConfig.turnPeerMap {
+		maps.TurnPeers[server] = make(map[string]models.TurnPeerCfg, len(peers))
+		for peerKey, cfg := range peers {
+			maps.TurnPeers[server][peerKey] = cfg
+		}
+	}
+	return maps
+}
+
 // Config.SetTurnCfg - sets the turn config
 func (c *Config) SetTurnCfg(server string, t models.TurnCfg) {
 	c.mutex.Lock()
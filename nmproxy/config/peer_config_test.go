@@ -0,0 +1,56 @@
+package config
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gravitl/netclient/nmproxy/models"
+	nm_models "github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestCopyPeerMaps(t *testing.T) {
+	InitializeCfg()
+	defer Reset()
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerKey := key.PublicKey().String()
+
+	t.Run("copies are independent of the config", func(t *testing.T) {
+		is := is.New(t)
+		GetCfg().SavePeer(&models.Conn{Key: key.PublicKey(), Mutex: &sync.RWMutex{}, IsRelayed: true, StopConn: func() {}})
+		GetCfg().SetPeersIDsAndAddrs("server", nm_models.HostPeerMap{
+			peerKey: {"node": {ID: "node", Network: "dev"}},
+		})
+		GetCfg().SetPeerTurnCfg("server", peerKey, models.TurnPeerCfg{PeerTurnAddr: "10.0.0.1:3478"})
+		maps := GetCfg().CopyPeerMaps()
+		GetCfg().UpdatePeerTurnAddr("server", peerKey, "")
+		GetCfg().SetPeersIDsAndAddrs("server", nm_models.HostPeerMap{})
+		GetCfg().RemovePeer(peerKey)
+		is.True(maps.Peers[peerKey].IsRelayed)
+		is.Equal(maps.Nodes["server"][peerKey]["node"].Network, "dev")
+		is.Equal(maps.TurnPeers["server"][peerKey].PeerTurnAddr, "10.0.0.1:3478")
+	})
+	t.Run("copies while the proxy updates the peers", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				GetCfg().SavePeer(&models.Conn{Key: key.PublicKey(), Mutex: &sync.RWMutex{}, StopConn: func() {}})
+				GetCfg().SetPeersIDsAndAddrs("server", nm_models.HostPeerMap{peerKey: {}})
+				GetCfg().RemovePeer(peerKey)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				GetCfg().CopyPeerMaps()
+			}
+		}()
+		wg.Wait()
+	})
+}
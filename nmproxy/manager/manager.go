@@ -7,6 +7,7 @@ import (
 	"net"
 	"sync"
 
+	"github.com/gravitl/netclient/events"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netclient/nmproxy/config"
 	"github.com/gravitl/netclient/nmproxy/models"
@@ -189,6 +190,7 @@ func cleanUpInterface() {
 		config.GetCfg().RemovePeer(peerI.Key.String())
 		wireguard.UpdatePeer(&peerI.Config.PeerConf)
 	}
+	events.Publish(events.ProxyPeersReset{})
 
 }
 
@@ -226,6 +228,7 @@ func (m *proxyPayload) processPayload() error {
 				}
 				gCfg.DeletePeerHash(peerConn.Key.String())
 				gCfg.RemovePeer(peerConn.Key.String())
+				delete(peerConnMap, peerConn.Key.String())
 			}
 
 			continue
@@ -422,7 +425,17 @@ func (m *proxyPayload) peerUpdate() error {
 
 		}
 		if shouldUseProxy {
-			peerpkg.AddNew(m.Server, peerI, peerConf, isRelayed, relayedTo, false)
+			if err := peerpkg.AddNew(m.Server, peerI, peerConf, isRelayed, relayedTo, false); err == nil {
+				proxyPeer := events.ProxyPeerAdded{
+					Server:    m.Server,
+					PublicKey: peerI.PublicKey.String(),
+					Relayed:   isRelayed,
+				}
+				if relayedTo != nil {
+					proxyPeer.RelayedTo = relayedTo.String()
+				}
+				events.Publish(proxyPeer)
+			}
 		}
 
 	}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"fmt"
+	"net"
+)
+
+// protocols of acl rules
+const (
+	AclProtocolTCP  = "tcp"
+	AclProtocolUDP  = "udp"
+	AclProtocolICMP = "icmp"
+)
+
+// AclRule - a rule of the acl policy of a network, allows or denies traffic of the sources on the netmaker
+// interface to the host; the first matching rule of a network wins, allowed traffic and traffic no rule
+// matches return to the input rules of the host, which decide whether it is accepted
+type AclRule struct {
+	Sources  []net.IPNet `json:"sources"`            // rules without sources match nothing
+	Protocol string      `json:"protocol,omitempty"` // tcp, udp or icmp, all protocols if empty
+	Ports    []PortRange `json:"ports,omitempty"`    // destination ports of tcp and udp, all ports if empty
+	Allow    bool        `json:"allow"`
+}
+
+// PortRange - destination ports From to To, both included
+type PortRange struct {
+	From uint16 `json:"from"`
+	To   uint16 `json:"to"`
+}
+
+// validateAclRules - returns an error for rules the backends can not install
+func validateAclRules(rules []AclRule) error {
+	for i, rule := range rules {
+		switch rule.Protocol {
+		case "", AclProtocolTCP, AclProtocolUDP, AclProtocolICMP:
+		default:
+			return fmt.Errorf("acl rule %d: unknown protocol %q", i, rule.Protocol)
+		}
+		if len(rule.Ports) > 0 && rule.Protocol != AclProtocolTCP && rule.Protocol != AclProtocolUDP {
+			return fmt.Errorf("acl rule %d: ports need protocol tcp or udp", i)
+		}
+		for _, ports := range rule.Ports {
+			if ports.From == 0 || ports.From > ports.To {
+				return fmt.Errorf("acl rule %d: invalid port range %d-%d", i, ports.From, ports.To)
+			}
+		}
+		for _, source := range rule.Sources {
+			if source.IP == nil || source.Mask == nil {
+				return fmt.Errorf("acl rule %d: invalid source", i)
+			}
+		}
+	}
+	return nil
+}
+
+// SetAclRules - enforces the acl rules of a network on the netmaker interface, replacing the rules it had;
+// the firewall controller is initialised if it is not running
+func SetAclRules(network string, rules []AclRule) error {
+	if err := validateAclRules(rules); err != nil {
+		return err
+	}
+	fwMutex.Lock()
+	aclPolicies[network] = rules
+	fwMutex.Unlock()
+	if _, err := Init(); err != nil {
+		return err
+	}
+	return fwCrtl.SetAclRules(network, rules)
+}
+
+// DeleteAclRules - removes the acl rules of a network, its peers reach all ports of the host again
+func DeleteAclRules(network string) error {
+	fwMutex.Lock()
+	defer fwMutex.Unlock()
+	if _, ok := aclPolicies[network]; !ok {
+		return nil
+	}
+	delete(aclPolicies, network)
+	if !fwRunning {
+		return nil
+	}
+	return fwCrtl.DeleteAclRules(network)
+}
@@ -0,0 +1,192 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/sys/unix"
+)
+
+// aclMatch - a source, protocol and port range of an acl rule, installed as one firewall rule
+type aclMatch struct {
+	source   net.IPNet
+	protocol string
+	ports    *PortRange
+	allow    bool
+}
+
+func (m aclMatch) isIpv4() bool {
+	return m.source.IP.To4() != nil
+}
+
+// expandAclRules - returns the matches of the rules in their order, one per source and port range
+func expandAclRules(rules []AclRule) []aclMatch {
+	matches := []aclMatch{}
+	for _, rule := range rules {
+		for _, source := range rule.Sources {
+			source := canonicalNet(source)
+			if len(rule.Ports) == 0 {
+				matches = append(matches, aclMatch{source: source, protocol: rule.Protocol, allow: rule.Allow})
+				continue
+			}
+			for i := range rule.Ports {
+				matches = append(matches, aclMatch{source: source, protocol: rule.Protocol, ports: &rule.Ports[i], allow: rule.Allow})
+			}
+		}
+	}
+	return matches
+}
+
+// canonicalNet - returns the network with its address masked, ipv4 networks in their 4 byte form
+func canonicalNet(ipnet net.IPNet) net.IPNet {
+	ones, bits := ipnet.Mask.Size()
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		if bits == 8*net.IPv6len {
+			ones -= 8 * (net.IPv6len - net.IPv4len)
+		}
+		mask := net.CIDRMask(ones, 8*net.IPv4len)
+		return net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+	mask := net.CIDRMask(ones, 8*net.IPv6len)
+	return net.IPNet{IP: ipnet.IP.To16().Mask(mask), Mask: mask}
+}
+
+// aclMatch.l4proto - returns the ip protocol number of the match, 0 for all protocols
+func (m aclMatch) l4proto() byte {
+	switch m.protocol {
+	case AclProtocolTCP:
+		return unix.IPPROTO_TCP
+	case AclProtocolUDP:
+		return unix.IPPROTO_UDP
+	case AclProtocolICMP:
+		if m.isIpv4() {
+			return unix.IPPROTO_ICMP
+		}
+		return unix.IPPROTO_ICMPV6
+	}
+	return 0
+}
+
+// aclMatch.spec - returns the iptables rule spec of the match in the order iptables lists it,
+// also the key of the nftables rule
+func (m aclMatch) spec() []string {
+	spec := []string{"-s", m.source.String(), "-i", ncutils.GetInterfaceName()}
+	switch m.protocol {
+	case AclProtocolTCP, AclProtocolUDP:
+		spec = append(spec, "-p", m.protocol, "-m", m.protocol)
+	case AclProtocolICMP:
+		if m.isIpv4() {
+			spec = append(spec, "-p", "icmp")
+		} else {
+			spec = append(spec, "-p", "ipv6-icmp")
+		}
+	}
+	if m.ports != nil {
+		if m.ports.From == m.ports.To {
+			spec = append(spec, "--dport", fmt.Sprint(m.ports.From))
+		} else {
+			spec = append(spec, "--dport", fmt.Sprintf("%d:%d", m.ports.From, m.ports.To))
+		}
+	}
+	if m.allow {
+		return append(spec, "-j", "RETURN")
+	}
+	return append(spec, "-j", "DROP")
+}
+
+// aclMatch.nfRule - returns the nftables rule of the match in the netmaker acl chain
+func (m aclMatch) nfRule() *nftables.Rule {
+	proto, offset, length, xor := byte(unix.NFPROTO_IPV4), uint32(ipv4SrcOffset), uint32(ipv4Len), zeroXor
+	if !m.isIpv4() {
+		proto, offset, length, xor = unix.NFPROTO_IPV6, ipv6SrcOffset, ipv6Len, zeroXor6
+	}
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte(ncutils.GetInterfaceName() + "\x00"),
+		},
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       offset,
+			Len:          length,
+		},
+		&expr.Bitwise{
+			DestRegister:   1,
+			SourceRegister: 1,
+			Len:            length,
+			Mask:           m.source.Mask,
+			Xor:            xor,
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: m.source.IP},
+	}
+	if l4proto := m.l4proto(); l4proto != 0 {
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{l4proto}},
+		)
+	}
+	if m.ports != nil {
+		// destination port of tcp and udp
+		exprs = append(exprs, &expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		})
+		if m.ports.From == m.ports.To {
+			exprs = append(exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(m.ports.From)})
+		} else {
+			exprs = append(exprs,
+				&expr.Cmp{Op: expr.CmpOpGte, Register: 1, Data: binaryutil.BigEndian.PutUint16(m.ports.From)},
+				&expr.Cmp{Op: expr.CmpOpLte, Register: 1, Data: binaryutil.BigEndian.PutUint16(m.ports.To)},
+			)
+		}
+	}
+	verdict := expr.VerdictDrop
+	if m.allow {
+		verdict = expr.VerdictReturn
+	}
+	exprs = append(exprs, &expr.Counter{}, &expr.Verdict{Kind: verdict})
+	return &nftables.Rule{
+		Table:    filterTable,
+		Chain:    &nftables.Chain{Name: netmakerAclChain, Table: filterTable},
+		Exprs:    exprs,
+		UserData: []byte(genRuleKey(m.spec()...)),
+	}
+}
+
+// collectAclRules - returns the acl rules of the networks for the ownership map, the rules of a network
+// are kept per family
+func collectAclRules(acls ruletable, family func(isIpv4 bool) string) []ownedRule {
+	owned := []ownedRule{}
+	for network, cfg := range acls {
+		for key, rules := range cfg.rulesMap {
+			isIpv4 := key == ipv4
+			for _, rule := range rules {
+				owned = append(owned, ownedRule{
+					OwnedRule: OwnedRule{
+						RuleTable: aclTable,
+						Owner:     network,
+						Family:    family(isIpv4),
+						Table:     rule.table,
+						Chain:     rule.chain,
+						Rule:      strings.Join(rule.rule, " "),
+					},
+					info:   rule,
+					isIpv4: isIpv4,
+				})
+			}
+		}
+	}
+	return owned
+}
@@ -0,0 +1,194 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/matryer/is"
+	"golang.org/x/sys/unix"
+)
+
+func mustNet(cidr string) net.IPNet {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return *ipnet
+}
+
+var aclTests = []struct {
+	name  string
+	rules []AclRule
+	// iptables rule specs in the acl chain, IFACE stands for the netmaker interface
+	specs []string
+	// nftables rules in the acl chain: family, transport protocol, destination port comparisons and verdict
+	nft []nftAclRule
+}{
+	{
+		name: "allow ssh from a peer",
+		rules: []AclRule{
+			{Sources: []net.IPNet{mustNet("10.10.0.2/32")}, Protocol: AclProtocolTCP, Ports: []PortRange{{From: 22, To: 22}}, Allow: true},
+		},
+		specs: []string{"-s 10.10.0.2/32 -i IFACE -p tcp -m tcp --dport 22 -j RETURN"},
+		nft: []nftAclRule{
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.0.2/32", l4proto: unix.IPPROTO_TCP, ports: []string{"eq 22"}, verdict: expr.VerdictReturn},
+		},
+	},
+	{
+		name: "port range and single port of a network",
+		rules: []AclRule{
+			{Sources: []net.IPNet{mustNet("10.10.0.0/16")}, Protocol: AclProtocolUDP,
+				Ports: []PortRange{{From: 8000, To: 8100}, {From: 53, To: 53}}, Allow: true},
+		},
+		specs: []string{
+			"-s 10.10.0.0/16 -i IFACE -p udp -m udp --dport 8000:8100 -j RETURN",
+			"-s 10.10.0.0/16 -i IFACE -p udp -m udp --dport 53 -j RETURN",
+		},
+		nft: []nftAclRule{
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.0.0/16", l4proto: unix.IPPROTO_UDP, ports: []string{"gte 8000", "lte 8100"}, verdict: expr.VerdictReturn},
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.0.0/16", l4proto: unix.IPPROTO_UDP, ports: []string{"eq 53"}, verdict: expr.VerdictReturn},
+		},
+	},
+	{
+		name: "icmp of both families",
+		rules: []AclRule{
+			{Sources: []net.IPNet{mustNet("10.10.0.0/16"), mustNet("fd00::/64")}, Protocol: AclProtocolICMP, Allow: true},
+		},
+		specs: []string{
+			"-s 10.10.0.0/16 -i IFACE -p icmp -j RETURN",
+			"-s fd00::/64 -i IFACE -p ipv6-icmp -j RETURN",
+		},
+		nft: []nftAclRule{
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.0.0/16", l4proto: unix.IPPROTO_ICMP, verdict: expr.VerdictReturn},
+			{nfproto: unix.NFPROTO_IPV6, source: "fd00::/64", l4proto: unix.IPPROTO_ICMPV6, verdict: expr.VerdictReturn},
+		},
+	},
+	{
+		name: "deny all protocols in rule order",
+		rules: []AclRule{
+			{Sources: []net.IPNet{mustNet("10.10.0.3/32")}, Allow: true},
+			{Sources: []net.IPNet{mustNet("10.10.0.0/16")}, Allow: false},
+		},
+		specs: []string{
+			"-s 10.10.0.3/32 -i IFACE -j RETURN",
+			"-s 10.10.0.0/16 -i IFACE -j DROP",
+		},
+		nft: []nftAclRule{
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.0.3/32", verdict: expr.VerdictReturn},
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.0.0/16", verdict: expr.VerdictDrop},
+		},
+	},
+	{
+		name: "host bits of a source are masked",
+		rules: []AclRule{
+			{Sources: []net.IPNet{{IP: net.ParseIP("10.10.3.7"), Mask: net.CIDRMask(24, 32)}}, Allow: false},
+		},
+		specs: []string{"-s 10.10.3.0/24 -i IFACE -j DROP"},
+		nft: []nftAclRule{
+			{nfproto: unix.NFPROTO_IPV4, source: "10.10.3.0/24", verdict: expr.VerdictDrop},
+		},
+	},
+	{
+		name:  "rule without sources matches nothing",
+		rules: []AclRule{{Protocol: AclProtocolTCP, Ports: []PortRange{{From: 22, To: 22}}, Allow: true}},
+		specs: []string{},
+		nft:   []nftAclRule{},
+	},
+}
+
+// aclSpecs - returns the specs with the name of the netmaker interface
+func aclSpecs(specs []string) []string {
+	named := []string{}
+	for _, spec := range specs {
+		named = append(named, strings.ReplaceAll(spec, "IFACE", ncutils.GetInterfaceName()))
+	}
+	return named
+}
+
+func TestIptablesAclRules(t *testing.T) {
+	for _, tt := range aclTests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			specs := []string{}
+			for _, match := range expandAclRules(tt.rules) {
+				spec := match.spec()
+				// the spec is in the form iptables lists it, drift detection compares them as they are
+				is.Equal(normalizeSpec(spec), []string{strings.Join(spec, " ")})
+				specs = append(specs, strings.Join(spec, " "))
+			}
+			is.Equal(specs, aclSpecs(tt.specs))
+		})
+	}
+}
+
+// nftAclRule - the parts of an nftables acl rule the tests compare
+type nftAclRule struct {
+	nfproto byte
+	source  string
+	l4proto byte
+	ports   []string
+	verdict expr.VerdictKind
+}
+
+func TestNftablesAclRules(t *testing.T) {
+	for _, tt := range aclTests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			rules := []nftAclRule{}
+			specs := aclSpecs(tt.specs)
+			for i, match := range expandAclRules(tt.rules) {
+				r := match.nfRule()
+				is.Equal(r.Table, filterTable)
+				is.Equal(r.Chain.Name, netmakerAclChain)
+				// the user data keys the rule by its iptables spec
+				is.Equal(string(r.UserData), genRuleKey(strings.Fields(specs[i])...))
+				rules = append(rules, summarizeNftAclRule(t, r))
+			}
+			is.Equal(rules, tt.nft)
+		})
+	}
+}
+
+// summarizeNftAclRule - returns the parts of the rule the tests compare, it fails the test if the expressions
+// are not in the order of the acl rules
+func summarizeNftAclRule(t *testing.T, r *nftables.Rule) nftAclRule {
+	is := is.New(t)
+	var rule nftAclRule
+	exprs := r.Exprs
+	is.True(len(exprs) >= 9)
+	is.Equal(exprs[0], &expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1})
+	is.Equal(exprs[1].(*expr.Cmp).Data, []byte(ncutils.GetInterfaceName()+"\x00"))
+	is.Equal(exprs[2], &expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1})
+	rule.nfproto = exprs[3].(*expr.Cmp).Data[0]
+	source := net.IPNet{IP: exprs[6].(*expr.Cmp).Data, Mask: exprs[5].(*expr.Bitwise).Mask}
+	rule.source = source.String()
+	exprs = exprs[7:]
+	if meta, ok := exprs[0].(*expr.Meta); ok && meta.Key == expr.MetaKeyL4PROTO {
+		rule.l4proto = exprs[1].(*expr.Cmp).Data[0]
+		exprs = exprs[2:]
+	}
+	if payload, ok := exprs[0].(*expr.Payload); ok {
+		is.Equal(payload.Base, expr.PayloadBaseTransportHeader)
+		is.Equal(payload.Offset, uint32(2))
+		exprs = exprs[1:]
+		for {
+			cmp, ok := exprs[0].(*expr.Cmp)
+			if !ok {
+				break
+			}
+			op := map[expr.CmpOp]string{expr.CmpOpEq: "eq", expr.CmpOpGte: "gte", expr.CmpOpLte: "lte"}[cmp.Op]
+			rule.ports = append(rule.ports, fmt.Sprint(op, " ", binaryutil.BigEndian.Uint16(cmp.Data)))
+			exprs = exprs[1:]
+		}
+	}
+	is.Equal(len(exprs), 2)
+	is.Equal(exprs[0], &expr.Counter{})
+	rule.verdict = exprs[1].(*expr.Verdict).Kind
+	return rule
+}
@@ -1,6 +1,10 @@
 package router
 
 import (
+	"context"
+	"errors"
+	"sync"
+
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 )
@@ -8,6 +12,11 @@ import (
 var (
 	fwCrtl              firewallController
 	currEgressRangesMap = make(map[string][]string)
+
+	fwMutex     sync.Mutex // guards the start and stop of the firewall controller
+	fwRunning   bool
+	fwStop      func()
+	aclPolicies = make(map[string][]AclRule) // acl rules of the networks, installed again on every start
 )
 
 type rulesCfg struct {
@@ -29,8 +38,67 @@ type serverrulestable map[string]ruletable
 const (
 	ingressTable = "ingress"
 	egressTable  = "egress"
+	// jumpTable - rule table of the jump rules into the netmaker chains in the ownership map
+	jumpTable = "jump"
+	// aclTable - rule table of the acl rules of the networks in the ownership map
+	aclTable = "acl"
+)
+
+// kinds of drift between the rules of the controller and the kernel
+const (
+	// DriftMissing - installed by the controller, not found in the kernel
+	DriftMissing = "missing"
+	// DriftUnexpected - found in a netmaker chain, not installed by the controller
+	DriftUnexpected = "unexpected"
 )
 
+// ErrFirewallNotInitialised - the firewall controller is started once the host is an ingress or egress gateway
+// or a network has acl rules
+var ErrFirewallNotInitialised = errors.New("firewall is not initialised")
+
+// Ruleset - the netmaker chains in the kernel, the rules the firewall controller installed and the drift between them
+type Ruleset struct {
+	Backend string         `json:"backend"`
+	Chains  []ChainDump    `json:"chains"`
+	Rules   []OwnedRule    `json:"rules"`
+	Drift   []RuleDrift    `json:"drift"`
+	Repairs RepairCounters `json:"repairs"`
+	Nft     string         `json:"nft,omitempty"` // the chains in nft syntax, if requested
+}
+
+// ChainDump - rules of a chain as found in the kernel, only the netmaker rules of the builtin chains
+type ChainDump struct {
+	Family string   `json:"family"` // ipv4, ipv6 or inet
+	Table  string   `json:"table"`
+	Chain  string   `json:"chain"`
+	Rules  []string `json:"rules"`
+}
+
+// OwnedRule - a rule of the ownership map of the controller
+type OwnedRule struct {
+	Server    string `json:"server,omitempty"` // empty for jump and acl rules
+	RuleTable string `json:"rule_table"`       // ingress, egress, acl or jump
+	Owner     string `json:"owner,omitempty"`  // ext client key on ingress, egress gateway id on egress, network on acl
+	Peer      string `json:"peer,omitempty"`   // peer the rule allows traffic for, the owner for its own rules
+	Family    string `json:"family"`
+	Table     string `json:"table"`
+	Chain     string `json:"chain"`
+	Rule      string `json:"rule"`
+	Installed bool   `json:"installed"`
+}
+
+// RuleDrift - a difference between the ownership map and the kernel
+type RuleDrift struct {
+	Kind   string `json:"kind"` // missing or unexpected
+	Server string `json:"server,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	Peer   string `json:"peer,omitempty"`
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Chain  string `json:"chain"`
+	Rule   string `json:"rule"` // empty if the whole chain is missing
+}
+
 type firewallController interface {
 	// CreateChains  creates a firewall chains and jump rules
 	CreateChains() error
@@ -60,20 +128,121 @@ type firewallController interface {
 	SaveRules(server, ruleTableName string, ruleTable ruletable)
 	// FlushAll - clears all rules from netmaker chains and deletes the chains
 	FlushAll()
+	// Inspect - returns the netmaker chains, the ownership map of the rules and their drift against the kernel
+	Inspect() (Ruleset, error)
+	// Repair - reinstalls the netmaker chains, jump rules and rules of the ownership map missing in the kernel
+	Repair() (repairs, error)
+	// SetAclRules - replaces the acl rules of a network in the netmaker acl chain
+	SetAclRules(network string, rules []AclRule) error
+	// DeleteAclRules - removes the acl rules of a network from the netmaker acl chain
+	DeleteAclRules(network string) error
 }
 
-// Init - initialises the firewall controller,return a close func to flush all rules
+// Init - initialises the firewall controller if it is not running, return a close func to flush all rules;
+// the acl rules of the networks are installed with the chains
 func Init() (func(), error) {
+	fwMutex.Lock()
+	defer fwMutex.Unlock()
+	if fwRunning {
+		return Close, nil
+	}
+	if err := start(); err != nil {
+		if fwCrtl != nil {
+			return fwCrtl.FlushAll, err
+		}
+		return nil, err
+	}
+	return Close, nil
+}
+
+// start - creates the firewall controller with its chains and the acl rules and starts the drift watcher,
+// the caller holds fwMutex
+func start() error {
 	var err error
 	logger.Log(0, "Starting firewall...")
 	fwCrtl, err = newFirewall()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if err := fwCrtl.CreateChains(); err != nil {
-		return fwCrtl.FlushAll, err
+		return err
+	}
+	for network, rules := range aclPolicies {
+		if err := fwCrtl.SetAclRules(network, rules); err != nil {
+			logger.Log(0, "failed to set acl rules of network ", network, err.Error())
+		}
+	}
+	controller := fwCrtl
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watchDrift(ctx, controller)
+	}()
+	fwStop = func() {
+		cancel()
+		wg.Wait()
+	}
+	fwRunning = true
+	return nil
+}
+
+// stop - stops the drift watcher and flushes all rules of the firewall controller, the caller holds fwMutex
+func stop() {
+	// stop the watcher first, it would reinstall the flushed rules
+	fwStop()
+	fwCrtl.FlushAll()
+	fwRunning = false
+}
+
+// Close - flushes the gateway rules of the firewall controller, it is stopped unless a network has an
+// acl policy, in which case it starts over with the acl rules only
+func Close() {
+	fwMutex.Lock()
+	defer fwMutex.Unlock()
+	if !fwRunning {
+		return
+	}
+	stop()
+	if len(aclPolicies) == 0 {
+		return
+	}
+	if err := start(); err != nil {
+		logger.Log(0, "failed to restart firewall for acl policies: ", err.Error())
+	}
+}
+
+// Stop - stops the firewall controller and flushes all its rules, the acl policies included
+func Stop() {
+	fwMutex.Lock()
+	defer fwMutex.Unlock()
+	aclPolicies = make(map[string][]AclRule)
+	if !fwRunning {
+		return
+	}
+	stop()
+}
+
+// Backend - returns the name of the firewall backend in use, empty if the firewall is not initialised
+func Backend() string {
+	if fwCrtl == nil {
+		return ""
+	}
+	return backendName(fwCrtl)
+}
+
+// Inspect - returns the netmaker chains, the rules installed by the firewall controller and the drift between them
+func Inspect() (Ruleset, error) {
+	fwMutex.Lock()
+	running := fwRunning
+	fwMutex.Unlock()
+	if !running {
+		return Ruleset{}, ErrFirewallNotInitialised
 	}
-	return fwCrtl.FlushAll, nil
+	ruleset, err := fwCrtl.Inspect()
+	ruleset.Repairs = GetRepairCounters()
+	return ruleset, err
 }
 
 // EnableForwardRule - enable firewall to forward netmaker traffic
@@ -25,6 +25,7 @@ func newFirewall() (firewallController, error) {
 			ipv6Client:   ipv6Client,
 			ingRules:     make(serverrulestable),
 			engressRules: make(serverrulestable),
+			aclRules:     make(ruletable),
 		}
 		return manager, nil
 	}
@@ -35,6 +36,7 @@ func newFirewall() (firewallController, error) {
 			conn:         &nftables.Conn{},
 			ingRules:     make(serverrulestable),
 			engressRules: make(serverrulestable),
+			aclRules:     make(ruletable),
 		}
 		return manager, nil
 	}
@@ -42,6 +44,18 @@ func newFirewall() (firewallController, error) {
 	return manager, errors.New("firewall support not found")
 }
 
+// backendName - returns the name of the firewall backend of the controller
+func backendName(controller firewallController) string {
+	switch controller.(type) {
+	case *iptablesManager:
+		return "iptables"
+	case *nftablesManager:
+		return "nftables"
+	default:
+		return "unknown"
+	}
+}
+
 func isIptablesSupported() bool {
 	_, err4 := exec.LookPath("iptables")
 	_, err6 := exec.LookPath("ip6tables")
@@ -4,6 +4,8 @@
 package router
 
 import (
+	"errors"
+
 	"github.com/gravitl/netmaker/models"
 )
 
@@ -57,6 +59,32 @@ func (unimplementedFirewall) DeleteRuleTable(server, ruleTableName string) {
 
 }
 
+func (unimplementedFirewall) Inspect() (Ruleset, error) {
+	return Ruleset{Backend: "unsupported", Chains: []ChainDump{}, Rules: []OwnedRule{}, Drift: []RuleDrift{}}, nil
+}
+
+func (unimplementedFirewall) Repair() (repairs, error) {
+	return repairs{}, nil
+}
+
+func (unimplementedFirewall) SetAclRules(network string, rules []AclRule) error {
+	return nil
+}
+
+func (unimplementedFirewall) DeleteAclRules(network string) error {
+	return nil
+}
+
+// NftText - returns the netmaker chains in nft syntax, not supported on this platform
+func NftText(ruleset Ruleset) (string, error) {
+	return "", errors.New("nft output is only supported on linux")
+}
+
+// backendName - returns the name of the firewall backend of the controller
+func backendName(controller firewallController) string {
+	return "unsupported"
+}
+
 // newFirewall returns an unimplemented Firewall manager
 func newFirewall() (firewallController, error) {
 	return unimplementedFirewall{}, nil
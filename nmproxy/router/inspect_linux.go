@@ -0,0 +1,256 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// inspectedChain - a chain dumped by Inspect, all rules of the netmaker chains are dumped,
+// only the rules netmaker added of the builtin chains
+type inspectedChain struct {
+	table    string
+	chain    string
+	netmaker bool
+}
+
+var inspectedChains = []inspectedChain{
+	{table: defaultIpTable, chain: iptableFWDChain},
+	{table: defaultIpTable, chain: netmakerFilterChain, netmaker: true},
+	{table: defaultNatTable, chain: nattablePRTChain},
+	{table: defaultNatTable, chain: netmakerNatChain, netmaker: true},
+	{table: defaultIpTable, chain: iptableINPUTChain},
+	{table: defaultIpTable, chain: netmakerAclChain, netmaker: true},
+}
+
+// ownedRule - a rule of the ownership map together with the rule the controller installed
+type ownedRule struct {
+	OwnedRule
+	info   ruleInfo
+	isIpv4 bool
+}
+
+func newRuleset(backend string) Ruleset {
+	return Ruleset{
+		Backend: backend,
+		Chains:  []ChainDump{},
+		Rules:   []OwnedRule{},
+		Drift:   []RuleDrift{},
+	}
+}
+
+// collectRules - returns the rules of the ingress and egress tables of all servers,
+// family names the family of a rules config
+func collectRules(ingress, egress serverrulestable, family func(isIpv4 bool) string) []ownedRule {
+	owned := []ownedRule{}
+	for ruleTableName, tables := range map[string]serverrulestable{ingressTable: ingress, egressTable: egress} {
+		for server, ruleTable := range tables {
+			for owner, cfg := range ruleTable {
+				for peer, rules := range cfg.rulesMap {
+					for _, rule := range rules {
+						owned = append(owned, ownedRule{
+							OwnedRule: OwnedRule{
+								Server:    server,
+								RuleTable: ruleTableName,
+								Owner:     owner,
+								Peer:      peer,
+								Family:    family(cfg.isIpv4),
+								Table:     rule.table,
+								Chain:     rule.chain,
+								Rule:      strings.Join(rule.rule, " "),
+							},
+							info:   rule,
+							isIpv4: cfg.isIpv4,
+						})
+					}
+				}
+			}
+		}
+	}
+	return owned
+}
+
+// chainID - identifies a chain of a family in the maps of Inspect
+func chainID(family, table, chain string) string {
+	return family + "/" + table + "/" + chain
+}
+
+// missingDrift - returns the drift of an owned rule not found in the kernel
+func missingDrift(rule ownedRule) RuleDrift {
+	return RuleDrift{
+		Kind:   DriftMissing,
+		Server: rule.Server,
+		Owner:  rule.Owner,
+		Peer:   rule.Peer,
+		Family: rule.Family,
+		Table:  rule.Table,
+		Chain:  rule.Chain,
+		Rule:   rule.Rule,
+	}
+}
+
+// finish - sets the owned rules of the ruleset and sorts its entries
+func (r *Ruleset) finish(owned []ownedRule) {
+	for _, rule := range owned {
+		r.Rules = append(r.Rules, rule.OwnedRule)
+	}
+	sort.SliceStable(r.Rules, func(i, j int) bool {
+		a, b := r.Rules[i], r.Rules[j]
+		for _, pair := range [][2]string{{a.Server, b.Server}, {a.RuleTable, b.RuleTable}, {a.Owner, b.Owner},
+			{a.Peer, b.Peer}, {a.Family, b.Family}, {a.Table, b.Table}, {a.Chain, b.Chain}, {a.Rule, b.Rule}} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return false
+	})
+	sort.SliceStable(r.Drift, func(i, j int) bool {
+		a, b := r.Drift[i], r.Drift[j]
+		for _, pair := range [][2]string{{a.Kind, b.Kind}, {a.Server, b.Server}, {a.Family, b.Family},
+			{a.Table, b.Table}, {a.Chain, b.Chain}, {a.Rule, b.Rule}} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return false
+	})
+}
+
+// normalizeSpec - returns the forms iptables lists a rule spec in, see expandSpec and canonicalOrder
+func normalizeSpec(spec []string) []string {
+	normalized := []string{}
+	for _, variant := range expandSpec(spec) {
+		normalized = append(normalized, strings.Join(canonicalOrder(variant), " "))
+	}
+	return normalized
+}
+
+// canonicalOrder - returns the spec with its options in the order iptables lists them: addresses,
+// interfaces and protocol first, the target last and the other options in their order
+func canonicalOrder(spec []string) []string {
+	groups := [][]string{}
+	negated := false
+	for _, token := range spec {
+		switch {
+		case token == "!":
+			groups = append(groups, []string{token})
+			negated = true
+		case strings.HasPrefix(token, "-") && negated:
+			groups[len(groups)-1] = append(groups[len(groups)-1], token)
+			negated = false
+		case strings.HasPrefix(token, "-") || len(groups) == 0:
+			groups = append(groups, []string{token})
+		default:
+			groups[len(groups)-1] = append(groups[len(groups)-1], token)
+		}
+	}
+	rank := func(group []string) int {
+		option := group[0]
+		if option == "!" && len(group) > 1 {
+			option = group[1]
+		}
+		switch option {
+		case "-s":
+			return 0
+		case "-d":
+			return 1
+		case "-i":
+			return 2
+		case "-o":
+			return 3
+		case "-p":
+			return 4
+		case "-j":
+			return 6
+		}
+		return 5
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return rank(groups[i]) < rank(groups[j]) })
+	ordered := make([]string, 0, len(spec))
+	for _, group := range groups {
+		ordered = append(ordered, group...)
+	}
+	return ordered
+}
+
+// expandSpec - returns the rules iptables installs for a rule spec: addresses with prefix length,
+// networks in canonical form and one rule per address of a comma separated list
+func expandSpec(spec []string) [][]string {
+	variants := [][]string{{}}
+	for idx := 0; idx < len(spec); idx++ {
+		token := spec[idx]
+		if (token != "-s" && token != "-d") || idx+1 == len(spec) {
+			for v := range variants {
+				variants[v] = append(variants[v], token)
+			}
+			continue
+		}
+		idx++
+		expanded := [][]string{}
+		for _, addr := range strings.Split(spec[idx], ",") {
+			for _, variant := range variants {
+				expanded = append(expanded, append(append([]string{}, variant...), token, normalizeAddr(addr)))
+			}
+		}
+		variants = expanded
+	}
+	return variants
+}
+
+// normalizeAddr - returns an address or network in the form iptables lists it
+func normalizeAddr(addr string) string {
+	if !strings.Contains(addr, "/") {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return addr
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32"
+		}
+		return ip.String() + "/128"
+	}
+	_, cidr, err := net.ParseCIDR(addr)
+	if err != nil {
+		return addr
+	}
+	return cidr.String()
+}
+
+// NftText - returns the netmaker chains of the firewall controller in nft syntax, iptables rules are
+// translated with iptables-translate
+func NftText(ruleset Ruleset) (string, error) {
+	var text strings.Builder
+	if ruleset.Backend == backendName(&nftablesManager{}) {
+		for _, chain := range inspectedChains {
+			out, err := exec.Command("nft", "list", "chain", "inet", chain.table, chain.chain).CombinedOutput()
+			if err != nil {
+				fmt.Fprintf(&text, "# inet %s %s: %s\n", chain.table, chain.chain, strings.TrimSpace(string(out)))
+				continue
+			}
+			text.Write(out)
+		}
+		return text.String(), nil
+	}
+	for _, chain := range ruleset.Chains {
+		translate := "iptables-translate"
+		if chain.Family == ipv6 {
+			translate = "ip6tables-translate"
+		}
+		if _, err := exec.LookPath(translate); err != nil {
+			return "", fmt.Errorf("%s is required for nft output: %w", translate, err)
+		}
+		fmt.Fprintf(&text, "# %s %s %s\n", chain.Family, chain.Table, chain.Chain)
+		for _, rule := range chain.Rules {
+			args := append([]string{"-t", chain.Table}, strings.Fields(rule)...)
+			out, err := exec.Command(translate, args...).CombinedOutput()
+			if err != nil {
+				fmt.Fprintf(&text, "# untranslated: %s\n", rule)
+				continue
+			}
+			text.Write(out)
+		}
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestNormalizeSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec []string
+		want []string
+	}{
+		{
+			name: "address gets prefix length",
+			spec: []string{"-s", "10.0.0.5", "-d", "fd00::1", "-j", "ACCEPT"},
+			want: []string{"-s 10.0.0.5/32 -d fd00::1/128 -j ACCEPT"},
+		},
+		{
+			name: "network in canonical form",
+			spec: []string{"-s", "10.0.0.5/32", "-d", "192.168.1.7/24", "-j", "ACCEPT"},
+			want: []string{"-s 10.0.0.5/32 -d 192.168.1.0/24 -j ACCEPT"},
+		},
+		{
+			name: "comma separated ranges",
+			spec: []string{"-s", "10.0.0.5/32", "-d", "10.1.0.0/16,10.2.0.0/16", "-j", "ACCEPT"},
+			want: []string{"-s 10.0.0.5/32 -d 10.1.0.0/16 -j ACCEPT", "-s 10.0.0.5/32 -d 10.2.0.0/16 -j ACCEPT"},
+		},
+		{
+			name: "negation and comment",
+			spec: []string{"-s", "10.0.0.5/32", "!", "-d", "10.0.0.1/32", "-j", "netmakerfilter", "-m", "comment", "--comment", "NETMAKER"},
+			want: []string{"-s 10.0.0.5/32 ! -d 10.0.0.1/32 -m comment --comment NETMAKER -j netmakerfilter"},
+		},
+		{
+			name: "options in listing order",
+			spec: []string{"-i", "netmaker", "-d", "10.1.0.0/16", "-j", "netmakerfilter", "-m", "comment", "--comment", "NETMAKER"},
+			want: []string{"-d 10.1.0.0/16 -i netmaker -m comment --comment NETMAKER -j netmakerfilter"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(normalizeSpec(tt.spec), tt.want)
+		})
+	}
+}
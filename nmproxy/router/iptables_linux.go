@@ -23,6 +23,8 @@ const (
 	netmakerNatChain    = "netmakernat"
 	iptableFWDChain     = "FORWARD"
 	nattablePRTChain    = "POSTROUTING"
+	iptableINPUTChain   = "INPUT"
+	netmakerAclChain    = "netmakeracl"
 	netmakerSignature   = "NETMAKER"
 )
 
@@ -31,11 +33,16 @@ type iptablesManager struct {
 	ipv6Client   *iptables.IPTables
 	ingRules     serverrulestable
 	engressRules serverrulestable
+	aclRules     ruletable
+	forwarding   bool // the forwarding rule was added by ForwardRule
 	mux          sync.Mutex
 }
 
 var (
-
+	// forwarding rule of the FORWARD chain, added by ForwardRule
+	forwardRuleSpec = []string{"-i", "netmaker", "-j", netmakerFilterChain}
+	// the forwarding rule as a jump rule of the ipv4 filter table, owned once ForwardRule added it
+	forwardJumpRule = ruleInfo{rule: forwardRuleSpec, table: defaultIpTable, chain: iptableFWDChain}
 	// filter table netmaker jump rules
 	filterNmJumpRules = []ruleInfo{
 		{
@@ -63,8 +70,30 @@ var (
 			chain: netmakerNatChain,
 		},
 	}
+	// acl jump rules, inserted at the top of their chains: traffic of the netmaker interface to the host
+	// passes the acl chain before other input rules, replies to connections of the host return to them unchecked
+	aclNmJumpRules = []ruleInfo{
+		{
+			rule: []string{"-i", ncutils.GetInterfaceName(), "-j", netmakerAclChain,
+				"-m", "comment", "--comment", netmakerSignature},
+			table: defaultIpTable,
+			chain: iptableINPUTChain,
+		},
+		{
+			rule:  []string{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"},
+			table: defaultIpTable,
+			chain: netmakerAclChain,
+		},
+	}
 )
 
+// iptablesJumpRules - returns the jump rules of all netmaker chains
+func iptablesJumpRules() []ruleInfo {
+	rules := append([]ruleInfo{}, filterNmJumpRules...)
+	rules = append(rules, natNmJumpRules...)
+	return append(rules, aclNmJumpRules...)
+}
+
 func createChain(iptables *iptables.IPTables, table, newChain string) error {
 
 	chains, err := iptables.ListChains(table)
@@ -96,7 +125,7 @@ func (i *iptablesManager) ForwardRule() error {
 	logger.Log(0, "adding forwarding rule")
 	iptablesClient := i.ipv4Client
 	createChain(iptablesClient, defaultIpTable, netmakerFilterChain)
-	ruleSpec := []string{"-i", "netmaker", "-j", netmakerFilterChain}
+	ruleSpec := forwardRuleSpec
 	ok, err := iptablesClient.Exists(defaultIpTable, iptableFWDChain, ruleSpec...)
 	if err != nil {
 		return err
@@ -107,6 +136,7 @@ func (i *iptablesManager) ForwardRule() error {
 			return err
 		}
 	}
+	i.forwarding = true
 	return nil
 }
 
@@ -141,6 +171,7 @@ func (i *iptablesManager) CreateChains() error {
 	i.removeJumpRules()
 	i.cleanup(defaultIpTable, netmakerFilterChain)
 	i.cleanup(defaultNatTable, netmakerNatChain)
+	i.cleanup(defaultIpTable, netmakerAclChain)
 
 	//errMSGFormat := "iptables: failed creating %s chain %s,error: %v"
 
@@ -165,6 +196,12 @@ func (i *iptablesManager) CreateChains() error {
 		logger.Log(1, "failed to create netmaker chain: ", err.Error())
 		return err
 	}
+	for _, client := range []*iptables.IPTables{i.ipv4Client, i.ipv6Client} {
+		if err := createChain(client, defaultIpTable, netmakerAclChain); err != nil {
+			logger.Log(1, "failed to create netmaker chain: ", err.Error())
+			return err
+		}
+	}
 	// add jump rules
 	i.addJumpRules()
 	return nil
@@ -191,6 +228,13 @@ func (i *iptablesManager) addJumpRules() {
 			logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
 		}
 	}
+	for _, rule := range aclNmJumpRules {
+		for _, client := range []*iptables.IPTables{i.ipv4Client, i.ipv6Client} {
+			if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+				logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
+			}
+		}
+	}
 }
 
 // checks if rule has been added by netmaker
@@ -250,7 +294,19 @@ func (i *iptablesManager) removeJumpRules() {
 			}
 		}
 	}
-
+	for _, client := range []*iptables.IPTables{i.ipv4Client, i.ipv6Client} {
+		rules, err := client.List(defaultIpTable, iptableINPUTChain)
+		if err != nil {
+			continue
+		}
+		for _, rule := range rules {
+			if addedByNetmaker(rule) {
+				if err := client.Delete(defaultIpTable, iptableINPUTChain, strings.Fields(rule)[2:]...); err != nil {
+					logger.Log(1, "failed to delete rule: ", rule, err.Error())
+				}
+			}
+		}
+	}
 }
 
 // iptablesManager.AddIngressRoutingRule - adds a ingress route for a peer
@@ -759,6 +815,8 @@ func (i *iptablesManager) FlushAll() {
 	i.removeJumpRules()
 	i.cleanup(defaultIpTable, netmakerFilterChain)
 	i.cleanup(defaultNatTable, netmakerNatChain)
+	i.cleanup(defaultIpTable, netmakerAclChain)
+	i.forwarding = false
 }
 
 func iptablesProtoToString(proto iptables.Protocol) string {
@@ -772,3 +830,276 @@ func appendNetmakerCommentToRule(ruleSpec []string) []string {
 	ruleSpec = append(ruleSpec, "-m", "comment", "--comment", netmakerSignature)
 	return ruleSpec
 }
+
+// iptablesManager.Inspect - returns the netmaker chains of both families, the rules installed by the manager
+// and the drift between them and the kernel
+func (i *iptablesManager) Inspect() (Ruleset, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	ruleset := newRuleset(backendName(i))
+	owned := collectRules(i.ingRules, i.engressRules, iptablesFamily)
+	owned = append(owned, collectAclRules(i.aclRules, iptablesFamily)...)
+	for _, rule := range iptablesJumpRules() {
+		for _, isIpv4 := range []bool{true, false} {
+			owned = append(owned, ownedRule{
+				OwnedRule: OwnedRule{
+					RuleTable: jumpTable,
+					Family:    iptablesFamily(isIpv4),
+					Table:     rule.table,
+					Chain:     rule.chain,
+					Rule:      strings.Join(rule.rule, " "),
+				},
+				info:   rule,
+				isIpv4: isIpv4,
+			})
+		}
+	}
+	expected := map[string]bool{
+		// not owned until ForwardRule added it, the forwarding rule is only added when ip forwarding is set up
+		chainID(ipv4, defaultIpTable, iptableFWDChain) + " " + normalizeSpec(forwardRuleSpec)[0]: true,
+	}
+	if i.forwarding {
+		owned = append(owned, ownedRule{
+			OwnedRule: OwnedRule{
+				RuleTable: jumpTable,
+				Family:    ipv4,
+				Table:     forwardJumpRule.table,
+				Chain:     forwardJumpRule.chain,
+				Rule:      strings.Join(forwardJumpRule.rule, " "),
+			},
+			info:   forwardJumpRule,
+			isIpv4: true,
+		})
+	}
+	for idx := range owned {
+		rule := &owned[idx]
+		// a missing chain is reported as an error, the rule is not installed either way
+		rule.Installed, _ = i.client(rule.isIpv4).Exists(rule.Table, rule.Chain, rule.info.rule...)
+		if !rule.Installed {
+			ruleset.Drift = append(ruleset.Drift, missingDrift(*rule))
+		}
+		for _, spec := range normalizeSpec(rule.info.rule) {
+			expected[chainID(rule.Family, rule.Table, rule.Chain)+" "+spec] = true
+		}
+	}
+	for _, isIpv4 := range []bool{true, false} {
+		family := iptablesFamily(isIpv4)
+		for _, chain := range inspectedChains {
+			lines, err := i.client(isIpv4).List(chain.table, chain.chain)
+			if err != nil {
+				if chain.netmaker {
+					ruleset.Drift = append(ruleset.Drift, RuleDrift{Kind: DriftMissing, Family: family, Table: chain.table, Chain: chain.chain})
+				}
+				continue
+			}
+			dump := ChainDump{Family: family, Table: chain.table, Chain: chain.chain, Rules: []string{}}
+			prefix := "-A " + chain.chain + " "
+			for _, line := range lines {
+				if !strings.HasPrefix(line, prefix) {
+					// chain definitions and policies
+					continue
+				}
+				spec := strings.TrimPrefix(line, prefix)
+				if !chain.netmaker && !addedByNetmaker(line) && !strings.Contains(line, "-j "+netmakerFilterChain) &&
+					!strings.Contains(line, "-j "+netmakerNatChain) && !strings.Contains(line, "-j "+netmakerAclChain) {
+					continue
+				}
+				dump.Rules = append(dump.Rules, line)
+				if !expected[chainID(family, chain.table, chain.chain)+" "+normalizeSpec(strings.Fields(spec))[0]] {
+					ruleset.Drift = append(ruleset.Drift, RuleDrift{Kind: DriftUnexpected, Family: family, Table: chain.table, Chain: chain.chain, Rule: spec})
+				}
+			}
+			ruleset.Chains = append(ruleset.Chains, dump)
+		}
+	}
+	ruleset.finish(owned)
+	return ruleset, nil
+}
+
+// iptablesManager.Repair - recreates the netmaker chains and reinstalls the jump rules and the rules of the
+// ownership map missing in the kernel, rules with several addresses are checked per address
+func (i *iptablesManager) Repair() (repairs, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	var fixed repairs
+	for _, isIpv4 := range []bool{true, false} {
+		client := i.client(isIpv4)
+		for _, chain := range inspectedChains {
+			if !chain.netmaker {
+				continue
+			}
+			exists, err := client.ChainExists(chain.table, chain.chain)
+			if err != nil {
+				return fixed, err
+			}
+			if exists {
+				continue
+			}
+			if err := createChain(client, chain.table, chain.chain); err != nil {
+				return fixed, err
+			}
+			fixed.chains++
+		}
+		jumpRules := iptablesJumpRules()
+		if isIpv4 && i.forwarding {
+			jumpRules = append(jumpRules, forwardJumpRule)
+		}
+		for idx, rule := range jumpRules {
+			ok, err := client.Exists(rule.table, rule.chain, rule.rule...)
+			if err != nil {
+				return fixed, err
+			}
+			if ok {
+				continue
+			}
+			position := 1
+			if rule.chain != iptableINPUTChain && rule.chain != netmakerAclChain && rule.chain != iptableFWDChain {
+				if position, err = jumpRulePosition(client, jumpRules, idx); err != nil {
+					return fixed, err
+				}
+			}
+			if position > 0 {
+				err = client.Insert(rule.table, rule.chain, position, rule.rule...)
+			} else {
+				err = client.Append(rule.table, rule.chain, rule.rule...)
+			}
+			if err != nil {
+				return fixed, err
+			}
+			fixed.jumpRules++
+		}
+	}
+	for _, rule := range collectRules(i.ingRules, i.engressRules, iptablesFamily) {
+		client := i.client(rule.isIpv4)
+		for _, spec := range expandSpec(rule.info.rule) {
+			ok, err := client.Exists(rule.Table, rule.Chain, spec...)
+			if err != nil {
+				return fixed, err
+			}
+			if ok {
+				continue
+			}
+			if err := client.Insert(rule.Table, rule.Chain, 1, spec...); err != nil {
+				return fixed, err
+			}
+			fixed.peerRules++
+		}
+	}
+	// the rules of a network are matched in order, they are installed again as a whole
+	for network, cfg := range i.aclRules {
+		missing := 0
+		for key, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				if ok, err := i.client(key == ipv4).Exists(rule.table, rule.chain, rule.rule...); err != nil || !ok {
+					missing++
+				}
+			}
+		}
+		if missing == 0 {
+			continue
+		}
+		i.removeAclRules(network)
+		if err := i.installAclRules(network, cfg); err != nil {
+			return fixed, err
+		}
+		fixed.peerRules += missing
+	}
+	return fixed, nil
+}
+
+// jumpRulePosition - returns the position a missing jump rule is inserted at to get back its place in the
+// chain: before the first installed jump rule following it in the chain, 0 to append it
+func jumpRulePosition(client *iptables.IPTables, jumpRules []ruleInfo, idx int) (int, error) {
+	rule := jumpRules[idx]
+	lines, err := client.List(rule.table, rule.chain)
+	if err != nil {
+		return 0, err
+	}
+	specs := []string{}
+	prefix := "-A " + rule.chain + " "
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			specs = append(specs, normalizeSpec(strings.Fields(strings.TrimPrefix(line, prefix)))[0])
+		}
+	}
+	for _, next := range jumpRules[idx+1:] {
+		if next.table != rule.table || next.chain != rule.chain {
+			continue
+		}
+		want := normalizeSpec(next.rule)[0]
+		for position, spec := range specs {
+			if spec == want {
+				return position + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// iptablesManager.SetAclRules - replaces the acl rules of a network, rules are appended to the acl chain
+// in their order
+func (i *iptablesManager) SetAclRules(network string, rules []AclRule) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.removeAclRules(network)
+	cfg := rulesCfg{rulesMap: make(map[string][]ruleInfo)}
+	for _, match := range expandAclRules(rules) {
+		family := iptablesFamily(match.isIpv4())
+		cfg.rulesMap[family] = append(cfg.rulesMap[family], ruleInfo{
+			rule:  match.spec(),
+			table: defaultIpTable,
+			chain: netmakerAclChain,
+		})
+	}
+	i.aclRules[network] = cfg
+	return i.installAclRules(network, cfg)
+}
+
+// iptablesManager.DeleteAclRules - removes the acl rules of a network
+func (i *iptablesManager) DeleteAclRules(network string) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.removeAclRules(network)
+	delete(i.aclRules, network)
+	return nil
+}
+
+// iptablesManager.installAclRules - appends the acl rules of a network, the caller holds the lock
+func (i *iptablesManager) installAclRules(network string, cfg rulesCfg) error {
+	for key, rules := range cfg.rulesMap {
+		client := i.client(key == ipv4)
+		for _, rule := range rules {
+			if err := client.Append(rule.table, rule.chain, rule.rule...); err != nil {
+				return fmt.Errorf("iptables: failed to add acl rule %v of network %s: %w", rule.rule, network, err)
+			}
+		}
+	}
+	return nil
+}
+
+// iptablesManager.removeAclRules - removes the acl rules of a network from the kernel, the caller holds the lock
+func (i *iptablesManager) removeAclRules(network string) {
+	for key, rules := range i.aclRules[network].rulesMap {
+		client := i.client(key == ipv4)
+		for _, rule := range rules {
+			if err := client.DeleteIfExists(rule.table, rule.chain, rule.rule...); err != nil {
+				logger.Log(1, fmt.Sprintf("failed to delete acl rule %v of network %s: %v", rule.rule, network, err.Error()))
+			}
+		}
+	}
+}
+
+// iptablesManager.client - returns the client of the family
+func (i *iptablesManager) client(isIpv4 bool) *iptables.IPTables {
+	if isIpv4 {
+		return i.ipv4Client
+	}
+	return i.ipv6Client
+}
+
+func iptablesFamily(isIpv4 bool) string {
+	if isIpv4 {
+		return ipv4
+	}
+	return ipv6
+}
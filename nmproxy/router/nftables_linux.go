@@ -26,6 +26,8 @@ const (
 	ipv6Len        = 16
 	ipv6SrcOffset  = 8
 	ipv6DestOffset = 24
+	// nftFamily - family of the netmaker tables, which hold ipv4 and ipv6 rules
+	nftFamily = "inet"
 )
 
 var (
@@ -37,12 +39,14 @@ type nftablesManager struct {
 	conn         *nftables.Conn
 	ingRules     serverrulestable
 	engressRules serverrulestable
+	aclRules     ruletable
 	mux          sync.Mutex
 }
 
 func init() {
 	nfJumpRules = append(nfJumpRules, nfFilterJumpRules...)
 	nfJumpRules = append(nfJumpRules, nfNatJumpRules...)
+	nfJumpRules = append(nfJumpRules, nfAclJumpRules...)
 }
 
 var (
@@ -150,6 +154,53 @@ var (
 			chain: netmakerNatChain,
 		},
 	}
+	// acl jump rules, inserted at the top of their chains: traffic of the netmaker interface to the host
+	// passes the acl chain before other input rules, replies to connections of the host return to them unchecked
+	nfAclJumpRules = []ruleInfo{
+		{
+			nfRule: &nftables.Rule{
+				Table: filterTable,
+				Chain: &nftables.Chain{Name: iptableINPUTChain},
+				Exprs: []expr.Any{
+					&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+					&expr.Cmp{
+						Op:       expr.CmpOpEq,
+						Register: 1,
+						Data:     []byte(ncutils.GetInterfaceName() + "\x00"),
+					},
+					&expr.Counter{},
+					&expr.Verdict{Kind: expr.VerdictJump, Chain: netmakerAclChain},
+				},
+				UserData: []byte(genRuleKey("-i", ncutils.GetInterfaceName(), "-j", netmakerAclChain)),
+			},
+			rule:  []string{"-i", ncutils.GetInterfaceName(), "-j", netmakerAclChain},
+			table: defaultIpTable,
+			chain: iptableINPUTChain,
+		},
+		{
+			nfRule: &nftables.Rule{
+				Table: filterTable,
+				Chain: &nftables.Chain{Name: netmakerAclChain},
+				Exprs: []expr.Any{
+					&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+					&expr.Bitwise{
+						SourceRegister: 1,
+						DestRegister:   1,
+						Len:            4,
+						Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+						Xor:            zeroXor,
+					},
+					&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: zeroXor},
+					&expr.Counter{},
+					&expr.Verdict{Kind: expr.VerdictReturn},
+				},
+				UserData: []byte(genRuleKey("-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN")),
+			},
+			rule:  []string{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"},
+			table: defaultIpTable,
+			chain: netmakerAclChain,
+		},
+	}
 )
 
 // nftables.CreateChains - creates default chains and rules
@@ -168,7 +219,20 @@ func (n *nftablesManager) CreateChains() error {
 
 	n.deleteChain(defaultIpTable, netmakerFilterChain)
 	n.deleteChain(defaultNatTable, netmakerNatChain)
+	n.deleteChain(defaultIpTable, netmakerAclChain)
+
+	n.addChains()
+	if err := n.conn.Flush(); err != nil {
+		return err
+	}
+	// add jump rules
+	n.addJumpRules()
+	return nil
+}
 
+// nftables.addChains - adds the base chains of the netmaker tables and the netmaker chains, chains that
+// exist are kept as they are; the caller flushes
+func (n *nftablesManager) addChains() {
 	defaultForwardPolicy := new(nftables.ChainPolicy)
 	*defaultForwardPolicy = nftables.ChainPolicyAccept
 
@@ -240,12 +304,10 @@ func (n *nftablesManager) CreateChains() error {
 	}
 	n.conn.AddChain(natChain)
 
-	if err := n.conn.Flush(); err != nil {
-		return err
-	}
-	// add jump rules
-	n.addJumpRules()
-	return nil
+	n.conn.AddChain(&nftables.Chain{
+		Name:  netmakerAclChain,
+		Table: filterTable,
+	})
 }
 
 // nftables.ForwardRule - forward netmaker traffic (not implemented)
@@ -1886,6 +1948,194 @@ func (n *nftablesManager) FlushAll() {
 	}
 }
 
+// nftables.Inspect - returns the netmaker chains, the rules installed by the manager and the drift between
+// them and the kernel, rules are matched by the key stored in their user data
+func (n *nftablesManager) Inspect() (Ruleset, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	ruleset := newRuleset(backendName(n))
+	owned := collectRules(n.ingRules, n.engressRules, func(bool) string { return nftFamily })
+	owned = append(owned, collectAclRules(n.aclRules, func(bool) string { return nftFamily })...)
+	for _, rule := range nfJumpRules {
+		r := rule.nfRule.(*nftables.Rule)
+		owned = append(owned, ownedRule{
+			OwnedRule: OwnedRule{
+				RuleTable: jumpTable,
+				Family:    nftFamily,
+				Table:     r.Table.Name,
+				Chain:     r.Chain.Name,
+				Rule:      strings.Join(rule.rule, " "),
+			},
+			info: rule,
+		})
+	}
+	expected := make(map[string]bool)
+	for _, rule := range owned {
+		expected[chainID(nftFamily, rule.Table, rule.Chain)+" "+genRuleKey(rule.info.rule...)] = true
+	}
+	present := make(map[string]bool)
+	for _, chain := range inspectedChains {
+		rules, err := n.conn.GetRules(
+			&nftables.Table{Name: chain.table, Family: nftables.TableFamilyINet},
+			&nftables.Chain{Name: chain.chain})
+		if err != nil {
+			if chain.netmaker {
+				ruleset.Drift = append(ruleset.Drift, RuleDrift{Kind: DriftMissing, Family: nftFamily, Table: chain.table, Chain: chain.chain})
+			}
+			continue
+		}
+		dump := ChainDump{Family: nftFamily, Table: chain.table, Chain: chain.chain, Rules: []string{}}
+		for _, rule := range rules {
+			key := string(rule.UserData)
+			if key == "" && !chain.netmaker {
+				// not added by netmaker
+				continue
+			}
+			text := strings.ReplaceAll(key, ":", " ")
+			if key == "" {
+				text = fmt.Sprintf("handle %d", rule.Handle)
+			}
+			dump.Rules = append(dump.Rules, text)
+			id := chainID(nftFamily, chain.table, chain.chain) + " " + key
+			present[id] = true
+			if !expected[id] {
+				ruleset.Drift = append(ruleset.Drift, RuleDrift{Kind: DriftUnexpected, Family: nftFamily, Table: chain.table, Chain: chain.chain, Rule: text})
+			}
+		}
+		ruleset.Chains = append(ruleset.Chains, dump)
+	}
+	for idx := range owned {
+		rule := &owned[idx]
+		rule.Installed = present[chainID(nftFamily, rule.Table, rule.Chain)+" "+genRuleKey(rule.info.rule...)]
+		if !rule.Installed {
+			ruleset.Drift = append(ruleset.Drift, missingDrift(*rule))
+		}
+	}
+	ruleset.finish(owned)
+	return ruleset, nil
+}
+
+// nftables.Repair - recreates the netmaker tables and chains and reinstalls the jump rules and the rules of
+// the ownership map missing in the kernel
+func (n *nftablesManager) Repair() (repairs, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	var fixed repairs
+	present := make(map[string]bool)
+	for _, chain := range inspectedChains {
+		rules, err := n.conn.GetRules(
+			&nftables.Table{Name: chain.table, Family: nftables.TableFamilyINet},
+			&nftables.Chain{Name: chain.chain})
+		if err != nil {
+			fixed.chains++
+			continue
+		}
+		for _, rule := range rules {
+			if len(rule.UserData) > 0 {
+				present[chainID(nftFamily, chain.table, chain.chain)+" "+string(rule.UserData)] = true
+			}
+		}
+	}
+	if fixed.chains > 0 {
+		n.conn.AddTable(filterTable)
+		n.conn.AddTable(natTable)
+		n.addChains()
+		if err := n.conn.Flush(); err != nil {
+			return repairs{}, err
+		}
+	}
+	for _, rule := range nfJumpRules {
+		r := rule.nfRule.(*nftables.Rule)
+		if present[chainID(nftFamily, r.Table.Name, r.Chain.Name)+" "+string(r.UserData)] {
+			continue
+		}
+		if r.Chain.Name == iptableINPUTChain || r.Chain.Name == netmakerAclChain {
+			n.conn.InsertRule(r)
+		} else {
+			n.conn.AddRule(r)
+		}
+		fixed.jumpRules++
+	}
+	for _, rule := range collectRules(n.ingRules, n.engressRules, func(bool) string { return nftFamily }) {
+		r, ok := rule.info.nfRule.(*nftables.Rule)
+		if !ok || present[chainID(nftFamily, rule.Table, rule.Chain)+" "+string(r.UserData)] {
+			continue
+		}
+		n.conn.InsertRule(r)
+		fixed.peerRules++
+	}
+	if fixed.jumpRules+fixed.peerRules > 0 {
+		if err := n.conn.Flush(); err != nil {
+			return repairs{chains: fixed.chains}, err
+		}
+	}
+	// the rules of a network are matched in order, they are installed again as a whole
+	for network, cfg := range n.aclRules {
+		missing := 0
+		for _, rule := range cfg.rulesMap[nftFamily] {
+			if !present[chainID(nftFamily, rule.table, rule.chain)+" "+genRuleKey(rule.rule...)] {
+				missing++
+			}
+		}
+		if missing == 0 {
+			continue
+		}
+		n.removeAclRules(network)
+		if err := n.installAclRules(network, cfg); err != nil {
+			return fixed, err
+		}
+		fixed.peerRules += missing
+	}
+	return fixed, nil
+}
+
+// nftables.SetAclRules - replaces the acl rules of a network, rules are appended to the acl chain in their order
+func (n *nftablesManager) SetAclRules(network string, rules []AclRule) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.removeAclRules(network)
+	cfg := rulesCfg{rulesMap: make(map[string][]ruleInfo)}
+	for _, match := range expandAclRules(rules) {
+		cfg.rulesMap[nftFamily] = append(cfg.rulesMap[nftFamily], ruleInfo{
+			nfRule: match.nfRule(),
+			rule:   match.spec(),
+			table:  defaultIpTable,
+			chain:  netmakerAclChain,
+		})
+	}
+	n.aclRules[network] = cfg
+	return n.installAclRules(network, cfg)
+}
+
+// nftables.DeleteAclRules - removes the acl rules of a network
+func (n *nftablesManager) DeleteAclRules(network string) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.removeAclRules(network)
+	delete(n.aclRules, network)
+	return nil
+}
+
+// nftables.installAclRules - appends the acl rules of a network, the caller holds the lock
+func (n *nftablesManager) installAclRules(network string, cfg rulesCfg) error {
+	for _, rule := range cfg.rulesMap[nftFamily] {
+		n.conn.AddRule(rule.nfRule.(*nftables.Rule))
+	}
+	if err := n.conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: failed to add acl rules of network %s: %w", network, err)
+	}
+	return nil
+}
+
+// nftables.removeAclRules - removes the acl rules of a network from the kernel, the caller holds the lock
+func (n *nftablesManager) removeAclRules(network string) {
+	for _, rule := range n.aclRules[network].rulesMap[nftFamily] {
+		if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+			logger.Log(1, fmt.Sprintf("failed to delete acl rule %v of network %s: %v", rule.rule, network, err.Error()))
+		}
+	}
+}
+
 // private functions
 
 //lint:ignore U1000 might be useful in future
@@ -1960,6 +2210,9 @@ func (n *nftablesManager) addJumpRules() {
 	for _, rule := range nfNatJumpRules {
 		n.conn.AddRule(rule.nfRule.(*nftables.Rule))
 	}
+	for _, rule := range nfAclJumpRules {
+		n.conn.InsertRule(rule.nfRule.(*nftables.Rule))
+	}
 	if err := n.conn.Flush(); err != nil {
 		logger.Log(0, fmt.Sprintf("failed to add jump rules, Err: %s", err.Error()))
 	}
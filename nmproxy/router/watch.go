@@ -0,0 +1,105 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netmaker/logger"
+)
+
+const (
+	// driftCheckInterval - interval of the drift checks, also when no ruleset change was notified
+	driftCheckInterval = time.Minute
+	// driftSettleTime - wait after a notified ruleset change before checking, changes come in bursts
+	driftSettleTime = time.Second * 2
+)
+
+// repairs - pieces of the firewall reinstalled by a drift check
+type repairs struct {
+	chains    int
+	jumpRules int
+	peerRules int
+}
+
+// RepairCounters - drift checks of the firewall watcher and the pieces it reinstalled
+type RepairCounters struct {
+	Checks     uint64    `json:"checks"`
+	Chains     uint64    `json:"chains"`
+	JumpRules  uint64    `json:"jump_rules"`
+	PeerRules  uint64    `json:"peer_rules"`
+	LastCheck  time.Time `json:"last_check"`
+	LastRepair time.Time `json:"last_repair"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+var (
+	repairMutex    sync.Mutex
+	repairCounters RepairCounters
+)
+
+// GetRepairCounters - returns the drift checks and repairs of the firewall watcher
+func GetRepairCounters() RepairCounters {
+	repairMutex.Lock()
+	defer repairMutex.Unlock()
+	return repairCounters
+}
+
+// watchDrift - checks the netmaker chains and rules of the controller until the context is done, after every
+// ruleset change notified by netlink and at the check interval; missing pieces are reinstalled
+func watchDrift(ctx context.Context, controller firewallController) {
+	ticker := time.NewTicker(driftCheckInterval)
+	defer ticker.Stop()
+	settle := time.NewTimer(driftSettleTime)
+	settle.Stop()
+	defer settle.Stop()
+	notifications := rulesetNotifications(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-notifications:
+			if !ok {
+				logger.Log(1, "ruleset notifications stopped, checking firewall drift at interval")
+				notifications = nil
+				continue
+			}
+			settle.Reset(driftSettleTime)
+		case <-settle.C:
+			checkDrift(controller)
+		case <-ticker.C:
+			checkDrift(controller)
+		}
+	}
+}
+
+// checkDrift - repairs the rules of the controller and counts the repairs
+func checkDrift(controller firewallController) {
+	fixed, err := controller.Repair()
+	now := time.Now()
+	repairMutex.Lock()
+	repairCounters.Checks++
+	repairCounters.LastCheck = now
+	repairCounters.Chains += uint64(fixed.chains)
+	repairCounters.JumpRules += uint64(fixed.jumpRules)
+	repairCounters.PeerRules += uint64(fixed.peerRules)
+	repairCounters.LastError = ""
+	if err != nil {
+		repairCounters.LastError = err.Error()
+	}
+	repaired := fixed.chains+fixed.jumpRules+fixed.peerRules > 0
+	if repaired {
+		repairCounters.LastRepair = now
+	}
+	repairMutex.Unlock()
+	if err != nil {
+		logger.Log(0, "failed to repair firewall drift: ", err.Error())
+	}
+	if repaired {
+		logger.Log(0, fmt.Sprintf("repaired firewall drift: %d chains, %d jump rules, %d peer rules",
+			fixed.chains, fixed.jumpRules, fixed.peerRules))
+		events.Publish(events.FirewallRepaired{Chains: fixed.chains, JumpRules: fixed.jumpRules, PeerRules: fixed.peerRules})
+	}
+}
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"context"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// rulesetNotifications - returns a channel receiving a value after changes of the nftables ruleset,
+// closed once the notifications stop; iptables-nft changes are notified too, iptables-legacy changes are not
+func rulesetNotifications(ctx context.Context) <-chan struct{} {
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, &netlink.Config{Groups: 1 << (unix.NFNLGRP_NFTABLES - 1)})
+	if err != nil {
+		logger.Log(1, "nftables notifications not available, checking firewall drift at interval: ", err.Error())
+		return nil
+	}
+	notifications := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(notifications)
+		for {
+			if _, err := conn.Receive(); err != nil {
+				if ctx.Err() == nil {
+					logger.Log(1, "failed to receive nftables notification: ", err.Error())
+				}
+				return
+			}
+			select {
+			case notifications <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return notifications
+}
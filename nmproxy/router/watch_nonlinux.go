@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package router
+
+import "context"
+
+// rulesetNotifications - ruleset changes are not notified on this platform, drift is checked at interval
+func rulesetNotifications(ctx context.Context) <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,48 @@
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// driftController - a controller whose Repair returns fixed results
+type driftController struct {
+	firewallController
+	fixed repairs
+	err   error
+}
+
+func (d driftController) Repair() (repairs, error) {
+	return d.fixed, d.err
+}
+
+func TestCheckDrift(t *testing.T) {
+	is := is.New(t)
+	repairCounters = RepairCounters{}
+	t.Run("nothing to repair", func(t *testing.T) {
+		checkDrift(driftController{})
+		counters := GetRepairCounters()
+		is.Equal(counters.Checks, uint64(1))
+		is.True(counters.LastRepair.IsZero())
+	})
+	t.Run("repairs are counted", func(t *testing.T) {
+		checkDrift(driftController{fixed: repairs{chains: 1, jumpRules: 2, peerRules: 3}})
+		checkDrift(driftController{fixed: repairs{peerRules: 1}})
+		counters := GetRepairCounters()
+		is.Equal(counters.Checks, uint64(3))
+		is.Equal(counters.Chains, uint64(1))
+		is.Equal(counters.JumpRules, uint64(2))
+		is.Equal(counters.PeerRules, uint64(4))
+		is.True(!counters.LastRepair.IsZero())
+	})
+	t.Run("failed check keeps partial repairs", func(t *testing.T) {
+		checkDrift(driftController{fixed: repairs{chains: 2}, err: errors.New("chain busy")})
+		counters := GetRepairCounters()
+		is.Equal(counters.Chains, uint64(3))
+		is.Equal(counters.LastError, "chain busy")
+		checkDrift(driftController{})
+		is.Equal(GetRepairCounters().LastError, "")
+	})
+}
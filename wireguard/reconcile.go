@@ -0,0 +1,276 @@
+package wireguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/events"
+	"github.com/gravitl/netclient/ncutils"
+	proxy_config "github.com/gravitl/netclient/nmproxy/config"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// ReconcileInterval - time between two runs of the reconciler
+	ReconcileInterval = time.Minute
+	// roamingThreshold - a peer with a handshake within this window keeps the endpoint it roamed to
+	roamingThreshold = time.Minute * 3
+)
+
+// kinds of drift corrected by the reconciler
+const (
+	DriftMissingPeer     = "missing_peer"
+	DriftUnknownPeer     = "unknown_peer"
+	DriftAllowedIPs      = "allowed_ips"
+	DriftEndpoint        = "endpoint"
+	DriftKeepalive       = "keepalive"
+	DriftListenPort      = "listen_port"
+	DriftPrivateKey      = "private_key"
+	DriftMTU             = "mtu"
+	DriftMissingAddress  = "missing_address"
+	DriftUnknownAddress  = "unknown_address"
+	driftUnknownEndpoint = "none"
+)
+
+// Drift - difference between the desired config of the netmaker interface and the device
+type Drift struct {
+	Kind      string
+	PublicKey string
+	Desired   string
+	Actual    string
+}
+
+// StartReconciler - periodically converges the netmaker interface to the desired config
+func StartReconciler(ctx context.Context, waitg *sync.WaitGroup) {
+	defer waitg.Done()
+	ticker := time.NewTicker(ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := Reconcile(); err != nil {
+				slog.Warn("failed to reconcile wireguard interface", "error", err)
+			}
+		}
+	}
+}
+
+// Reconcile - diffs the netmaker interface against the desired config, applies the minimal
+// corrections and returns the drifts it fixed
+func Reconcile() ([]Drift, error) {
+	wgMutex.Lock()
+	defer wgMutex.Unlock()
+	if netmaker.Config.PrivateKey == nil {
+		// interface has not been configured yet
+		return nil, nil
+	}
+	wg, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	defer wg.Close()
+	device, err := wg.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			slog.Debug("netmaker interface does not exist, skipping reconcile")
+			return nil, nil
+		}
+		return nil, err
+	}
+	endpoints, external := desiredEndpoints(netmaker.Config.Peers)
+	drifts, correction := diffDevice(netmaker.Config, endpoints, external, device)
+	if correction.PrivateKey != nil || correction.ListenPort != nil || len(correction.Peers) > 0 {
+		if err := wg.ConfigureDevice(ncutils.GetInterfaceName(), correction); err != nil {
+			return nil, err
+		}
+	}
+	addrDrifts, err := netmaker.reconcileAddrs()
+	if err != nil {
+		slog.Warn("failed to reconcile interface addresses", "error", err)
+	}
+	drifts = append(drifts, addrDrifts...)
+	for _, drift := range drifts {
+		slog.Warn("corrected wireguard drift", "kind", drift.Kind, "peer", drift.PublicKey,
+			"desired", drift.Desired, "actual", drift.Actual)
+		events.Publish(events.DeviceDrift{
+			Kind:      drift.Kind,
+			PublicKey: drift.PublicKey,
+			Desired:   drift.Desired,
+			Actual:    drift.Actual,
+		})
+	}
+	return drifts, nil
+}
+
+// desiredEndpoints - returns the endpoints the peers should have on the device and the peers
+// whose endpoints the proxy or turn set on the device outside the desired config,
+// peers handled by the proxy talk to its local connection instead of the peer
+func desiredEndpoints(peers []wgtypes.PeerConfig) (map[wgtypes.Key]string, map[wgtypes.Key]struct{}) {
+	endpoints := make(map[wgtypes.Key]string, len(peers))
+	external := make(map[wgtypes.Key]struct{})
+	cfg := proxy_config.GetCfg()
+	servers := config.GetServers()
+	for _, peer := range peers {
+		if cfg != nil {
+			if proxyPeer, ok := cfg.GetPeer(peer.PublicKey.String()); ok {
+				proxyPeer.Mutex.RLock()
+				if proxyPeer.Config.LocalConnAddr != nil {
+					endpoints[peer.PublicKey] = proxyPeer.Config.LocalConnAddr.String()
+				}
+				proxyPeer.Mutex.RUnlock()
+				external[peer.PublicKey] = struct{}{}
+				continue
+			}
+			if usingTurn(cfg, servers, peer.PublicKey.String()) {
+				external[peer.PublicKey] = struct{}{}
+			}
+		}
+		if peer.Endpoint != nil {
+			endpoints[peer.PublicKey] = peer.Endpoint.String()
+		}
+	}
+	return endpoints, external
+}
+
+// usingTurn - returns true if the peer is relayed through the turn server of one of the servers
+func usingTurn(cfg *proxy_config.Config, servers []string, peerKey string) bool {
+	for _, server := range servers {
+		if _, ok := cfg.GetPeerTurnCfg(server, peerKey); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// diffDevice - compares the device with the desired config, returns the drifts found
+// and the config correcting them, the endpoints of external peers are left as they are
+func diffDevice(desired wgtypes.Config, endpoints map[wgtypes.Key]string, external map[wgtypes.Key]struct{}, device *wgtypes.Device) ([]Drift, wgtypes.Config) {
+	drifts := []Drift{}
+	correction := wgtypes.Config{}
+	if desired.PrivateKey != nil && *desired.PrivateKey != device.PrivateKey {
+		// report the public keys, the private key never leaves the host
+		drifts = append(drifts, Drift{
+			Kind:    DriftPrivateKey,
+			Desired: desired.PrivateKey.PublicKey().String(),
+			Actual:  device.PublicKey.String(),
+		})
+		key := *desired.PrivateKey
+		correction.PrivateKey = &key
+	}
+	if desired.ListenPort != nil && *desired.ListenPort != 0 && *desired.ListenPort != device.ListenPort {
+		drifts = append(drifts, Drift{
+			Kind:    DriftListenPort,
+			Desired: strconv.Itoa(*desired.ListenPort),
+			Actual:  strconv.Itoa(device.ListenPort),
+		})
+		port := *desired.ListenPort
+		correction.ListenPort = &port
+	}
+	wanted := make(map[wgtypes.Key]wgtypes.PeerConfig, len(desired.Peers))
+	for _, peer := range desired.Peers {
+		if !peer.Remove {
+			wanted[peer.PublicKey] = peer
+		}
+	}
+	seen := make(map[wgtypes.Key]struct{}, len(device.Peers))
+	for _, actual := range device.Peers {
+		key := actual.PublicKey
+		seen[key] = struct{}{}
+		peer, ok := wanted[key]
+		if !ok {
+			drifts = append(drifts, Drift{Kind: DriftUnknownPeer, PublicKey: key.String()})
+			correction.Peers = append(correction.Peers, wgtypes.PeerConfig{PublicKey: key, Remove: true})
+			continue
+		}
+		fix := wgtypes.PeerConfig{PublicKey: key, UpdateOnly: true}
+		changed := false
+		if desiredIPs, actualIPs := allowedIPsString(peer.AllowedIPs), allowedIPsString(actual.AllowedIPs); desiredIPs != actualIPs {
+			drifts = append(drifts, Drift{Kind: DriftAllowedIPs, PublicKey: key.String(), Desired: desiredIPs, Actual: actualIPs})
+			fix.AllowedIPs = peer.AllowedIPs
+			fix.ReplaceAllowedIPs = true
+			changed = true
+		}
+		// wireguard follows a peer roaming to a new address, only correct endpoints of peers that went quiet
+		_, isExternal := external[key]
+		if endpoint, ok := endpoints[key]; ok && !isExternal && endpoint != endpointString(actual) &&
+			time.Since(actual.LastHandshakeTime) > roamingThreshold {
+			if fix.Endpoint = endpointAddr(peer, endpoint); fix.Endpoint != nil {
+				drifts = append(drifts, Drift{Kind: DriftEndpoint, PublicKey: key.String(), Desired: endpoint, Actual: endpointString(actual)})
+				changed = true
+			}
+		}
+		if peer.PersistentKeepaliveInterval != nil && *peer.PersistentKeepaliveInterval != actual.PersistentKeepaliveInterval {
+			drifts = append(drifts, Drift{
+				Kind:      DriftKeepalive,
+				PublicKey: key.String(),
+				Desired:   peer.PersistentKeepaliveInterval.String(),
+				Actual:    actual.PersistentKeepaliveInterval.String(),
+			})
+			keepalive := *peer.PersistentKeepaliveInterval
+			fix.PersistentKeepaliveInterval = &keepalive
+			changed = true
+		}
+		if changed {
+			correction.Peers = append(correction.Peers, fix)
+		}
+	}
+	for _, peer := range desired.Peers {
+		if peer.Remove {
+			continue
+		}
+		if _, ok := seen[peer.PublicKey]; ok {
+			continue
+		}
+		drifts = append(drifts, Drift{Kind: DriftMissingPeer, PublicKey: peer.PublicKey.String()})
+		fix := peer
+		fix.UpdateOnly = false
+		fix.ReplaceAllowedIPs = true
+		if endpoint, ok := endpoints[peer.PublicKey]; ok {
+			fix.Endpoint = endpointAddr(peer, endpoint)
+		}
+		correction.Peers = append(correction.Peers, fix)
+	}
+	return drifts, correction
+}
+
+// endpointAddr - returns the address of the desired endpoint of the peer
+func endpointAddr(peer wgtypes.PeerConfig, endpoint string) *net.UDPAddr {
+	if peer.Endpoint != nil && peer.Endpoint.String() == endpoint {
+		return peer.Endpoint
+	}
+	addr, err := net.ResolveUDPAddr("udp", endpoint)
+	if err != nil {
+		slog.Debug("failed to parse desired endpoint", "peer", peer.PublicKey.String(), "endpoint", endpoint, "error", err)
+		return nil
+	}
+	return addr
+}
+
+func endpointString(peer wgtypes.Peer) string {
+	if peer.Endpoint == nil {
+		return driftUnknownEndpoint
+	}
+	return peer.Endpoint.String()
+}
+
+// allowedIPsString - returns the allowed ips sorted and joined for comparison
+func allowedIPsString(ips []net.IPNet) string {
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, ip.String())
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
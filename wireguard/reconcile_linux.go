@@ -0,0 +1,57 @@
+package wireguard
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// NCIface.reconcileAddrs - converges the addresses of the interface to the node addresses
+func (nc *NCIface) reconcileAddrs() ([]Drift, error) {
+	l, err := netlink.LinkByName(nc.Name)
+	if err != nil {
+		return nil, err
+	}
+	current, err := netlink.AddrList(l, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]net.IPNet)
+	for _, addr := range nc.Addresses {
+		if addr.AddRoute || addr.IP == nil {
+			continue
+		}
+		ipnet := net.IPNet{IP: addr.IP, Mask: addr.Network.Mask}
+		wanted[addrKey(ipnet)] = ipnet
+	}
+	drifts := []Drift{}
+	for i := range current {
+		if current[i].IPNet == nil || current[i].IP.IsLinkLocalUnicast() {
+			continue
+		}
+		key := addrKey(*current[i].IPNet)
+		if _, ok := wanted[key]; ok {
+			delete(wanted, key)
+			continue
+		}
+		if err := netlink.AddrDel(l, &current[i]); err != nil {
+			return drifts, err
+		}
+		drifts = append(drifts, Drift{Kind: DriftUnknownAddress, Actual: key})
+	}
+	for key, ipnet := range wanted {
+		ipnet := ipnet
+		if err := netlink.AddrAdd(l, &netlink.Addr{IPNet: &ipnet}); err != nil {
+			return drifts, err
+		}
+		drifts = append(drifts, Drift{Kind: DriftMissingAddress, Desired: key})
+	}
+	return drifts, nil
+}
+
+// addrKey - returns the address in cidr notation independent of the ip's byte length
+func addrKey(ipnet net.IPNet) string {
+	ones, _ := ipnet.Mask.Size()
+	return fmt.Sprintf("%s/%d", ipnet.IP.String(), ones)
+}
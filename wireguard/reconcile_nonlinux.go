@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package wireguard
+
+// NCIface.reconcileAddrs - addresses are not reconciled on this platform
+func (nc *NCIface) reconcileAddrs() ([]Drift, error) {
+	return nil, nil
+}
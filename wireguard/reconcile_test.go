@@ -0,0 +1,248 @@
+package wireguard
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	proxy_config "github.com/gravitl/netclient/nmproxy/config"
+	"github.com/gravitl/netclient/nmproxy/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// testKeys - returns a private key per name
+func testKeys(t *testing.T, names ...string) map[string]wgtypes.Key {
+	keys := make(map[string]wgtypes.Key, len(names))
+	for _, name := range names {
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+	return keys
+}
+
+func mustCIDR(t *testing.T, cidr string) net.IPNet {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *ipnet
+}
+
+func mustUDPAddr(t *testing.T, addr string) *net.UDPAddr {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return udpAddr
+}
+
+// describeCorrection - returns the changes of the correction per peer name
+func describeCorrection(keys map[string]wgtypes.Key, correction wgtypes.Config) []string {
+	names := make(map[wgtypes.Key]string, len(keys))
+	for name, key := range keys {
+		names[key.PublicKey()] = name
+	}
+	changes := []string{}
+	if correction.PrivateKey != nil {
+		changes = append(changes, "private_key="+names[correction.PrivateKey.PublicKey()])
+	}
+	if correction.ListenPort != nil {
+		changes = append(changes, "listen_port")
+	}
+	for _, peer := range correction.Peers {
+		change := []string{names[peer.PublicKey]}
+		switch {
+		case peer.Remove:
+			change = append(change, "remove")
+		case peer.UpdateOnly:
+			change = append(change, "update")
+		default:
+			change = append(change, "add")
+		}
+		if peer.ReplaceAllowedIPs {
+			change = append(change, "allowed_ips="+allowedIPsString(peer.AllowedIPs))
+		}
+		if peer.Endpoint != nil {
+			change = append(change, "endpoint="+peer.Endpoint.String())
+		}
+		if peer.PersistentKeepaliveInterval != nil {
+			change = append(change, "keepalive="+peer.PersistentKeepaliveInterval.String())
+		}
+		changes = append(changes, strings.Join(change, " "))
+	}
+	return changes
+}
+
+func TestDiffDevice(t *testing.T) {
+	keys := testKeys(t, "host", "other", "a", "b")
+	host, other := keys["host"], keys["other"]
+	a, b := keys["a"].PublicKey(), keys["b"].PublicKey()
+	port := 51821
+	keepalive := time.Second * 20
+	// desiredPeer - returns the desired config of the peer
+	desiredPeer := func(key wgtypes.Key, endpoint string) wgtypes.PeerConfig {
+		return wgtypes.PeerConfig{
+			PublicKey:                   key,
+			Endpoint:                    mustUDPAddr(t, endpoint),
+			AllowedIPs:                  []net.IPNet{mustCIDR(t, "10.0.0.2/32")},
+			PersistentKeepaliveInterval: &keepalive,
+		}
+	}
+	// devicePeer - returns the peer on the device matching the desired config
+	devicePeer := func(key wgtypes.Key, endpoint string) wgtypes.Peer {
+		return wgtypes.Peer{
+			PublicKey:                   key,
+			Endpoint:                    mustUDPAddr(t, endpoint),
+			AllowedIPs:                  []net.IPNet{mustCIDR(t, "10.0.0.2/32")},
+			PersistentKeepaliveInterval: keepalive,
+		}
+	}
+	tests := []struct {
+		name     string
+		desired  []wgtypes.PeerConfig
+		device   []wgtypes.Peer
+		private  wgtypes.Key
+		port     int
+		external bool // the endpoint of peer a is set by the proxy or turn
+		drifts   []string
+		changes  []string
+	}{
+		{
+			name:    "in sync",
+			desired: []wgtypes.PeerConfig{desiredPeer(a, "1.1.1.1:51821")},
+			device:  []wgtypes.Peer{devicePeer(a, "1.1.1.1:51821")},
+			drifts:  []string{},
+			changes: []string{},
+		},
+		{
+			name:    "private key and listen port",
+			private: other,
+			port:    51820,
+			drifts:  []string{DriftPrivateKey, DriftListenPort},
+			changes: []string{"private_key=host", "listen_port"},
+		},
+		{
+			name:    "unknown peer",
+			desired: []wgtypes.PeerConfig{{PublicKey: b, Remove: true}},
+			device:  []wgtypes.Peer{devicePeer(b, "2.2.2.2:51821")},
+			drifts:  []string{DriftUnknownPeer},
+			changes: []string{"b remove"},
+		},
+		{
+			name:    "missing peer",
+			desired: []wgtypes.PeerConfig{desiredPeer(a, "1.1.1.1:51821")},
+			drifts:  []string{DriftMissingPeer},
+			changes: []string{"a add allowed_ips=10.0.0.2/32 endpoint=1.1.1.1:51821 keepalive=20s"},
+		},
+		{
+			name:    "allowed ips and keepalive",
+			desired: []wgtypes.PeerConfig{desiredPeer(a, "1.1.1.1:51821")},
+			device: []wgtypes.Peer{{
+				PublicKey:  a,
+				Endpoint:   mustUDPAddr(t, "1.1.1.1:51821"),
+				AllowedIPs: []net.IPNet{mustCIDR(t, "10.0.0.3/32")},
+			}},
+			drifts:  []string{DriftAllowedIPs, DriftKeepalive},
+			changes: []string{"a update allowed_ips=10.0.0.2/32 keepalive=20s"},
+		},
+		{
+			name:    "endpoint of a quiet peer",
+			desired: []wgtypes.PeerConfig{desiredPeer(a, "1.1.1.1:51821")},
+			device:  []wgtypes.Peer{devicePeer(a, "3.3.3.3:51821")},
+			drifts:  []string{DriftEndpoint},
+			changes: []string{"a update endpoint=1.1.1.1:51821"},
+		},
+		{
+			name:    "endpoint of a roaming peer",
+			desired: []wgtypes.PeerConfig{desiredPeer(a, "1.1.1.1:51821")},
+			device: func() []wgtypes.Peer {
+				peer := devicePeer(a, "3.3.3.3:51821")
+				peer.LastHandshakeTime = time.Now()
+				return []wgtypes.Peer{peer}
+			}(),
+			drifts:  []string{},
+			changes: []string{},
+		},
+		{
+			name:     "endpoint set by the proxy or turn",
+			desired:  []wgtypes.PeerConfig{desiredPeer(a, "1.1.1.1:51821")},
+			device:   []wgtypes.Peer{devicePeer(a, "127.0.0.1:40000")},
+			external: true,
+			drifts:   []string{},
+			changes:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			private := tt.private
+			if private == (wgtypes.Key{}) {
+				private = host
+			}
+			devicePort := tt.port
+			if devicePort == 0 {
+				devicePort = port
+			}
+			desired := wgtypes.Config{PrivateKey: &host, ListenPort: &port, Peers: tt.desired}
+			device := &wgtypes.Device{PrivateKey: private, PublicKey: private.PublicKey(), ListenPort: devicePort, Peers: tt.device}
+			endpoints := map[wgtypes.Key]string{}
+			for _, peer := range tt.desired {
+				if peer.Endpoint != nil {
+					endpoints[peer.PublicKey] = peer.Endpoint.String()
+				}
+			}
+			external := map[wgtypes.Key]struct{}{}
+			if tt.external {
+				external[a] = struct{}{}
+			}
+			drifts, correction := diffDevice(desired, endpoints, external, device)
+			kinds := []string{}
+			for _, drift := range drifts {
+				kinds = append(kinds, drift.Kind)
+			}
+			is.Equal(kinds, tt.drifts)
+			is.Equal(describeCorrection(keys, correction), tt.changes)
+		})
+	}
+}
+
+func TestDesiredEndpoints(t *testing.T) {
+	is := is.New(t)
+	proxy_config.InitializeCfg()
+	config.Servers = map[string]config.Server{"server": {Name: "server"}}
+	t.Cleanup(func() {
+		proxy_config.InitializeCfg()
+		proxy_config.GetCfg().ProxyStatus = false
+		config.Servers = map[string]config.Server{}
+	})
+	keys := testKeys(t, "direct", "proxied", "turn", "none")
+	direct, proxied, turn, none := keys["direct"].PublicKey(), keys["proxied"].PublicKey(), keys["turn"].PublicKey(), keys["none"].PublicKey()
+	proxy_config.GetCfg().SavePeer(&models.Conn{
+		Key:    proxied,
+		Config: models.Proxy{LocalConnAddr: mustUDPAddr(t, "127.0.0.1:40000")},
+		Mutex:  &sync.RWMutex{},
+	})
+	proxy_config.GetCfg().SetPeerTurnCfg("server", turn.String(), models.TurnPeerCfg{Server: "server"})
+	endpoints, external := desiredEndpoints([]wgtypes.PeerConfig{
+		{PublicKey: direct, Endpoint: mustUDPAddr(t, "1.1.1.1:51821")},
+		{PublicKey: proxied, Endpoint: mustUDPAddr(t, "2.2.2.2:51821")},
+		{PublicKey: turn, Endpoint: mustUDPAddr(t, "3.3.3.3:51821")},
+		{PublicKey: none},
+	})
+	// proxied peers are added with the local connection of the proxy
+	is.Equal(endpoints, map[wgtypes.Key]string{
+		direct:  "1.1.1.1:51821",
+		proxied: "127.0.0.1:40000",
+		turn:    "3.3.3.3:51821",
+	})
+	is.Equal(external, map[wgtypes.Key]struct{}{proxied: {}, turn: {}})
+	_, ok := endpoints[none]
+	is.True(!ok)
+}
@@ -0,0 +1,27 @@
+package wireguard
+
+import (
+	"strconv"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// Reload - rebuilds the desired config of the netmaker interface from the host config and nodes
+// and converges the device to it in place, the interface and the peers that did not change stay up
+func Reload(host *config.Config, nodes config.NodeMap) ([]Drift, error) {
+	wgMutex.Lock()
+	mtu := netmaker.MTU
+	nc := NewNCIface(host, nodes)
+	nc.GetPeerRoutes()
+	drifts := []Drift{}
+	if nc.MTU != 0 && nc.MTU != mtu {
+		if err := nc.SetMTU(); err != nil {
+			wgMutex.Unlock()
+			return nil, err
+		}
+		drifts = append(drifts, Drift{Kind: DriftMTU, Desired: strconv.Itoa(nc.MTU), Actual: strconv.Itoa(mtu)})
+	}
+	wgMutex.Unlock()
+	reconciled, err := Reconcile()
+	return append(drifts, reconciled...), err
+}
@@ -134,11 +134,48 @@ func GetInterface() *NCIface {
 
 // NCIface.UpdatePeer - Updates Peers from provided PeerConfig
 func (n *NCIface) UpdatePeer(p wgtypes.PeerConfig) {
-	peers := []wgtypes.PeerConfig{}
-	peers = append(peers, p)
-	n.Config.ReplacePeers = false
-	n.Config.Peers = peers
-	apply(&n.Config)
+	wgMutex.Lock()
+	defer wgMutex.Unlock()
+	n.trackPeer(p)
+	apply(&wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{p},
+	})
+}
+
+// NCIface.trackPeer - records a change applied to a single peer in the desired config
+// of the interface, which is what the reconciler converges the device to
+func (n *NCIface) trackPeer(p wgtypes.PeerConfig) {
+	// copy, the peers may share their backing array with the host peers
+	peers := append([]wgtypes.PeerConfig{}, n.Config.Peers...)
+	for i := range peers {
+		if peers[i].PublicKey != p.PublicKey {
+			continue
+		}
+		if p.Remove {
+			n.Config.Peers = append(peers[:i], peers[i+1:]...)
+			return
+		}
+		if p.Endpoint != nil {
+			peers[i].Endpoint = p.Endpoint
+		}
+		if p.ReplaceAllowedIPs {
+			peers[i].AllowedIPs = p.AllowedIPs
+		} else if len(p.AllowedIPs) > 0 {
+			peers[i].AllowedIPs = append(append([]net.IPNet{}, peers[i].AllowedIPs...), p.AllowedIPs...)
+		}
+		if p.PersistentKeepaliveInterval != nil {
+			peers[i].PersistentKeepaliveInterval = p.PersistentKeepaliveInterval
+		}
+		if p.PresharedKey != nil {
+			peers[i].PresharedKey = p.PresharedKey
+		}
+		n.Config.Peers = peers
+		return
+	}
+	if p.Remove || p.UpdateOnly {
+		return
+	}
+	n.Config.Peers = append(peers, p)
 }
 
 // == private ==
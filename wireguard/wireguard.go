@@ -15,7 +15,8 @@ import (
 
 // SetPeers - sets peers on netmaker WireGuard interface
 func SetPeers(replace bool) error {
-
+	wgMutex.Lock()
+	defer wgMutex.Unlock()
 	peers := config.Netclient().HostPeers
 	for i := range peers {
 		peer := peers[i]
@@ -38,7 +39,10 @@ func SetPeers(replace bool) error {
 // temporarily making public func to pass staticchecks
 // this function will be required in future when add/delete node on server is refactored
 func RemovePeer(n *config.Node, p *wgtypes.PeerConfig) error {
+	wgMutex.Lock()
+	defer wgMutex.Unlock()
 	p.Remove = true
+	netmaker.trackPeer(*p)
 	config := wgtypes.Config{
 		Peers: []wgtypes.PeerConfig{*p},
 	}
@@ -49,6 +53,9 @@ func RemovePeer(n *config.Node, p *wgtypes.PeerConfig) error {
 // temporarily making public func to pass staticchecks
 // this function will be required in future when update node on server is refactored
 func UpdatePeer(p *wgtypes.PeerConfig) error {
+	wgMutex.Lock()
+	defer wgMutex.Unlock()
+	netmaker.trackPeer(*p)
 	config := wgtypes.Config{
 		Peers:        []wgtypes.PeerConfig{*p},
 		ReplacePeers: false,